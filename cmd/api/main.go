@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"os"
+	"os/signal"
 	"sms/config"
 	"sms/internal/api/handlers/http"
 	"sms/internal/app"
+	"sms/pkg/tracing"
+	"syscall"
+	"time"
 )
 
 var configPath = flag.String("config", "config.yaml", "service configuration file")
@@ -19,7 +24,70 @@ func main() {
 	}
 	c := config.MustReadConfig(*configPath)
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config(c.Tracing))
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	appContainer := app.NewMustApp(c)
+	smsService := appContainer.SMSService(ctx)
+
+	relayDone := make(chan struct{})
+	go func() {
+		defer close(relayDone)
+		_ = smsService.RunOutboxRelay(ctx, c.Outbox.PollInterval, c.Outbox.BatchSize)
+	}()
+
+	serverDone := make(chan error, 1)
+	go func() {
+		serverDone <- http.Run(ctx, appContainer, c.Server)
+	}()
+
+	// Graceful shutdown handling
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	var serverErr error
+	select {
+	case sig := <-sigChan:
+		log.Printf("Received shutdown signal %s, draining requests", sig)
+		cancel()
+		serverErr = <-serverDone
+	case serverErr = <-serverDone:
+		cancel()
+	}
+	if serverErr != nil {
+		log.Printf("HTTP server error: %v", serverErr)
+	}
+
+	// the relay finishes its current batch; whatever the last requests
+	// stored in the outbox is published before the connection closes
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), c.Server.ShutdownTimeout)
+	defer cancelFlush()
+	select {
+	case <-relayDone:
+		if relayed, err := smsService.FlushOutbox(flushCtx, c.Outbox.BatchSize); err != nil {
+			log.Printf("Failed to flush outbox after relaying %d events: %v", relayed, err)
+		}
+	case <-flushCtx.Done():
+		log.Printf("Outbox relay did not stop in time")
+	}
+
+	if err := appContainer.Close(); err != nil {
+		log.Printf("Failed to close connections: %v", err)
+	}
+
+	tracingCtx, cancelTracing := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelTracing()
+	if err := shutdownTracing(tracingCtx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
 
-	log.Fatal(http.Run(appContainer, c.Server))
+	log.Printf("API shutdown complete")
+	if serverErr != nil {
+		os.Exit(1)
+	}
 }
@@ -2,14 +2,20 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"net/http"
 	"os"
 	"os/signal"
 	"sms/config"
 	"sms/internal/api/handlers/messaging"
 	"sms/internal/app"
+	"sms/pkg/health"
 	"sms/pkg/logger"
+	"sms/pkg/metrics"
+	"sms/pkg/tracing"
 	"syscall"
+	"time"
 )
 
 var configPath = flag.String("config", "config.yaml", "service configuration file")
@@ -24,11 +30,18 @@ func main() {
 	c := config.MustReadConfig(*configPath)
 	appLogger := logger.NewLogger(logger.LogLevel("info"))
 
-	appContainer := app.NewMustApp(c)
-
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config(c.Tracing))
+	if err != nil {
+		appLogger.ErrorWithoutContext("failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+
+	appContainer := app.NewMustApp(c)
+
 	ctx = logger.WithTraceID(ctx)
 
 	smsService := appContainer.SMSService(ctx)
@@ -38,8 +51,50 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	errChan := make(chan error, 1)
+	// one slot per goroutine, so none blocks once shutdown has begun
+	errChan := make(chan error, 6)
+	relayDone := make(chan struct{})
+	go func() {
+		defer close(relayDone)
+		if err := smsService.RunOutboxRelay(ctx, c.Outbox.PollInterval, c.Outbox.BatchSize); err != nil && err != context.Canceled {
+			errChan <- err
+		}
+	}()
+
+	campaignsDone := make(chan struct{})
 	go func() {
+		defer close(campaignsDone)
+		if err := smsService.RunCampaigns(ctx, c.Campaigns.PollInterval); err != nil && err != context.Canceled {
+			errChan <- err
+		}
+	}()
+
+	schedulerDone := make(chan struct{})
+	go func() {
+		defer close(schedulerDone)
+		if err := smsService.RunScheduler(ctx, c.Scheduler.PollInterval, c.Scheduler.BatchSize); err != nil && err != context.Canceled {
+			errChan <- err
+		}
+	}()
+
+	reconcilerDone := make(chan struct{})
+	go func() {
+		defer close(reconcilerDone)
+		if err := smsService.RunReconciler(ctx, c.Reconciler.PollInterval, c.Reconciler.SendingTimeout, c.Reconciler.BatchSize); err != nil && err != context.Canceled {
+			errChan <- err
+		}
+	}()
+
+	adminServer := newAdminServer(c.Admin.ListenAddr, appContainer.Health())
+	go func() {
+		if err := adminServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errChan <- err
+		}
+	}()
+
+	consumerDone := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
 		appLogger.Logger.Info("Starting SMS consumer worker")
 		if err := consumer.Run(ctx); err != nil && err != context.Canceled {
 			errChan <- err
@@ -55,5 +110,29 @@ func main() {
 		cancel()
 	}
 
+	// wait for in-flight messages to be handled
+	<-consumerDone
+	<-campaignsDone
+	<-schedulerDone
+	<-reconcilerDone
+	<-relayDone
+	_ = adminServer.Shutdown(context.Background())
+	if err := appContainer.Close(); err != nil {
+		appLogger.ErrorWithoutContext("failed to close connections", "error", err)
+	}
 	appLogger.Logger.Info("SMS consumer worker shutdown complete")
 }
+
+// newAdminServer serves metrics and health probes, as the consumer has no
+// HTTP API of its own.
+func newAdminServer(addr string, checker *health.Checker) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", health.LiveHandler())
+	mux.Handle("/readyz", checker.ReadyHandler())
+	return &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+}
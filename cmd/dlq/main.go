@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sms/config"
+	"sms/pkg/rabbit"
+	"time"
+)
+
+var (
+	configPath = flag.String("config", "config.yaml", "service configuration file")
+	queue      = flag.String("queue", "", "queue whose DLQ is inspected or re-driven, e.g. sms_billing.debit.completed")
+	limit      = flag.Int("limit", 10, "maximum number of messages to handle")
+	redrive    = flag.Bool("redrive", false, "move messages back to their original queue instead of listing them")
+)
+
+// dlq lists or re-drives the dead-lettered messages of a queue.
+func main() {
+	flag.Parse()
+
+	if v := os.Getenv("CONFIG_PATH"); len(v) > 0 {
+		*configPath = v
+	}
+	if *queue == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c := config.MustReadConfig(*configPath)
+	conn, err := rabbit.NewRabbitConn(c.RabbitMQ.URI, rabbit.Options{PublishTimeout: c.RabbitMQ.Reconnect.PublishTimeout})
+	if err != nil {
+		log.Fatalf("failed to connect to RabbitMQ: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if *redrive {
+		moved, err := conn.RedriveDLQ(ctx, *queue, *limit)
+		if err != nil {
+			log.Fatalf("re-drive stopped after %d messages: %v", moved, err)
+		}
+		fmt.Printf("moved %d messages from %s back to their queue\n", moved, rabbit.DLQName(*queue))
+		return
+	}
+
+	letters, err := conn.InspectDLQ(ctx, *queue, *limit)
+	if err != nil {
+		log.Fatalf("failed to inspect %s: %v", rabbit.DLQName(*queue), err)
+	}
+	for _, letter := range letters {
+		fmt.Printf("%s from=%s redeliveries=%d reason=%q\n  %s\n",
+			letter.FailedAt.Format(time.RFC3339), letter.OriginalQueue, letter.Redeliveries, letter.Reason, letter.Body)
+	}
+	fmt.Printf("%d messages shown\n", len(letters))
+}
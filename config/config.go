@@ -1,25 +1,130 @@
 package config
 
+import "time"
+
 type Config struct {
-	Server   Server   `yaml:"server"`
-	DB       DB       `yaml:"database"`
-	RabbitMQ RabbitMQ `yaml:"rabbitmq"`
+	Server    Server    `yaml:"server"`
+	DB        DB        `yaml:"database"`
+	RabbitMQ  RabbitMQ  `yaml:"rabbitmq"`
+	Outbox    Outbox    `yaml:"outbox"`
+	Pricing   Pricing   `yaml:"pricing"`
+	Providers Providers `yaml:"providers"`
+	Retry     Retry     `yaml:"retry"`
+	Tracing   Tracing   `yaml:"tracing"`
+	Admin     Admin     `yaml:"admin"`
+	Bulk      Bulk      `yaml:"bulk"`
+	Campaigns Campaigns `yaml:"campaigns"`
+	Scheduler Scheduler `yaml:"scheduler"`
+
+	// Reconciler configures how the consumer settles SMS left in sending.
+	Reconciler Reconciler `yaml:"reconciler"`
+}
+
+// Scheduler configures how the consumer releases scheduled SMS once due.
+type Scheduler struct {
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// BatchSize is how many due SMS are handed to billing per transaction.
+	BatchSize int `yaml:"batch_size"`
+}
+
+// Reconciler configures how the consumer settles SMS whose delivery outcome
+// was never recorded.
+type Reconciler struct {
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// SendingTimeout is how long an SMS may stay in sending before it is
+	// failed and refunded; keep it well above the provider timeouts.
+	SendingTimeout time.Duration `yaml:"sending_timeout"`
+	BatchSize      int           `yaml:"batch_size"`
+}
+
+type Campaigns struct {
+	// PollInterval is how often the consumer looks for campaigns to parse,
+	// start or send.
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// ChunkSize is how many rows become SMS per transaction.
+	ChunkSize int `yaml:"chunk_size"`
+	MaxRows   int `yaml:"max_rows"`
+	// MaxFileSize caps an uploaded CSV, in bytes.
+	MaxFileSize int `yaml:"max_file_size"`
+}
+
+type Bulk struct {
+	// BillingMode is "message", the default, to debit each SMS on its own
+	// or "batch" to request one debit per bulk send. "batch" needs a billing
+	// service that implements the batch debit contract, see
+	// sms.BillingPerBatch, and the batch completed queue to be configured.
+	BillingMode string `yaml:"billing_mode"`
+	// InsertBatchSize is how many SMS rows are written per INSERT.
+	InsertBatchSize int `yaml:"insert_batch_size"`
+}
+
+type Admin struct {
+	// ListenAddr is where the consumer serves /metrics, /healthz and
+	// /readyz. The API serves them on its own port.
+	ListenAddr string `yaml:"listen_addr"`
+}
+
+type Tracing struct {
+	// Exporter is "otlp", "stdout" or "none".
+	Exporter string `yaml:"exporter"`
+	// Endpoint is the OTLP/HTTP collector address, e.g. "localhost:4318".
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	ServiceName string  `yaml:"service_name"`
+	SampleRatio float64 `yaml:"sample_ratio"`
 }
 
 type Server struct {
 	Host string `yaml:"host"`
 	Port int    `yaml:"port"`
+	// ShutdownTimeout bounds how long in-flight requests may take to finish
+	// once the process is asked to stop.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
 }
 
 type RabbitMQ struct {
-	URI    string  `yaml:"uri"`
-	Queues []Queue `yaml:"queues"`
+	URI       string    `yaml:"uri"`
+	Queues    []Queue   `yaml:"queues"`
+	Reconnect Reconnect `yaml:"reconnect"`
+	// DrainTimeout bounds how long the consumer waits for in-flight
+	// messages on shutdown.
+	DrainTimeout time.Duration `yaml:"drain_timeout"`
+	// DeliveryRetry and Dispatch tune the consumers of the service's own
+	// delivery retry and bulk dispatch queues.
+	DeliveryRetry Consumer `yaml:"delivery_retry"`
+	Dispatch      Consumer `yaml:"dispatch"`
+}
+
+type Reconnect struct {
+	InitialDelay time.Duration `yaml:"initial_delay"`
+	MaxDelay     time.Duration `yaml:"max_delay"`
+	// PublishMode is "block" to wait up to PublishTimeout for a lost
+	// connection to come back, or "fail" to return an error right away.
+	PublishMode string `yaml:"publish_mode"`
+	// PublishTimeout also bounds the wait for the broker to confirm a
+	// published message.
+	PublishTimeout time.Duration `yaml:"publish_timeout"`
 }
 
 type Queue struct {
 	Name       string `yaml:"name"`
 	Exchange   string `yaml:"exchange"`
 	RoutingKey string `yaml:"routing_key"`
+	Consumer   `yaml:",inline"`
+}
+
+// Consumer tunes how a queue is consumed.
+type Consumer struct {
+	// MaxRedeliveries is how often a message failing its handler is
+	// redelivered before it is moved to the queue's DLQ.
+	MaxRedeliveries int `yaml:"max_redeliveries"`
+	// RedeliveryDelay is how long a failed message waits before it is
+	// redelivered.
+	RedeliveryDelay time.Duration `yaml:"redelivery_delay"`
+	// Workers is how many messages are handled in parallel and Prefetch
+	// how many unacked messages the broker hands out at once.
+	Workers  int `yaml:"workers"`
+	Prefetch int `yaml:"prefetch"`
 }
 
 type DB struct {
@@ -30,3 +135,111 @@ type DB struct {
 	Database string `yaml:"database"`
 	Schema   string `yaml:"schema"`
 }
+
+type Outbox struct {
+	PollInterval time.Duration `yaml:"poll_interval"`
+	BatchSize    int           `yaml:"batch_size"`
+	// MaxAttempts is how often an event is published before it is parked
+	// as failed.
+	MaxAttempts int `yaml:"max_attempts"`
+	// ClaimTimeout is how long other relays skip a batch one relay claimed.
+	ClaimTimeout time.Duration `yaml:"claim_timeout"`
+}
+
+// Retry configures redelivery of SMS that failed with a transient provider
+// error. Attempt n waits InitialDelay * Multiplier^(n-2), capped at MaxDelay.
+type Retry struct {
+	// MaxAttempts counts every delivery attempt; 1 disables retries.
+	MaxAttempts  int           `yaml:"max_attempts"`
+	InitialDelay time.Duration `yaml:"initial_delay"`
+	Multiplier   float64       `yaml:"multiplier"`
+	MaxDelay     time.Duration `yaml:"max_delay"`
+}
+
+type Pricing struct {
+	// Source is "config" (default) to use Plans and Users below, or
+	// "database" to load tariff plans from Postgres.
+	Source      string       `yaml:"source"`
+	DefaultPlan string       `yaml:"default_plan"`
+	Plans       []TariffPlan `yaml:"plans"`
+	Users       []UserTariff `yaml:"users"`
+}
+
+type TariffPlan struct {
+	Name         string       `yaml:"name"`
+	DefaultPrice int64        `yaml:"default_price"`
+	Rates        []TariffRate `yaml:"rates"`
+}
+
+type TariffRate struct {
+	Prefix string `yaml:"prefix"`
+	Price  int64  `yaml:"price"`
+}
+
+type UserTariff struct {
+	UserID string `yaml:"user_id"`
+	Plan   string `yaml:"plan"`
+}
+
+type Providers struct {
+	Gateways []Gateway `yaml:"gateways"`
+	// Failover lists gateway names in the order they are tried. It also
+	// serves receivers that match none of the routes.
+	Failover       []string       `yaml:"failover"`
+	Routes         []Route        `yaml:"routes"`
+	CircuitBreaker CircuitBreaker `yaml:"circuit_breaker"`
+}
+
+// Route sends receivers starting with one of Prefixes (E.164, e.g. "+98912")
+// through Providers, tried in order.
+type Route struct {
+	Name      string   `yaml:"name"`
+	Prefixes  []string `yaml:"prefixes"`
+	Providers []string `yaml:"providers"`
+}
+
+type Gateway struct {
+	Name string `yaml:"name"`
+	// Type is one of "http", "smpp", "mock", "random_fail" or "always_fail".
+	Type            string      `yaml:"type"`
+	FailProbability float64     `yaml:"fail_probability"`
+	HTTP            HTTPGateway `yaml:"http"`
+	SMPP            SMPPGateway `yaml:"smpp"`
+}
+
+type HTTPGateway struct {
+	URL          string            `yaml:"url"`
+	Method       string            `yaml:"method"`
+	Headers      map[string]string `yaml:"headers"`
+	ContentType  string            `yaml:"content_type"`
+	BodyTemplate string            `yaml:"body_template"`
+	Timeout      time.Duration     `yaml:"timeout"`
+	Response     HTTPResponse      `yaml:"response"`
+	// ReceiptSecret keys the signature of the delivery receipts the gateway
+	// posts to /api/v1/dlr/<name>. Receipts are rejected while it is empty.
+	ReceiptSecret string `yaml:"receipt_secret"`
+}
+
+type HTTPResponse struct {
+	SuccessField   string            `yaml:"success_field"`
+	SuccessValue   string            `yaml:"success_value"`
+	MessageIDField string            `yaml:"message_id_field"`
+	ErrorCodeField string            `yaml:"error_code_field"`
+	ErrorCodes     map[string]string `yaml:"error_codes"`
+}
+
+type SMPPGateway struct {
+	Addr                string        `yaml:"addr"`
+	SystemID            string        `yaml:"system_id"`
+	Password            string        `yaml:"password"`
+	SystemType          string        `yaml:"system_type"`
+	SourceAddr          string        `yaml:"source_addr"`
+	WindowSize          int           `yaml:"window_size"`
+	EnquireLinkInterval time.Duration `yaml:"enquire_link_interval"`
+	Timeout             time.Duration `yaml:"timeout"`
+}
+
+type CircuitBreaker struct {
+	FailureThreshold int           `yaml:"failure_threshold"`
+	OpenTimeout      time.Duration `yaml:"open_timeout"`
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -13,7 +14,137 @@ func ReadConfig(configPath string) (Config, error) {
 		return c, err
 	}
 
-	return c, yaml.Unmarshal(data, &c)
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return c, err
+	}
+
+	setDefaults(&c)
+	return c, nil
+}
+
+func setDefaults(c *Config) {
+	if c.Outbox.PollInterval <= 0 {
+		c.Outbox.PollInterval = time.Second
+	}
+	if c.Outbox.BatchSize <= 0 {
+		c.Outbox.BatchSize = 100
+	}
+	if c.Outbox.MaxAttempts <= 0 {
+		c.Outbox.MaxAttempts = 10
+	}
+	if c.Outbox.ClaimTimeout <= 0 {
+		c.Outbox.ClaimTimeout = time.Minute
+	}
+	if c.Providers.CircuitBreaker.FailureThreshold <= 0 {
+		c.Providers.CircuitBreaker.FailureThreshold = 5
+	}
+	if c.Providers.CircuitBreaker.OpenTimeout <= 0 {
+		c.Providers.CircuitBreaker.OpenTimeout = 30 * time.Second
+	}
+	for i := range c.Providers.Gateways {
+		gw := &c.Providers.Gateways[i]
+		if gw.Type == "http" && gw.HTTP.Timeout <= 0 {
+			gw.HTTP.Timeout = 10 * time.Second
+		}
+		if gw.Type == "smpp" {
+			if gw.SMPP.Timeout <= 0 {
+				gw.SMPP.Timeout = 10 * time.Second
+			}
+			if gw.SMPP.WindowSize <= 0 {
+				gw.SMPP.WindowSize = 10
+			}
+			if gw.SMPP.EnquireLinkInterval <= 0 {
+				gw.SMPP.EnquireLinkInterval = 30 * time.Second
+			}
+		}
+	}
+	if c.RabbitMQ.Reconnect.InitialDelay <= 0 {
+		c.RabbitMQ.Reconnect.InitialDelay = time.Second
+	}
+	if c.RabbitMQ.Reconnect.MaxDelay <= 0 {
+		c.RabbitMQ.Reconnect.MaxDelay = 30 * time.Second
+	}
+	if c.RabbitMQ.Reconnect.PublishMode == "" {
+		c.RabbitMQ.Reconnect.PublishMode = "block"
+	}
+	if c.RabbitMQ.Reconnect.PublishTimeout <= 0 {
+		c.RabbitMQ.Reconnect.PublishTimeout = 5 * time.Second
+	}
+	if c.RabbitMQ.DrainTimeout <= 0 {
+		c.RabbitMQ.DrainTimeout = 30 * time.Second
+	}
+	for i := range c.RabbitMQ.Queues {
+		setConsumerDefaults(&c.RabbitMQ.Queues[i].Consumer)
+	}
+	setConsumerDefaults(&c.RabbitMQ.DeliveryRetry)
+	setConsumerDefaults(&c.RabbitMQ.Dispatch)
+	if c.Retry.MaxAttempts <= 0 {
+		c.Retry.MaxAttempts = 3
+	}
+	if c.Retry.InitialDelay <= 0 {
+		c.Retry.InitialDelay = 10 * time.Second
+	}
+	if c.Retry.Multiplier < 1 {
+		c.Retry.Multiplier = 2
+	}
+	if c.Retry.MaxDelay <= 0 {
+		c.Retry.MaxDelay = 5 * time.Minute
+	}
+	if c.Tracing.Exporter == "" {
+		c.Tracing.Exporter = "none"
+	}
+	if c.Tracing.ServiceName == "" {
+		c.Tracing.ServiceName = "sms"
+	}
+	if c.Tracing.SampleRatio <= 0 {
+		c.Tracing.SampleRatio = 1
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		c.Server.ShutdownTimeout = 15 * time.Second
+	}
+	if c.Bulk.BillingMode == "" {
+		c.Bulk.BillingMode = "message"
+	}
+	if c.Bulk.InsertBatchSize <= 0 {
+		c.Bulk.InsertBatchSize = 500
+	}
+	if c.Campaigns.PollInterval <= 0 {
+		c.Campaigns.PollInterval = 2 * time.Second
+	}
+	if c.Campaigns.ChunkSize <= 0 {
+		c.Campaigns.ChunkSize = 500
+	}
+	if c.Campaigns.MaxRows <= 0 {
+		c.Campaigns.MaxRows = 100000
+	}
+	if c.Campaigns.MaxFileSize <= 0 {
+		c.Campaigns.MaxFileSize = 10 << 20
+	}
+	if c.Scheduler.PollInterval <= 0 {
+		c.Scheduler.PollInterval = time.Second
+	}
+	if c.Scheduler.BatchSize <= 0 {
+		c.Scheduler.BatchSize = 100
+	}
+	if c.Reconciler.PollInterval <= 0 {
+		c.Reconciler.PollInterval = time.Minute
+	}
+	if c.Reconciler.SendingTimeout <= 0 {
+		c.Reconciler.SendingTimeout = 10 * time.Minute
+	}
+	if c.Reconciler.BatchSize <= 0 {
+		c.Reconciler.BatchSize = 100
+	}
+	if c.Admin.ListenAddr == "" {
+		c.Admin.ListenAddr = ":9091"
+	}
+	if c.Pricing.Source == "" {
+		c.Pricing.Source = "config"
+	}
+	if c.Pricing.Source == "config" && len(c.Pricing.Plans) == 0 {
+		c.Pricing.DefaultPlan = "flat"
+		c.Pricing.Plans = []TariffPlan{{Name: "flat", DefaultPrice: 1}}
+	}
 }
 
 func MustReadConfig(configPath string) Config {
@@ -23,3 +154,18 @@ func MustReadConfig(configPath string) Config {
 	}
 	return c
 }
+
+func setConsumerDefaults(c *Consumer) {
+	if c.MaxRedeliveries <= 0 {
+		c.MaxRedeliveries = 5
+	}
+	if c.RedeliveryDelay <= 0 {
+		c.RedeliveryDelay = 5 * time.Second
+	}
+	if c.Workers <= 0 {
+		c.Workers = 4
+	}
+	if c.Prefetch < c.Workers {
+		c.Prefetch = 2 * c.Workers
+	}
+}
@@ -3,9 +3,12 @@ package dto
 import "time"
 
 type SendSMSRequest struct {
-	Content  string `json:"content" validate:"required,max=160"`
-	Receiver string `json:"receiver" validate:"required,e164"` // E.164 format phone number
+	Content  string `json:"content" validate:"required"`       // split into up to 10 GSM-7 or UCS-2 segments
+	Receiver string `json:"receiver" validate:"required,e164"` // E.164 format phone number; Iranian local numbers such as 09123456789 are accepted
 	UserID   string `json:"user_id" validate:"required,uuid"`
+	// SendAt schedules the SMS; billing is requested once it is due. A time
+	// that has passed sends at once.
+	SendAt *time.Time `json:"send_at,omitempty"`
 }
 
 type SendSMSResponse struct {
@@ -16,20 +19,136 @@ type SendSMSResponse struct {
 }
 
 type GetSMSResponse struct {
-	ID          string     `json:"id"`
-	UserID      string     `json:"user_id"`
-	Content     string     `json:"content"`
-	Receiver    string     `json:"receiver"`
-	Provider    string     `json:"provider,omitempty"`
-	Status      string     `json:"status"`
-	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
-	FailureCode string     `json:"failure_code,omitempty"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
+	ID                string     `json:"id"`
+	UserID            string     `json:"user_id"`
+	Content           string     `json:"content"`
+	Receiver          string     `json:"receiver"`
+	Provider          string     `json:"provider,omitempty"`
+	ProviderMessageID string     `json:"provider_message_id,omitempty"`
+	Status            string     `json:"status"`
+	SegmentCount      int        `json:"segment_count"`
+	Amount            int64      `json:"amount"`
+	DeliveredAt       *time.Time `json:"delivered_at,omitempty"`
+	FailureCode       string     `json:"failure_code,omitempty"`
+	BatchID           string     `json:"batch_id,omitempty"` // set for SMS of a bulk send
+	SendAt            *time.Time `json:"send_at,omitempty"`  // set for scheduled SMS
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+type ListSMSRequest struct {
+	UserID      string `query:"user_id" json:"user_id" validate:"omitempty,uuid"`
+	Status      string `query:"status" json:"status" validate:"omitempty,sms_status"`
+	Receiver    string `query:"receiver" json:"receiver" validate:"omitempty,e164"`
+	Provider    string `query:"provider" json:"provider"`
+	BatchID     string `query:"batch_id" json:"batch_id" validate:"omitempty,uuid"`
+	CreatedFrom string `query:"created_from" json:"created_from" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"` // RFC 3339, inclusive
+	CreatedTo   string `query:"created_to" json:"created_to" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`     // RFC 3339, exclusive
+	Limit       int    `query:"limit" json:"limit" validate:"omitempty,min=1,max=100"`                                    // defaults to 20
+	Cursor      string `query:"cursor" json:"cursor"`                                                                     // next_cursor of the previous page
+	WithTotal   bool   `query:"with_total" json:"with_total"`                                                             // also count all matching messages
+}
+
+type ListSMSResponse struct {
+	Items      []GetSMSResponse `json:"items"`
+	NextCursor string           `json:"next_cursor,omitempty"` // empty on the last page
+	Total      *int64           `json:"total,omitempty"`
+}
+
+type BulkSendRequest struct {
+	UserID     string          `json:"user_id" validate:"required,uuid"`
+	Content    string          `json:"content,omitempty"` // sent to every recipient without content of its own
+	Recipients []BulkRecipient `json:"recipients" validate:"required,min=1,max=10000,dive"`
+}
+
+type BulkRecipient struct {
+	Receiver string `json:"receiver" validate:"required,e164"`
+	Content  string `json:"content,omitempty" validate:"required"` // overrides the shared content
+}
+
+type BulkSendResponse struct {
+	BatchID     string    `json:"batch_id"`
+	Total       int       `json:"total"`
+	Amount      int64     `json:"amount"`
+	BillingMode string    `json:"billing_mode"` // batch or message
+	CreatedAt   time.Time `json:"created_at"`
+	Message     string    `json:"message,omitempty"`
+}
+
+type BatchProgressResponse struct {
+	BatchID     string           `json:"batch_id"`
+	UserID      string           `json:"user_id"`
+	Total       int              `json:"total"`
+	Amount      int64            `json:"amount"`
+	BillingMode string           `json:"billing_mode"`
+	Processed   int64            `json:"processed"` // sent or finally failed
+	Done        bool             `json:"done"`
+	Statuses    map[string]int64 `json:"statuses"` // SMS of the batch per status
+	CreatedAt   time.Time        `json:"created_at"`
+}
+
+// CreateCampaignRequest holds the form fields sent along with the CSV file.
+type CreateCampaignRequest struct {
+	UserID   string `form:"user_id" json:"user_id" validate:"required,uuid"`
+	Name     string `form:"name" json:"name" validate:"required,max=200"`
+	Template string `form:"template" json:"template" validate:"required"`                                     // e.g. "Hi {{name}}, your code is {{code}}"
+	StartAt  string `form:"start_at" json:"start_at" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"` // RFC 3339; sending starts right after parsing when empty
+}
+
+type CampaignResponse struct {
+	ID            string           `json:"id"`
+	UserID        string           `json:"user_id"`
+	Name          string           `json:"name"`
+	Template      string           `json:"template"`
+	Status        string           `json:"status"` // uploaded, scheduled, running, paused, completed, cancelled or failed
+	StartAt       *time.Time       `json:"start_at,omitempty"`
+	Error         string           `json:"error,omitempty"` // why the CSV could not be used
+	TotalRows     int              `json:"total_rows"`
+	InvalidRows   int              `json:"invalid_rows"`
+	QueuedRows    int              `json:"queued_rows"` // rows whose SMS was created
+	FailedRows    int              `json:"failed_rows"`
+	CancelledRows int              `json:"cancelled_rows"`
+	PendingRows   int              `json:"pending_rows"`
+	SMS           map[string]int64 `json:"sms,omitempty"` // SMS of queued rows per status
+	CreatedAt     time.Time        `json:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+}
+
+type CampaignErrorsRequest struct {
+	AfterLine int `query:"after_line" json:"after_line" validate:"min=0"`          // next_after_line of the previous page
+	Limit     int `query:"limit" json:"limit" validate:"omitempty,min=1,max=1000"` // defaults to 100
+}
+
+type CampaignErrorsResponse struct {
+	Items         []CampaignRowError `json:"items"`
+	NextAfterLine int                `json:"next_after_line,omitempty"` // empty on the last page
+}
+
+// CampaignRowError is a CSV row that failed validation.
+type CampaignRowError struct {
+	Line     int    `json:"line"` // the header is line 1
+	Receiver string `json:"receiver,omitempty"`
+	Error    string `json:"error"`
+}
+
+type DeliveryReceiptRequest struct {
+	MessageID string     `json:"message_id" validate:"required"` // ID the provider returned when accepting the SMS
+	Status    string     `json:"status" validate:"required"`     // delivered, undelivered, expired or an SMPP state such as DELIVRD
+	ErrorCode string     `json:"error_code,omitempty"`           // operator error code
+	DoneAt    *time.Time `json:"done_at,omitempty"`
 }
 
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message,omitempty"`
-	Code    int    `json:"code,omitempty"`
+	Error   string       `json:"error"`
+	Message string       `json:"message,omitempty"`
+	Code    int          `json:"code,omitempty"`
+	Fields  []FieldError `json:"fields,omitempty"` // set when the request failed validation
+}
+
+// FieldError names a request field and the validation rule it broke.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`            // validate tag, e.g. required or e164
+	Param   string `json:"param,omitempty"` // rule parameter, e.g. the limit of max
+	Message string `json:"message"`
 }
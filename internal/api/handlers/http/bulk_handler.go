@@ -0,0 +1,126 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"sms/internal/api/dto"
+	smsdomain "sms/internal/domain/sms"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// SendBulkSMS godoc
+// @Summary Send an SMS to many receivers
+// @Description Queue one SMS per recipient as a batch. Recipients without content of their own get the shared content.
+// @Tags SMS
+// @Accept json
+// @Produce json
+// @Param batch body dto.BulkSendRequest true "Bulk send payload"
+// @Success 202 {object} dto.BulkSendResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /sms/bulk [post]
+func (h *SMSHandler) SendBulkSMS(c *fiber.Ctx) error {
+	var req dto.BulkSendRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(dto.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "Invalid request body",
+		})
+	}
+
+	for i := range req.Recipients {
+		recipient := &req.Recipients[i]
+		recipient.Receiver = smsdomain.NormalizeReceiver(recipient.Receiver)
+		if recipient.Content == "" {
+			recipient.Content = req.Content
+		}
+	}
+	if err := validate.Struct(req); err != nil {
+		return validationFailed(c, err)
+	}
+
+	now := time.Now()
+	batch := &smsdomain.SMSBatch{
+		ID:        uuid.New().String(),
+		UserID:    req.UserID,
+		CreatedAt: now,
+	}
+	messages := make([]*smsdomain.SMSMessage, 0, len(req.Recipients))
+	for _, recipient := range req.Recipients {
+		messages = append(messages, &smsdomain.SMSMessage{
+			ID:        uuid.New().String(),
+			UserID:    req.UserID,
+			Content:   recipient.Content,
+			Receiver:  recipient.Receiver,
+			Status:    smsdomain.SMSStatusPending,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+	}
+
+	ctx := c.UserContext()
+	if err := h.smsUseCase.CreateAndBillBatch(ctx, batch, messages); err != nil {
+		if errors.Is(err, smsdomain.ErrContentTooLong) || errors.Is(err, smsdomain.ErrNoTariffRate) {
+			return c.Status(http.StatusBadRequest).JSON(dto.ErrorResponse{
+				Error:   "invalid_request",
+				Message: err.Error(),
+			})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(dto.ErrorResponse{
+			Error:   "processing_error",
+			Message: "Failed to process SMS batch",
+		})
+	}
+
+	return c.Status(http.StatusAccepted).JSON(dto.BulkSendResponse{
+		BatchID:     batch.ID,
+		Total:       batch.Total,
+		Amount:      batch.Amount,
+		BillingMode: string(batch.BillingMode),
+		CreatedAt:   batch.CreatedAt,
+		Message:     "SMS batch queued for processing",
+	})
+}
+
+// GetBatchProgress godoc
+// @Summary Get the progress of a bulk send
+// @Description Count the SMS of a batch by status
+// @Tags SMS
+// @Produce json
+// @Param id path string true "Batch ID"
+// @Success 200 {object} dto.BatchProgressResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /sms/bulk/{id} [get]
+func (h *SMSHandler) GetBatchProgress(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	ctx := c.UserContext()
+	progress, err := h.smsUseCase.GetBatchProgress(ctx, id)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(dto.ErrorResponse{
+			Error:   "not_found",
+			Message: "SMS batch not found",
+		})
+	}
+
+	statuses := make(map[string]int64, len(progress.Counts))
+	for status, count := range progress.Counts {
+		statuses[string(status)] = count
+	}
+	return c.Status(http.StatusOK).JSON(dto.BatchProgressResponse{
+		BatchID:     progress.Batch.ID,
+		UserID:      progress.Batch.UserID,
+		Total:       progress.Batch.Total,
+		Amount:      progress.Batch.Amount,
+		BillingMode: string(progress.Batch.BillingMode),
+		Processed:   progress.Processed(),
+		Done:        progress.Done(),
+		Statuses:    statuses,
+		CreatedAt:   progress.Batch.CreatedAt,
+	})
+}
@@ -0,0 +1,288 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"sms/internal/api/dto"
+	smsdomain "sms/internal/domain/sms"
+	"sms/internal/usecase/sms"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const defaultCampaignErrorsLimit = 100
+
+type CampaignHandler struct {
+	smsUseCase  *sms.Service
+	maxFileSize int
+}
+
+func NewCampaignHandler(smsUseCase *sms.Service, maxFileSize int) *CampaignHandler {
+	return &CampaignHandler{
+		smsUseCase:  smsUseCase,
+		maxFileSize: maxFileSize,
+	}
+}
+
+// CreateCampaign godoc
+// @Summary Create a campaign from a CSV file
+// @Description Upload a CSV with a receiver column and one column per template variable. The file is parsed in the background; rows that fail validation are listed by the errors endpoint.
+// @Tags Campaigns
+// @Accept multipart/form-data
+// @Produce json
+// @Param user_id formData string true "User ID"
+// @Param name formData string true "Campaign name"
+// @Param template formData string true "Content with {{column}} placeholders"
+// @Param start_at formData string false "Start sending at, RFC 3339"
+// @Param file formData file true "CSV file"
+// @Success 202 {object} dto.CampaignResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 413 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /campaigns [post]
+func (h *CampaignHandler) CreateCampaign(c *fiber.Ctx) error {
+	var req dto.CreateCampaignRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(dto.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "Invalid request body",
+		})
+	}
+	if err := validate.Struct(req); err != nil {
+		return validationFailed(c, err)
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(dto.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "CSV file is required",
+		})
+	}
+	if file.Size > int64(h.maxFileSize) {
+		return c.Status(http.StatusRequestEntityTooLarge).JSON(dto.ErrorResponse{
+			Error:   "file_too_large",
+			Message: "CSV file is too large",
+		})
+	}
+	source, err := readFile(file)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(dto.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "CSV file cannot be read",
+		})
+	}
+
+	campaign := &smsdomain.Campaign{
+		ID:        uuid.New().String(),
+		UserID:    req.UserID,
+		Name:      req.Name,
+		Template:  req.Template,
+		Source:    source,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if req.StartAt != "" {
+		campaign.StartAt, _ = time.Parse(time.RFC3339, req.StartAt)
+	}
+
+	ctx := c.UserContext()
+	if err := h.smsUseCase.CreateCampaign(ctx, campaign); err != nil {
+		if errors.Is(err, smsdomain.ErrInvalidTemplate) {
+			return c.Status(http.StatusBadRequest).JSON(dto.ErrorResponse{
+				Error:   "invalid_request",
+				Message: err.Error(),
+			})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(dto.ErrorResponse{
+			Error:   "processing_error",
+			Message: "Failed to create campaign",
+		})
+	}
+
+	return c.Status(http.StatusAccepted).JSON(toCampaignResponse(campaign, nil))
+}
+
+func readFile(file *multipart.FileHeader) ([]byte, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// GetCampaign godoc
+// @Summary Get a campaign and its progress
+// @Description Row counters of the campaign and the SMS of its queued rows per status
+// @Tags Campaigns
+// @Produce json
+// @Param id path string true "Campaign ID"
+// @Success 200 {object} dto.CampaignResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /campaigns/{id} [get]
+func (h *CampaignHandler) GetCampaign(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	progress, err := h.smsUseCase.GetCampaignProgress(ctx, c.Params("id"))
+	if err != nil {
+		return campaignFailed(c, err)
+	}
+	return c.Status(http.StatusOK).JSON(toCampaignResponse(progress.Campaign, progress.SMS))
+}
+
+// GetCampaignErrors godoc
+// @Summary List the rows of a campaign that failed validation
+// @Tags Campaigns
+// @Produce json
+// @Param id path string true "Campaign ID"
+// @Param after_line query int false "next_after_line of the previous page"
+// @Param limit query int false "Page size, 1 to 1000" default(100)
+// @Success 200 {object} dto.CampaignErrorsResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /campaigns/{id}/errors [get]
+func (h *CampaignHandler) GetCampaignErrors(c *fiber.Ctx) error {
+	var req dto.CampaignErrorsRequest
+
+	if err := c.QueryParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(dto.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "Invalid query parameters",
+		})
+	}
+	if err := validate.Struct(req); err != nil {
+		return validationFailed(c, err)
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultCampaignErrorsLimit
+	}
+
+	ctx := c.UserContext()
+	rows, err := h.smsUseCase.CampaignErrors(ctx, c.Params("id"), req.AfterLine, req.Limit)
+	if err != nil {
+		return campaignFailed(c, err)
+	}
+
+	resp := dto.CampaignErrorsResponse{Items: make([]dto.CampaignRowError, 0, len(rows))}
+	for _, row := range rows {
+		resp.Items = append(resp.Items, dto.CampaignRowError{
+			Line:     row.Line,
+			Receiver: row.Receiver,
+			Error:    row.Error,
+		})
+	}
+	if len(rows) == req.Limit {
+		resp.NextAfterLine = rows[len(rows)-1].Line
+	}
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+// PauseCampaign godoc
+// @Summary Pause a campaign
+// @Description Stop sending after the chunk in progress
+// @Tags Campaigns
+// @Produce json
+// @Param id path string true "Campaign ID"
+// @Success 200 {object} dto.CampaignResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /campaigns/{id}/pause [post]
+func (h *CampaignHandler) PauseCampaign(c *fiber.Ctx) error {
+	return h.changeCampaign(c, h.smsUseCase.PauseCampaign)
+}
+
+// ResumeCampaign godoc
+// @Summary Resume a paused campaign
+// @Tags Campaigns
+// @Produce json
+// @Param id path string true "Campaign ID"
+// @Success 200 {object} dto.CampaignResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /campaigns/{id}/resume [post]
+func (h *CampaignHandler) ResumeCampaign(c *fiber.Ctx) error {
+	return h.changeCampaign(c, h.smsUseCase.ResumeCampaign)
+}
+
+// CancelCampaign godoc
+// @Summary Cancel a campaign
+// @Description Cancel the rows whose SMS was not created yet; SMS already created are still sent
+// @Tags Campaigns
+// @Produce json
+// @Param id path string true "Campaign ID"
+// @Success 200 {object} dto.CampaignResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /campaigns/{id}/cancel [post]
+func (h *CampaignHandler) CancelCampaign(c *fiber.Ctx) error {
+	return h.changeCampaign(c, h.smsUseCase.CancelCampaign)
+}
+
+func (h *CampaignHandler) changeCampaign(c *fiber.Ctx, change func(ctx context.Context, campaignID string) (*smsdomain.Campaign, error)) error {
+	campaign, err := change(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return campaignFailed(c, err)
+	}
+	return c.Status(http.StatusOK).JSON(toCampaignResponse(campaign, nil))
+}
+
+func campaignFailed(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, smsdomain.ErrCampaignNotFound):
+		return c.Status(http.StatusNotFound).JSON(dto.ErrorResponse{
+			Error:   "not_found",
+			Message: "Campaign not found",
+		})
+	case errors.Is(err, smsdomain.ErrInvalidCampaignTransition):
+		return c.Status(http.StatusConflict).JSON(dto.ErrorResponse{
+			Error:   "invalid_transition",
+			Message: err.Error(),
+		})
+	default:
+		return c.Status(http.StatusInternalServerError).JSON(dto.ErrorResponse{
+			Error:   "processing_error",
+			Message: "Failed to process campaign",
+		})
+	}
+}
+
+func toCampaignResponse(campaign *smsdomain.Campaign, counts map[smsdomain.SMSStatus]int64) dto.CampaignResponse {
+	resp := dto.CampaignResponse{
+		ID:            campaign.ID,
+		UserID:        campaign.UserID,
+		Name:          campaign.Name,
+		Template:      campaign.Template,
+		Status:        string(campaign.Status),
+		Error:         campaign.Error,
+		TotalRows:     campaign.TotalRows,
+		InvalidRows:   campaign.InvalidRows,
+		QueuedRows:    campaign.QueuedRows,
+		FailedRows:    campaign.FailedRows,
+		CancelledRows: campaign.CancelledRows,
+		PendingRows:   campaign.PendingRows(),
+		CreatedAt:     campaign.CreatedAt,
+		UpdatedAt:     campaign.UpdatedAt,
+	}
+	if !campaign.StartAt.IsZero() {
+		resp.StartAt = &campaign.StartAt
+	}
+	if len(counts) > 0 {
+		resp.SMS = make(map[string]int64, len(counts))
+		for status, count := range counts {
+			resp.SMS[string(status)] = count
+		}
+	}
+	return resp
+}
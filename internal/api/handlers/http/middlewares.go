@@ -1,15 +1,32 @@
 package http
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sms/internal/api/dto"
 	"sms/pkg/logger"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// ReceiptSignatureHeader carries the hex HMAC-SHA256 of a delivery receipt's
+// body, keyed with the receipt secret of the gateway that posts it.
+const ReceiptSignatureHeader = "X-Signature"
+
 // TODO: make this private
+// setTraceID continues the trace of the caller when it sends X-Trace-ID and
+// starts a new one otherwise.
 func setTraceID() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		ctx := logger.WithTraceID(c.Context())
+		var ctx context.Context
+		if traceID := c.Get("X-Trace-ID"); traceID != "" {
+			ctx = logger.ContextWithTraceID(c.UserContext(), traceID)
+		} else {
+			ctx = logger.WithTraceID(c.UserContext())
+		}
 		c.SetUserContext(ctx)
 
 		traceID := logger.GetTraceID(ctx)
@@ -17,3 +34,26 @@ func setTraceID() fiber.Handler {
 		return c.Next()
 	}
 }
+
+// VerifyReceiptSignature lets a delivery receipt through only when it is
+// signed with the secret of the gateway named in the path. Gateways without a
+// secret cannot post receipts.
+func VerifyReceiptSignature(secrets map[string]string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		secret := secrets[c.Params("provider")]
+		signature, err := hex.DecodeString(c.Get(ReceiptSignatureHeader))
+		if secret == "" || err != nil || !hmac.Equal(signature, receiptSignature(secret, c.Body())) {
+			return c.Status(http.StatusUnauthorized).JSON(dto.ErrorResponse{
+				Error:   "unauthorized",
+				Message: "Missing or invalid receipt signature",
+			})
+		}
+		return c.Next()
+	}
+}
+
+func receiptSignature(secret string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"sms/config"
 	"sms/internal/app"
+	"sms/pkg/health"
+	"sms/pkg/metrics"
+	"sms/pkg/tracing"
 
 	"sms/docs"
 
@@ -13,23 +16,45 @@ import (
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
-func Run(appContainer app.App, cfg config.Server) error {
+// Run serves the API until ctx is done, then stops accepting connections and
+// waits up to cfg.ShutdownTimeout for in-flight requests to finish.
+func Run(ctx context.Context, appContainer app.App, cfg config.Server) error {
 	router := fiber.New(fiber.Config{
 		ErrorHandler: customErrorHandler,
+		// campaign uploads carry a CSV of up to max_file_size
+		BodyLimit: max(appContainer.Config().Campaigns.MaxFileSize+1<<20, fiber.DefaultBodyLimit),
 	})
 
-	registerSMSRoutes(appContainer, router)
+	router.Use(tracing.Middleware(), metrics.Middleware())
+	registerSMSRoutes(ctx, appContainer, router)
 	docs.SwaggerInfo.Host = ""
 	docs.SwaggerInfo.Schemes = []string{}
 	docs.SwaggerInfo.BasePath = "/api/v1"
 
 	router.Get("/swagger/*", adaptor.HTTPHandler(httpSwagger.Handler()))
+	router.Get("/metrics", adaptor.HTTPHandler(metrics.Handler()))
+	router.Get("/healthz", adaptor.HTTPHandler(health.LiveHandler()))
+	router.Get("/readyz", adaptor.HTTPHandler(appContainer.Health().ReadyHandler()))
 
-	return router.Listen(fmt.Sprintf(":%d", cfg.Port))
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- router.Listen(fmt.Sprintf(":%d", cfg.Port))
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownErr := router.ShutdownWithTimeout(cfg.ShutdownTimeout)
+	if err := <-serveErr; err != nil {
+		return err
+	}
+	return shutdownErr
 }
 
-func registerSMSRoutes(appContainer app.App, router fiber.Router) {
-	ctx := context.Background()
+func registerSMSRoutes(ctx context.Context, appContainer app.App, router fiber.Router) {
 	smsUseCase := appContainer.SMSService(ctx)
 
 	smsHandler := NewSMSHandler(smsUseCase)
@@ -39,7 +64,35 @@ func registerSMSRoutes(appContainer app.App, router fiber.Router) {
 	// SMS routes
 	sms := v1.Group("/sms")
 	sms.Post("/", setTraceID(), smsHandler.SendSMS)
+	sms.Get("/", setTraceID(), smsHandler.ListSMS)
+	sms.Post("/bulk", setTraceID(), smsHandler.SendBulkSMS)
+	sms.Get("/bulk/:id", setTraceID(), smsHandler.GetBatchProgress)
 	sms.Get("/:id", setTraceID(), smsHandler.GetSMSByID)
+	sms.Post("/:id/cancel", setTraceID(), smsHandler.CancelSMS)
+
+	campaignHandler := NewCampaignHandler(smsUseCase, appContainer.Config().Campaigns.MaxFileSize)
+	campaigns := v1.Group("/campaigns")
+	campaigns.Post("/", setTraceID(), campaignHandler.CreateCampaign)
+	campaigns.Get("/:id", setTraceID(), campaignHandler.GetCampaign)
+	campaigns.Get("/:id/errors", setTraceID(), campaignHandler.GetCampaignErrors)
+	campaigns.Post("/:id/pause", setTraceID(), campaignHandler.PauseCampaign)
+	campaigns.Post("/:id/resume", setTraceID(), campaignHandler.ResumeCampaign)
+	campaigns.Post("/:id/cancel", setTraceID(), campaignHandler.CancelCampaign)
+
+	// delivery receipt callbacks from HTTP gateways
+	v1.Post("/dlr/:provider", VerifyReceiptSignature(receiptSecrets(appContainer.Config().Providers)), setTraceID(), smsHandler.ReceiveDeliveryReceipt)
+}
+
+// receiptSecrets maps each HTTP gateway that may post delivery receipts to
+// its secret.
+func receiptSecrets(cfg config.Providers) map[string]string {
+	secrets := make(map[string]string)
+	for _, gateway := range cfg.Gateways {
+		if gateway.Type == "http" && gateway.HTTP.ReceiptSecret != "" {
+			secrets[gateway.Name] = gateway.HTTP.ReceiptSecret
+		}
+	}
+	return secrets
 }
 
 func customErrorHandler(c *fiber.Ctx, err error) error {
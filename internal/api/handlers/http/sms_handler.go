@@ -1,6 +1,7 @@
 package http
 
 import (
+	"errors"
 	"net/http"
 	"sms/internal/api/dto"
 	smsdomain "sms/internal/domain/sms"
@@ -30,6 +31,7 @@ func NewSMSHandler(smsUseCase *sms.Service) *SMSHandler {
 // @Param sms body dto.SendSMSRequest true "SMS request payload"
 // @Success 201 {object} dto.SendSMSResponse
 // @Failure 400 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /sms [post]
 func (h *SMSHandler) SendSMS(c *fiber.Ctx) error {
@@ -42,6 +44,11 @@ func (h *SMSHandler) SendSMS(c *fiber.Ctx) error {
 		})
 	}
 
+	req.Receiver = smsdomain.NormalizeReceiver(req.Receiver)
+	if err := validate.Struct(req); err != nil {
+		return validationFailed(c, err)
+	}
+
 	smsMessage := &smsdomain.SMSMessage{
 		ID:        uuid.New().String(),
 		UserID:    req.UserID,
@@ -51,23 +58,71 @@ func (h *SMSHandler) SendSMS(c *fiber.Ctx) error {
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
+	if req.SendAt != nil {
+		smsMessage.SendAt = *req.SendAt
+	}
 
 	ctx := c.UserContext()
 	if err := h.smsUseCase.CreateAndBillSMS(ctx, smsMessage); err != nil {
+		if errors.Is(err, smsdomain.ErrContentTooLong) || errors.Is(err, smsdomain.ErrNoTariffRate) {
+			return c.Status(http.StatusBadRequest).JSON(dto.ErrorResponse{
+				Error:   "invalid_request",
+				Message: err.Error(),
+			})
+		}
 		return c.Status(http.StatusInternalServerError).JSON(dto.ErrorResponse{
 			Error:   "processing_error",
 			Message: "Failed to process SMS",
 		})
 	}
 
+	message := "SMS queued for processing"
+	if smsMessage.Status == smsdomain.SMSStatusScheduled {
+		message = "SMS scheduled"
+	}
 	return c.Status(http.StatusCreated).JSON(dto.SendSMSResponse{
 		ID:        smsMessage.ID,
 		Status:    string(smsMessage.Status),
 		CreatedAt: smsMessage.CreatedAt,
-		Message:   "SMS queued for processing",
+		Message:   message,
 	})
 }
 
+// CancelSMS godoc
+// @Summary Cancel a scheduled SMS
+// @Description Cancel an SMS sent with send_at before it is due. Once due it is billed and can no longer be cancelled.
+// @Tags SMS
+// @Produce json
+// @Param id path string true "SMS ID"
+// @Success 200 {object} dto.GetSMSResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /sms/{id}/cancel [post]
+func (h *SMSHandler) CancelSMS(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	smsMessage, err := h.smsUseCase.CancelSMS(ctx, c.Params("id"))
+	switch {
+	case err == nil:
+		return c.Status(http.StatusOK).JSON(toSMSResponse(smsMessage))
+	case errors.Is(err, smsdomain.ErrSMSNotFound):
+		return c.Status(http.StatusNotFound).JSON(dto.ErrorResponse{
+			Error:   "not_found",
+			Message: "SMS not found",
+		})
+	case errors.Is(err, smsdomain.ErrInvalidStatusTransition):
+		return c.Status(http.StatusConflict).JSON(dto.ErrorResponse{
+			Error:   "invalid_transition",
+			Message: "Only scheduled SMS that are not due yet can be cancelled",
+		})
+	default:
+		return c.Status(http.StatusInternalServerError).JSON(dto.ErrorResponse{
+			Error:   "processing_error",
+			Message: "Failed to cancel SMS",
+		})
+	}
+}
+
 // GetSMSByID godoc
 // @Summary Get an SMS message by ID
 // @Description Retrieve SMS message details by its ID
@@ -98,21 +153,206 @@ func (h *SMSHandler) GetSMSByID(c *fiber.Ctx) error {
 		})
 	}
 
+	return c.Status(http.StatusOK).JSON(toSMSResponse(smsMessage))
+}
+
+// ListSMS godoc
+// @Summary List SMS messages
+// @Description List SMS messages newest first, filtered and paged with an opaque cursor
+// @Tags SMS
+// @Produce json
+// @Param user_id query string false "User ID"
+// @Param status query string false "SMS status"
+// @Param receiver query string false "Receiver phone number"
+// @Param provider query string false "Provider that accepted the SMS"
+// @Param batch_id query string false "Bulk send the SMS belongs to"
+// @Param created_from query string false "Created at or after, RFC 3339"
+// @Param created_to query string false "Created before, RFC 3339"
+// @Param limit query int false "Page size, 1 to 100" default(20)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param with_total query bool false "Also count all matching messages"
+// @Success 200 {object} dto.ListSMSResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /sms [get]
+func (h *SMSHandler) ListSMS(c *fiber.Ctx) error {
+	var req dto.ListSMSRequest
+
+	if err := c.QueryParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(dto.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "Invalid query parameters",
+		})
+	}
+
+	if req.Receiver != "" {
+		req.Receiver = smsdomain.NormalizeReceiver(req.Receiver)
+	}
+	if err := validate.Struct(req); err != nil {
+		return validationFailed(c, err)
+	}
+
+	filter, page, err := toListQuery(req)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(dto.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+	}
+
+	ctx := c.UserContext()
+	result, err := h.smsUseCase.ListSMS(ctx, filter, page)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(dto.ErrorResponse{
+			Error:   "processing_error",
+			Message: "Failed to list SMS",
+		})
+	}
+
+	resp := dto.ListSMSResponse{
+		Items: make([]dto.GetSMSResponse, 0, len(result.Messages)),
+		Total: result.Total,
+	}
+	for _, message := range result.Messages {
+		resp.Items = append(resp.Items, toSMSResponse(message))
+	}
+	if result.Next != nil {
+		resp.NextCursor = result.Next.Encode()
+	}
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+// toListQuery turns a validated list request into the repository filter and
+// page.
+func toListQuery(req dto.ListSMSRequest) (smsdomain.ListFilter, smsdomain.Page, error) {
+	var filter smsdomain.ListFilter
+	if req.UserID != "" {
+		filter.UserID = &req.UserID
+	}
+	if req.Status != "" {
+		status := smsdomain.SMSStatus(req.Status)
+		filter.Status = &status
+	}
+	if req.Receiver != "" {
+		filter.Receiver = &req.Receiver
+	}
+	if req.Provider != "" {
+		filter.Provider = &req.Provider
+	}
+	if req.BatchID != "" {
+		filter.BatchID = &req.BatchID
+	}
+	if req.CreatedFrom != "" {
+		from, _ := time.Parse(time.RFC3339, req.CreatedFrom)
+		filter.CreatedFrom = &from
+	}
+	if req.CreatedTo != "" {
+		to, _ := time.Parse(time.RFC3339, req.CreatedTo)
+		filter.CreatedTo = &to
+	}
+
+	page := smsdomain.Page{Limit: req.Limit, WithTotal: req.WithTotal}
+	if req.Cursor != "" {
+		cursor, err := smsdomain.ParseCursor(req.Cursor)
+		if err != nil {
+			return filter, page, err
+		}
+		page.Cursor = cursor
+	}
+	return filter, page, nil
+}
+
+func toSMSResponse(smsMessage *smsdomain.SMSMessage) dto.GetSMSResponse {
 	var deliveredAt *time.Time
 	if !smsMessage.DeliveredAt.IsZero() {
 		deliveredAt = &smsMessage.DeliveredAt
 	}
+	var sendAt *time.Time
+	if !smsMessage.SendAt.IsZero() {
+		sendAt = &smsMessage.SendAt
+	}
 
-	return c.Status(http.StatusOK).JSON(dto.GetSMSResponse{
-		ID:          smsMessage.ID,
-		UserID:      smsMessage.UserID,
-		Content:     smsMessage.Content,
-		Receiver:    smsMessage.Receiver,
-		Provider:    smsMessage.Provider,
-		Status:      string(smsMessage.Status),
-		DeliveredAt: deliveredAt,
-		FailureCode: smsMessage.FailureCode,
-		CreatedAt:   smsMessage.CreatedAt,
-		UpdatedAt:   smsMessage.UpdatedAt,
-	})
+	return dto.GetSMSResponse{
+		ID:                smsMessage.ID,
+		UserID:            smsMessage.UserID,
+		Content:           smsMessage.Content,
+		Receiver:          smsMessage.Receiver,
+		Provider:          smsMessage.Provider,
+		ProviderMessageID: smsMessage.ProviderMessageID,
+		Status:            string(smsMessage.Status),
+		SegmentCount:      smsMessage.SegmentCount,
+		Amount:            smsMessage.Amount,
+		DeliveredAt:       deliveredAt,
+		FailureCode:       smsMessage.FailureCode,
+		BatchID:           smsMessage.BatchID,
+		SendAt:            sendAt,
+		CreatedAt:         smsMessage.CreatedAt,
+		UpdatedAt:         smsMessage.UpdatedAt,
+	}
+}
+
+// ReceiveDeliveryReceipt godoc
+// @Summary Receive a delivery receipt
+// @Description Callback for SMS gateways reporting the final delivery status of a message they accepted
+// @Tags DLR
+// @Accept json
+// @Produce json
+// @Param provider path string true "Gateway name"
+// @Param X-Signature header string true "Hex HMAC-SHA256 of the body keyed with the gateway's receipt secret"
+// @Param receipt body dto.DeliveryReceiptRequest true "Delivery receipt"
+// @Success 204
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /dlr/{provider} [post]
+func (h *SMSHandler) ReceiveDeliveryReceipt(c *fiber.Ctx) error {
+	var req dto.DeliveryReceiptRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(dto.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := validate.Struct(req); err != nil {
+		return validationFailed(c, err)
+	}
+
+	status, err := smsdomain.ParseReceiptStatus(req.Status)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(dto.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+	}
+
+	receipt := smsdomain.DeliveryReceipt{
+		Provider:  c.Params("provider"),
+		MessageID: req.MessageID,
+		Status:    status,
+		ErrorCode: req.ErrorCode,
+	}
+	if req.DoneAt != nil {
+		receipt.DoneAt = *req.DoneAt
+	}
+
+	ctx := c.UserContext()
+	if err := h.smsUseCase.ProcessDeliveryReceipt(ctx, receipt); err != nil {
+		if errors.Is(err, smsdomain.ErrUnknownReceipt) {
+			return c.Status(http.StatusNotFound).JSON(dto.ErrorResponse{
+				Error:   "not_found",
+				Message: "No SMS matches the receipt",
+			})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(dto.ErrorResponse{
+			Error:   "processing_error",
+			Message: "Failed to process delivery receipt",
+		})
+	}
+
+	return c.SendStatus(http.StatusNoContent)
 }
@@ -0,0 +1,89 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sms/internal/api/dto"
+	smsdomain "sms/internal/domain/sms"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// validate runs the validate tags of request DTOs. Errors name fields the
+// way they appear in JSON.
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	// a validator.New with valid tags never fails to register
+	_ = v.RegisterValidation("sms_status", func(fl validator.FieldLevel) bool {
+		return smsdomain.SMSStatus(fl.Field().String()).IsValid()
+	})
+	return v
+}
+
+// validationFailed answers 422 with every field and rule err reports.
+func validationFailed(c *fiber.Ctx, err error) error {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return err
+	}
+
+	fields := make([]dto.FieldError, 0, len(validationErrs))
+	for _, fieldErr := range validationErrs {
+		fields = append(fields, dto.FieldError{
+			Field:   fieldPath(fieldErr),
+			Rule:    fieldErr.Tag(),
+			Param:   fieldErr.Param(),
+			Message: ruleMessage(fieldErr),
+		})
+	}
+	return c.Status(http.StatusUnprocessableEntity).JSON(dto.ErrorResponse{
+		Error:   "validation_failed",
+		Message: "Request failed validation",
+		Code:    http.StatusUnprocessableEntity,
+		Fields:  fields,
+	})
+}
+
+// fieldPath names nested fields by their path, e.g. recipients[2].receiver.
+func fieldPath(fieldErr validator.FieldError) string {
+	_, path, _ := strings.Cut(fieldErr.Namespace(), ".")
+	return path
+}
+
+func ruleMessage(fieldErr validator.FieldError) string {
+	field := fieldPath(fieldErr)
+	switch fieldErr.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", field)
+	case "e164":
+		return fmt.Sprintf("%s must be a phone number in E.164 format, e.g. +989123456789", field)
+	case "uuid":
+		return fmt.Sprintf("%s must be a UUID", field)
+	case "sms_status":
+		return fmt.Sprintf("%s must be an SMS status such as sent or delivered", field)
+	case "datetime":
+		return fmt.Sprintf("%s must be an RFC 3339 timestamp", field)
+	case "min":
+		return fmt.Sprintf("%s must be at least %s", field, fieldErr.Param())
+	case "max":
+		if fieldErr.Kind() == reflect.String {
+			return fmt.Sprintf("%s must be at most %s characters long", field, fieldErr.Param())
+		}
+		return fmt.Sprintf("%s must be at most %s", field, fieldErr.Param())
+	default:
+		return fmt.Sprintf("%s failed the %s rule", field, fieldErr.Tag())
+	}
+}
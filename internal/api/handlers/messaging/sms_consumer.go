@@ -3,6 +3,7 @@ package messaging
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"sms/config"
 	smsDomain "sms/internal/domain/sms"
 	"sms/internal/usecase/sms"
@@ -33,7 +34,7 @@ func (h *ConsumerHandler) HandleDebitedSMS(ctx context.Context, message []byte)
 	err := json.Unmarshal(message, &msg)
 	if err != nil {
 		h.log.Error(ctx, "failed to unmarshal billing completed message", "error", err, "raw_message", string(message))
-		return err
+		return fmt.Errorf("%w: %v", rabbit.ErrMalformedMessage, err)
 	}
 
 	h.log.Info(ctx, "processing billing completed event", "sms_id", msg.SMSID, "transaction_id", msg.TransactionID, "user_id", msg.UserID)
@@ -48,28 +49,66 @@ func (h *ConsumerHandler) HandleDebitedSMS(ctx context.Context, message []byte)
 	return nil
 }
 
-func (h *ConsumerHandler) Run(ctx context.Context) error {
-	h.log.Info(ctx, "initializing SMS consumer")
+func (h *ConsumerHandler) HandleDebitedBatch(ctx context.Context, message []byte) error {
+	var msg smsDomain.BatchBillingCompleted
+	if err := json.Unmarshal(message, &msg); err != nil {
+		h.log.Error(ctx, "failed to unmarshal batch billing completed message", "error", err, "raw_message", string(message))
+		return fmt.Errorf("%w: %v", rabbit.ErrMalformedMessage, err)
+	}
+
+	if err := h.smsService.ProcessDebitedBatch(ctx, msg); err != nil {
+		h.log.Error(ctx, "failed to process batch billing completed event", "error", err, "batch_id", msg.BatchID, "transaction_id", msg.TransactionID)
+		return err
+	}
+	return nil
+}
+
+func (h *ConsumerHandler) HandleDispatch(ctx context.Context, message []byte) error {
+	var msg smsDomain.SMSDispatchRequested
+	if err := json.Unmarshal(message, &msg); err != nil {
+		h.log.Error(ctx, "failed to unmarshal dispatch message", "error", err, "raw_message", string(message))
+		return fmt.Errorf("%w: %v", rabbit.ErrMalformedMessage, err)
+	}
+
+	if err := h.smsService.DispatchBatchSMS(ctx, msg); err != nil {
+		h.log.Error(ctx, "failed to process dispatch event", "error", err, "sms_id", msg.SMSID, "transaction_id", msg.TransactionID)
+		return err
+	}
+	return nil
+}
+
+func (h *ConsumerHandler) HandleDeliveryRetry(ctx context.Context, message []byte) error {
+	var msg smsDomain.SMSDeliveryRetry
+	if err := json.Unmarshal(message, &msg); err != nil {
+		h.log.Error(ctx, "failed to unmarshal delivery retry message", "error", err, "raw_message", string(message))
+		return fmt.Errorf("%w: %v", rabbit.ErrMalformedMessage, err)
+	}
 
-	if err := h.consumer.SetQos(1); err != nil {
-		h.log.Error(ctx, "failed to set consumer QoS", "error", err)
+	if err := h.smsService.RetrySMSDelivery(ctx, msg); err != nil {
+		h.log.Error(ctx, "failed to process delivery retry event", "error", err, "sms_id", msg.SMSID, "attempt", msg.Attempt)
 		return err
 	}
-	h.log.Info(ctx, "consumer QoS set successfully", "prefetch_count", 1)
+	return nil
+}
+
+func (h *ConsumerHandler) Run(ctx context.Context) error {
+	h.log.Info(ctx, "initializing SMS consumer")
 
 	for _, queue := range h.config.RabbitMQ.Queues {
 		switch queue.Name {
 		//TODO: change to correct queue name and do not hardcode here
 		case rabbit.SMSBillingCompletedQueue:
-			h.consumer.Subscribe(queue.Name, func(message []byte) error {
-				return h.HandleDebitedSMS(ctx, message)
-			})
-			h.log.Info(ctx, "subscribed to queue successfully", "queue", queue.Name, "routing_key", queue.RoutingKey)
+			h.subscribe(ctx, queue.Name, queue.RoutingKey, queue.Consumer, h.HandleDebitedSMS)
+		case rabbit.BatchBillingCompletedQueue:
+			h.subscribe(ctx, queue.Name, queue.RoutingKey, queue.Consumer, h.HandleDebitedBatch)
 		default:
 			h.log.Info(ctx, "skipping unknown queue in configuration", "queue", queue.Name)
 		}
 	}
 
+	h.subscribe(ctx, rabbit.DeliveryRetryQueue, rabbit.DeliveryRetryRoutingKey, h.config.RabbitMQ.DeliveryRetry, h.HandleDeliveryRetry)
+	h.subscribe(ctx, rabbit.DispatchQueue, rabbit.DispatchRoutingKey, h.config.RabbitMQ.Dispatch, h.HandleDispatch)
+
 	h.log.Info(ctx, "starting SMS consumer workers")
 	if err := h.consumer.StartConsume(); err != nil {
 		h.log.Error(ctx, "failed to start consumer workers", "error", err)
@@ -78,6 +117,25 @@ func (h *ConsumerHandler) Run(ctx context.Context) error {
 	h.log.Info(ctx, "SMS consumer workers started successfully")
 
 	<-ctx.Done()
-	h.log.Info(ctx, "SMS consumer shutdown signal received")
+	h.log.Info(ctx, "SMS consumer shutdown signal received, draining in-flight messages", "timeout", h.config.RabbitMQ.DrainTimeout.String())
+
+	drainCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), h.config.RabbitMQ.DrainTimeout)
+	defer cancel()
+	if err := h.consumer.Shutdown(drainCtx); err != nil {
+		h.log.Error(ctx, "failed to drain in-flight messages", "error", err)
+		return err
+	}
+	h.log.Info(ctx, "SMS consumer drained")
 	return ctx.Err()
 }
+
+func (h *ConsumerHandler) subscribe(ctx context.Context, queue, routingKey string, c config.Consumer, handler rabbit.Handler) {
+	opts := rabbit.QueueOptions{
+		MaxRedeliveries: c.MaxRedeliveries,
+		RedeliveryDelay: c.RedeliveryDelay,
+		Workers:         c.Workers,
+		Prefetch:        c.Prefetch,
+	}
+	h.consumer.SubscribeWithOptions(queue, opts, handler)
+	h.log.Info(ctx, "subscribed to queue successfully", "queue", queue, "routing_key", routingKey, "max_redeliveries", c.MaxRedeliveries, "workers", c.Workers, "prefetch", c.Prefetch)
+}
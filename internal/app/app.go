@@ -2,15 +2,24 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
 	"sms/config"
+	smsdomain "sms/internal/domain/sms"
 	"sms/internal/infra/external"
 	"sms/internal/infra/messaging"
+	"sms/internal/infra/pricing"
 	"sms/internal/infra/storage"
 	"sms/internal/infra/storage/types"
 	"sms/internal/usecase/sms"
+	"sms/pkg/health"
 	"sms/pkg/logger"
 	"sms/pkg/postgres"
 	"sms/pkg/rabbit"
+	"sms/pkg/tracing"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -20,9 +29,15 @@ type app struct {
 	cfg        config.Config
 	rabbitConn *rabbit.RabbitConn
 	smsService *sms.Service
+	gateways   []io.Closer
+	health     *health.Checker
 	logger     *logger.Logger
 }
 
+// healthCheckTimeout bounds a readiness probe, so a hung dependency is
+// reported as down instead of stalling the probe.
+const healthCheckTimeout = 2 * time.Second
+
 func (a *app) Config() config.Config {
 	return a.cfg
 }
@@ -39,6 +54,27 @@ func (a *app) SMSService(ctx context.Context) *sms.Service {
 	return a.smsService
 }
 
+func (a *app) Health() *health.Checker {
+	return a.health
+}
+
+// Close closes the gateway connections, then the RabbitMQ connection and
+// then the database pool. Gateways go first, as receipts they deliver are
+// stored and published. Nothing may send, publish or query after it returns.
+func (a *app) Close() error {
+	var errs []error
+	for _, gateway := range a.gateways {
+		errs = append(errs, gateway.Close())
+	}
+	errs = append(errs, a.rabbitConn.Close())
+
+	sqlDB, err := a.db.DB()
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	return errors.Join(append(errs, sqlDB.Close())...)
+}
+
 func NewApp(cfg config.Config) (App, error) {
 	a := &app{
 		cfg:    cfg,
@@ -56,7 +92,20 @@ func NewApp(cfg config.Config) (App, error) {
 		return nil, err
 	}
 
-	a.smsService = setService(a.db, a.rabbitConn, a.logger)
+	smsService, gateways, err := setService(a.db, a.rabbitConn, a.cfg, a.logger)
+	if err != nil {
+		return nil, err
+	}
+	a.smsService = smsService
+	for _, gateway := range gateways {
+		if closer, ok := gateway.Provider.(io.Closer); ok {
+			a.gateways = append(a.gateways, closer)
+		}
+	}
+	a.health = health.NewChecker(healthCheckTimeout).
+		Add("database", a.checkDB).
+		Add("rabbitmq", a.rabbitConn.Check).
+		Add("providers", external.CheckGateways(gateways))
 	return a, nil
 }
 
@@ -68,11 +117,88 @@ func NewMustApp(cfg config.Config) App {
 	return app
 }
 
-func setService(db *gorm.DB, rabbitConn *rabbit.RabbitConn, log *logger.Logger) *sms.Service {
+func setService(db *gorm.DB, rabbitConn *rabbit.RabbitConn, cfg config.Config, log *logger.Logger) (*sms.Service, []external.NamedProvider, error) {
+	switch mode := smsdomain.BillingMode(cfg.Bulk.BillingMode); mode {
+	case smsdomain.BillingPerMessage:
+	case smsdomain.BillingPerBatch:
+		// the batch debit is answered on its own queue
+		if !slices.ContainsFunc(cfg.RabbitMQ.Queues, func(q config.Queue) bool { return q.Name == rabbit.BatchBillingCompletedQueue }) {
+			return nil, nil, fmt.Errorf("bulk billing mode %q needs the %s queue", mode, rabbit.BatchBillingCompletedQueue)
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown bulk billing mode %q", mode)
+	}
+	if source := cfg.Pricing.Source; source != "config" && source != "database" {
+		return nil, nil, fmt.Errorf("unknown pricing source %q", source)
+	}
 	smsRepo := storage.NewSMSRepository(db)
+	outboxRepo := storage.NewOutboxRepository(db)
+	inboxRepo := storage.NewInboxRepository(db)
 	smsPublisher := messaging.NewSMSPublisher(rabbitConn, log)
-	smsProvider := external.DefaultSMSProvider()
-	return sms.NewSMSService(smsRepo, smsPublisher, smsProvider, db, log)
+
+	// receipts only arrive for messages sent through the service, so it is
+	// set by the time the handler runs
+	var service *sms.Service
+	receipts := func(ctx context.Context, receipt smsdomain.DeliveryReceipt) error {
+		return service.ProcessDeliveryReceipt(ctx, receipt)
+	}
+
+	smsProvider, gateways, err := newSMSProvider(db, cfg.Providers, receipts, log)
+	if err != nil {
+		return nil, nil, err
+	}
+	service = sms.NewSMSService(smsRepo, outboxRepo, inboxRepo, smsPublisher, smsProvider, postgres.NewTransactor(db), log).
+		WithTariffs(newTariffRepo(db, cfg.Pricing)).
+		WithRetryPolicy(newRetryPolicy(cfg.Retry)).
+		WithOutboxPolicy(smsdomain.OutboxPolicy{
+			MaxAttempts:  cfg.Outbox.MaxAttempts,
+			ClaimTimeout: cfg.Outbox.ClaimTimeout,
+		}).
+		WithBatches(storage.NewBatchRepository(db), smsdomain.BulkPolicy{
+			BillingMode:     smsdomain.BillingMode(cfg.Bulk.BillingMode),
+			InsertBatchSize: cfg.Bulk.InsertBatchSize,
+		}).
+		WithCampaigns(storage.NewCampaignRepository(db), smsdomain.CampaignPolicy{
+			ChunkSize: cfg.Campaigns.ChunkSize,
+			MaxRows:   cfg.Campaigns.MaxRows,
+		})
+	return service, gateways, nil
+}
+
+func newRetryPolicy(cfg config.Retry) smsdomain.RetryPolicy {
+	return smsdomain.RetryPolicy{
+		MaxAttempts:  cfg.MaxAttempts,
+		InitialDelay: cfg.InitialDelay,
+		Multiplier:   cfg.Multiplier,
+		MaxDelay:     cfg.MaxDelay,
+	}
+}
+
+func newTariffRepo(db *gorm.DB, cfg config.Pricing) smsdomain.TariffRepo {
+	if cfg.Source == "database" {
+		return storage.NewTariffRepository(db, cfg.DefaultPlan)
+	}
+
+	plans := make([]smsdomain.Tariff, 0, len(cfg.Plans))
+	for _, plan := range cfg.Plans {
+		tariff := smsdomain.Tariff{
+			Plan:                   plan.Name,
+			DefaultPricePerSegment: plan.DefaultPrice,
+		}
+		for _, rate := range plan.Rates {
+			tariff.Rates = append(tariff.Rates, smsdomain.TariffRate{
+				Prefix:          rate.Prefix,
+				PricePerSegment: rate.Price,
+			})
+		}
+		plans = append(plans, tariff)
+	}
+
+	userPlans := make(map[string]string, len(cfg.Users))
+	for _, user := range cfg.Users {
+		userPlans[user.UserID] = user.Plan
+	}
+	return pricing.NewStaticTariffRepo(plans, userPlans, cfg.DefaultPlan)
 }
 
 func (a *app) setDB() error {
@@ -87,22 +213,55 @@ func (a *app) setDB() error {
 	if err != nil {
 		return err
 	}
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		return err
+	}
 	// Auto migrate
-	err = postgres.Migrate(db, &types.SMS{})
+	err = postgres.Migrate(db, &types.SMS{}, &types.OutboxEvent{}, &types.InboxEvent{},
+		&types.TariffPlan{}, &types.TariffRate{}, &types.UserTariff{}, &types.DeliveryAttempt{}, &types.SMSBatch{},
+		&types.Campaign{}, &types.CampaignRecipient{})
 	if err != nil {
 		return err
 	}
+	if err := storage.MigrateSMSIndexes(db); err != nil {
+		return err
+	}
 
 	a.db = db
 	return nil
 }
 
+// checkDB pings the database through the pool gorm uses.
+func (a *app) checkDB(ctx context.Context) error {
+	sqlDB, err := a.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
 func (a *app) setRabbitConn() error {
-	rabbitConn := rabbit.NewRabbitConn(a.cfg.RabbitMQ.URI)
+	if mode := a.cfg.RabbitMQ.Reconnect.PublishMode; mode != "block" && mode != "fail" {
+		return fmt.Errorf("unknown rabbitmq publish mode %q", mode)
+	}
+	rabbitConn, err := rabbit.NewRabbitConn(a.cfg.RabbitMQ.URI, newRabbitOptions(a.cfg.RabbitMQ.Reconnect, a.logger))
+	if err != nil {
+		return err
+	}
 	a.rabbitConn = rabbitConn
 	return nil
 }
 
+func newRabbitOptions(cfg config.Reconnect, log *logger.Logger) rabbit.Options {
+	return rabbit.Options{
+		ReconnectDelay:    cfg.InitialDelay,
+		MaxReconnectDelay: cfg.MaxDelay,
+		BlockPublish:      cfg.PublishMode == "block",
+		PublishTimeout:    cfg.PublishTimeout,
+		Logger:            log,
+	}
+}
+
 func (a *app) initQueues() error {
 	for _, q := range a.cfg.RabbitMQ.Queues {
 		err := a.rabbitConn.DeclareBindQueue(q.Name, q.Exchange, q.RoutingKey)
@@ -110,5 +269,21 @@ func (a *app) initQueues() error {
 			return err
 		}
 	}
+
+	err := a.rabbitConn.DeclareBindQueue(rabbit.DeliveryRetryQueue, rabbit.Exchange, rabbit.DeliveryRetryRoutingKey)
+	if err != nil {
+		return err
+	}
+	if err := a.rabbitConn.DeclareBindQueue(rabbit.DispatchQueue, rabbit.Exchange, rabbit.DispatchRoutingKey); err != nil {
+		return err
+	}
+	// delays of older policies are declared by the publisher once a retry
+	// still waiting in the outbox uses them
+	for _, delay := range newRetryPolicy(a.cfg.Retry).Delays() {
+		queue := rabbit.DelayQueueName(rabbit.DeliveryRetryQueue, delay)
+		if err := a.rabbitConn.DeclareDelayQueue(queue, delay, rabbit.Exchange, rabbit.DeliveryRetryRoutingKey); err != nil {
+			return err
+		}
+	}
 	return nil
 }
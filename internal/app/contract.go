@@ -4,6 +4,7 @@ import (
 	"context"
 	"sms/config"
 	"sms/internal/usecase/sms"
+	"sms/pkg/health"
 	"sms/pkg/rabbit"
 
 	"gorm.io/gorm"
@@ -14,4 +15,9 @@ type App interface {
 	DB() *gorm.DB
 	RabbitConn() *rabbit.RabbitConn
 	SMSService(ctx context.Context) *sms.Service
+	// Health checks the database, RabbitMQ and the SMS gateways.
+	Health() *health.Checker
+	// Close releases the gateway connections, the RabbitMQ connection and
+	// the database pool.
+	Close() error
 }
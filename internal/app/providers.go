@@ -0,0 +1,120 @@
+package app
+
+import (
+	"fmt"
+	"sms/config"
+	"sms/internal/domain/sms"
+	"sms/internal/infra/external"
+	"sms/internal/infra/storage"
+	"sms/pkg/circuitbreaker"
+	"sms/pkg/logger"
+
+	"gorm.io/gorm"
+)
+
+// newSMSProvider also returns the configured gateways so their health can
+// be reported.
+func newSMSProvider(db *gorm.DB, cfg config.Providers, receipts external.ReceiptHandler, log *logger.Logger) (sms.SMSProvider, []external.NamedProvider, error) {
+	if len(cfg.Failover) == 0 && len(cfg.Routes) == 0 {
+		return external.NewInstrumentedProvider("default", external.DefaultSMSProvider()), nil, nil
+	}
+
+	// one breaker per gateway, shared by every chain it takes part in
+	gateways := make(map[string]external.NamedProvider, len(cfg.Gateways))
+	gatewayList := make([]external.NamedProvider, 0, len(cfg.Gateways))
+	for _, gw := range cfg.Gateways {
+		provider, err := newGateway(gw, receipts)
+		if err != nil {
+			return nil, nil, err
+		}
+		gateways[gw.Name] = external.NamedProvider{
+			Name:     gw.Name,
+			Provider: external.NewInstrumentedProvider(gw.Name, provider),
+			Breaker:  circuitbreaker.New(cfg.CircuitBreaker.FailureThreshold, cfg.CircuitBreaker.OpenTimeout),
+		}
+		gatewayList = append(gatewayList, gateways[gw.Name])
+	}
+
+	recorder := storage.NewAttemptRepository(db)
+	newChain := func(names []string) (sms.SMSProvider, error) {
+		chain := make([]external.NamedProvider, 0, len(names))
+		for _, name := range names {
+			gw, ok := gateways[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown gateway: %s", name)
+			}
+			chain = append(chain, gw)
+		}
+		return external.NewFailoverProvider(chain, external.BreakerOptions{}, recorder, log), nil
+	}
+
+	var fallback sms.SMSProvider
+	if len(cfg.Failover) > 0 {
+		chain, err := newChain(cfg.Failover)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failover: %w", err)
+		}
+		fallback = chain
+	}
+
+	if len(cfg.Routes) == 0 {
+		return fallback, gatewayList, nil
+	}
+
+	routes := make([]external.Route, 0, len(cfg.Routes))
+	for _, route := range cfg.Routes {
+		chain, err := newChain(route.Providers)
+		if err != nil {
+			return nil, nil, fmt.Errorf("route %s: %w", route.Name, err)
+		}
+		routes = append(routes, external.Route{
+			Name:     route.Name,
+			Prefixes: route.Prefixes,
+			Provider: chain,
+		})
+	}
+	return external.NewPrefixRouter(routes, fallback), gatewayList, nil
+}
+
+func newGateway(gw config.Gateway, receipts external.ReceiptHandler) (sms.SMSProvider, error) {
+	switch gw.Type {
+	case "http":
+		return external.NewHTTPProvider(external.HTTPProviderConfig{
+			Name:         gw.Name,
+			URL:          gw.HTTP.URL,
+			Method:       gw.HTTP.Method,
+			Headers:      gw.HTTP.Headers,
+			ContentType:  gw.HTTP.ContentType,
+			BodyTemplate: gw.HTTP.BodyTemplate,
+			Timeout:      gw.HTTP.Timeout,
+			Response: external.HTTPResponseMapping{
+				SuccessField:   gw.HTTP.Response.SuccessField,
+				SuccessValue:   gw.HTTP.Response.SuccessValue,
+				MessageIDField: gw.HTTP.Response.MessageIDField,
+				ErrorCodeField: gw.HTTP.Response.ErrorCodeField,
+				ErrorCodes:     gw.HTTP.Response.ErrorCodes,
+			},
+		})
+	case "smpp":
+		return external.NewSMPPProvider(external.SMPPProviderConfig{
+			Name:                gw.Name,
+			Addr:                gw.SMPP.Addr,
+			SystemID:            gw.SMPP.SystemID,
+			Password:            gw.SMPP.Password,
+			SystemType:          gw.SMPP.SystemType,
+			SourceAddr:          gw.SMPP.SourceAddr,
+			WindowSize:          gw.SMPP.WindowSize,
+			EnquireLinkInterval: gw.SMPP.EnquireLinkInterval,
+			Timeout:             gw.SMPP.Timeout,
+			Receipts:            receipts,
+		}), nil
+	case "mock":
+		return external.MockSMSProvider(), nil
+	case "random_fail":
+		return external.RandomFailSMSProvider(gw.FailProbability), nil
+	case "always_fail":
+		return external.AlwaysFailSMSProvider(), nil
+	default:
+		return nil, fmt.Errorf("unknown gateway type %q for %s", gw.Type, gw.Name)
+	}
+}
@@ -0,0 +1,73 @@
+package sms
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BillingMode says how the SMS of a batch are billed.
+type BillingMode string
+
+const (
+	// BillingPerMessage requests a debit per SMS, like single sends. It
+	// only uses the single debit contract and is the default.
+	BillingPerMessage BillingMode = "message"
+	// BillingPerBatch requests one debit for the whole batch. The billing
+	// service has to consume RequestBatchBilling from
+	// "billing.debit.batch.request", debit Amount once and answer with
+	// BatchBillingCompleted on "billing.debit.batch.completed", carrying
+	// the batch ID and the debit's transaction ID. SMS of the batch that
+	// fail are refunded one by one against that transaction.
+	BillingPerBatch BillingMode = "batch"
+)
+
+// BulkPolicy configures bulk sends.
+type BulkPolicy struct {
+	BillingMode BillingMode
+	// InsertBatchSize is how many SMS rows go into one INSERT.
+	InsertBatchSize int
+}
+
+// SMSBatch groups the SMS created by one bulk send.
+type SMSBatch struct {
+	ID          string
+	UserID      string
+	Total       int
+	Amount      int64
+	BillingMode BillingMode
+	CreatedAt   time.Time
+}
+
+type BatchRepo interface {
+	Create(ctx context.Context, batch *SMSBatch) error
+	Get(ctx context.Context, ID string) (*SMSBatch, error)
+	// StatusCounts counts the SMS of a batch by status.
+	StatusCounts(ctx context.Context, batchID string) (map[SMSStatus]int64, error)
+	WithTx(tx *gorm.DB) BatchRepo
+}
+
+// BatchProgress is how far the SMS of a batch have come.
+type BatchProgress struct {
+	Batch  *SMSBatch
+	Counts map[SMSStatus]int64
+}
+
+// Processed counts the SMS that were handed to a provider or failed for
+// good; only a delivery receipt may still change them.
+func (p BatchProgress) Processed() int64 {
+	var processed int64
+	for status, count := range p.Counts {
+		switch status {
+		case SMSStatusPending, SMSStatusBillingRequested, SMSStatusBilled, SMSStatusSending, SMSStatusRetryScheduled:
+		default:
+			processed += count
+		}
+	}
+	return processed
+}
+
+func (p BatchProgress) Done() bool {
+	return p.Processed() >= int64(p.Batch.Total)
+}
@@ -0,0 +1,168 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type CampaignStatus string
+
+const (
+	// CampaignStatusUploaded campaigns wait for their CSV to be parsed.
+	CampaignStatusUploaded  CampaignStatus = "uploaded"
+	CampaignStatusScheduled CampaignStatus = "scheduled"
+	CampaignStatusRunning   CampaignStatus = "running"
+	CampaignStatusPaused    CampaignStatus = "paused"
+	CampaignStatusCompleted CampaignStatus = "completed"
+	CampaignStatusCancelled CampaignStatus = "cancelled"
+	// CampaignStatusFailed campaigns had a CSV that could not be used at all.
+	CampaignStatusFailed CampaignStatus = "failed"
+)
+
+var campaignTransitions = map[CampaignStatus][]CampaignStatus{
+	CampaignStatusUploaded:  {CampaignStatusScheduled, CampaignStatusRunning, CampaignStatusFailed, CampaignStatusCancelled},
+	CampaignStatusScheduled: {CampaignStatusRunning, CampaignStatusPaused, CampaignStatusCancelled},
+	CampaignStatusRunning:   {CampaignStatusPaused, CampaignStatusCompleted, CampaignStatusCancelled},
+	CampaignStatusPaused:    {CampaignStatusScheduled, CampaignStatusRunning, CampaignStatusCancelled},
+	CampaignStatusCompleted: {},
+	CampaignStatusCancelled: {},
+	CampaignStatusFailed:    {},
+}
+
+var (
+	ErrCampaignNotFound          = errors.New("campaign not found")
+	ErrInvalidCampaignTransition = errors.New("invalid campaign status transition")
+	// ErrInvalidCampaignCSV is returned for CSV files no row can be read from.
+	ErrInvalidCampaignCSV = errors.New("invalid campaign CSV")
+)
+
+// CampaignPolicy configures how campaigns are parsed and sent.
+type CampaignPolicy struct {
+	// ChunkSize is how many rows are turned into SMS per transaction; a
+	// paused or cancelled campaign stops after the current chunk.
+	ChunkSize int
+	// MaxRows caps the data rows of one CSV.
+	MaxRows int
+}
+
+// ReceiverColumn is the CSV column holding the phone number. The other
+// columns are template variables.
+const ReceiverColumn = "receiver"
+
+func (s CampaignStatus) CanTransitionTo(to CampaignStatus) bool {
+	for _, next := range campaignTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// RecipientStatus is how far one CSV row of a campaign has come.
+type RecipientStatus string
+
+const (
+	RecipientStatusPending RecipientStatus = "pending"
+	// RecipientStatusQueued rows have their SMS created and billing requested.
+	RecipientStatusQueued RecipientStatus = "queued"
+	// RecipientStatusInvalid rows failed validation when the CSV was parsed.
+	RecipientStatusInvalid RecipientStatus = "invalid"
+	// RecipientStatusFailed rows passed validation but could no longer be
+	// billed when their turn came, e.g. after a tariff change.
+	RecipientStatusFailed    RecipientStatus = "failed"
+	RecipientStatusCancelled RecipientStatus = "cancelled"
+)
+
+// Campaign sends a templated SMS to every valid row of an uploaded CSV.
+type Campaign struct {
+	ID       string
+	UserID   string
+	Name     string
+	Template string
+	Status   CampaignStatus
+	// StartAt delays sending; the zero value starts once the CSV is parsed.
+	StartAt time.Time
+	// Source is the uploaded CSV, kept until it is parsed.
+	Source []byte
+	// Error says why a failed campaign could not be parsed.
+	Error string
+
+	TotalRows     int
+	InvalidRows   int
+	QueuedRows    int
+	FailedRows    int
+	CancelledRows int
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (c *Campaign) TransitionTo(status CampaignStatus) error {
+	if !c.Status.CanTransitionTo(status) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidCampaignTransition, c.Status, status)
+	}
+	c.Status = status
+	c.UpdatedAt = time.Now()
+	return nil
+}
+
+// Start moves a parsed or resumed campaign to scheduled while StartAt is
+// ahead and to running otherwise.
+func (c *Campaign) Start(now time.Time) error {
+	if c.StartAt.After(now) {
+		return c.TransitionTo(CampaignStatusScheduled)
+	}
+	return c.TransitionTo(CampaignStatusRunning)
+}
+
+// PendingRows counts the rows still waiting for their SMS.
+func (c *Campaign) PendingRows() int {
+	return c.TotalRows - c.InvalidRows - c.QueuedRows - c.FailedRows - c.CancelledRows
+}
+
+// CampaignRecipient is one CSV row. Its SMS takes the recipient's ID.
+type CampaignRecipient struct {
+	ID         string
+	CampaignID string
+	// Line is where the row starts in the CSV, the header being line 1.
+	Line      int
+	Receiver  string
+	Variables map[string]string
+	Status    RecipientStatus
+	Error     string
+}
+
+type CampaignRepo interface {
+	Create(ctx context.Context, campaign *Campaign) error
+	Get(ctx context.Context, ID string) (*Campaign, error)
+	// Lock reads a campaign and locks it until the transaction ends.
+	Lock(ctx context.Context, ID string) (*Campaign, error)
+	// ClaimNext locks the oldest campaign in status whose StartAt is not
+	// after dueBy, skipping campaigns other workers hold. A zero dueBy
+	// ignores StartAt. It returns nil when there is none.
+	ClaimNext(ctx context.Context, status CampaignStatus, dueBy time.Time) (*Campaign, error)
+	Update(ctx context.Context, campaign *Campaign) error
+
+	AddRecipients(ctx context.Context, recipients []*CampaignRecipient, batchSize int) error
+	// PendingRecipients returns up to limit pending rows in CSV order.
+	PendingRecipients(ctx context.Context, campaignID string, limit int) ([]*CampaignRecipient, error)
+	UpdateRecipients(ctx context.Context, recipients []*CampaignRecipient) error
+	// CancelPending cancels every pending row and returns how many there were.
+	CancelPending(ctx context.Context, campaignID string) (int64, error)
+	// InvalidRecipients returns up to limit invalid rows after line afterLine.
+	InvalidRecipients(ctx context.Context, campaignID string, afterLine, limit int) ([]*CampaignRecipient, error)
+	// SMSStatusCounts counts the SMS of a campaign by status.
+	SMSStatusCounts(ctx context.Context, campaignID string) (map[SMSStatus]int64, error)
+	WithTx(tx *gorm.DB) CampaignRepo
+}
+
+// CampaignProgress is a campaign with the SMS of its queued rows counted by
+// status.
+type CampaignProgress struct {
+	Campaign *Campaign
+	SMS      map[SMSStatus]int64
+}
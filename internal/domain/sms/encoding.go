@@ -0,0 +1,195 @@
+package sms
+
+import (
+	"errors"
+	"hash/fnv"
+	"unicode/utf16"
+)
+
+type Encoding string
+
+const (
+	EncodingGSM7 Encoding = "GSM-7"
+	EncodingUCS2 Encoding = "UCS-2"
+)
+
+const (
+	// MaxSegments caps how many concatenated parts a single SMS may use.
+	MaxSegments = 10
+
+	gsm7SingleLimit = 160
+	gsm7PartLimit   = 153
+	ucs2SingleLimit = 70
+	ucs2PartLimit   = 67
+)
+
+var ErrContentTooLong = errors.New("sms content exceeds the maximum number of segments")
+
+// gsm7Basic is the GSM 03.38 default alphabet, without the escape character.
+const gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// gsm7Extension holds the characters sent as escape + code, taking two septets.
+const gsm7Extension = "\f^{}\\[~]|€"
+
+// gsm7ExtensionCodes are the codes following the escape for gsm7Extension.
+var gsm7ExtensionCodes = []byte{0x0A, 0x14, 0x28, 0x29, 0x2F, 0x3C, 0x3D, 0x3E, 0x40, 0x65}
+
+const gsm7Escape = 0x1B
+
+var (
+	gsm7Septets = buildGSM7Table()
+	gsm7Codes   = buildGSM7Codes()
+)
+
+func buildGSM7Table() map[rune]int {
+	table := make(map[rune]int)
+	for _, r := range gsm7Basic {
+		table[r] = 1
+	}
+	for _, r := range gsm7Extension {
+		table[r] = 2
+	}
+	return table
+}
+
+func buildGSM7Codes() map[rune][]byte {
+	codes := make(map[rune][]byte)
+	for i, r := range []rune(gsm7Basic) {
+		code := byte(i)
+		// gsm7Basic skips the escape code
+		if code >= gsm7Escape {
+			code++
+		}
+		codes[r] = []byte{code}
+	}
+	for i, r := range []rune(gsm7Extension) {
+		codes[r] = []byte{gsm7Escape, gsm7ExtensionCodes[i]}
+	}
+	return codes
+}
+
+// Segment is one part of a possibly concatenated SMS.
+type Segment struct {
+	Sequence int
+	Text     string
+	// UDH is the concatenation user data header; nil for single-part messages.
+	UDH []byte
+}
+
+type EncodedContent struct {
+	Encoding  Encoding
+	Reference byte
+	Segments  []Segment
+}
+
+// DetectEncoding returns GSM-7 when every character is in the GSM 03.38
+// alphabet and UCS-2 otherwise.
+func DetectEncoding(content string) Encoding {
+	for _, r := range content {
+		if _, ok := gsm7Septets[r]; !ok {
+			return EncodingUCS2
+		}
+	}
+	return EncodingGSM7
+}
+
+// EncodeContent splits content into segments sized for its encoding. Parts of
+// a multipart message carry a UDH with the given concatenation reference.
+func EncodeContent(content string, reference byte) EncodedContent {
+	encoding := DetectEncoding(content)
+	singleLimit, partLimit := gsm7SingleLimit, gsm7PartLimit
+	if encoding == EncodingUCS2 {
+		singleLimit, partLimit = ucs2SingleLimit, ucs2PartLimit
+	}
+
+	result := EncodedContent{Encoding: encoding, Reference: reference}
+	if contentUnits(content, encoding) <= singleLimit {
+		result.Segments = []Segment{{Sequence: 1, Text: content}}
+		return result
+	}
+
+	var (
+		texts []string
+		start int
+		used  int
+	)
+	for i, r := range content {
+		units := runeUnits(r, encoding)
+		// never split an escape sequence or a surrogate pair across parts
+		if used+units > partLimit {
+			texts = append(texts, content[start:i])
+			start, used = i, 0
+		}
+		used += units
+	}
+	texts = append(texts, content[start:])
+
+	for i, text := range texts {
+		result.Segments = append(result.Segments, Segment{
+			Sequence: i + 1,
+			Text:     text,
+			UDH:      []byte{0x05, 0x00, 0x03, reference, byte(len(texts)), byte(i + 1)},
+		})
+	}
+	return result
+}
+
+// EncodeText returns text as sent on the wire: one GSM 03.38 code per octet
+// (unpacked septets) for GSM-7, big-endian UTF-16 for UCS-2.
+func EncodeText(text string, encoding Encoding) []byte {
+	if encoding == EncodingGSM7 {
+		out := make([]byte, 0, len(text))
+		for _, r := range text {
+			out = append(out, gsm7Codes[r]...)
+		}
+		return out
+	}
+
+	units := utf16.Encode([]rune(text))
+	out := make([]byte, 0, 2*len(units))
+	for _, u := range units {
+		out = append(out, byte(u>>8), byte(u))
+	}
+	return out
+}
+
+// CountSegments returns how many parts content needs.
+func CountSegments(content string) int {
+	return len(EncodeContent(content, 0).Segments)
+}
+
+func contentUnits(content string, encoding Encoding) int {
+	total := 0
+	for _, r := range content {
+		total += runeUnits(r, encoding)
+	}
+	return total
+}
+
+// runeUnits returns septets for GSM-7 and UTF-16 code units for UCS-2.
+func runeUnits(r rune, encoding Encoding) int {
+	if encoding == EncodingGSM7 {
+		return gsm7Septets[r]
+	}
+	return utf16.RuneLen(r)
+}
+
+// Encode splits the message content using a concatenation reference derived
+// from the message ID, so every part of one SMS shares the same reference.
+func (s *SMSMessage) Encode() EncodedContent {
+	hash := fnv.New32a()
+	hash.Write([]byte(s.ID))
+	return EncodeContent(s.Content, byte(hash.Sum32()))
+}
+
+// SetSegmentCount records how many parts the content needs and rejects
+// content longer than MaxSegments.
+func (s *SMSMessage) SetSegmentCount() error {
+	count := CountSegments(s.Content)
+	if count > MaxSegments {
+		return ErrContentTooLong
+	}
+	s.SegmentCount = count
+	return nil
+}
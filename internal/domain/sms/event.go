@@ -2,6 +2,8 @@ package sms
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -11,6 +13,11 @@ const (
 	EventTypeBillingRequested EventType = "BillingRequested"
 	EventTypeBillingCompleted EventType = "BillingCompleted"
 	EventTypeBillingRefunded  EventType = "BillingRefunded"
+	EventTypeDeliveryRetry    EventType = "DeliveryRetry"
+
+	EventTypeBatchBillingRequested EventType = "BatchBillingRequested"
+	EventTypeBatchBillingCompleted EventType = "BatchBillingCompleted"
+	EventTypeDispatchRequested     EventType = "DispatchRequested"
 )
 
 type EventPublisher interface {
@@ -66,6 +73,7 @@ func (e SMSBillingCompleted) Timestamp() time.Time {
 
 type RequestBillingRefund struct {
 	TransactionID string    `json:"transaction_id"`
+	Amount        int64     `json:"amount"`
 	TimeStamp     time.Time `json:"timestamp"`
 }
 
@@ -80,3 +88,142 @@ func (e RequestBillingRefund) AggregateID() string {
 func (e RequestBillingRefund) Timestamp() time.Time {
 	return e.TimeStamp
 }
+
+// SMSDeliveryRetry asks for another delivery attempt of a billed SMS once
+// Delay has passed.
+type SMSDeliveryRetry struct {
+	SMSID         string `json:"sms_id"`
+	TransactionID string `json:"transaction_id"`
+	// Attempt is the number of the attempt to make, 2 for the first retry.
+	Attempt   int           `json:"attempt"`
+	Delay     time.Duration `json:"delay"`
+	TimeStamp time.Time     `json:"timestamp"`
+}
+
+func (e SMSDeliveryRetry) EventType() EventType {
+	return EventTypeDeliveryRetry
+}
+
+func (e SMSDeliveryRetry) AggregateID() string {
+	return e.SMSID
+}
+
+func (e SMSDeliveryRetry) Timestamp() time.Time {
+	return e.TimeStamp
+}
+
+// RequestBatchBilling asks for a single debit covering every SMS of a batch;
+// it is only sent with BillingPerBatch, whose contract is described there.
+type RequestBatchBilling struct {
+	UserID    string    `json:"user_id"`
+	BatchID   string    `json:"batch_id"`
+	Count     int       `json:"count"`
+	Amount    int64     `json:"amount"`
+	TimeStamp time.Time `json:"timestamp"`
+}
+
+func (e RequestBatchBilling) EventType() EventType {
+	return EventTypeBatchBillingRequested
+}
+
+func (e RequestBatchBilling) AggregateID() string {
+	return e.BatchID
+}
+
+func (e RequestBatchBilling) Timestamp() time.Time {
+	return e.TimeStamp
+}
+
+// BatchBillingCompleted is the billing service's answer to
+// RequestBatchBilling.
+type BatchBillingCompleted struct {
+	UserID        string    `json:"user_id"`
+	BatchID       string    `json:"batch_id"`
+	Amount        int64     `json:"amount"`
+	TransactionID string    `json:"transaction_id"`
+	TimeStamp     time.Time `json:"timestamp"`
+}
+
+func (e BatchBillingCompleted) EventType() EventType {
+	return EventTypeBatchBillingCompleted
+}
+
+func (e BatchBillingCompleted) AggregateID() string {
+	return e.BatchID
+}
+
+func (e BatchBillingCompleted) Timestamp() time.Time {
+	return e.TimeStamp
+}
+
+// SMSDispatchRequested hands one SMS of a billed batch to the workers, so
+// a large batch is sent in parallel rather than in one transaction.
+// Refunds of a failed SMS refer to the batch's TransactionID.
+type SMSDispatchRequested struct {
+	SMSID         string    `json:"sms_id"`
+	TransactionID string    `json:"transaction_id"`
+	TimeStamp     time.Time `json:"timestamp"`
+}
+
+func (e SMSDispatchRequested) EventType() EventType {
+	return EventTypeDispatchRequested
+}
+
+func (e SMSDispatchRequested) AggregateID() string {
+	return e.SMSID
+}
+
+func (e SMSDispatchRequested) Timestamp() time.Time {
+	return e.TimeStamp
+}
+
+// DecodeEvent rebuilds a domain event from its JSON payload, e.g. when
+// relaying events stored in the outbox.
+func DecodeEvent(eventType EventType, payload []byte) (DomainEvent, error) {
+	switch eventType {
+	case EventTypeBillingRequested:
+		var event RequestSMSBilling
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+		return event, nil
+	case EventTypeBillingCompleted:
+		var event SMSBillingCompleted
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+		return event, nil
+	case EventTypeBillingRefunded:
+		var event RequestBillingRefund
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+		return event, nil
+	case EventTypeDeliveryRetry:
+		var event SMSDeliveryRetry
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+		return event, nil
+	case EventTypeBatchBillingRequested:
+		var event RequestBatchBilling
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+		return event, nil
+	case EventTypeBatchBillingCompleted:
+		var event BatchBillingCompleted
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+		return event, nil
+	case EventTypeDispatchRequested:
+		var event SMSDispatchRequested
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+		return event, nil
+	default:
+		return nil, fmt.Errorf("unknown event type: %s", eventType)
+	}
+}
@@ -0,0 +1,14 @@
+package sms
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// InboxRepo deduplicates consumed billing events by TransactionID and SMSID.
+type InboxRepo interface {
+	// MarkProcessed records the event and reports false if it was already recorded.
+	MarkProcessed(ctx context.Context, transactionID, smsID string) (bool, error)
+	WithTx(tx *gorm.DB) InboxRepo
+}
@@ -0,0 +1,89 @@
+package sms
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// ListFilter selects the SMS to list. Nil fields do not filter.
+type ListFilter struct {
+	UserID   *string
+	Status   *SMSStatus
+	Receiver *string
+	Provider *string
+	BatchID  *string
+	// CreatedFrom is inclusive and CreatedTo exclusive.
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+}
+
+// Page asks for up to Limit messages after Cursor, newest first.
+type Page struct {
+	Limit  int
+	Cursor *Cursor
+	// WithTotal also counts every message matching the filter, which costs
+	// a second query.
+	WithTotal bool
+}
+
+// Cursor is the position of the last message of a page. Messages are ordered
+// by creation time and then ID, so the order is stable when several share a
+// timestamp.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// ListResult is one page of messages. Next is nil on the last page and Total
+// is only set when it was asked for.
+type ListResult struct {
+	Messages []*SMSMessage
+	Next     *Cursor
+	Total    *int64
+}
+
+// Normalize applies the default page size and caps it at MaxPageSize.
+func (p Page) Normalize() Page {
+	if p.Limit <= 0 {
+		p.Limit = DefaultPageSize
+	}
+	p.Limit = min(p.Limit, MaxPageSize)
+	return p
+}
+
+// CursorAfter returns the cursor pointing past message.
+func CursorAfter(message *SMSMessage) *Cursor {
+	return &Cursor{CreatedAt: message.CreatedAt, ID: message.ID}
+}
+
+// Encode returns the cursor as an opaque token for clients.
+func (c Cursor) Encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseCursor reads a token returned by Encode.
+func ParseCursor(token string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return nil, ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{CreatedAt: t, ID: id}, nil
+}
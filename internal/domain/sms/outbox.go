@@ -0,0 +1,66 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OutboxRepo stores domain events in the same transaction as the SMS rows
+// they belong to, so they can be relayed to the broker afterwards.
+type OutboxRepo interface {
+	Add(ctx context.Context, event DomainEvent) error
+	// ClaimPending claims up to limit of the oldest pending events for
+	// lease, so other relays skip them while they are published. Call it
+	// inside a transaction and publish after it commits.
+	ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error)
+	MarkSent(ctx context.Context, ID string) error
+	MarkFailed(ctx context.Context, ID string, reason string) error
+	// RecordAttempt records a failed publish and drops the event's claim.
+	RecordAttempt(ctx context.Context, ID string, reason string) error
+	// Release drops the claims of events that were not published.
+	Release(ctx context.Context, IDs []string) error
+	WithTx(tx *gorm.DB) OutboxRepo
+}
+
+// ErrEventRejected marks publish errors that retrying cannot fix, such as an
+// event the broker nacked or could not route. Wrap it, e.g.
+// fmt.Errorf("%w: %w", ErrEventRejected, err).
+var ErrEventRejected = errors.New("event rejected by broker")
+
+// OutboxPolicy bounds how the relay publishes outbox events.
+type OutboxPolicy struct {
+	// MaxAttempts is how often an event is published before it is parked
+	// as failed, so it cannot hold up the events behind it for good.
+	MaxAttempts int
+	// ClaimTimeout is how long other relays skip a claimed event; the
+	// events of a relay that stops mid-batch are relayed after it.
+	ClaimTimeout time.Duration
+}
+
+type OutboxStatus string
+
+const (
+	OutboxStatusPending OutboxStatus = "pending"
+	OutboxStatusSent    OutboxStatus = "sent"
+	OutboxStatusFailed  OutboxStatus = "failed"
+)
+
+type OutboxMessage struct {
+	ID          string
+	EventType   EventType
+	AggregateID string
+	Payload     []byte
+	// TraceID is the trace of the request that stored the event; it is
+	// published along with it.
+	TraceID string
+	// TraceParent links the spans of the relay to the request's trace.
+	TraceParent string
+	Status      OutboxStatus
+	Attempts    int
+	LastError   string
+	CreatedAt   time.Time
+	SentAt      time.Time
+}
@@ -0,0 +1,57 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+var ErrNoTariffRate = errors.New("no tariff rate for receiver")
+
+// TariffRepo resolves the tariff plan that applies to a user.
+type TariffRepo interface {
+	GetTariff(ctx context.Context, userID string) (Tariff, error)
+}
+
+// TariffRate prices one segment sent to receivers starting with Prefix, e.g.
+// "+98" for a country or "+98912" for an operator range. A zero price sends
+// for free.
+type TariffRate struct {
+	Prefix          string
+	PricePerSegment int64
+}
+
+type Tariff struct {
+	Plan  string
+	Rates []TariffRate
+	// DefaultPricePerSegment applies when no prefix matches; zero rejects
+	// receivers outside the listed prefixes.
+	DefaultPricePerSegment int64
+}
+
+// Price returns the amount to debit for sending segments parts to receiver,
+// using the rate with the longest matching prefix.
+func (t Tariff) Price(receiver string, segments int) (int64, error) {
+	price := t.DefaultPricePerSegment
+	found := price > 0
+	matched := -1
+	for _, rate := range t.Rates {
+		if len(rate.Prefix) > matched && strings.HasPrefix(receiver, rate.Prefix) {
+			price = rate.PricePerSegment
+			matched = len(rate.Prefix)
+			found = true
+		}
+	}
+	if !found || price < 0 {
+		return 0, ErrNoTariffRate
+	}
+	return price * int64(segments), nil
+}
+
+// FlatTariff is a TariffRepo charging every user the same price per segment
+// for any receiver.
+type FlatTariff int64
+
+func (f FlatTariff) GetTariff(ctx context.Context, userID string) (Tariff, error) {
+	return Tariff{Plan: "flat", DefaultPricePerSegment: int64(f)}, nil
+}
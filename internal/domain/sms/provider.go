@@ -1,6 +1,12 @@
 package sms
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
 
 type SMSProvider interface {
 	SendSMS(ctx context.Context, message *SMSMessage) (providerName string, err error)
@@ -11,3 +17,85 @@ type SMSProviderFunc func(ctx context.Context, message *SMSMessage) (string, err
 func (f SMSProviderFunc) SendSMS(ctx context.Context, message *SMSMessage) (string, error) {
 	return f(ctx, message)
 }
+
+// DeliveryAttempt is one call to an upstream provider for an SMS.
+type DeliveryAttempt struct {
+	SMSID    string
+	Provider string
+	Error    string
+	// Code is the failure code of the provider's error, if it carries one.
+	Code string
+	// Skipped is set when an open circuit breaker kept the provider from
+	// being called.
+	Skipped bool
+	// Permanent is set when retrying the provider later cannot help.
+	Permanent   bool
+	Latency     time.Duration
+	AttemptedAt time.Time
+}
+
+// AttemptRecorder keeps the history of provider calls.
+type AttemptRecorder interface {
+	RecordAttempt(ctx context.Context, attempt DeliveryAttempt) error
+}
+
+var (
+	ErrProvidersExhausted = errors.New("all sms providers failed")
+	ErrNoProviderRoute    = errors.New("no provider route for receiver")
+	// ErrPartiallySubmitted means some parts of a multipart message reached
+	// the provider before it failed. Sending the message again, to the same
+	// or another provider, would deliver those parts twice.
+	ErrPartiallySubmitted = errors.New("sms partially submitted")
+)
+
+// ProvidersExhaustedError is returned once every provider of a failover chain
+// failed or was skipped for the message.
+type ProvidersExhaustedError struct {
+	Attempts []DeliveryAttempt
+}
+
+func (e *ProvidersExhaustedError) Error() string {
+	parts := make([]string, 0, len(e.Attempts))
+	for _, attempt := range e.Attempts {
+		parts = append(parts, fmt.Sprintf("%s: %s", attempt.Provider, attempt.Error))
+	}
+	return fmt.Sprintf("%s [%s]", ErrProvidersExhausted, strings.Join(parts, "; "))
+}
+
+func (e *ProvidersExhaustedError) Is(target error) bool {
+	return target == ErrProvidersExhausted
+}
+
+// FailureCode is the code of the last provider that was called, or
+// ProvidersExhausted when its error carried none or no provider was called.
+func (e *ProvidersExhaustedError) FailureCode() string {
+	for i := len(e.Attempts) - 1; i >= 0; i-- {
+		if e.Attempts[i].Skipped {
+			continue
+		}
+		if e.Attempts[i].Code != "" {
+			return e.Attempts[i].Code
+		}
+		break
+	}
+	return ProvidersExhausted
+}
+
+// ProviderError is a failed provider call mapped to the failure code stored
+// on the SMS.
+type ProviderError struct {
+	Provider string
+	Code     string
+	// Permanent marks failures that retrying cannot fix, like a rejected
+	// receiver.
+	Permanent bool
+	Err       error
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", e.Provider, e.Code, e.Err)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,92 @@
+package sms
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownReceiptStatus = errors.New("unknown delivery receipt status")
+	ErrUnknownReceipt       = errors.New("delivery receipt matches no sms")
+)
+
+// DeliveryReceipt is a provider's final report on a message it accepted.
+type DeliveryReceipt struct {
+	Provider  string
+	MessageID string
+	// Status is delivered, undelivered or expired.
+	Status SMSStatus
+	// ErrorCode is the operator error code for undelivered and expired
+	// messages.
+	ErrorCode string
+	DoneAt    time.Time
+}
+
+// receiptStatuses maps our status names and the SMPP message states used in
+// receipt texts (stat:DELIVRD) to final statuses.
+var receiptStatuses = map[string]SMSStatus{
+	"delivered":   SMSStatusDelivered,
+	"undelivered": SMSStatusUndelivered,
+	"expired":     SMSStatusExpired,
+	"DELIVRD":     SMSStatusDelivered,
+	"UNDELIV":     SMSStatusUndelivered,
+	"REJECTD":     SMSStatusUndelivered,
+	"DELETED":     SMSStatusUndelivered,
+	"UNKNOWN":     SMSStatusUndelivered,
+	"EXPIRED":     SMSStatusExpired,
+}
+
+// ParseReceiptStatus returns the final status a receipt reports. Intermediate
+// states such as ENROUTE or ACCEPTD yield ErrUnknownReceiptStatus.
+func ParseReceiptStatus(value string) (SMSStatus, error) {
+	if status, ok := receiptStatuses[value]; ok {
+		return status, nil
+	}
+	if status, ok := receiptStatuses[strings.ToLower(value)]; ok {
+		return status, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownReceiptStatus, value)
+}
+
+// ApplyDeliveryReceipt moves a sent message to the status the receipt reports.
+// A message sent in several parts is only delivered once every part is; until
+// then the delivered part is recorded and the message stays sent. A part that
+// is not delivered settles the whole message.
+func (s *SMSMessage) ApplyDeliveryReceipt(receipt DeliveryReceipt) error {
+	switch receipt.Status {
+	case SMSStatusDelivered, SMSStatusUndelivered, SMSStatusExpired:
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownReceiptStatus, receipt.Status)
+	}
+
+	if receipt.Status == SMSStatusDelivered && len(s.ProviderPartIDs) > 1 {
+		if !s.Status.CanTransitionTo(SMSStatusDelivered) {
+			return &InvalidTransitionError{From: s.Status, To: SMSStatusDelivered}
+		}
+		if !slices.Contains(s.DeliveredPartIDs, receipt.MessageID) {
+			s.DeliveredPartIDs = append(s.DeliveredPartIDs, receipt.MessageID)
+		}
+		for _, partID := range s.ProviderPartIDs {
+			if !slices.Contains(s.DeliveredPartIDs, partID) {
+				return nil
+			}
+		}
+	}
+
+	if err := s.TransitionTo(receipt.Status); err != nil {
+		return err
+	}
+
+	if receipt.Status != SMSStatusDelivered {
+		s.FailureCode = receipt.ErrorCode
+		return nil
+	}
+	s.DeliveredAt = receipt.DoneAt
+	if s.DeliveredAt.IsZero() {
+		s.DeliveredAt = s.UpdatedAt
+	}
+	return nil
+}
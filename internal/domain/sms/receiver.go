@@ -0,0 +1,56 @@
+package sms
+
+import "strings"
+
+// IranCountryCode is the calling code local Iranian numbers are expanded with.
+const IranCountryCode = "98"
+
+// NormalizeReceiver rewrites the ways Iranian mobile numbers are commonly
+// written (09123456789, 9123456789, 00989123456789, 989123456789, with
+// spaces, dashes or Persian digits) to E.164. Other input is only stripped of
+// separators and left for validation to reject.
+func NormalizeReceiver(receiver string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(receiver) {
+		switch {
+		case r >= '۰' && r <= '۹':
+			b.WriteRune('0' + r - '۰')
+		case r >= '٠' && r <= '٩':
+			b.WriteRune('0' + r - '٠')
+		case r == ' ' || r == '-' || r == '(' || r == ')' || r == '.':
+		default:
+			b.WriteRune(r)
+		}
+	}
+	number := b.String()
+
+	switch {
+	case strings.HasPrefix(number, "+"):
+		return number
+	case strings.HasPrefix(number, "00"):
+		return "+" + number[2:]
+	case len(number) == 11 && strings.HasPrefix(number, "09"):
+		return "+" + IranCountryCode + number[1:]
+	case len(number) == 10 && strings.HasPrefix(number, "9"):
+		return "+" + IranCountryCode + number
+	case len(number) == 12 && strings.HasPrefix(number, IranCountryCode+"9"):
+		return "+" + number
+	default:
+		return number
+	}
+}
+
+// IsE164 reports whether receiver is a "+" followed by 2 to 15 digits, the
+// first of which is not 0.
+func IsE164(receiver string) bool {
+	digits, ok := strings.CutPrefix(receiver, "+")
+	if !ok || len(digits) < 2 || len(digits) > 15 || digits[0] == '0' {
+		return false
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
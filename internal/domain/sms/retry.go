@@ -0,0 +1,72 @@
+package sms
+
+import (
+	"errors"
+	"time"
+)
+
+// RetryPolicy decides whether and when a failed delivery is attempted again.
+type RetryPolicy struct {
+	// MaxAttempts counts every delivery attempt, including the first.
+	MaxAttempts  int
+	InitialDelay time.Duration
+	Multiplier   float64
+	MaxDelay     time.Duration
+}
+
+// ShouldRetry reports whether another attempt may follow the given number of
+// failed attempts.
+func (p RetryPolicy) ShouldRetry(attempts int) bool {
+	return attempts < p.MaxAttempts
+}
+
+// Delay returns how long to wait after the given number of failed attempts:
+// InitialDelay grown by Multiplier per attempt and capped at MaxDelay.
+func (p RetryPolicy) Delay(attempts int) time.Duration {
+	delay := float64(p.InitialDelay)
+	for i := 1; i < attempts; i++ {
+		delay *= p.Multiplier
+		if p.MaxDelay > 0 && delay >= float64(p.MaxDelay) {
+			return p.MaxDelay
+		}
+	}
+	return time.Duration(delay)
+}
+
+// Delays returns every distinct delay the policy can produce.
+func (p RetryPolicy) Delays() []time.Duration {
+	var delays []time.Duration
+	for attempts := 1; p.ShouldRetry(attempts); attempts++ {
+		delay := p.Delay(attempts)
+		if len(delays) > 0 && delays[len(delays)-1] == delay {
+			continue
+		}
+		delays = append(delays, delay)
+	}
+	return delays
+}
+
+// IsTransient reports whether a failed delivery may succeed if retried later.
+// Provider rejections and missing routes are permanent; timeouts, unavailable
+// providers and unclassified errors are transient.
+func IsTransient(err error) bool {
+	var (
+		exhausted   *ProvidersExhaustedError
+		providerErr *ProviderError
+	)
+	switch {
+	case errors.As(err, &exhausted):
+		for _, attempt := range exhausted.Attempts {
+			if !attempt.Permanent {
+				return true
+			}
+		}
+		return false
+	case errors.Is(err, ErrNoProviderRoute):
+		return false
+	case errors.As(err, &providerErr):
+		return !providerErr.Permanent
+	default:
+		return true
+	}
+}
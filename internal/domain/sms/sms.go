@@ -2,6 +2,7 @@ package sms
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"gorm.io/gorm"
@@ -9,54 +10,124 @@ import (
 
 type Repo interface {
 	GetByFilter(ctx context.Context, filter Filter) (*SMSMessage, error)
+	// List returns a page of the messages matching filter, newest first.
+	List(ctx context.Context, filter ListFilter, page Page) (ListResult, error)
 	Create(ctx context.Context, message *SMSMessage) error
-	Update(ctx context.Context, ID string, message *SMSMessage) error
+	// CreateInBatches inserts messages batchSize rows at a time.
+	CreateInBatches(ctx context.Context, messages []*SMSMessage, batchSize int) error
+	// Update persists the message if its row still has status from, the
+	// status it was read with, so concurrent writers cannot overwrite each
+	// other's transitions.
+	Update(ctx context.Context, ID string, from SMSStatus, message *SMSMessage) error
+	// Lock reads a message and locks it until the transaction ends.
+	Lock(ctx context.Context, ID string) (*SMSMessage, error)
+	// ClaimDue locks up to limit scheduled messages whose SendAt is not after
+	// dueBy, oldest first, skipping messages other workers hold.
+	ClaimDue(ctx context.Context, dueBy time.Time, limit int) ([]*SMSMessage, error)
+	// ClaimStuckSending locks up to limit messages that have been sending
+	// since before sendingSince, oldest first, skipping messages other
+	// workers hold.
+	ClaimStuckSending(ctx context.Context, sendingSince time.Time, limit int) ([]*SMSMessage, error)
 	WithTx(tx *gorm.DB) Repo
 }
 
-type SMSStatus string
-
-const (
-	SMSStatusPending   SMSStatus = "pending"
-	SMSStatusDelivered SMSStatus = "delivered"
-	SMSStatusFailed    SMSStatus = "failed"
-)
-
 type SMSMessage struct {
-	ID          string
-	UserID      string
-	Content     string
-	Receiver    string
-	Provider    string
-	Status      SMSStatus
-	DeliveredAt time.Time
-	FailureCode string
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	DeletedAt   time.Time
+	ID       string
+	UserID   string
+	Content  string
+	Receiver string
+	Provider string
+	// BatchID is set for SMS created by a bulk send.
+	BatchID string
+	// SendAt is when a scheduled SMS is due; the zero value sends at once.
+	SendAt time.Time
+	// ProviderMessageID is the ID the provider assigned on acceptance;
+	// delivery receipts refer to it. Multipart messages keep the first
+	// part's ID.
+	ProviderMessageID string
+	Status            SMSStatus
+	SegmentCount      int
+	Amount            int64
+	DeliveredAt       time.Time
+	FailureCode       string
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	DeletedAt         time.Time
+	// ProviderPartIDs holds the IDs of every part of a multipart message,
+	// since each part gets a delivery receipt of its own.
+	ProviderPartIDs []string
+	// TransactionID is the debit the SMS is sent under; its refund refers
+	// to it.
+	TransactionID string
+	// DeliveredPartIDs holds the parts of a multipart message whose
+	// receipts reported delivery so far.
+	DeliveredPartIDs []string
 }
 
+var ErrSMSNotFound = errors.New("sms not found")
+
 type Filter struct {
-	ID     *string
-	Status *SMSStatus
-	UserID *string
+	ID                *string
+	Status            *SMSStatus
+	UserID            *string
+	Provider          *string
+	ProviderMessageID *string
+}
+
+// TransitionTo moves the SMS to the given status if the lifecycle allows it.
+func (s *SMSMessage) TransitionTo(status SMSStatus) error {
+	if !s.Status.CanTransitionTo(status) {
+		return &InvalidTransitionError{From: s.Status, To: status}
+	}
+	s.Status = status
+	s.UpdatedAt = time.Now()
+	return nil
 }
 
-func (s *SMSMessage) MarkAsSent(provider string) {
-	s.Status = SMSStatusDelivered
+// MarkAsSent records that provider accepted the message, with the IDs of its
+// parts when it was sent in several. It is delivered only once a delivery
+// receipt says so.
+func (s *SMSMessage) MarkAsSent(provider string, messageID string, partIDs ...string) error {
+	if err := s.TransitionTo(SMSStatusSent); err != nil {
+		return err
+	}
 	s.Provider = provider
-	now := time.Now()
-	s.DeliveredAt = now
-	s.UpdatedAt = now
+	s.ProviderMessageID = messageID
+	s.ProviderPartIDs = partIDs
+	s.FailureCode = ""
+	return nil
+}
+
+// ScheduleRetry records a transient delivery failure that is going to be
+// retried.
+func (s *SMSMessage) ScheduleRetry(provider string, code string) error {
+	if err := s.TransitionTo(SMSStatusRetryScheduled); err != nil {
+		return err
+	}
+	s.Provider = provider
+	s.FailureCode = code
+	return nil
 }
 
 const (
-	MNOProviderFailed = "MNOProviderFailed"
+	MNOProviderFailed   = "MNOProviderFailed"
+	ProvidersExhausted  = "ProvidersExhausted"
+	NoProviderRoute     = "NoProviderRoute"
+	ProviderTimeout     = "ProviderTimeout"
+	ProviderRejected    = "ProviderRejected"
+	ProviderUnavailable = "ProviderUnavailable"
+	PartiallySubmitted  = "PartiallySubmitted"
 )
 
-func (s *SMSMessage) MarkAsFailed(provider string, code string) {
-	s.Status = SMSStatusFailed
+// DeliveryOutcomeUnknown marks an SMS whose delivery outcome was never
+// recorded, e.g. because the database failed after the provider was called.
+const DeliveryOutcomeUnknown = "DeliveryOutcomeUnknown"
+
+func (s *SMSMessage) MarkAsFailed(provider string, code string) error {
+	if err := s.TransitionTo(SMSStatusFailed); err != nil {
+		return err
+	}
 	s.Provider = provider
 	s.FailureCode = code
-	s.UpdatedAt = time.Now()
+	return nil
 }
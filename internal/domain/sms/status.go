@@ -0,0 +1,78 @@
+package sms
+
+import (
+	"errors"
+	"fmt"
+)
+
+type SMSStatus string
+
+const (
+	SMSStatusPending          SMSStatus = "pending"
+	SMSStatusBillingRequested SMSStatus = "billing_requested"
+	SMSStatusBilled           SMSStatus = "billed"
+	SMSStatusSending          SMSStatus = "sending"
+	SMSStatusRetryScheduled   SMSStatus = "retry_scheduled"
+	SMSStatusSent             SMSStatus = "sent"
+	SMSStatusDelivered        SMSStatus = "delivered"
+	SMSStatusUndelivered      SMSStatus = "undelivered"
+	// SMSStatusFailed messages are refunded in the transaction that fails
+	// them; the billing service tracks the refund, not the status.
+	SMSStatusFailed    SMSStatus = "failed"
+	SMSStatusExpired   SMSStatus = "expired"
+	SMSStatusCancelled SMSStatus = "cancelled"
+	// SMSStatusScheduled messages wait for their send time before billing is
+	// requested.
+	SMSStatusScheduled SMSStatus = "scheduled"
+)
+
+// statusTransitions lists, for every status, the statuses it may move to.
+// Statuses without outgoing transitions are final.
+var statusTransitions = map[SMSStatus][]SMSStatus{
+	SMSStatusPending: {SMSStatusBillingRequested, SMSStatusScheduled, SMSStatusCancelled, SMSStatusFailed,
+		// rows created before billing_requested existed
+		SMSStatusBilled},
+	SMSStatusScheduled:        {SMSStatusBillingRequested, SMSStatusCancelled},
+	SMSStatusBillingRequested: {SMSStatusBilled, SMSStatusCancelled, SMSStatusExpired, SMSStatusFailed},
+	SMSStatusBilled:           {SMSStatusSending, SMSStatusFailed},
+	// providers that confirm delivery synchronously skip sent
+	SMSStatusSending:        {SMSStatusSent, SMSStatusDelivered, SMSStatusRetryScheduled, SMSStatusFailed},
+	SMSStatusRetryScheduled: {SMSStatusSending},
+	SMSStatusSent:           {SMSStatusDelivered, SMSStatusUndelivered, SMSStatusExpired, SMSStatusFailed},
+	SMSStatusDelivered:      {},
+	SMSStatusUndelivered:    {},
+	SMSStatusFailed:         {},
+	SMSStatusExpired:        {},
+	SMSStatusCancelled:      {},
+}
+
+var ErrInvalidStatusTransition = errors.New("invalid sms status transition")
+
+// InvalidTransitionError is returned when an SMS is asked to move to a
+// status the lifecycle does not allow from its current one.
+type InvalidTransitionError struct {
+	From SMSStatus
+	To   SMSStatus
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("%s: %s -> %s", ErrInvalidStatusTransition, e.From, e.To)
+}
+
+func (e *InvalidTransitionError) Is(target error) bool {
+	return target == ErrInvalidStatusTransition
+}
+
+func (s SMSStatus) IsValid() bool {
+	_, ok := statusTransitions[s]
+	return ok
+}
+
+func (s SMSStatus) CanTransitionTo(to SMSStatus) bool {
+	for _, next := range statusTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
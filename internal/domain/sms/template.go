@@ -0,0 +1,71 @@
+package sms
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidTemplate = errors.New("invalid template")
+	ErrMissingVariable = errors.New("missing template variable")
+)
+
+// Template is SMS content with {{name}} placeholders filled in per recipient.
+type Template struct {
+	// parts alternates literal text and variable names, starting with text.
+	parts []string
+}
+
+// ParseTemplate reads placeholders such as {{name}} or {{ code }}.
+func ParseTemplate(text string) (Template, error) {
+	var t Template
+	rest := text
+	for {
+		open := strings.Index(rest, "{{")
+		if open < 0 {
+			t.parts = append(t.parts, rest)
+			return t, nil
+		}
+		end := strings.Index(rest[open:], "}}")
+		if end < 0 {
+			return t, fmt.Errorf("%w: unclosed {{ at %q", ErrInvalidTemplate, rest[open:])
+		}
+		name := strings.TrimSpace(rest[open+2 : open+end])
+		if name == "" || strings.ContainsAny(name, "{} \t") {
+			return t, fmt.Errorf("%w: bad placeholder %q", ErrInvalidTemplate, rest[open:open+end+2])
+		}
+		t.parts = append(t.parts, rest[:open], name)
+		rest = rest[open+end+2:]
+	}
+}
+
+// Variables lists the placeholder names in the order they first appear.
+func (t Template) Variables() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for i := 1; i < len(t.parts); i += 2 {
+		if !seen[t.parts[i]] {
+			seen[t.parts[i]] = true
+			names = append(names, t.parts[i])
+		}
+	}
+	return names
+}
+
+// Render fills in the placeholders. Every variable needs a non-empty value.
+func (t Template) Render(vars map[string]string) (string, error) {
+	var b strings.Builder
+	for i, part := range t.parts {
+		if i%2 == 0 {
+			b.WriteString(part)
+			continue
+		}
+		value := vars[part]
+		if value == "" {
+			return "", fmt.Errorf("%w: %s", ErrMissingVariable, part)
+		}
+		b.WriteString(value)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,13 @@
+package sms
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// Transactor runs fn in a database transaction that commits when fn returns
+// nil and rolls back otherwise. Repositories join it through WithTx(tx).
+type Transactor interface {
+	InTx(ctx context.Context, fn func(tx *gorm.DB) error) error
+}
@@ -0,0 +1,135 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"sms/internal/domain/sms"
+	"sms/pkg/circuitbreaker"
+	"sms/pkg/logger"
+	"time"
+)
+
+const errCircuitOpen = "circuit breaker open"
+
+type NamedProvider struct {
+	Name     string
+	Provider sms.SMSProvider
+	// Breaker is shared when the same provider takes part in several chains;
+	// a new one is created from BreakerOptions when nil.
+	Breaker *circuitbreaker.Breaker
+}
+
+type BreakerOptions struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+}
+
+type failoverMember struct {
+	name     string
+	provider sms.SMSProvider
+	breaker  *circuitbreaker.Breaker
+}
+
+// FailoverProvider tries its providers in order until one accepts the
+// message, skipping providers whose circuit breaker is open.
+type FailoverProvider struct {
+	members  []failoverMember
+	recorder sms.AttemptRecorder
+	log      *logger.Logger
+}
+
+func NewFailoverProvider(providers []NamedProvider, opts BreakerOptions, recorder sms.AttemptRecorder, log *logger.Logger) *FailoverProvider {
+	members := make([]failoverMember, 0, len(providers))
+	for _, p := range providers {
+		breaker := p.Breaker
+		if breaker == nil {
+			breaker = circuitbreaker.New(opts.FailureThreshold, opts.OpenTimeout)
+		}
+		members = append(members, failoverMember{
+			name:     p.Name,
+			provider: p.Provider,
+			breaker:  breaker,
+		})
+	}
+	return &FailoverProvider{
+		members:  members,
+		recorder: recorder,
+		log:      log,
+	}
+}
+
+func (f *FailoverProvider) SendSMS(ctx context.Context, message *sms.SMSMessage) (string, error) {
+	var attempts []sms.DeliveryAttempt
+
+	for _, member := range f.members {
+		if err := ctx.Err(); err != nil {
+			return f.lastProvider(attempts), err
+		}
+
+		attempt := sms.DeliveryAttempt{
+			SMSID:       message.ID,
+			Provider:    member.name,
+			AttemptedAt: time.Now(),
+		}
+
+		if !member.breaker.Allow() {
+			f.log.Info(ctx, "skipping provider with open circuit breaker", "sms_id", message.ID, "provider", member.name)
+			attempt.Error = errCircuitOpen
+			attempt.Skipped = true
+			attempts = append(attempts, attempt)
+			continue
+		}
+
+		_, err := member.provider.SendSMS(ctx, message)
+		attempt.Latency = time.Since(attempt.AttemptedAt)
+		f.record(ctx, &attempt, err)
+		attempts = append(attempts, attempt)
+
+		if err == nil {
+			member.breaker.Success()
+			return member.name, nil
+		}
+
+		// a cancelled request says nothing about the provider's health
+		if errors.Is(err, context.Canceled) {
+			member.breaker.Cancel()
+			return member.name, err
+		}
+		member.breaker.Failure()
+		// the receiver already got some parts; another provider would
+		// send them again
+		if errors.Is(err, sms.ErrPartiallySubmitted) {
+			f.log.Error(ctx, "provider failed after submitting part of the message", "error", err, "sms_id", message.ID, "provider", member.name, "breaker_state", string(member.breaker.State()))
+			return member.name, err
+		}
+		f.log.Error(ctx, "provider failed, trying next one", "error", err, "sms_id", message.ID, "provider", member.name, "breaker_state", string(member.breaker.State()))
+	}
+
+	return f.lastProvider(attempts), &sms.ProvidersExhaustedError{Attempts: attempts}
+}
+
+func (f *FailoverProvider) record(ctx context.Context, attempt *sms.DeliveryAttempt, err error) {
+	if err != nil {
+		attempt.Error = err.Error()
+		attempt.Permanent = !sms.IsTransient(err)
+		var providerErr *sms.ProviderError
+		if errors.As(err, &providerErr) {
+			attempt.Code = providerErr.Code
+		}
+	}
+	if f.recorder == nil {
+		return
+	}
+	if recErr := f.recorder.RecordAttempt(ctx, *attempt); recErr != nil {
+		f.log.Error(ctx, "failed to record delivery attempt", "error", recErr, "sms_id", attempt.SMSID, "provider", attempt.Provider)
+	}
+}
+
+func (f *FailoverProvider) lastProvider(attempts []sms.DeliveryAttempt) string {
+	for i := len(attempts) - 1; i >= 0; i-- {
+		if !attempts[i].Skipped {
+			return attempts[i].Provider
+		}
+	}
+	return ""
+}
@@ -0,0 +1,28 @@
+package external
+
+import (
+	"context"
+	"fmt"
+	"sms/pkg/circuitbreaker"
+	"strings"
+)
+
+// CheckGateways fails once the breaker of every gateway is open, i.e. no SMS
+// can be sent until one of them recovers. Gateways are not probed, so an
+// idle gateway counts as healthy.
+func CheckGateways(gateways []NamedProvider) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if len(gateways) == 0 {
+			return nil
+		}
+
+		open := make([]string, 0, len(gateways))
+		for _, gw := range gateways {
+			if gw.Breaker == nil || gw.Breaker.State() != circuitbreaker.StateOpen {
+				return nil
+			}
+			open = append(open, gw.Name)
+		}
+		return fmt.Errorf("circuit open for every gateway: %s", strings.Join(open, ", "))
+	}
+}
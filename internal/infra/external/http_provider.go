@@ -0,0 +1,214 @@
+package external
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sms/internal/domain/sms"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const maxResponseBody = 1 << 20
+
+// HTTPProviderConfig describes an HTTP SMS gateway: how to build the request
+// and how to tell a successful response from a failed one.
+type HTTPProviderConfig struct {
+	Name        string
+	URL         string
+	Method      string
+	Headers     map[string]string
+	ContentType string
+	// BodyTemplate is a text/template rendered with the SMS fields (.ID,
+	// .UserID, .Receiver, .Content); {{json .Content}} emits a quoted string.
+	BodyTemplate string
+	Timeout      time.Duration
+	Response     HTTPResponseMapping
+}
+
+// HTTPResponseMapping reads gateway responses. Fields are dot-separated paths
+// into the JSON body, e.g. "result.status".
+type HTTPResponseMapping struct {
+	// SuccessField must equal SuccessValue for a 2xx response to count as
+	// accepted; leave empty to trust the status code alone.
+	SuccessField string
+	SuccessValue string
+	// MessageIDField holds the gateway's ID for the message, which its
+	// delivery receipts refer to.
+	MessageIDField string
+	ErrorCodeField string
+	// ErrorCodes maps gateway error codes to SMS failure codes.
+	ErrorCodes map[string]string
+}
+
+type HTTPProvider struct {
+	cfg    HTTPProviderConfig
+	body   *template.Template
+	client *http.Client
+}
+
+type httpTemplateData struct {
+	ID       string
+	UserID   string
+	Receiver string
+	Content  string
+}
+
+func NewHTTPProvider(cfg HTTPProviderConfig) (*HTTPProvider, error) {
+	if cfg.Method == "" {
+		cfg.Method = http.MethodPost
+	}
+	if cfg.ContentType == "" {
+		cfg.ContentType = "application/json"
+	}
+
+	body, err := template.New(cfg.Name).Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(cfg.BodyTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("http provider %s: invalid body template: %w", cfg.Name, err)
+	}
+
+	return &HTTPProvider{
+		cfg:    cfg,
+		body:   body,
+		client: &http.Client{},
+	}, nil
+}
+
+func (p *HTTPProvider) SendSMS(ctx context.Context, message *sms.SMSMessage) (string, error) {
+	if p.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.cfg.Timeout)
+		defer cancel()
+	}
+
+	var body bytes.Buffer
+	err := p.body.Execute(&body, httpTemplateData{
+		ID:       message.ID,
+		UserID:   message.UserID,
+		Receiver: message.Receiver,
+		Content:  message.Content,
+	})
+	if err != nil {
+		return p.cfg.Name, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, p.cfg.Method, p.cfg.URL, &body)
+	if err != nil {
+		return p.cfg.Name, err
+	}
+	req.Header.Set("Content-Type", p.cfg.ContentType)
+	for key, value := range p.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return p.cfg.Name, p.transportError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return p.cfg.Name, p.transportError(ctx, err)
+	}
+
+	messageID, err := p.checkResponse(resp.StatusCode, respBody)
+	if err != nil {
+		return p.cfg.Name, err
+	}
+	message.ProviderMessageID = messageID
+	return p.cfg.Name, nil
+}
+
+func (p *HTTPProvider) transportError(ctx context.Context, err error) error {
+	// the caller gave up; this is not the gateway's fault
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return ctx.Err()
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return p.fail(sms.ProviderTimeout, nil, err)
+	}
+	return p.fail(sms.ProviderUnavailable, nil, err)
+}
+
+// checkResponse returns the gateway's message ID for an accepted message.
+func (p *HTTPProvider) checkResponse(status int, body []byte) (string, error) {
+	var parsed map[string]any
+	_ = json.Unmarshal(body, &parsed)
+
+	if status >= 200 && status < 300 {
+		mapping := p.cfg.Response
+		if mapping.SuccessField == "" || lookupField(parsed, mapping.SuccessField) == mapping.SuccessValue {
+			return lookupField(parsed, mapping.MessageIDField), nil
+		}
+		return "", p.fail(sms.ProviderRejected, parsed, fmt.Errorf("gateway reported failure: %s", body))
+	}
+
+	code := sms.ProviderUnavailable
+	if status < 500 && status != http.StatusTooManyRequests {
+		code = sms.ProviderRejected
+	}
+	return "", p.fail(code, parsed, fmt.Errorf("unexpected status %d: %s", status, body))
+}
+
+func (p *HTTPProvider) mapErrorCode(parsed map[string]any, fallback string) string {
+	if p.cfg.Response.ErrorCodeField == "" {
+		return fallback
+	}
+	if code, ok := p.cfg.Response.ErrorCodes[lookupField(parsed, p.cfg.Response.ErrorCodeField)]; ok {
+		return code
+	}
+	return fallback
+}
+
+// fail builds the error for a failed call. Rejections are permanent; a code
+// mapped from the response keeps that classification.
+func (p *HTTPProvider) fail(code string, parsed map[string]any, err error) error {
+	return &sms.ProviderError{
+		Provider:  p.cfg.Name,
+		Code:      p.mapErrorCode(parsed, code),
+		Permanent: code == sms.ProviderRejected,
+		Err:       err,
+	}
+}
+
+// lookupField follows a dot-separated path into a decoded JSON object and
+// returns the value formatted as a string, or "" when it is missing.
+func lookupField(data map[string]any, path string) string {
+	if path == "" {
+		return ""
+	}
+	var current any = data
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := current.(map[string]any)
+		if !ok {
+			return ""
+		}
+		current, ok = obj[key]
+		if !ok {
+			return ""
+		}
+	}
+
+	switch v := current.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
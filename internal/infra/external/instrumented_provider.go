@@ -0,0 +1,67 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sms/internal/domain/sms"
+	"sms/pkg/metrics"
+	"sms/pkg/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentedProvider wraps SendSMS of a gateway in a client span and
+// records how long the gateway took.
+type InstrumentedProvider struct {
+	name     string
+	provider sms.SMSProvider
+}
+
+func NewInstrumentedProvider(name string, provider sms.SMSProvider) *InstrumentedProvider {
+	return &InstrumentedProvider{name: name, provider: provider}
+}
+
+func (p *InstrumentedProvider) SendSMS(ctx context.Context, message *sms.SMSMessage) (string, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "sms.send "+p.name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("sms.id", message.ID),
+			attribute.String("sms.gateway", p.name),
+		),
+	)
+	defer span.End()
+
+	start := time.Now()
+	provider, err := p.provider.SendSMS(ctx, message)
+	metrics.ProviderRequestDuration.WithLabelValues(p.name, providerOutcome(err)).Observe(metrics.Since(start))
+
+	if message.ProviderMessageID != "" {
+		span.SetAttributes(attribute.String("sms.provider_message_id", message.ProviderMessageID))
+	}
+	tracing.RecordError(span, err)
+	return provider, err
+}
+
+// Close closes the wrapped gateway if it holds a connection.
+func (p *InstrumentedProvider) Close() error {
+	if closer, ok := p.provider.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// providerOutcome labels a send by the provider error code it failed with.
+func providerOutcome(err error) string {
+	var providerErr *sms.ProviderError
+	switch {
+	case err == nil:
+		return metrics.OutcomeSuccess
+	case errors.As(err, &providerErr) && providerErr.Code != "":
+		return providerErr.Code
+	default:
+		return metrics.OutcomeError
+	}
+}
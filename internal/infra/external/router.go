@@ -0,0 +1,67 @@
+package external
+
+import (
+	"context"
+	"sms/internal/domain/sms"
+	"sort"
+	"strings"
+)
+
+type Route struct {
+	Name     string
+	Prefixes []string
+	Provider sms.SMSProvider
+}
+
+type routePrefix struct {
+	prefix string
+	route  Route
+}
+
+// PrefixRouter sends each message through the route whose prefix is the
+// longest match for the receiver, e.g. a mobile operator's number ranges,
+// and through the fallback provider when no prefix matches.
+type PrefixRouter struct {
+	prefixes []routePrefix
+	fallback sms.SMSProvider
+}
+
+func NewPrefixRouter(routes []Route, fallback sms.SMSProvider) *PrefixRouter {
+	var prefixes []routePrefix
+	for _, route := range routes {
+		for _, prefix := range route.Prefixes {
+			prefixes = append(prefixes, routePrefix{prefix: normalizeNumber(prefix), route: route})
+		}
+	}
+	sort.SliceStable(prefixes, func(i, j int) bool {
+		return len(prefixes[i].prefix) > len(prefixes[j].prefix)
+	})
+
+	return &PrefixRouter{
+		prefixes: prefixes,
+		fallback: fallback,
+	}
+}
+
+// Route returns the name of the route serving receiver, or "" for the fallback.
+func (r *PrefixRouter) Route(receiver string) (string, sms.SMSProvider) {
+	number := normalizeNumber(receiver)
+	for _, p := range r.prefixes {
+		if strings.HasPrefix(number, p.prefix) {
+			return p.route.Name, p.route.Provider
+		}
+	}
+	return "", r.fallback
+}
+
+func (r *PrefixRouter) SendSMS(ctx context.Context, message *sms.SMSMessage) (string, error) {
+	_, provider := r.Route(message.Receiver)
+	if provider == nil {
+		return "", sms.ErrNoProviderRoute
+	}
+	return provider.SendSMS(ctx, message)
+}
+
+func normalizeNumber(number string) string {
+	return strings.TrimPrefix(strings.TrimSpace(number), "+")
+}
@@ -0,0 +1,195 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sms/internal/domain/sms"
+	"sms/pkg/smpp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+type SMPPProviderConfig struct {
+	Name       string
+	Addr       string
+	SystemID   string
+	Password   string
+	SystemType string
+	// SourceAddr is the sender shown to the receiver: a number or an
+	// alphanumeric sender ID.
+	SourceAddr          string
+	WindowSize          int
+	EnquireLinkInterval time.Duration
+	Timeout             time.Duration
+	// Receipts handles delivery receipts arriving over the bind.
+	Receipts ReceiptHandler
+}
+
+// ReceiptHandler processes delivery receipts pushed by a provider.
+type ReceiptHandler func(ctx context.Context, receipt sms.DeliveryReceipt) error
+
+// SMPPProvider submits messages over a transceiver bind that is shared by all
+// SendSMS calls and re-dialed on the next call after it drops. Delivery
+// receipts arrive over the same bind.
+type SMPPProvider struct {
+	cfg SMPPProviderConfig
+
+	mu     sync.Mutex
+	client *smpp.Client
+}
+
+func NewSMPPProvider(cfg SMPPProviderConfig) *SMPPProvider {
+	return &SMPPProvider{cfg: cfg}
+}
+
+func (p *SMPPProvider) SendSMS(ctx context.Context, message *sms.SMSMessage) (string, error) {
+	client, err := p.connect(ctx)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return p.cfg.Name, ctx.Err()
+		}
+		return p.cfg.Name, &sms.ProviderError{Provider: p.cfg.Name, Code: sms.ProviderUnavailable, Err: err}
+	}
+
+	encoded := message.Encode()
+	sourceTON, sourceNPI, source := smppAddress(p.cfg.SourceAddr)
+	destTON, destNPI, dest := smppAddress(message.Receiver)
+
+	dataCoding := smpp.DataCodingDefault
+	if encoded.Encoding == sms.EncodingUCS2 {
+		dataCoding = smpp.DataCodingUCS2
+	}
+
+	partIDs := make([]string, 0, len(encoded.Segments))
+	for _, segment := range encoded.Segments {
+		submit := smpp.ShortMessage{
+			SourceAddrTON: sourceTON,
+			SourceAddrNPI: sourceNPI,
+			SourceAddr:    source,
+			DestAddrTON:   destTON,
+			DestAddrNPI:   destNPI,
+			DestAddr:      dest,
+			DataCoding:    dataCoding,
+			ShortMessage:  append(append([]byte{}, segment.UDH...), sms.EncodeText(segment.Text, encoded.Encoding)...),
+		}
+		if segment.UDH != nil {
+			submit.ESMClass = smpp.ESMClassUDHI
+		}
+
+		messageID, err := client.Submit(ctx, submit)
+		if err != nil {
+			err = p.submitError(ctx, err)
+			if len(partIDs) > 0 {
+				// sending the message again would repeat the parts that
+				// went out
+				err = &sms.ProviderError{Provider: p.cfg.Name, Code: sms.PartiallySubmitted, Permanent: true, Err: fmt.Errorf("%w after %d of %d parts: %w", sms.ErrPartiallySubmitted, len(partIDs), len(encoded.Segments), err)}
+			}
+			return p.cfg.Name, err
+		}
+		partIDs = append(partIDs, messageID)
+	}
+	message.ProviderMessageID = partIDs[0]
+	if len(partIDs) > 1 {
+		message.ProviderPartIDs = partIDs
+	}
+	return p.cfg.Name, nil
+}
+
+// Close unbinds the shared connection, if any.
+func (p *SMPPProvider) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.client == nil {
+		return nil
+	}
+	err := p.client.Close()
+	p.client = nil
+	return err
+}
+
+func (p *SMPPProvider) connect(ctx context.Context) (*smpp.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.client != nil && p.client.Err() == nil {
+		return p.client, nil
+	}
+
+	client, err := smpp.Dial(ctx, smpp.Config{
+		Addr:                p.cfg.Addr,
+		SystemID:            p.cfg.SystemID,
+		Password:            p.cfg.Password,
+		SystemType:          p.cfg.SystemType,
+		WindowSize:          p.cfg.WindowSize,
+		EnquireLinkInterval: p.cfg.EnquireLinkInterval,
+		ResponseTimeout:     p.cfg.Timeout,
+		OnDeliver:           p.handleDeliver,
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.client = client
+	return client, nil
+}
+
+// handleDeliver passes delivery receipts to the receipt handler. Errors other
+// than unparsable receipts make the SMSC redeliver, e.g. when a receipt
+// arrives before its SMS is stored as sent.
+func (p *SMPPProvider) handleDeliver(msg smpp.ShortMessage) error {
+	// mobile originated messages are not supported
+	if msg.ESMClass&smpp.ESMClassDeliveryReceipt == 0 || p.cfg.Receipts == nil {
+		return nil
+	}
+
+	receipt, err := smpp.ParseReceipt(string(msg.ShortMessage))
+	if err != nil {
+		return smpp.StatusXPAppn
+	}
+	status, err := sms.ParseReceiptStatus(receipt.Stat)
+	if err != nil {
+		// intermediate states like ENROUTE are not tracked
+		return nil
+	}
+
+	return p.cfg.Receipts(context.Background(), sms.DeliveryReceipt{
+		Provider:  p.cfg.Name,
+		MessageID: receipt.MessageID,
+		Status:    status,
+		ErrorCode: receipt.Err,
+		DoneAt:    receipt.DoneDate,
+	})
+}
+
+func (p *SMPPProvider) submitError(ctx context.Context, err error) error {
+	// the caller gave up; this is not the SMSC's fault
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return ctx.Err()
+	}
+
+	var status smpp.Status
+	switch {
+	case errors.Is(err, smpp.ErrResponseTimeout), errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return &sms.ProviderError{Provider: p.cfg.Name, Code: sms.ProviderTimeout, Err: err}
+	case errors.As(err, &status) && !status.Temporary():
+		return &sms.ProviderError{Provider: p.cfg.Name, Code: sms.ProviderRejected, Permanent: true, Err: err}
+	default:
+		return &sms.ProviderError{Provider: p.cfg.Name, Code: sms.ProviderUnavailable, Err: err}
+	}
+}
+
+// smppAddress returns the TON, NPI and digits for an E.164 number, or marks
+// addr as alphanumeric when it holds letters.
+func smppAddress(addr string) (byte, byte, string) {
+	if strings.HasPrefix(addr, "+") {
+		return smpp.TONInternational, smpp.NPIISDN, strings.TrimPrefix(addr, "+")
+	}
+	if strings.IndexFunc(addr, unicode.IsLetter) >= 0 {
+		return smpp.TONAlphanumeric, smpp.NPIUnknown, addr
+	}
+	return smpp.TONUnknown, smpp.NPIISDN, addr
+}
@@ -2,21 +2,30 @@ package messaging
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sms/internal/domain/sms"
 	"sms/pkg/logger"
 	"sms/pkg/rabbit"
+	"sync"
+	"time"
 )
 
 type SMSPublisher struct {
+	conn      *rabbit.RabbitConn
 	publisher *rabbit.Publisher
 	log       *logger.Logger
+
+	mu          sync.Mutex
+	delayQueues map[string]bool
 }
 
 func NewSMSPublisher(conn *rabbit.RabbitConn, log *logger.Logger) sms.EventPublisher {
 	return &SMSPublisher{
-		publisher: rabbit.NewPublisher(conn),
-		log:       log,
+		conn:        conn,
+		publisher:   rabbit.NewPublisher(conn),
+		log:         log,
+		delayQueues: make(map[string]bool),
 	}
 }
 
@@ -24,11 +33,57 @@ func (p *SMSPublisher) PublishEvent(ctx context.Context, event sms.DomainEvent)
 	switch event.EventType() {
 	case sms.EventTypeBillingRequested:
 		p.log.Info(ctx, "publishing billing requested event", "sms_id", event.AggregateID(), "routing_key", rabbit.BillingRequestedRoutingKey)
-		return p.publisher.Publish(rabbit.BillingRequestedRoutingKey, rabbit.Exchange, event)
+		return p.publish(ctx, rabbit.BillingRequestedRoutingKey, rabbit.Exchange, event)
+	case sms.EventTypeBatchBillingRequested:
+		p.log.Info(ctx, "publishing batch billing requested event", "batch_id", event.AggregateID(), "routing_key", rabbit.BatchBillingRequestedRoutingKey)
+		return p.publish(ctx, rabbit.BatchBillingRequestedRoutingKey, rabbit.Exchange, event)
+	case sms.EventTypeDispatchRequested:
+		p.log.Info(ctx, "publishing dispatch requested event", "sms_id", event.AggregateID(), "routing_key", rabbit.DispatchRoutingKey)
+		return p.publish(ctx, rabbit.DispatchRoutingKey, rabbit.Exchange, event)
 	case sms.EventTypeBillingRefunded:
 		p.log.Info(ctx, "publishing billing refunded event", "transaction_id", event.AggregateID(), "routing_key", rabbit.BillingRefundedRoutingKey)
-		return p.publisher.Publish(rabbit.BillingRefundedRoutingKey, rabbit.Exchange, event)
+		return p.publish(ctx, rabbit.BillingRefundedRoutingKey, rabbit.Exchange, event)
+	case sms.EventTypeDeliveryRetry:
+		retry, ok := event.(sms.SMSDeliveryRetry)
+		if !ok {
+			return fmt.Errorf("unexpected delivery retry event: %T", event)
+		}
+		queue, err := p.delayQueue(retry.Delay)
+		if err != nil {
+			return err
+		}
+		// the default exchange routes straight to the delay queue
+		p.log.Info(ctx, "publishing delivery retry event", "sms_id", event.AggregateID(), "queue", queue, "attempt", retry.Attempt)
+		return p.publish(ctx, queue, "", event)
 	default:
 		return fmt.Errorf("unknown event type: %s", event.EventType())
 	}
 }
+
+// publish marks the errors that publishing the event again cannot fix with
+// sms.ErrEventRejected.
+func (p *SMSPublisher) publish(ctx context.Context, routingKey, exchange string, event sms.DomainEvent) error {
+	err := p.publisher.Publish(ctx, routingKey, exchange, event)
+	if errors.Is(err, rabbit.ErrNacked) || errors.Is(err, rabbit.ErrUnroutable) {
+		return fmt.Errorf("%w: %w", sms.ErrEventRejected, err)
+	}
+	return err
+}
+
+// delayQueue declares the delay queue for delay the first time it is used.
+// Retry events stored in the outbox before the retry policy changed name
+// delays that startup no longer declares.
+func (p *SMSPublisher) delayQueue(delay time.Duration) (string, error) {
+	queue := rabbit.DelayQueueName(rabbit.DeliveryRetryQueue, delay)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.delayQueues[queue] {
+		return queue, nil
+	}
+	if err := p.conn.DeclareDelayQueue(queue, delay, rabbit.Exchange, rabbit.DeliveryRetryRoutingKey); err != nil {
+		return "", err
+	}
+	p.delayQueues[queue] = true
+	return queue, nil
+}
@@ -0,0 +1,39 @@
+package pricing
+
+import (
+	"context"
+	"fmt"
+	"sms/internal/domain/sms"
+)
+
+// StaticTariffRepo serves tariff plans declared in configuration.
+type StaticTariffRepo struct {
+	plans       map[string]sms.Tariff
+	userPlans   map[string]string
+	defaultPlan string
+}
+
+func NewStaticTariffRepo(plans []sms.Tariff, userPlans map[string]string, defaultPlan string) sms.TariffRepo {
+	byName := make(map[string]sms.Tariff, len(plans))
+	for _, plan := range plans {
+		byName[plan.Plan] = plan
+	}
+	return &StaticTariffRepo{
+		plans:       byName,
+		userPlans:   userPlans,
+		defaultPlan: defaultPlan,
+	}
+}
+
+func (r *StaticTariffRepo) GetTariff(ctx context.Context, userID string) (sms.Tariff, error) {
+	planName, ok := r.userPlans[userID]
+	if !ok {
+		planName = r.defaultPlan
+	}
+
+	plan, ok := r.plans[planName]
+	if !ok {
+		return sms.Tariff{}, fmt.Errorf("unknown tariff plan: %s", planName)
+	}
+	return plan, nil
+}
@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"context"
+	"sms/internal/domain/sms"
+	"sms/internal/infra/storage/mapper"
+
+	"gorm.io/gorm"
+)
+
+type AttemptRepository struct {
+	Db *gorm.DB
+}
+
+func NewAttemptRepository(db *gorm.DB) sms.AttemptRecorder {
+	return &AttemptRepository{
+		Db: db,
+	}
+}
+
+func (r *AttemptRepository) RecordAttempt(ctx context.Context, attempt sms.DeliveryAttempt) error {
+	return r.Db.WithContext(ctx).Create(mapper.AttemptTOStorage(attempt)).Error
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"sms/internal/domain/sms"
+	"sms/internal/infra/storage/mapper"
+	"sms/internal/infra/storage/types"
+
+	"gorm.io/gorm"
+)
+
+type BatchRepository struct {
+	Db *gorm.DB
+}
+
+func NewBatchRepository(db *gorm.DB) sms.BatchRepo {
+	return &BatchRepository{
+		Db: db,
+	}
+}
+
+func (r *BatchRepository) WithTx(tx *gorm.DB) sms.BatchRepo {
+	return &BatchRepository{
+		Db: tx,
+	}
+}
+
+func (r *BatchRepository) Create(ctx context.Context, batch *sms.SMSBatch) error {
+	return r.Db.WithContext(ctx).Create(mapper.BatchTOStorage(*batch)).Error
+}
+
+func (r *BatchRepository) Get(ctx context.Context, ID string) (*sms.SMSBatch, error) {
+	var model types.SMSBatch
+	if err := r.Db.WithContext(ctx).Where("id = ?", ID).First(&model).Error; err != nil {
+		return nil, err
+	}
+	return mapper.BatchTODomain(model), nil
+}
+
+func (r *BatchRepository) StatusCounts(ctx context.Context, batchID string) (map[sms.SMSStatus]int64, error) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	err := r.Db.WithContext(ctx).
+		Model(&types.SMS{}).
+		Select("status, count(*) AS count").
+		Where("batch_id = ?", batchID).
+		Group("status").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[sms.SMSStatus]int64, len(rows))
+	for _, row := range rows {
+		counts[sms.SMSStatus(row.Status)] = row.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sms/internal/domain/sms"
+	"sms/internal/infra/storage/mapper"
+	"sms/internal/infra/storage/types"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CampaignRepository struct {
+	Db *gorm.DB
+}
+
+func NewCampaignRepository(db *gorm.DB) sms.CampaignRepo {
+	return &CampaignRepository{
+		Db: db,
+	}
+}
+
+func (r *CampaignRepository) WithTx(tx *gorm.DB) sms.CampaignRepo {
+	return &CampaignRepository{
+		Db: tx,
+	}
+}
+
+func (r *CampaignRepository) Create(ctx context.Context, campaign *sms.Campaign) error {
+	return r.Db.WithContext(ctx).Create(mapper.CampaignTOStorage(*campaign)).Error
+}
+
+func (r *CampaignRepository) Get(ctx context.Context, ID string) (*sms.Campaign, error) {
+	return r.first(r.Db.WithContext(ctx).Where("id = ?", ID))
+}
+
+func (r *CampaignRepository) Lock(ctx context.Context, ID string) (*sms.Campaign, error) {
+	query := r.Db.
+		WithContext(ctx).
+		Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).
+		Where("id = ?", ID)
+	return r.first(query)
+}
+
+func (r *CampaignRepository) first(query *gorm.DB) (*sms.Campaign, error) {
+	var model types.Campaign
+	if err := query.First(&model).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, sms.ErrCampaignNotFound
+		}
+		return nil, err
+	}
+	return mapper.CampaignTODomain(model), nil
+}
+
+// ClaimNext locks with SKIP LOCKED; call it inside a transaction.
+func (r *CampaignRepository) ClaimNext(ctx context.Context, status sms.CampaignStatus, dueBy time.Time) (*sms.Campaign, error) {
+	query := r.Db.
+		WithContext(ctx).
+		Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsSkipLocked}).
+		Where("status = ?", string(status))
+	if !dueBy.IsZero() {
+		query = query.Where("start_at IS NULL OR start_at <= ?", dueBy)
+	}
+
+	var models []types.Campaign
+	if err := query.Order("created_at").Limit(1).Find(&models).Error; err != nil {
+		return nil, err
+	}
+	if len(models) == 0 {
+		return nil, nil
+	}
+	return mapper.CampaignTODomain(models[0]), nil
+}
+
+// Update writes the status, counters and source, including zero values.
+func (r *CampaignRepository) Update(ctx context.Context, campaign *sms.Campaign) error {
+	model := mapper.CampaignTOStorage(*campaign)
+	return r.Db.
+		WithContext(ctx).
+		Model(&types.Campaign{}).
+		Where("id = ?", campaign.ID).
+		Updates(map[string]any{
+			"status":         model.Status,
+			"start_at":       model.StartAt,
+			"source":         model.Source,
+			"error":          model.Error,
+			"total_rows":     model.TotalRows,
+			"invalid_rows":   model.InvalidRows,
+			"queued_rows":    model.QueuedRows,
+			"failed_rows":    model.FailedRows,
+			"cancelled_rows": model.CancelledRows,
+			"updated_at":     time.Now(),
+		}).Error
+}
+
+func (r *CampaignRepository) AddRecipients(ctx context.Context, recipients []*sms.CampaignRecipient, batchSize int) error {
+	models := make([]*types.CampaignRecipient, 0, len(recipients))
+	for _, recipient := range recipients {
+		models = append(models, mapper.RecipientTOStorage(*recipient))
+	}
+	return r.Db.WithContext(ctx).CreateInBatches(models, batchSize).Error
+}
+
+func (r *CampaignRepository) PendingRecipients(ctx context.Context, campaignID string, limit int) ([]*sms.CampaignRecipient, error) {
+	return r.recipients(r.Db.
+		WithContext(ctx).
+		Where("campaign_id = ?", campaignID).
+		Where("status = ?", string(sms.RecipientStatusPending)).
+		Order("line").
+		Limit(limit))
+}
+
+func (r *CampaignRepository) InvalidRecipients(ctx context.Context, campaignID string, afterLine, limit int) ([]*sms.CampaignRecipient, error) {
+	return r.recipients(r.Db.
+		WithContext(ctx).
+		Where("campaign_id = ?", campaignID).
+		Where("status = ?", string(sms.RecipientStatusInvalid)).
+		Where("line > ?", afterLine).
+		Order("line").
+		Limit(limit))
+}
+
+func (r *CampaignRepository) recipients(query *gorm.DB) ([]*sms.CampaignRecipient, error) {
+	var models []types.CampaignRecipient
+	if err := query.Find(&models).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*sms.CampaignRecipient, 0, len(models))
+	for _, model := range models {
+		result = append(result, mapper.RecipientTODomain(model))
+	}
+	return result, nil
+}
+
+// UpdateRecipients writes the status and error of each recipient, with one
+// UPDATE per distinct pair.
+func (r *CampaignRepository) UpdateRecipients(ctx context.Context, recipients []*sms.CampaignRecipient) error {
+	type outcome struct {
+		status sms.RecipientStatus
+		error  string
+	}
+	groups := make(map[outcome][]string)
+	for _, recipient := range recipients {
+		key := outcome{recipient.Status, recipient.Error}
+		groups[key] = append(groups[key], recipient.ID)
+	}
+
+	for key, ids := range groups {
+		var reason *string
+		if key.error != "" {
+			reason = &key.error
+		}
+		err := r.Db.
+			WithContext(ctx).
+			Model(&types.CampaignRecipient{}).
+			Where("id IN ?", ids).
+			Updates(map[string]any{
+				"status":     string(key.status),
+				"error":      reason,
+				"updated_at": time.Now(),
+			}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *CampaignRepository) CancelPending(ctx context.Context, campaignID string) (int64, error) {
+	result := r.Db.
+		WithContext(ctx).
+		Model(&types.CampaignRecipient{}).
+		Where("campaign_id = ?", campaignID).
+		Where("status = ?", string(sms.RecipientStatusPending)).
+		Updates(map[string]any{
+			"status":     string(sms.RecipientStatusCancelled),
+			"updated_at": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
+
+// SMSStatusCounts relies on the SMS of a recipient taking its ID.
+func (r *CampaignRepository) SMSStatusCounts(ctx context.Context, campaignID string) (map[sms.SMSStatus]int64, error) {
+	recipients := r.Db.
+		Model(&types.CampaignRecipient{}).
+		Select("id").
+		Where("campaign_id = ?", campaignID).
+		Where("status = ?", string(sms.RecipientStatusQueued))
+
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	err := r.Db.WithContext(ctx).
+		Model(&types.SMS{}).
+		Select("status, count(*) AS count").
+		Where("id IN (?)", recipients).
+		Group("status").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[sms.SMSStatus]int64, len(rows))
+	for _, row := range rows {
+		counts[sms.SMSStatus(row.Status)] = row.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"sms/internal/domain/sms"
+	"sms/internal/infra/storage/types"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type InboxRepository struct {
+	Db *gorm.DB
+}
+
+func NewInboxRepository(db *gorm.DB) sms.InboxRepo {
+	return &InboxRepository{
+		Db: db,
+	}
+}
+
+func (r *InboxRepository) WithTx(tx *gorm.DB) sms.InboxRepo {
+	return &InboxRepository{
+		Db: tx,
+	}
+}
+
+func (r *InboxRepository) MarkProcessed(ctx context.Context, transactionID, smsID string) (bool, error) {
+	model := types.InboxEvent{
+		TransactionID: transactionID,
+		SMSID:         smsID,
+		ProcessedAt:   time.Now(),
+	}
+	result := r.Db.
+		WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
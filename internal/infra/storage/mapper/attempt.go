@@ -0,0 +1,25 @@
+package mapper
+
+import (
+	"sms/internal/domain/sms"
+	"sms/internal/infra/storage/types"
+)
+
+func AttemptTOStorage(attempt sms.DeliveryAttempt) *types.DeliveryAttempt {
+	model := &types.DeliveryAttempt{
+		SMSID:       attempt.SMSID,
+		Provider:    attempt.Provider,
+		LatencyMs:   attempt.Latency.Milliseconds(),
+		AttemptedAt: attempt.AttemptedAt,
+	}
+
+	if attempt.Error != "" {
+		model.Error = &attempt.Error
+	}
+
+	if attempt.Code != "" {
+		model.Code = &attempt.Code
+	}
+
+	return model
+}
@@ -0,0 +1,30 @@
+package mapper
+
+import (
+	"sms/internal/domain/sms"
+	"sms/internal/infra/storage/types"
+)
+
+func BatchTODomain(model types.SMSBatch) *sms.SMSBatch {
+	return &sms.SMSBatch{
+		ID:          model.ID,
+		UserID:      model.UserID,
+		Total:       model.Total,
+		Amount:      model.Amount,
+		BillingMode: sms.BillingMode(model.BillingMode),
+		CreatedAt:   model.CreatedAt,
+	}
+}
+
+func BatchTOStorage(batch sms.SMSBatch) *types.SMSBatch {
+	return &types.SMSBatch{
+		Base: types.Base{
+			ID:        batch.ID,
+			CreatedAt: batch.CreatedAt,
+		},
+		UserID:      batch.UserID,
+		Total:       batch.Total,
+		Amount:      batch.Amount,
+		BillingMode: string(batch.BillingMode),
+	}
+}
@@ -0,0 +1,104 @@
+package mapper
+
+import (
+	"encoding/json"
+	"sms/internal/domain/sms"
+	"sms/internal/infra/storage/types"
+)
+
+func CampaignTODomain(model types.Campaign) *sms.Campaign {
+	result := &sms.Campaign{
+		ID:            model.ID,
+		UserID:        model.UserID,
+		Name:          model.Name,
+		Template:      model.Template,
+		Status:        sms.CampaignStatus(model.Status),
+		Source:        model.Source,
+		TotalRows:     model.TotalRows,
+		InvalidRows:   model.InvalidRows,
+		QueuedRows:    model.QueuedRows,
+		FailedRows:    model.FailedRows,
+		CancelledRows: model.CancelledRows,
+		CreatedAt:     model.CreatedAt,
+		UpdatedAt:     model.UpdatedAt,
+	}
+
+	if model.StartAt != nil {
+		result.StartAt = *model.StartAt
+	}
+
+	if model.Error != nil {
+		result.Error = *model.Error
+	}
+
+	return result
+}
+
+func CampaignTOStorage(campaign sms.Campaign) *types.Campaign {
+	model := &types.Campaign{
+		Base: types.Base{
+			ID:        campaign.ID,
+			CreatedAt: campaign.CreatedAt,
+			UpdatedAt: campaign.UpdatedAt,
+		},
+		UserID:        campaign.UserID,
+		Name:          campaign.Name,
+		Template:      campaign.Template,
+		Status:        string(campaign.Status),
+		Source:        campaign.Source,
+		TotalRows:     campaign.TotalRows,
+		InvalidRows:   campaign.InvalidRows,
+		QueuedRows:    campaign.QueuedRows,
+		FailedRows:    campaign.FailedRows,
+		CancelledRows: campaign.CancelledRows,
+	}
+
+	if !campaign.StartAt.IsZero() {
+		model.StartAt = &campaign.StartAt
+	}
+
+	if campaign.Error != "" {
+		model.Error = &campaign.Error
+	}
+
+	return model
+}
+
+func RecipientTODomain(model types.CampaignRecipient) *sms.CampaignRecipient {
+	result := &sms.CampaignRecipient{
+		ID:         model.ID,
+		CampaignID: model.CampaignID,
+		Line:       model.Line,
+		Receiver:   model.Receiver,
+		Status:     sms.RecipientStatus(model.Status),
+	}
+
+	// rows are only written by RecipientTOStorage, so the JSON is valid
+	_ = json.Unmarshal([]byte(model.Variables), &result.Variables)
+
+	if model.Error != nil {
+		result.Error = *model.Error
+	}
+
+	return result
+}
+
+func RecipientTOStorage(recipient sms.CampaignRecipient) *types.CampaignRecipient {
+	variables, _ := json.Marshal(recipient.Variables)
+	model := &types.CampaignRecipient{
+		Base: types.Base{
+			ID: recipient.ID,
+		},
+		CampaignID: recipient.CampaignID,
+		Status:     string(recipient.Status),
+		Line:       recipient.Line,
+		Receiver:   recipient.Receiver,
+		Variables:  string(variables),
+	}
+
+	if recipient.Error != "" {
+		model.Error = &recipient.Error
+	}
+
+	return model
+}
@@ -0,0 +1,30 @@
+package mapper
+
+import (
+	"sms/internal/domain/sms"
+	"sms/internal/infra/storage/types"
+)
+
+func OutboxTODomain(model types.OutboxEvent) sms.OutboxMessage {
+	result := sms.OutboxMessage{
+		ID:          model.ID,
+		EventType:   sms.EventType(model.EventType),
+		AggregateID: model.AggregateID,
+		Payload:     model.Payload,
+		TraceID:     model.TraceID,
+		TraceParent: model.TraceParent,
+		Status:      sms.OutboxStatus(model.Status),
+		Attempts:    model.Attempts,
+		CreatedAt:   model.CreatedAt,
+	}
+
+	if model.LastError != nil {
+		result.LastError = *model.LastError
+	}
+
+	if model.SentAt != nil {
+		result.SentAt = *model.SentAt
+	}
+
+	return result
+}
@@ -1,19 +1,22 @@
 package mapper
 
 import (
+	"encoding/json"
 	"sms/internal/domain/sms"
 	"sms/internal/infra/storage/types"
 )
 
 func TODomain(model types.SMS) *sms.SMSMessage {
 	result := &sms.SMSMessage{
-		ID:        model.ID,
-		UserID:    model.UserID,
-		Content:   model.Content,
-		Receiver:  model.Receiver,
-		Status:    sms.SMSStatus(model.Status),
-		CreatedAt: model.CreatedAt,
-		UpdatedAt: model.UpdatedAt,
+		ID:           model.ID,
+		UserID:       model.UserID,
+		Content:      model.Content,
+		Receiver:     model.Receiver,
+		Status:       sms.SMSStatus(model.Status),
+		SegmentCount: model.SegmentCount,
+		Amount:       model.Amount,
+		CreatedAt:    model.CreatedAt,
+		UpdatedAt:    model.UpdatedAt,
 	}
 
 	// Handle nullable fields safely
@@ -21,6 +24,10 @@ func TODomain(model types.SMS) *sms.SMSMessage {
 		result.Provider = *model.Provider
 	}
 
+	if model.ProviderMessageID != nil {
+		result.ProviderMessageID = *model.ProviderMessageID
+	}
+
 	if model.DeliveredAt != nil {
 		result.DeliveredAt = *model.DeliveredAt
 	}
@@ -29,27 +36,78 @@ func TODomain(model types.SMS) *sms.SMSMessage {
 		result.FailureCode = *model.FailureCode
 	}
 
+	if model.BatchID != nil {
+		result.BatchID = *model.BatchID
+	}
+
+	if model.SendAt != nil {
+		result.SendAt = *model.SendAt
+	}
+
+	if model.TransactionID != nil {
+		result.TransactionID = *model.TransactionID
+	}
+
 	if model.DeletedAt != nil {
 		result.DeletedAt = *model.DeletedAt
 	}
 
+	// rows are only written by TOStorage, so the JSON is valid
+	if model.ProviderPartIDs != nil {
+		_ = json.Unmarshal([]byte(*model.ProviderPartIDs), &result.ProviderPartIDs)
+	}
+
+	if model.DeliveredPartIDs != nil {
+		_ = json.Unmarshal([]byte(*model.DeliveredPartIDs), &result.DeliveredPartIDs)
+	}
+
 	return result
 }
 
 func TOStorage(sms sms.SMSMessage) *types.SMS {
-	return &types.SMS{
+	model := &types.SMS{
 		Base: types.Base{
 			ID:        sms.ID,
 			CreatedAt: sms.CreatedAt,
 			UpdatedAt: sms.UpdatedAt,
 			DeletedAt: &sms.DeletedAt,
 		},
-		UserID:      sms.UserID,
-		Content:     sms.Content,
-		Receiver:    sms.Receiver,
-		Provider:    &sms.Provider,
-		Status:      string(sms.Status),
-		DeliveredAt: &sms.DeliveredAt,
-		FailureCode: &sms.FailureCode,
+		UserID:            sms.UserID,
+		Content:           sms.Content,
+		Receiver:          sms.Receiver,
+		Provider:          &sms.Provider,
+		ProviderMessageID: &sms.ProviderMessageID,
+		Status:            string(sms.Status),
+		SegmentCount:      sms.SegmentCount,
+		Amount:            sms.Amount,
+		DeliveredAt:       &sms.DeliveredAt,
+		FailureCode:       &sms.FailureCode,
 	}
+
+	// batch_id is a UUID column, so single sends store NULL
+	if sms.BatchID != "" {
+		model.BatchID = &sms.BatchID
+	}
+
+	if !sms.SendAt.IsZero() {
+		model.SendAt = &sms.SendAt
+	}
+
+	if sms.TransactionID != "" {
+		model.TransactionID = &sms.TransactionID
+	}
+
+	if len(sms.ProviderPartIDs) > 0 {
+		raw, _ := json.Marshal(sms.ProviderPartIDs)
+		partIDs := string(raw)
+		model.ProviderPartIDs = &partIDs
+	}
+
+	if len(sms.DeliveredPartIDs) > 0 {
+		raw, _ := json.Marshal(sms.DeliveredPartIDs)
+		deliveredPartIDs := string(raw)
+		model.DeliveredPartIDs = &deliveredPartIDs
+	}
+
+	return model
 }
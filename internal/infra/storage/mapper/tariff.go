@@ -0,0 +1,22 @@
+package mapper
+
+import (
+	"sms/internal/domain/sms"
+	"sms/internal/infra/storage/types"
+)
+
+func TariffTODomain(model types.TariffPlan) sms.Tariff {
+	result := sms.Tariff{
+		Plan:                   model.Name,
+		DefaultPricePerSegment: model.DefaultPricePerSegment,
+	}
+
+	for _, rate := range model.Rates {
+		result.Rates = append(result.Rates, sms.TariffRate{
+			Prefix:          rate.Prefix,
+			PricePerSegment: rate.PricePerSegment,
+		})
+	}
+
+	return result
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"sms/internal/domain/sms"
+	"sms/internal/infra/storage/mapper"
+	"sms/internal/infra/storage/types"
+	"sms/pkg/logger"
+	"sms/pkg/tracing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OutboxRepository struct {
+	Db *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) sms.OutboxRepo {
+	return &OutboxRepository{
+		Db: db,
+	}
+}
+
+func (r *OutboxRepository) WithTx(tx *gorm.DB) sms.OutboxRepo {
+	return &OutboxRepository{
+		Db: tx,
+	}
+}
+
+func (r *OutboxRepository) Add(ctx context.Context, event sms.DomainEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	model := types.OutboxEvent{
+		EventType:   string(event.EventType()),
+		AggregateID: event.AggregateID(),
+		Payload:     payload,
+		TraceID:     logger.GetTraceID(ctx),
+		TraceParent: tracing.TraceParent(ctx),
+		Status:      string(sms.OutboxStatusPending),
+	}
+	return r.Db.WithContext(ctx).Create(&model).Error
+}
+
+// ClaimPending locks the oldest unclaimed pending events with SKIP LOCKED and
+// sets their claim, so several relay workers can run side by side without
+// holding the locks while they publish; call it inside a transaction.
+func (r *OutboxRepository) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]sms.OutboxMessage, error) {
+	now := time.Now()
+	var models []types.OutboxEvent
+	err := r.Db.
+		WithContext(ctx).
+		Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsSkipLocked}).
+		Where("status = ?", string(sms.OutboxStatusPending)).
+		Where("claimed_until IS NULL OR claimed_until < ?", now).
+		Order("created_at").
+		Limit(limit).
+		Find(&models).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(models) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, 0, len(models))
+	for _, model := range models {
+		ids = append(ids, model.ID)
+	}
+	err = r.Db.
+		WithContext(ctx).
+		Model(&types.OutboxEvent{}).
+		Where("id IN ?", ids).
+		Update("claimed_until", now.Add(lease)).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]sms.OutboxMessage, 0, len(models))
+	for _, model := range models {
+		result = append(result, mapper.OutboxTODomain(model))
+	}
+	return result, nil
+}
+
+func (r *OutboxRepository) MarkSent(ctx context.Context, ID string) error {
+	return r.Db.
+		WithContext(ctx).
+		Model(&types.OutboxEvent{}).
+		Where("id = ?", ID).
+		Updates(map[string]any{
+			"status":   string(sms.OutboxStatusSent),
+			"sent_at":  time.Now(),
+			"attempts": gorm.Expr("attempts + 1"),
+		}).Error
+}
+
+func (r *OutboxRepository) MarkFailed(ctx context.Context, ID string, reason string) error {
+	return r.Db.
+		WithContext(ctx).
+		Model(&types.OutboxEvent{}).
+		Where("id = ?", ID).
+		Updates(map[string]any{
+			"status":     string(sms.OutboxStatusFailed),
+			"last_error": reason,
+			"attempts":   gorm.Expr("attempts + 1"),
+		}).Error
+}
+
+func (r *OutboxRepository) RecordAttempt(ctx context.Context, ID string, reason string) error {
+	return r.Db.
+		WithContext(ctx).
+		Model(&types.OutboxEvent{}).
+		Where("id = ?", ID).
+		Updates(map[string]any{
+			"last_error":    reason,
+			"attempts":      gorm.Expr("attempts + 1"),
+			"claimed_until": nil,
+		}).Error
+}
+
+func (r *OutboxRepository) Release(ctx context.Context, IDs []string) error {
+	if len(IDs) == 0 {
+		return nil
+	}
+	return r.Db.
+		WithContext(ctx).
+		Model(&types.OutboxEvent{}).
+		Where("id IN ?", IDs).
+		Update("claimed_until", nil).Error
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"fmt"
+	"sms/internal/infra/storage/types"
+
+	"gorm.io/gorm"
+)
+
+// smsListIndexes back SMS listing: each filter column leads an index that
+// continues with the (created_at, id) page order. They are created by hand
+// because created_at lives in the shared Base model.
+var smsListIndexes = []struct {
+	name    string
+	columns string
+}{
+	{"idx_sms_created_at_id", "created_at DESC, id DESC"},
+	{"idx_sms_user_created_at", "user_id, created_at DESC, id DESC"},
+	{"idx_sms_status_created_at", "status, created_at DESC, id DESC"},
+	{"idx_sms_receiver_created_at", "receiver, created_at DESC, id DESC"},
+	{"idx_sms_provider_created_at", "provider, created_at DESC, id DESC"},
+	{"idx_sms_batch_created_at", "batch_id, created_at DESC, id DESC"},
+}
+
+// MigrateSMSIndexes creates the listing indexes that do not exist yet.
+func MigrateSMSIndexes(db *gorm.DB) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&types.SMS{}); err != nil {
+		return err
+	}
+	for _, index := range smsListIndexes {
+		sql := fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", index.name, stmt.Quote(stmt.Schema.Table), index.columns)
+		if err := db.Exec(sql).Error; err != nil {
+			return fmt.Errorf("create index %s: %w", index.name, err)
+		}
+	}
+	return nil
+}
@@ -2,11 +2,15 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"sms/internal/domain/sms"
 	"sms/internal/infra/storage/mapper"
 	"sms/internal/infra/storage/types"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type SMSRepository struct {
@@ -39,6 +43,16 @@ func (r *SMSRepository) GetByFilter(ctx context.Context, filter sms.Filter) (*sm
 		query = query.Where("user_id = ?", *filter.UserID)
 	}
 
+	if filter.Provider != nil {
+		query = query.Where("provider = ?", *filter.Provider)
+	}
+
+	// any part of a multipart message identifies it
+	if filter.ProviderMessageID != nil {
+		partID, _ := json.Marshal([]string{*filter.ProviderMessageID})
+		query = query.Where("(provider_message_id = ? OR provider_part_ids @> ?::jsonb)", *filter.ProviderMessageID, string(partID))
+	}
+
 	if err := query.First(&sms).Error; err != nil {
 		return nil, err
 	}
@@ -50,11 +64,161 @@ func (r *SMSRepository) Create(ctx context.Context, message *sms.SMSMessage) err
 	return r.Db.WithContext(ctx).Create(&model).Error
 }
 
-func (r *SMSRepository) Update(ctx context.Context, ID string, message *sms.SMSMessage) error {
+// CreateInBatches inserts the messages with one INSERT per batchSize rows.
+func (r *SMSRepository) CreateInBatches(ctx context.Context, messages []*sms.SMSMessage, batchSize int) error {
+	models := make([]*types.SMS, 0, len(messages))
+	for _, message := range messages {
+		models = append(models, mapper.TOStorage(*message))
+	}
+	return r.Db.WithContext(ctx).CreateInBatches(models, batchSize).Error
+}
+
+// Update persists the message only if the stored status is still from. The
+// use case may move a message through several statuses in memory, so the
+// row is compared with the status it was read with rather than with the
+// statuses that lead to the new one.
+func (r *SMSRepository) Update(ctx context.Context, ID string, from sms.SMSStatus, message *sms.SMSMessage) error {
 	var model types.SMS
-	return r.Db.
+	result := r.Db.
 		WithContext(ctx).
 		Model(&model).
 		Where("id = ?", ID).
-		Updates(mapper.TOStorage(*message)).Error
+		Where("status = ?", string(from)).
+		Updates(mapper.TOStorage(*message))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	current, err := r.GetByFilter(ctx, sms.Filter{ID: &ID})
+	if err != nil {
+		return err
+	}
+	return &sms.InvalidTransitionError{From: current.Status, To: message.Status}
+}
+
+func (r *SMSRepository) Lock(ctx context.Context, ID string) (*sms.SMSMessage, error) {
+	var model types.SMS
+	err := r.Db.
+		WithContext(ctx).
+		Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).
+		Where("id = ?", ID).
+		First(&model).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, sms.ErrSMSNotFound
+		}
+		return nil, err
+	}
+	return mapper.TODomain(model), nil
+}
+
+// ClaimDue locks with SKIP LOCKED; call it inside a transaction.
+func (r *SMSRepository) ClaimDue(ctx context.Context, dueBy time.Time, limit int) ([]*sms.SMSMessage, error) {
+	var models []types.SMS
+	err := r.Db.
+		WithContext(ctx).
+		Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsSkipLocked}).
+		Where("status = ?", string(sms.SMSStatusScheduled)).
+		Where("send_at <= ?", dueBy).
+		Order("send_at").
+		Limit(limit).
+		Find(&models).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*sms.SMSMessage, 0, len(models))
+	for _, model := range models {
+		result = append(result, mapper.TODomain(model))
+	}
+	return result, nil
+}
+
+func (r *SMSRepository) ClaimStuckSending(ctx context.Context, sendingSince time.Time, limit int) ([]*sms.SMSMessage, error) {
+	var models []types.SMS
+	err := r.Db.
+		WithContext(ctx).
+		Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsSkipLocked}).
+		Where("status = ?", string(sms.SMSStatusSending)).
+		Where("updated_at < ?", sendingSince).
+		Order("updated_at").
+		Limit(limit).
+		Find(&models).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*sms.SMSMessage, 0, len(models))
+	for _, model := range models {
+		result = append(result, mapper.TODomain(model))
+	}
+	return result, nil
+}
+
+// List pages through messages by (created_at, id) descending. It reads one
+// message past the page to tell whether another page follows.
+func (r *SMSRepository) List(ctx context.Context, filter sms.ListFilter, page sms.Page) (sms.ListResult, error) {
+	page = page.Normalize()
+	query := r.listQuery(ctx, filter)
+
+	var result sms.ListResult
+	if page.WithTotal {
+		var total int64
+		if err := query.Session(&gorm.Session{}).Model(&types.SMS{}).Count(&total).Error; err != nil {
+			return result, err
+		}
+		result.Total = &total
+	}
+
+	if page.Cursor != nil {
+		query = query.Where("(created_at, id) < (?, ?)", page.Cursor.CreatedAt, page.Cursor.ID)
+	}
+	var models []types.SMS
+	err := query.
+		Order("created_at DESC").
+		Order("id DESC").
+		Limit(page.Limit + 1).
+		Find(&models).Error
+	if err != nil {
+		return result, err
+	}
+
+	if len(models) > page.Limit {
+		models = models[:page.Limit]
+		result.Next = sms.CursorAfter(mapper.TODomain(models[len(models)-1]))
+	}
+	result.Messages = make([]*sms.SMSMessage, 0, len(models))
+	for _, model := range models {
+		result.Messages = append(result.Messages, mapper.TODomain(model))
+	}
+	return result, nil
+}
+
+func (r *SMSRepository) listQuery(ctx context.Context, filter sms.ListFilter) *gorm.DB {
+	query := r.Db.WithContext(ctx)
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.Status != nil {
+		query = query.Where("status = ?", *filter.Status)
+	}
+	if filter.Receiver != nil {
+		query = query.Where("receiver = ?", *filter.Receiver)
+	}
+	if filter.Provider != nil {
+		query = query.Where("provider = ?", *filter.Provider)
+	}
+	if filter.BatchID != nil {
+		query = query.Where("batch_id = ?", *filter.BatchID)
+	}
+	if filter.CreatedFrom != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		query = query.Where("created_at < ?", *filter.CreatedTo)
+	}
+	return query
 }
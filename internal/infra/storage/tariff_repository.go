@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sms/internal/domain/sms"
+	"sms/internal/infra/storage/mapper"
+	"sms/internal/infra/storage/types"
+
+	"gorm.io/gorm"
+)
+
+type TariffRepository struct {
+	Db          *gorm.DB
+	defaultPlan string
+}
+
+// NewTariffRepository loads tariff plans from the database; users without a
+// row in the user tariffs table get defaultPlan.
+func NewTariffRepository(db *gorm.DB, defaultPlan string) sms.TariffRepo {
+	return &TariffRepository{
+		Db:          db,
+		defaultPlan: defaultPlan,
+	}
+}
+
+func (r *TariffRepository) GetTariff(ctx context.Context, userID string) (sms.Tariff, error) {
+	planName := r.defaultPlan
+
+	var userTariff types.UserTariff
+	err := r.Db.WithContext(ctx).Where("user_id = ?", userID).First(&userTariff).Error
+	switch {
+	case err == nil:
+		planName = userTariff.Plan
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return sms.Tariff{}, err
+	}
+
+	var plan types.TariffPlan
+	if err := r.Db.WithContext(ctx).Preload("Rates").Where("name = ?", planName).First(&plan).Error; err != nil {
+		return sms.Tariff{}, err
+	}
+	return mapper.TariffTODomain(plan), nil
+}
@@ -0,0 +1,15 @@
+package types
+
+import (
+	"time"
+)
+
+type DeliveryAttempt struct {
+	Base
+	SMSID       string `gorm:"type:uuid;index"`
+	Provider    string
+	Error       *string
+	Code        *string
+	LatencyMs   int64
+	AttemptedAt time.Time
+}
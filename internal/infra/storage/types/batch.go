@@ -0,0 +1,9 @@
+package types
+
+type SMSBatch struct {
+	Base
+	UserID      string `gorm:"index"`
+	Total       int
+	Amount      int64
+	BillingMode string
+}
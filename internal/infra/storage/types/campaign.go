@@ -0,0 +1,31 @@
+package types
+
+import (
+	"time"
+)
+
+type Campaign struct {
+	Base
+	UserID        string `gorm:"index"`
+	Name          string
+	Template      string
+	Status        string `gorm:"index"`
+	StartAt       *time.Time
+	Source        []byte
+	Error         *string
+	TotalRows     int
+	InvalidRows   int
+	QueuedRows    int
+	FailedRows    int
+	CancelledRows int
+}
+
+type CampaignRecipient struct {
+	Base
+	CampaignID string `gorm:"type:uuid;index:idx_campaign_recipient_status,priority:1"`
+	Status     string `gorm:"index:idx_campaign_recipient_status,priority:2"`
+	Line       int    `gorm:"index:idx_campaign_recipient_status,priority:3"`
+	Receiver   string
+	Variables  string `gorm:"type:jsonb"`
+	Error      *string
+}
@@ -0,0 +1,11 @@
+package types
+
+import (
+	"time"
+)
+
+type InboxEvent struct {
+	TransactionID string `gorm:"primaryKey"`
+	SMSID         string `gorm:"primaryKey;type:uuid"`
+	ProcessedAt   time.Time
+}
@@ -0,0 +1,20 @@
+package types
+
+import (
+	"time"
+)
+
+type OutboxEvent struct {
+	Base
+	EventType   string
+	AggregateID string
+	Payload     []byte
+	TraceID     string
+	TraceParent string
+	Status      string `gorm:"index"`
+	Attempts    int
+	LastError   *string
+	SentAt      *time.Time
+	// ClaimedUntil hides the event from other relays while one publishes it.
+	ClaimedUntil *time.Time
+}
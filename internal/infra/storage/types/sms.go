@@ -6,11 +6,23 @@ import (
 
 type SMS struct {
 	Base
-	UserID      string
-	Content     string
-	Receiver    string
-	Provider    *string
-	Status      string
-	DeliveredAt *time.Time
-	FailureCode *string
+	UserID            string
+	Content           string
+	Receiver          string
+	Provider          *string `gorm:"index:idx_sms_provider_message_id,priority:1"`
+	ProviderMessageID *string `gorm:"index:idx_sms_provider_message_id,priority:2"`
+	Status            string
+	SegmentCount      int
+	Amount            int64
+	DeliveredAt       *time.Time
+	FailureCode       *string
+	BatchID           *string `gorm:"type:uuid"`
+	// only scheduled messages are looked up by send time
+	SendAt *time.Time `gorm:"index:idx_sms_scheduled_send_at,where:status = 'scheduled'"`
+	// receipts for any part of a multipart message are matched by
+	// containment, hence the GIN index
+	ProviderPartIDs *string `gorm:"type:jsonb;index:idx_sms_provider_part_ids,type:gin"`
+	TransactionID   *string
+	// delivered parts of a multipart message, as a JSON array
+	DeliveredPartIDs *string `gorm:"type:jsonb"`
 }
@@ -0,0 +1,19 @@
+package types
+
+type TariffPlan struct {
+	Name                   string `gorm:"primaryKey"`
+	DefaultPricePerSegment int64
+	Rates                  []TariffRate `gorm:"foreignKey:Plan;references:Name"`
+}
+
+type TariffRate struct {
+	ID              uint   `gorm:"primaryKey"`
+	Plan            string `gorm:"index"`
+	Prefix          string
+	PricePerSegment int64
+}
+
+type UserTariff struct {
+	UserID string `gorm:"type:uuid;primaryKey"`
+	Plan   string
+}
@@ -0,0 +1,192 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"sms/internal/domain/sms"
+	"sms/pkg/metrics"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WithBatches sets where bulk sends are stored.
+func (u *Service) WithBatches(batches sms.BatchRepo, policy sms.BulkPolicy) *Service {
+	u.batches = batches
+	u.bulk = policy
+	return u
+}
+
+// CreateAndBillBatch stores a bulk send and queues its billing. Every message
+// is priced before anything is stored, so one bad recipient rejects the whole
+// batch. Depending on the bulk policy one debit covers the batch or each SMS
+// is debited like a single send.
+func (u *Service) CreateAndBillBatch(ctx context.Context, batch *sms.SMSBatch, messages []*sms.SMSMessage) error {
+	u.log.Info(ctx, "creating SMS batch and requesting billing", "batch_id", batch.ID, "user_id", batch.UserID, "recipients", len(messages))
+
+	for i, smsMsg := range messages {
+		if err := u.prepareBilling(ctx, smsMsg); err != nil {
+			u.log.Error(ctx, "SMS of batch cannot be billed", "error", err, "batch_id", batch.ID, "recipient", i)
+			return fmt.Errorf("recipient %d: %w", i, err)
+		}
+	}
+
+	err := u.inTx(ctx, func(tx *gorm.DB) error {
+		return u.storeBatch(ctx, tx, batch, messages)
+	})
+	if err != nil {
+		return err
+	}
+	u.log.Info(ctx, "SMS batch created and billing requests queued in outbox", "batch_id", batch.ID, "billing_mode", string(batch.BillingMode), "amount", batch.Amount)
+	metrics.SMSCreated.Add(float64(len(messages)))
+
+	return nil
+}
+
+// storeBatch stores a batch of priced messages together with their billing
+// requests.
+func (u *Service) storeBatch(ctx context.Context, tx *gorm.DB, batch *sms.SMSBatch, messages []*sms.SMSMessage) error {
+	batch.Total = len(messages)
+	batch.Amount = 0
+	batch.BillingMode = u.bulk.BillingMode
+	for _, smsMsg := range messages {
+		smsMsg.BatchID = batch.ID
+		batch.Amount += smsMsg.Amount
+	}
+
+	var events []sms.DomainEvent
+	if batch.BillingMode == sms.BillingPerMessage {
+		for _, smsMsg := range messages {
+			events = append(events, sms.RequestSMSBilling{
+				UserID:    smsMsg.UserID,
+				SMSID:     smsMsg.ID,
+				Amount:    smsMsg.Amount,
+				TimeStamp: time.Now(),
+			})
+		}
+	} else {
+		events = append(events, sms.RequestBatchBilling{
+			UserID:    batch.UserID,
+			BatchID:   batch.ID,
+			Count:     batch.Total,
+			Amount:    batch.Amount,
+			TimeStamp: time.Now(),
+		})
+	}
+
+	if err := u.batches.WithTx(tx).Create(ctx, batch); err != nil {
+		u.log.Error(ctx, "failed to create SMS batch in database", "error", err, "batch_id", batch.ID)
+		return err
+	}
+	if err := u.smsRepo.WithTx(tx).CreateInBatches(ctx, messages, u.bulk.InsertBatchSize); err != nil {
+		u.log.Error(ctx, "failed to create SMS of batch in database", "error", err, "batch_id", batch.ID)
+		return err
+	}
+	outbox := u.outbox.WithTx(tx)
+	for _, event := range events {
+		if err := outbox.Add(ctx, event); err != nil {
+			u.log.Error(ctx, "failed to store billing request in outbox", "error", err, "batch_id", batch.ID)
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareBilling segments and prices a new SMS and marks it as awaiting
+// billing.
+func (u *Service) prepareBilling(ctx context.Context, smsMsg *sms.SMSMessage) error {
+	if err := smsMsg.SetSegmentCount(); err != nil {
+		return err
+	}
+	if err := u.priceSMS(ctx, smsMsg); err != nil {
+		return err
+	}
+	return smsMsg.TransitionTo(sms.SMSStatusBillingRequested)
+}
+
+// prepareBillingWith is prepareBilling with the user's tariff already loaded.
+func prepareBillingWith(tariff sms.Tariff, smsMsg *sms.SMSMessage) error {
+	if err := smsMsg.SetSegmentCount(); err != nil {
+		return err
+	}
+	if err := priceWith(tariff, smsMsg); err != nil {
+		return err
+	}
+	return smsMsg.TransitionTo(sms.SMSStatusBillingRequested)
+}
+
+// ProcessDebitedBatch fans a debited batch out into one dispatch event per
+// SMS still awaiting billing, so the workers send them in parallel. Like
+// single billing events, a redelivered batch event is a no-op.
+func (u *Service) ProcessDebitedBatch(ctx context.Context, event sms.BatchBillingCompleted) error {
+	u.log.Info(ctx, "processing debited SMS batch", "batch_id", event.BatchID, "transaction_id", event.TransactionID)
+
+	dispatched := 0
+	err := u.inTx(ctx, func(tx *gorm.DB) error {
+		firstDelivery, err := u.inbox.WithTx(tx).MarkProcessed(ctx, event.TransactionID, event.BatchID)
+		if err != nil {
+			u.log.Error(ctx, "failed to record batch billing event in inbox", "error", err, "batch_id", event.BatchID, "transaction_id", event.TransactionID)
+			return err
+		}
+		if !firstDelivery {
+			u.log.Info(ctx, "skipping already processed batch billing event", "batch_id", event.BatchID, "transaction_id", event.TransactionID)
+			return nil
+		}
+
+		status := sms.SMSStatusBillingRequested
+		filter := sms.ListFilter{BatchID: &event.BatchID, Status: &status}
+		page := sms.Page{Limit: sms.MaxPageSize}
+		outbox := u.outbox.WithTx(tx)
+		for {
+			result, err := u.smsRepo.WithTx(tx).List(ctx, filter, page)
+			if err != nil {
+				u.log.Error(ctx, "failed to list SMS of batch", "error", err, "batch_id", event.BatchID)
+				return err
+			}
+			for _, smsMsg := range result.Messages {
+				dispatch := sms.SMSDispatchRequested{
+					SMSID:         smsMsg.ID,
+					TransactionID: event.TransactionID,
+					TimeStamp:     time.Now(),
+				}
+				if err := outbox.Add(ctx, dispatch); err != nil {
+					u.log.Error(ctx, "failed to store dispatch request in outbox", "error", err, "sms_id", smsMsg.ID, "batch_id", event.BatchID)
+					return err
+				}
+				dispatched++
+			}
+			if result.Next == nil {
+				return nil
+			}
+			page.Cursor = result.Next
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	u.log.Info(ctx, "SMS batch queued for dispatch", "batch_id", event.BatchID, "dispatched", dispatched)
+	return nil
+}
+
+// DispatchBatchSMS sends one SMS of a debited batch.
+func (u *Service) DispatchBatchSMS(ctx context.Context, event sms.SMSDispatchRequested) error {
+	return u.ProcessDebitedSMS(ctx, sms.SMSBillingCompleted{
+		SMSID:         event.SMSID,
+		TransactionID: event.TransactionID,
+		TimeStamp:     event.TimeStamp,
+	})
+}
+
+// GetBatchProgress counts the SMS of a batch by status.
+func (u *Service) GetBatchProgress(ctx context.Context, batchID string) (sms.BatchProgress, error) {
+	batch, err := u.batches.Get(ctx, batchID)
+	if err != nil {
+		return sms.BatchProgress{}, err
+	}
+	counts, err := u.batches.StatusCounts(ctx, batchID)
+	if err != nil {
+		return sms.BatchProgress{}, err
+	}
+	return sms.BatchProgress{Batch: batch, Counts: counts}, nil
+}
@@ -0,0 +1,442 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sms/internal/domain/sms"
+	"sms/pkg/metrics"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// WithCampaigns sets where campaigns are stored and how they are sent.
+func (u *Service) WithCampaigns(campaigns sms.CampaignRepo, policy sms.CampaignPolicy) *Service {
+	u.campaigns = campaigns
+	u.campaign = policy
+	return u
+}
+
+// CreateCampaign stores an uploaded campaign. Its CSV is parsed later by
+// RunCampaigns, so only the template is checked here.
+func (u *Service) CreateCampaign(ctx context.Context, campaign *sms.Campaign) error {
+	if _, err := sms.ParseTemplate(campaign.Template); err != nil {
+		return err
+	}
+	campaign.Status = sms.CampaignStatusUploaded
+
+	if err := u.campaigns.Create(ctx, campaign); err != nil {
+		u.log.Error(ctx, "failed to create campaign in database", "error", err, "campaign_id", campaign.ID)
+		return err
+	}
+	u.log.Info(ctx, "campaign uploaded", "campaign_id", campaign.ID, "user_id", campaign.UserID, "size", len(campaign.Source))
+	return nil
+}
+
+// GetCampaignProgress returns a campaign with the SMS of its rows counted by
+// status.
+func (u *Service) GetCampaignProgress(ctx context.Context, campaignID string) (sms.CampaignProgress, error) {
+	campaign, err := u.campaigns.Get(ctx, campaignID)
+	if err != nil {
+		return sms.CampaignProgress{}, err
+	}
+	counts, err := u.campaigns.SMSStatusCounts(ctx, campaignID)
+	if err != nil {
+		return sms.CampaignProgress{}, err
+	}
+	return sms.CampaignProgress{Campaign: campaign, SMS: counts}, nil
+}
+
+// CampaignErrors returns up to limit rows that failed validation, after line
+// afterLine.
+func (u *Service) CampaignErrors(ctx context.Context, campaignID string, afterLine, limit int) ([]*sms.CampaignRecipient, error) {
+	if _, err := u.campaigns.Get(ctx, campaignID); err != nil {
+		return nil, err
+	}
+	return u.campaigns.InvalidRecipients(ctx, campaignID, afterLine, limit)
+}
+
+// PauseCampaign stops a campaign after the chunk being sent, if any.
+func (u *Service) PauseCampaign(ctx context.Context, campaignID string) (*sms.Campaign, error) {
+	return u.changeCampaign(ctx, campaignID, func(campaign *sms.Campaign) error {
+		return campaign.TransitionTo(sms.CampaignStatusPaused)
+	})
+}
+
+// ResumeCampaign continues a paused campaign, or schedules it if its start
+// time is still ahead.
+func (u *Service) ResumeCampaign(ctx context.Context, campaignID string) (*sms.Campaign, error) {
+	return u.changeCampaign(ctx, campaignID, func(campaign *sms.Campaign) error {
+		if campaign.Status != sms.CampaignStatusPaused {
+			return fmt.Errorf("%w: %s -> %s", sms.ErrInvalidCampaignTransition, campaign.Status, sms.CampaignStatusRunning)
+		}
+		return campaign.Start(time.Now())
+	})
+}
+
+// CancelCampaign cancels the rows that have no SMS yet. SMS already created
+// are billed and sent as usual.
+func (u *Service) CancelCampaign(ctx context.Context, campaignID string) (*sms.Campaign, error) {
+	return u.changeCampaign(ctx, campaignID, func(campaign *sms.Campaign) error {
+		return campaign.TransitionTo(sms.CampaignStatusCancelled)
+	})
+}
+
+// changeCampaign applies change to the locked campaign, so it waits for a
+// chunk being sent to finish.
+func (u *Service) changeCampaign(ctx context.Context, campaignID string, change func(*sms.Campaign) error) (*sms.Campaign, error) {
+	var campaign *sms.Campaign
+	err := u.inTx(ctx, func(tx *gorm.DB) error {
+		campaigns := u.campaigns.WithTx(tx)
+
+		var err error
+		campaign, err = campaigns.Lock(ctx, campaignID)
+		if err != nil {
+			return err
+		}
+		if err := change(campaign); err != nil {
+			return err
+		}
+		if campaign.Status == sms.CampaignStatusCancelled {
+			cancelled, err := campaigns.CancelPending(ctx, campaignID)
+			if err != nil {
+				return err
+			}
+			campaign.CancelledRows += int(cancelled)
+		}
+		return campaigns.Update(ctx, campaign)
+	})
+	if err != nil {
+		return nil, err
+	}
+	u.log.Info(ctx, "campaign status changed", "campaign_id", campaignID, "status", string(campaign.Status))
+	return campaign, nil
+}
+
+// RunCampaigns parses uploaded campaigns, starts scheduled ones once due and
+// sends running ones chunk by chunk, checking for work every interval until
+// ctx is done. Campaigns are claimed with SKIP LOCKED, so several workers can
+// run side by side.
+func (u *Service) RunCampaigns(ctx context.Context, interval time.Duration) error {
+	u.log.Info(ctx, "starting campaign worker", "interval", interval.String(), "chunk_size", u.campaign.ChunkSize)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			// a chunk that has started is finished, like an outbox batch
+			worked, err := u.ProcessCampaigns(context.WithoutCancel(ctx))
+			if err != nil {
+				u.log.Error(ctx, "campaign worker run failed", "error", err)
+			}
+			if !worked || err != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			u.log.Info(ctx, "campaign worker stopped")
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessCampaigns does one step of campaign work: it parses an uploaded
+// campaign, starts a due scheduled one or sends one chunk of a running one.
+// It reports whether there was anything to do.
+func (u *Service) ProcessCampaigns(ctx context.Context) (bool, error) {
+	steps := []func(context.Context) (bool, error){u.parseNextCampaign, u.startNextCampaign, u.sendNextChunk}
+	for _, step := range steps {
+		worked, err := step(ctx)
+		if err != nil || worked {
+			return worked, err
+		}
+	}
+	return false, nil
+}
+
+func (u *Service) parseNextCampaign(ctx context.Context) (bool, error) {
+	var campaign *sms.Campaign
+	err := u.inTx(ctx, func(tx *gorm.DB) error {
+		campaigns := u.campaigns.WithTx(tx)
+
+		var err error
+		campaign, err = campaigns.ClaimNext(ctx, sms.CampaignStatusUploaded, time.Time{})
+		if err != nil || campaign == nil {
+			return err
+		}
+
+		recipients, err := u.parseCampaignCSV(ctx, campaign)
+		if err != nil && !errors.Is(err, sms.ErrInvalidCampaignCSV) {
+			return err
+		}
+		campaign.Source = nil
+		if err != nil {
+			u.log.Error(ctx, "campaign CSV cannot be used", "error", err, "campaign_id", campaign.ID)
+			campaign.Error = err.Error()
+			if err := campaign.TransitionTo(sms.CampaignStatusFailed); err != nil {
+				return err
+			}
+			return campaigns.Update(ctx, campaign)
+		}
+
+		campaign.TotalRows = len(recipients)
+		for _, recipient := range recipients {
+			if recipient.Status == sms.RecipientStatusInvalid {
+				campaign.InvalidRows++
+			}
+		}
+		if err := campaigns.AddRecipients(ctx, recipients, u.bulk.InsertBatchSize); err != nil {
+			u.log.Error(ctx, "failed to store campaign recipients", "error", err, "campaign_id", campaign.ID)
+			return err
+		}
+		if campaign.PendingRows() == 0 {
+			err = campaign.TransitionTo(sms.CampaignStatusRunning)
+		} else {
+			err = campaign.Start(time.Now())
+		}
+		if err != nil {
+			return err
+		}
+		return campaigns.Update(ctx, campaign)
+	})
+	if err != nil || campaign == nil {
+		return false, err
+	}
+
+	u.log.Info(ctx, "campaign parsed", "campaign_id", campaign.ID, "status", string(campaign.Status), "rows", campaign.TotalRows, "invalid_rows", campaign.InvalidRows)
+	return true, nil
+}
+
+// parseCampaignCSV reads one recipient per data row. Rows that cannot be
+// sent are kept as invalid with the reason. ErrInvalidCampaignCSV means the
+// file as a whole cannot be used.
+func (u *Service) parseCampaignCSV(ctx context.Context, campaign *sms.Campaign) ([]*sms.CampaignRecipient, error) {
+	template, err := sms.ParseTemplate(campaign.Template)
+	if err != nil {
+		return nil, err
+	}
+	tariff, err := u.tariffs.GetTariff(ctx, campaign.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(campaign.Source, []byte("\ufeff"))))
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: header: %v", sms.ErrInvalidCampaignCSV, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("%w: duplicate column %q", sms.ErrInvalidCampaignCSV, name)
+		}
+		header[i] = name
+		columns[name] = i
+	}
+	if _, ok := columns[sms.ReceiverColumn]; !ok {
+		return nil, fmt.Errorf("%w: no %q column", sms.ErrInvalidCampaignCSV, sms.ReceiverColumn)
+	}
+	for _, variable := range template.Variables() {
+		if _, ok := columns[variable]; !ok {
+			return nil, fmt.Errorf("%w: template variable %q has no column", sms.ErrInvalidCampaignCSV, variable)
+		}
+	}
+
+	var recipients []*sms.CampaignRecipient
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+			return nil, fmt.Errorf("%w: %v", sms.ErrInvalidCampaignCSV, err)
+		}
+		if u.campaign.MaxRows > 0 && len(recipients) == u.campaign.MaxRows {
+			return nil, fmt.Errorf("%w: more than %d rows", sms.ErrInvalidCampaignCSV, u.campaign.MaxRows)
+		}
+
+		recipient := &sms.CampaignRecipient{
+			ID:         uuid.New().String(),
+			CampaignID: campaign.ID,
+			Line:       recordLine(reader),
+			Status:     sms.RecipientStatusPending,
+			Variables:  make(map[string]string, len(header)),
+		}
+		for i, value := range record {
+			if i < len(header) && header[i] != sms.ReceiverColumn {
+				recipient.Variables[header[i]] = strings.TrimSpace(value)
+			}
+		}
+		if err != nil {
+			recipient.Status = sms.RecipientStatusInvalid
+			recipient.Error = fmt.Sprintf("row has %d fields, the header %d", len(record), len(header))
+		} else {
+			recipient.Receiver = sms.NormalizeReceiver(record[columns[sms.ReceiverColumn]])
+			if err := checkRecipient(template, tariff, campaign.UserID, recipient); err != nil {
+				recipient.Status = sms.RecipientStatusInvalid
+				recipient.Error = err.Error()
+			}
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("%w: no rows", sms.ErrInvalidCampaignCSV)
+	}
+	return recipients, nil
+}
+
+// recordLine is the line the record last read starts on.
+func recordLine(reader *csv.Reader) int {
+	line, _ := reader.FieldPos(0)
+	return line
+}
+
+// checkRecipient tells whether the SMS of a row could be created and billed.
+func checkRecipient(template sms.Template, tariff sms.Tariff, userID string, recipient *sms.CampaignRecipient) error {
+	if !sms.IsE164(recipient.Receiver) {
+		return fmt.Errorf("receiver %q is not a phone number in E.164 format", recipient.Receiver)
+	}
+	_, err := newCampaignSMS(template, tariff, userID, recipient)
+	return err
+}
+
+// newCampaignSMS renders and prices the SMS of a row. The SMS takes the
+// recipient's ID.
+func newCampaignSMS(template sms.Template, tariff sms.Tariff, userID string, recipient *sms.CampaignRecipient) (*sms.SMSMessage, error) {
+	content, err := template.Render(recipient.Variables)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	smsMsg := &sms.SMSMessage{
+		ID:        recipient.ID,
+		UserID:    userID,
+		Content:   content,
+		Receiver:  recipient.Receiver,
+		Status:    sms.SMSStatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := prepareBillingWith(tariff, smsMsg); err != nil {
+		return nil, err
+	}
+	return smsMsg, nil
+}
+
+func (u *Service) startNextCampaign(ctx context.Context) (bool, error) {
+	var campaign *sms.Campaign
+	err := u.inTx(ctx, func(tx *gorm.DB) error {
+		campaigns := u.campaigns.WithTx(tx)
+
+		var err error
+		campaign, err = campaigns.ClaimNext(ctx, sms.CampaignStatusScheduled, time.Now())
+		if err != nil || campaign == nil {
+			return err
+		}
+		if err := campaign.TransitionTo(sms.CampaignStatusRunning); err != nil {
+			return err
+		}
+		return campaigns.Update(ctx, campaign)
+	})
+	if err != nil || campaign == nil {
+		return false, err
+	}
+
+	u.log.Info(ctx, "scheduled campaign started", "campaign_id", campaign.ID)
+	return true, nil
+}
+
+// sendNextChunk creates the SMS of the next rows of a running campaign as
+// one batch, billed like a bulk send, and completes the campaign once no
+// rows are left.
+func (u *Service) sendNextChunk(ctx context.Context) (bool, error) {
+	var (
+		campaign *sms.Campaign
+		queued   int
+	)
+	err := u.inTx(ctx, func(tx *gorm.DB) error {
+		campaigns := u.campaigns.WithTx(tx)
+
+		var err error
+		campaign, err = campaigns.ClaimNext(ctx, sms.CampaignStatusRunning, time.Now())
+		if err != nil || campaign == nil {
+			return err
+		}
+
+		recipients, err := campaigns.PendingRecipients(ctx, campaign.ID, u.campaign.ChunkSize)
+		if err != nil {
+			return err
+		}
+		if len(recipients) > 0 {
+			if queued, err = u.queueRecipients(ctx, tx, campaign, recipients); err != nil {
+				return err
+			}
+		}
+		if campaign.PendingRows() <= 0 {
+			if err := campaign.TransitionTo(sms.CampaignStatusCompleted); err != nil {
+				return err
+			}
+		}
+		return campaigns.Update(ctx, campaign)
+	})
+	if err != nil || campaign == nil {
+		return false, err
+	}
+
+	metrics.SMSCreated.Add(float64(queued))
+	u.log.Info(ctx, "campaign chunk queued", "campaign_id", campaign.ID, "queued", queued, "pending_rows", campaign.PendingRows(), "status", string(campaign.Status))
+	return true, nil
+}
+
+// queueRecipients creates and bills the SMS of recipients. Rows that can no
+// longer be billed are marked failed rather than holding up the rest.
+func (u *Service) queueRecipients(ctx context.Context, tx *gorm.DB, campaign *sms.Campaign, recipients []*sms.CampaignRecipient) (int, error) {
+	template, err := sms.ParseTemplate(campaign.Template)
+	if err != nil {
+		return 0, err
+	}
+	tariff, err := u.tariffs.GetTariff(ctx, campaign.UserID)
+	if err != nil {
+		return 0, err
+	}
+
+	messages := make([]*sms.SMSMessage, 0, len(recipients))
+	for _, recipient := range recipients {
+		smsMsg, err := newCampaignSMS(template, tariff, campaign.UserID, recipient)
+		if err != nil {
+			u.log.Error(ctx, "campaign row can no longer be billed", "error", err, "campaign_id", campaign.ID, "line", recipient.Line)
+			recipient.Status = sms.RecipientStatusFailed
+			recipient.Error = err.Error()
+			campaign.FailedRows++
+			continue
+		}
+		recipient.Status = sms.RecipientStatusQueued
+		campaign.QueuedRows++
+		messages = append(messages, smsMsg)
+	}
+
+	if len(messages) > 0 {
+		batch := &sms.SMSBatch{ID: uuid.New().String(), UserID: campaign.UserID, CreatedAt: time.Now()}
+		if err := u.storeBatch(ctx, tx, batch, messages); err != nil {
+			return 0, err
+		}
+	}
+	if err := u.campaigns.WithTx(tx).UpdateRecipients(ctx, recipients); err != nil {
+		u.log.Error(ctx, "failed to update campaign recipients", "error", err, "campaign_id", campaign.ID)
+		return 0, err
+	}
+	return len(messages), nil
+}
@@ -0,0 +1,71 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"sms/internal/domain/sms"
+
+	"gorm.io/gorm"
+)
+
+// ProcessDeliveryReceipt moves the SMS a receipt refers to into the delivery
+// status it reports, or records the delivered part of a multipart SMS whose
+// other parts are outstanding. Repeated receipts for a message are ignored.
+func (u *Service) ProcessDeliveryReceipt(ctx context.Context, receipt sms.DeliveryReceipt) error {
+	u.log.Info(ctx, "processing delivery receipt", "provider", receipt.Provider, "provider_message_id", receipt.MessageID, "status", string(receipt.Status))
+
+	if receipt.MessageID == "" {
+		return sms.ErrUnknownReceipt
+	}
+
+	var updated *sms.SMSMessage
+	err := u.inTx(ctx, func(tx *gorm.DB) error {
+		smsRepo := u.smsRepo.WithTx(tx)
+
+		found, err := smsRepo.GetByFilter(ctx, sms.Filter{Provider: &receipt.Provider, ProviderMessageID: &receipt.MessageID})
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			u.log.Error(ctx, "delivery receipt matches no SMS", "provider", receipt.Provider, "provider_message_id", receipt.MessageID)
+			return sms.ErrUnknownReceipt
+		}
+		if err != nil {
+			u.log.Error(ctx, "failed to retrieve SMS for delivery receipt", "error", err, "provider", receipt.Provider, "provider_message_id", receipt.MessageID)
+			return err
+		}
+		// receipts for the parts of a message arrive side by side and each
+		// adds to its delivered parts
+		smsMsg, err := smsRepo.Lock(ctx, found.ID)
+		if err != nil {
+			u.log.Error(ctx, "failed to lock SMS for delivery receipt", "error", err, "sms_id", found.ID)
+			return err
+		}
+
+		from := smsMsg.Status
+		if err := smsMsg.ApplyDeliveryReceipt(receipt); err != nil {
+			if errors.Is(err, sms.ErrInvalidStatusTransition) {
+				u.log.Info(ctx, "skipping delivery receipt for SMS not awaiting one", "sms_id", smsMsg.ID, "status", string(smsMsg.Status))
+				return nil
+			}
+			return err
+		}
+
+		if err := smsRepo.Update(ctx, smsMsg.ID, from, smsMsg); err != nil {
+			u.log.Error(ctx, "failed to update SMS delivery status", "error", err, "sms_id", smsMsg.ID)
+			return err
+		}
+		if smsMsg.Status == from {
+			u.log.Info(ctx, "SMS part delivered", "sms_id", smsMsg.ID, "provider_message_id", receipt.MessageID, "delivered_parts", len(smsMsg.DeliveredPartIDs), "parts", len(smsMsg.ProviderPartIDs))
+			return nil
+		}
+		u.log.Info(ctx, "SMS delivery status updated", "sms_id", smsMsg.ID, "status", string(smsMsg.Status), "failure_code", smsMsg.FailureCode)
+		updated = smsMsg
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if updated != nil {
+		recordStatus(updated)
+	}
+	return nil
+}
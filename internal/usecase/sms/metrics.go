@@ -0,0 +1,24 @@
+package sms
+
+import (
+	"sms/internal/domain/sms"
+	"sms/pkg/metrics"
+)
+
+// recordStatus counts the status an SMS ended up in once the transaction that
+// stored it has committed. Intermediate statuses are not counted.
+func recordStatus(smsMsg *sms.SMSMessage) {
+	switch smsMsg.Status {
+	case sms.SMSStatusSent:
+		metrics.SMSSent.WithLabelValues(smsMsg.Provider).Inc()
+	case sms.SMSStatusDelivered:
+		metrics.SMSDelivered.WithLabelValues(smsMsg.Provider).Inc()
+	case sms.SMSStatusFailed:
+		metrics.SMSFailed.WithLabelValues(smsMsg.Provider, string(smsMsg.Status), smsMsg.FailureCode).Inc()
+		// a failed send is always refunded; undelivered and expired
+		// messages were accepted by the operator and stay billed
+		metrics.SMSRefunded.WithLabelValues(smsMsg.Provider, smsMsg.FailureCode).Inc()
+	case sms.SMSStatusUndelivered, sms.SMSStatusExpired:
+		metrics.SMSFailed.WithLabelValues(smsMsg.Provider, string(smsMsg.Status), smsMsg.FailureCode).Inc()
+	}
+}
@@ -0,0 +1,134 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"sms/internal/domain/sms"
+	"sms/pkg/logger"
+	"sms/pkg/tracing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WithOutboxPolicy sets how often an outbox event is published before it is
+// parked and how long a relay holds its claim on a batch.
+func (u *Service) WithOutboxPolicy(policy sms.OutboxPolicy) *Service {
+	u.relay = policy
+	return u
+}
+
+// RelayOutbox publishes up to batchSize pending outbox events and marks them
+// sent. The batch is claimed in a short transaction and published after it
+// commits, so no row stays locked while the broker confirms. It stops at the
+// first publish failure so events keep their order; the failed event stays
+// pending and is retried on the next run. Events the broker rejected or that
+// used up their attempts are parked as failed instead, and the relay moves on.
+func (u *Service) RelayOutbox(ctx context.Context, batchSize int) (int, error) {
+	var messages []sms.OutboxMessage
+	err := u.inTx(ctx, func(tx *gorm.DB) error {
+		var err error
+		messages, err = u.outbox.WithTx(tx).ClaimPending(ctx, batchSize, u.relay.ClaimTimeout)
+		return err
+	})
+	if err != nil {
+		u.log.Error(ctx, "failed to claim pending outbox events", "error", err)
+		return 0, err
+	}
+
+	relayed := 0
+	for i, msg := range messages {
+		sent, err := u.relayEvent(ctx, msg)
+		if err != nil {
+			// the rest of the batch goes out on the next run, in order
+			ids := make([]string, 0, len(messages)-i-1)
+			for _, rest := range messages[i+1:] {
+				ids = append(ids, rest.ID)
+			}
+			if err := u.outbox.Release(ctx, ids); err != nil {
+				u.log.Error(ctx, "failed to release outbox events", "error", err, "count", len(ids))
+			}
+			return relayed, err
+		}
+		if sent {
+			relayed++
+		}
+	}
+	return relayed, nil
+}
+
+// relayEvent publishes msg and marks it sent. An event that cannot be
+// published, or has run out of attempts, is marked failed and reported as not
+// sent without an error.
+func (u *Service) relayEvent(ctx context.Context, msg sms.OutboxMessage) (bool, error) {
+	event, err := sms.DecodeEvent(msg.EventType, msg.Payload)
+	if err != nil {
+		u.log.Error(ctx, "dropping undecodable outbox event", "error", err, "outbox_id", msg.ID, "event_type", string(msg.EventType))
+		return false, u.outbox.MarkFailed(ctx, msg.ID, err.Error())
+	}
+
+	publishCtx := tracing.WithTraceParent(ctx, msg.TraceParent)
+	if msg.TraceID != "" {
+		publishCtx = logger.ContextWithTraceID(publishCtx, msg.TraceID)
+	}
+	if err := u.publisher.PublishEvent(publishCtx, event); err != nil {
+		attempts := msg.Attempts + 1
+		if errors.Is(err, sms.ErrEventRejected) || attempts >= u.relay.MaxAttempts {
+			u.log.Error(ctx, "parking outbox event as failed", "error", err, "outbox_id", msg.ID, "event_type", string(msg.EventType), "aggregate_id", msg.AggregateID, "attempts", attempts)
+			return false, u.outbox.MarkFailed(ctx, msg.ID, err.Error())
+		}
+
+		u.log.Error(ctx, "failed to publish outbox event", "error", err, "outbox_id", msg.ID, "event_type", string(msg.EventType), "aggregate_id", msg.AggregateID, "attempts", attempts)
+		if recordErr := u.outbox.RecordAttempt(ctx, msg.ID, err.Error()); recordErr != nil {
+			return false, recordErr
+		}
+		return false, err
+	}
+
+	return true, u.outbox.MarkSent(ctx, msg.ID)
+}
+
+// RunOutboxRelay relays pending outbox events every interval until ctx is done.
+func (u *Service) RunOutboxRelay(ctx context.Context, interval time.Duration, batchSize int) error {
+	u.log.Info(ctx, "starting outbox relay", "interval", interval.String(), "batch_size", batchSize)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// a batch that has started is finished, so events already published
+		// are marked sent rather than published again after a restart
+		relayed, err := u.RelayOutbox(context.WithoutCancel(ctx), batchSize)
+		if err != nil {
+			u.log.Error(ctx, "outbox relay run failed", "error", err, "relayed", relayed)
+		} else if relayed > 0 {
+			u.log.Info(ctx, "outbox events relayed", "relayed", relayed)
+		}
+
+		// drain full batches without waiting for the next tick
+		if err == nil && relayed == batchSize && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			u.log.Info(ctx, "outbox relay stopped")
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// FlushOutbox relays pending outbox events until none are left or ctx is
+// done. It is meant for shutdown, after the relay loop has stopped.
+func (u *Service) FlushOutbox(ctx context.Context, batchSize int) (int, error) {
+	var total int
+	for ctx.Err() == nil {
+		relayed, err := u.RelayOutbox(ctx, batchSize)
+		total += relayed
+		if err != nil || relayed < batchSize {
+			return total, err
+		}
+	}
+	return total, ctx.Err()
+}
@@ -0,0 +1,30 @@
+package sms
+
+import (
+	"context"
+	"sms/internal/domain/sms"
+)
+
+func (u *Service) WithTariffs(tariffs sms.TariffRepo) *Service {
+	u.tariffs = tariffs
+	return u
+}
+
+// priceSMS records on the message the amount its user is billed for it.
+func (u *Service) priceSMS(ctx context.Context, smsMsg *sms.SMSMessage) error {
+	tariff, err := u.tariffs.GetTariff(ctx, smsMsg.UserID)
+	if err != nil {
+		return err
+	}
+	return priceWith(tariff, smsMsg)
+}
+
+// priceWith prices the message with its user's tariff already loaded.
+func priceWith(tariff sms.Tariff, smsMsg *sms.SMSMessage) error {
+	amount, err := tariff.Price(smsMsg.Receiver, smsMsg.SegmentCount)
+	if err != nil {
+		return err
+	}
+	smsMsg.Amount = amount
+	return nil
+}
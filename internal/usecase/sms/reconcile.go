@@ -0,0 +1,85 @@
+package sms
+
+import (
+	"context"
+	"sms/internal/domain/sms"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ReconcileStuckSMS settles up to batchSize SMS that have been sending for
+// longer than timeout. Their delivery outcome was never recorded, so they are
+// failed with DeliveryOutcomeUnknown and refunded. Messages are claimed with
+// SKIP LOCKED, so several reconcilers can run side by side.
+func (u *Service) ReconcileStuckSMS(ctx context.Context, timeout time.Duration, batchSize int) (int, error) {
+	var stuck []*sms.SMSMessage
+	err := u.inTx(ctx, func(tx *gorm.DB) error {
+		var err error
+		stuck, err = u.smsRepo.WithTx(tx).ClaimStuckSending(ctx, time.Now().Add(-timeout), batchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, smsMsg := range stuck {
+			if err := smsMsg.MarkAsFailed(smsMsg.Provider, sms.DeliveryOutcomeUnknown); err != nil {
+				return err
+			}
+			if err := u.smsRepo.WithTx(tx).Update(ctx, smsMsg.ID, sms.SMSStatusSending, smsMsg); err != nil {
+				u.log.Error(ctx, "failed to fail SMS stuck in sending", "error", err, "sms_id", smsMsg.ID)
+				return err
+			}
+			u.log.Error(ctx, "SMS stuck in sending failed for an unknown outcome", "sms_id", smsMsg.ID, "transaction_id", smsMsg.TransactionID, "sending_since", smsMsg.UpdatedAt)
+
+			refund := sms.RequestBillingRefund{
+				TransactionID: smsMsg.TransactionID,
+				Amount:        smsMsg.Amount,
+				TimeStamp:     time.Now(),
+			}
+			if err := u.outbox.WithTx(tx).Add(ctx, refund); err != nil {
+				u.log.Error(ctx, "failed to store refund request in outbox", "error", err, "sms_id", smsMsg.ID)
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, smsMsg := range stuck {
+		recordStatus(smsMsg)
+	}
+	return len(stuck), nil
+}
+
+// RunReconciler settles SMS stuck in sending every interval until ctx is
+// done.
+func (u *Service) RunReconciler(ctx context.Context, interval, timeout time.Duration, batchSize int) error {
+	u.log.Info(ctx, "starting SMS reconciler", "interval", interval.String(), "sending_timeout", timeout.String(), "batch_size", batchSize)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// a batch that has started is committed as a whole
+		settled, err := u.ReconcileStuckSMS(context.WithoutCancel(ctx), timeout, batchSize)
+		if err != nil {
+			u.log.Error(ctx, "SMS reconciler run failed", "error", err)
+		} else if settled > 0 {
+			u.log.Info(ctx, "SMS stuck in sending failed and refunded", "settled", settled)
+		}
+
+		// drain full batches without waiting for the next tick
+		if err == nil && settled == batchSize && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			u.log.Info(ctx, "SMS reconciler stopped")
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"sms/internal/domain/sms"
+
+	"gorm.io/gorm"
+)
+
+// WithRetryPolicy sets how transient delivery failures are retried. Without
+// it the first failure is final.
+func (u *Service) WithRetryPolicy(policy sms.RetryPolicy) *Service {
+	u.retry = policy
+	return u
+}
+
+// RetrySMSDelivery makes a scheduled delivery attempt. Like billing events,
+// redelivered retry events are recorded in the inbox and become no-ops.
+func (u *Service) RetrySMSDelivery(ctx context.Context, event sms.SMSDeliveryRetry) error {
+	u.log.Info(ctx, "retrying SMS delivery", "sms_id", event.SMSID, "transaction_id", event.TransactionID, "attempt", event.Attempt)
+
+	var smsMsg *sms.SMSMessage
+	err := u.inTx(ctx, func(tx *gorm.DB) error {
+		key := fmt.Sprintf("%s/retry-%d", event.TransactionID, event.Attempt)
+		firstDelivery, err := u.inbox.WithTx(tx).MarkProcessed(ctx, key, event.SMSID)
+		if err != nil {
+			u.log.Error(ctx, "failed to record retry event in inbox", "error", err, "sms_id", event.SMSID, "attempt", event.Attempt)
+			return err
+		}
+		if !firstDelivery {
+			u.log.Info(ctx, "skipping already processed retry event", "sms_id", event.SMSID, "attempt", event.Attempt)
+			return nil
+		}
+
+		loaded, err := u.smsRepo.WithTx(tx).GetByFilter(ctx, sms.Filter{ID: &event.SMSID})
+		if err != nil {
+			u.log.Error(ctx, "failed to retrieve SMS from database", "error", err, "sms_id", event.SMSID)
+			return err
+		}
+
+		if loaded.Status != sms.SMSStatusRetryScheduled {
+			u.log.Info(ctx, "skipping retry of SMS not awaiting one", "sms_id", event.SMSID, "status", string(loaded.Status))
+			return nil
+		}
+		if err := u.claimDelivery(ctx, tx, loaded, sms.SMSStatusRetryScheduled, event.TransactionID); err != nil {
+			return err
+		}
+		smsMsg = loaded
+		return nil
+	})
+	if err != nil || smsMsg == nil {
+		return err
+	}
+
+	if err := u.deliverDebitedSMS(ctx, smsMsg, event.TransactionID, event.Attempt); err != nil {
+		return err
+	}
+	recordStatus(smsMsg)
+	return nil
+}
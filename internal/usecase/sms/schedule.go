@@ -0,0 +1,134 @@
+package sms
+
+import (
+	"context"
+	"sms/internal/domain/sms"
+	"sms/pkg/metrics"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// scheduleSMS stores an SMS whose SendAt is ahead. It is priced now so the
+// caller learns about content or tariff problems at once, but billing is
+// only requested by the scheduler once the SMS is due.
+func (u *Service) scheduleSMS(ctx context.Context, smsMsg *sms.SMSMessage) error {
+	if err := smsMsg.SetSegmentCount(); err != nil {
+		u.log.Error(ctx, "SMS cannot be scheduled", "error", err, "sms_id", smsMsg.ID, "receiver", smsMsg.Receiver)
+		return err
+	}
+	if err := u.priceSMS(ctx, smsMsg); err != nil {
+		u.log.Error(ctx, "SMS cannot be scheduled", "error", err, "sms_id", smsMsg.ID, "receiver", smsMsg.Receiver)
+		return err
+	}
+	if err := smsMsg.TransitionTo(sms.SMSStatusScheduled); err != nil {
+		return err
+	}
+
+	if err := u.smsRepo.Create(ctx, smsMsg); err != nil {
+		u.log.Error(ctx, "failed to create SMS in database", "error", err, "sms_id", smsMsg.ID)
+		return err
+	}
+	u.log.Info(ctx, "SMS scheduled", "sms_id", smsMsg.ID, "send_at", smsMsg.SendAt, "segments", smsMsg.SegmentCount, "amount", smsMsg.Amount)
+	metrics.SMSCreated.Inc()
+
+	return nil
+}
+
+// ProcessScheduledSMS requests billing for up to batchSize scheduled SMS that
+// are due and returns how many it handed over. Messages are claimed with
+// SKIP LOCKED, so several schedulers can run side by side.
+func (u *Service) ProcessScheduledSMS(ctx context.Context, batchSize int) (int, error) {
+	var due []*sms.SMSMessage
+	err := u.inTx(ctx, func(tx *gorm.DB) error {
+		var err error
+		due, err = u.smsRepo.WithTx(tx).ClaimDue(ctx, time.Now(), batchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, smsMsg := range due {
+			if err := smsMsg.TransitionTo(sms.SMSStatusBillingRequested); err != nil {
+				return err
+			}
+			if err := u.smsRepo.WithTx(tx).Update(ctx, smsMsg.ID, sms.SMSStatusScheduled, smsMsg); err != nil {
+				u.log.Error(ctx, "failed to update scheduled SMS in database", "error", err, "sms_id", smsMsg.ID)
+				return err
+			}
+
+			debitEvent := sms.RequestSMSBilling{
+				UserID:    smsMsg.UserID,
+				SMSID:     smsMsg.ID,
+				Amount:    smsMsg.Amount,
+				TimeStamp: time.Now(),
+			}
+			if err := u.outbox.WithTx(tx).Add(ctx, debitEvent); err != nil {
+				u.log.Error(ctx, "failed to store billing request in outbox", "error", err, "sms_id", smsMsg.ID)
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(due), nil
+}
+
+// RunScheduler hands due scheduled SMS to billing every interval until ctx
+// is done.
+func (u *Service) RunScheduler(ctx context.Context, interval time.Duration, batchSize int) error {
+	u.log.Info(ctx, "starting SMS scheduler", "interval", interval.String(), "batch_size", batchSize)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// a batch that has started is committed as a whole
+		released, err := u.ProcessScheduledSMS(context.WithoutCancel(ctx), batchSize)
+		if err != nil {
+			u.log.Error(ctx, "SMS scheduler run failed", "error", err)
+		} else if released > 0 {
+			u.log.Info(ctx, "scheduled SMS queued for billing", "released", released)
+		}
+
+		// drain full batches without waiting for the next tick
+		if err == nil && released == batchSize && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			u.log.Info(ctx, "SMS scheduler stopped")
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// CancelSMS cancels a scheduled SMS. Once the scheduler has requested its
+// billing, the SMS can no longer be cancelled.
+func (u *Service) CancelSMS(ctx context.Context, smsID string) (*sms.SMSMessage, error) {
+	var smsMsg *sms.SMSMessage
+	err := u.inTx(ctx, func(tx *gorm.DB) error {
+		// waits for a scheduler holding the SMS, then sees its new status
+		var err error
+		smsMsg, err = u.smsRepo.WithTx(tx).Lock(ctx, smsID)
+		if err != nil {
+			return err
+		}
+		if smsMsg.Status != sms.SMSStatusScheduled {
+			return &sms.InvalidTransitionError{From: smsMsg.Status, To: sms.SMSStatusCancelled}
+		}
+		if err := smsMsg.TransitionTo(sms.SMSStatusCancelled); err != nil {
+			return err
+		}
+		return u.smsRepo.WithTx(tx).Update(ctx, smsMsg.ID, sms.SMSStatusScheduled, smsMsg)
+	})
+	if err != nil {
+		u.log.Error(ctx, "failed to cancel SMS", "error", err, "sms_id", smsID)
+		return nil, err
+	}
+	u.log.Info(ctx, "scheduled SMS cancelled", "sms_id", smsID)
+	return smsMsg, nil
+}
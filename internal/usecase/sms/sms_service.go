@@ -2,106 +2,259 @@ package sms
 
 import (
 	"context"
+	"errors"
 	"sms/internal/domain/sms"
 	"sms/pkg/logger"
+	"sms/pkg/metrics"
 	"time"
 
 	"gorm.io/gorm"
 )
 
 type Service struct {
+	tx        sms.Transactor
 	smsRepo   sms.Repo
+	outbox    sms.OutboxRepo
+	relay     sms.OutboxPolicy
+	inbox     sms.InboxRepo
 	publisher sms.EventPublisher
 	provider  sms.SMSProvider
+	tariffs   sms.TariffRepo
+	retry     sms.RetryPolicy
+	batches   sms.BatchRepo
+	bulk      sms.BulkPolicy
+	campaigns sms.CampaignRepo
+	campaign  sms.CampaignPolicy
 	log       *logger.Logger
 }
 
-func NewSMSService(smsRepo sms.Repo, publisher sms.EventPublisher, provider sms.SMSProvider, db *gorm.DB, log *logger.Logger) *Service {
+func NewSMSService(smsRepo sms.Repo, outbox sms.OutboxRepo, inbox sms.InboxRepo, publisher sms.EventPublisher, provider sms.SMSProvider, tx sms.Transactor, log *logger.Logger) *Service {
 	return &Service{
-		smsRepo:   smsRepo.WithTx(db),
+		tx:        tx,
+		smsRepo:   smsRepo,
+		outbox:    outbox,
+		inbox:     inbox,
+		relay:     sms.OutboxPolicy{MaxAttempts: 10, ClaimTimeout: time.Minute},
 		publisher: publisher,
 		provider:  provider,
+		tariffs:   sms.FlatTariff(1),
+		retry:     sms.RetryPolicy{MaxAttempts: 1},
+		bulk:      sms.BulkPolicy{BillingMode: sms.BillingPerMessage, InsertBatchSize: 500},
+		campaign:  sms.CampaignPolicy{ChunkSize: 500, MaxRows: 100000},
 		log:       log,
 	}
 }
 
+// inTx runs fn inside a database transaction.
+func (u *Service) inTx(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return u.tx.InTx(ctx, fn)
+}
+
 func (u *Service) GetSMSByID(ctx context.Context, filter sms.Filter) (*sms.SMSMessage, error) {
 	return u.smsRepo.GetByFilter(ctx, filter)
 }
 
+// ListSMS returns a page of the messages matching filter, newest first.
+func (u *Service) ListSMS(ctx context.Context, filter sms.ListFilter, page sms.Page) (sms.ListResult, error) {
+	return u.smsRepo.List(ctx, filter, page.Normalize())
+}
+
+// CreateAndBillSMS stores an SMS and requests its billing. An SMS whose
+// SendAt is ahead is scheduled instead and billed once due.
 func (u *Service) CreateAndBillSMS(ctx context.Context, smsMsg *sms.SMSMessage) error {
+	if smsMsg.SendAt.After(time.Now()) {
+		return u.scheduleSMS(ctx, smsMsg)
+	}
+
 	u.log.Info(ctx, "creating SMS and requesting billing", "sms_id", smsMsg.ID, "user_id", smsMsg.UserID, "receiver", smsMsg.Receiver)
 
-	err := u.smsRepo.Create(ctx, smsMsg)
-	if err != nil {
-		u.log.Error(ctx, "failed to create SMS in database", "error", err, "sms_id", smsMsg.ID)
+	if err := u.prepareBilling(ctx, smsMsg); err != nil {
+		u.log.Error(ctx, "SMS cannot be billed", "error", err, "sms_id", smsMsg.ID, "receiver", smsMsg.Receiver)
 		return err
 	}
-	u.log.Info(ctx, "SMS created successfully", "sms_id", smsMsg.ID)
 
 	debitEvent := sms.RequestSMSBilling{
-		UserID: smsMsg.UserID,
-		SMSID:  smsMsg.ID,
-		//TODO: do not hardcode amount
-		Amount:    1,
+		UserID:    smsMsg.UserID,
+		SMSID:     smsMsg.ID,
+		Amount:    smsMsg.Amount,
 		TimeStamp: time.Now(),
 	}
 
-	// TODO: use OutBox or update the sms failed.
-	err = u.publisher.PublishEvent(ctx, debitEvent)
+	err := u.inTx(ctx, func(tx *gorm.DB) error {
+		if err := u.smsRepo.WithTx(tx).Create(ctx, smsMsg); err != nil {
+			u.log.Error(ctx, "failed to create SMS in database", "error", err, "sms_id", smsMsg.ID)
+			return err
+		}
+
+		if err := u.outbox.WithTx(tx).Add(ctx, debitEvent); err != nil {
+			u.log.Error(ctx, "failed to store billing request in outbox", "error", err, "sms_id", smsMsg.ID)
+			return err
+		}
+		return nil
+	})
 	if err != nil {
-		u.log.Error(ctx, "failed to publish billing request", "error", err, "sms_id", smsMsg.ID)
 		return err
 	}
-	u.log.Info(ctx, "billing request published successfully", "sms_id", smsMsg.ID)
+	u.log.Info(ctx, "SMS created and billing request queued in outbox", "sms_id", smsMsg.ID, "segments", smsMsg.SegmentCount, "amount", smsMsg.Amount)
+	metrics.SMSCreated.Inc()
 
 	return nil
 }
 
+// ProcessDebitedSMS dispatches a billed SMS. Redelivered billing events are
+// recorded in the inbox and become no-ops, and an SMS that is no longer
+// awaiting billing is never dispatched again.
 func (u *Service) ProcessDebitedSMS(ctx context.Context, event sms.SMSBillingCompleted) error {
 	u.log.Info(ctx, "processing debited SMS", "sms_id", event.SMSID, "transaction_id", event.TransactionID)
 
-	smsMsg, err := u.smsRepo.GetByFilter(ctx, sms.Filter{ID: &event.SMSID})
-	if err != nil {
-		u.log.Error(ctx, "failed to retrieve SMS from database", "error", err, "sms_id", event.SMSID)
+	var smsMsg *sms.SMSMessage
+	err := u.inTx(ctx, func(tx *gorm.DB) error {
+		// a concurrent redelivery blocks here until this transaction finishes
+		firstDelivery, err := u.inbox.WithTx(tx).MarkProcessed(ctx, event.TransactionID, event.SMSID)
+		if err != nil {
+			u.log.Error(ctx, "failed to record billing event in inbox", "error", err, "sms_id", event.SMSID, "transaction_id", event.TransactionID)
+			return err
+		}
+		if !firstDelivery {
+			u.log.Info(ctx, "skipping already processed billing event", "sms_id", event.SMSID, "transaction_id", event.TransactionID)
+			return nil
+		}
+
+		loaded, err := u.smsRepo.WithTx(tx).GetByFilter(ctx, sms.Filter{ID: &event.SMSID})
+		if err != nil {
+			u.log.Error(ctx, "failed to retrieve SMS from database", "error", err, "sms_id", event.SMSID)
+			return err
+		}
+
+		from := loaded.Status
+		if err := loaded.TransitionTo(sms.SMSStatusBilled); err != nil {
+			u.log.Info(ctx, "skipping dispatch of SMS not awaiting billing", "error", err, "sms_id", event.SMSID, "status", string(loaded.Status))
+			return nil
+		}
+		if err := u.claimDelivery(ctx, tx, loaded, from, event.TransactionID); err != nil {
+			return err
+		}
+		smsMsg = loaded
+		return nil
+	})
+	if err != nil || smsMsg == nil {
+		return err
+	}
+
+	if err := u.deliverDebitedSMS(ctx, smsMsg, event.TransactionID, 1); err != nil {
+		return err
+	}
+	u.log.Info(ctx, "SMS processing completed", "sms_id", event.SMSID, "final_status", string(smsMsg.Status))
+	recordStatus(smsMsg)
+	return nil
+}
+
+// claimDelivery stores the SMS as sending under the debit transactionID, in
+// the transaction that records its event in the inbox. Once that commits, a
+// redelivered event is a no-op, so the provider is called at most once per
+// attempt.
+func (u *Service) claimDelivery(ctx context.Context, tx *gorm.DB, smsMsg *sms.SMSMessage, from sms.SMSStatus, transactionID string) error {
+	if err := smsMsg.TransitionTo(sms.SMSStatusSending); err != nil {
+		return err
+	}
+	smsMsg.TransactionID = transactionID
+	if err := u.smsRepo.WithTx(tx).Update(ctx, smsMsg.ID, from, smsMsg); err != nil {
+		u.log.Error(ctx, "failed to store SMS as sending", "error", err, "sms_id", smsMsg.ID)
 		return err
 	}
+	return nil
+}
 
-	u.log.Info(ctx, "attempting SMS delivery", "sms_id", event.SMSID, "receiver", smsMsg.Receiver)
-	provider, err := u.dispatchSMSDelivery(ctx, *smsMsg)
+// deliverDebitedSMS makes the given delivery attempt on an SMS claimed by
+// claimDelivery. The provider is called outside any transaction and the
+// outcome is recorded in a transaction of its own. Transient failures are
+// retried with backoff; the refund is only requested once the SMS fails for
+// good.
+func (u *Service) deliverDebitedSMS(ctx context.Context, smsMsg *sms.SMSMessage, transactionID string, attempt int) error {
+	u.log.Info(ctx, "attempting SMS delivery", "sms_id", smsMsg.ID, "receiver", smsMsg.Receiver, "attempt", attempt)
+	provider, accepted, sendErr := u.dispatchSMSDelivery(ctx, *smsMsg)
 
-	if err != nil {
-		u.log.Error(ctx, "SMS delivery failed", "error", err, "sms_id", event.SMSID, "provider", provider)
-		smsMsg.MarkAsFailed(provider, sms.MNOProviderFailed)
+	var followUp sms.DomainEvent
+	switch {
+	case sendErr == nil:
+		u.log.Info(ctx, "SMS accepted by provider", "sms_id", smsMsg.ID, "provider", provider, "provider_message_id", accepted.ProviderMessageID, "receiver", smsMsg.Receiver)
+		if err := smsMsg.MarkAsSent(provider, accepted.ProviderMessageID, accepted.ProviderPartIDs...); err != nil {
+			return err
+		}
 
-		// refunding user
-		refundMsg := sms.RequestBillingRefund{
-			TransactionID: event.TransactionID,
+	case sms.IsTransient(sendErr) && u.retry.ShouldRetry(attempt):
+		delay := u.retry.Delay(attempt)
+		u.log.Error(ctx, "SMS delivery failed, scheduling retry", "error", sendErr, "sms_id", smsMsg.ID, "provider", provider, "attempt", attempt, "delay", delay.String())
+		if err := smsMsg.ScheduleRetry(provider, failureCodeFor(sendErr)); err != nil {
+			return err
+		}
+		followUp = sms.SMSDeliveryRetry{
+			SMSID:         smsMsg.ID,
+			TransactionID: transactionID,
+			Attempt:       attempt + 1,
+			Delay:         delay,
 			TimeStamp:     time.Now(),
 		}
 
-		u.log.Info(ctx, "publishing refund request due to delivery failure", "sms_id", event.SMSID, "transaction_id", event.TransactionID)
-		err = u.publisher.PublishEvent(ctx, refundMsg)
-		if err != nil {
-			u.log.Error(ctx, "failed to publish refund request", "error", err, "sms_id", event.SMSID, "transaction_id", event.TransactionID)
+	default:
+		u.log.Error(ctx, "SMS delivery failed", "error", sendErr, "sms_id", smsMsg.ID, "provider", provider, "attempt", attempt, "transient", sms.IsTransient(sendErr))
+		if err := smsMsg.MarkAsFailed(provider, failureCodeFor(sendErr)); err != nil {
 			return err
 		}
-		u.log.Info(ctx, "refund request published successfully", "sms_id", event.SMSID, "transaction_id", event.TransactionID)
-	} else {
-		u.log.Info(ctx, "SMS delivered successfully", "sms_id", event.SMSID, "provider", provider, "receiver", smsMsg.Receiver)
-		smsMsg.MarkAsSent(provider)
+
+		// refunding user
+		followUp = sms.RequestBillingRefund{
+			TransactionID: transactionID,
+			Amount:        smsMsg.Amount,
+			TimeStamp:     time.Now(),
+		}
 	}
 
-	// updating sms object
-	err = u.smsRepo.Update(ctx, smsMsg.ID, smsMsg)
+	err := u.inTx(ctx, func(tx *gorm.DB) error {
+		// updating sms object together with the retry or refund request
+		if err := u.smsRepo.WithTx(tx).Update(ctx, smsMsg.ID, sms.SMSStatusSending, smsMsg); err != nil {
+			return err
+		}
+		if followUp == nil {
+			return nil
+		}
+		return u.outbox.WithTx(tx).Add(ctx, followUp)
+	})
 	if err != nil {
-		u.log.Error(ctx, "failed to update SMS status in database", "error", err, "sms_id", event.SMSID)
+		// the event is already in the inbox, so the SMS is not sent again;
+		// it stays in sending until ReconcileStuckSMS fails and refunds it
+		u.log.Error(ctx, "failed to record SMS delivery outcome", "error", err, "sms_id", smsMsg.ID, "status", string(smsMsg.Status), "provider", provider, "provider_message_id", accepted.ProviderMessageID)
 		return err
 	}
 
-	u.log.Info(ctx, "SMS processing completed", "sms_id", event.SMSID, "final_status", string(smsMsg.Status))
+	if followUp != nil {
+		u.log.Info(ctx, "follow-up event queued in outbox after delivery failure", "sms_id", smsMsg.ID, "transaction_id", transactionID, "event_type", string(followUp.EventType()))
+	}
 	return nil
 }
-func (u *Service) dispatchSMSDelivery(ctx context.Context, message sms.SMSMessage) (string, error) {
-	return u.provider.SendSMS(ctx, &message)
+
+// failureCodeFor maps a provider error to the failure code stored on the SMS.
+func failureCodeFor(err error) string {
+	var (
+		exhausted   *sms.ProvidersExhaustedError
+		providerErr *sms.ProviderError
+	)
+	switch {
+	case errors.As(err, &exhausted):
+		return exhausted.FailureCode()
+	case errors.Is(err, sms.ErrNoProviderRoute):
+		return sms.NoProviderRoute
+	case errors.As(err, &providerErr) && providerErr.Code != "":
+		return providerErr.Code
+	default:
+		return sms.MNOProviderFailed
+	}
+}
+
+// dispatchSMSDelivery sends a copy of the message and returns the provider
+// that accepted it together with the copy, which carries the IDs that
+// provider assigned.
+func (u *Service) dispatchSMSDelivery(ctx context.Context, message sms.SMSMessage) (string, sms.SMSMessage, error) {
+	provider, err := u.provider.SendSMS(ctx, &message)
+	return provider, message, err
 }
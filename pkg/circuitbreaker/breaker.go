@@ -0,0 +1,99 @@
+package circuitbreaker
+
+import (
+	"sync"
+	"time"
+)
+
+type State string
+
+const (
+	StateClosed   State = "closed"
+	StateOpen     State = "open"
+	StateHalfOpen State = "half_open"
+)
+
+// Breaker opens after FailureThreshold consecutive failures and rejects calls
+// for OpenTimeout. It then lets a single trial call through: success closes
+// it again, failure re-opens it.
+type Breaker struct {
+	mu               sync.Mutex
+	failureThreshold int
+	openTimeout      time.Duration
+	state            State
+	failures         int
+	openedAt         time.Time
+	trialInFlight    bool
+}
+
+func New(failureThreshold int, openTimeout time.Duration) *Breaker {
+	if failureThreshold <= 0 {
+		failureThreshold = 1
+	}
+	return &Breaker{
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		state:            StateClosed,
+	}
+}
+
+// Allow reports whether a call may go through now.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return false
+		}
+		b.state = StateHalfOpen
+		b.trialInFlight = true
+		return true
+	case StateHalfOpen:
+		if b.trialInFlight {
+			return false
+		}
+		b.trialInFlight = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = StateClosed
+	b.failures = 0
+	b.trialInFlight = false
+}
+
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.trialInFlight = false
+	if b.state == StateHalfOpen || b.failures >= b.failureThreshold {
+		b.state = StateOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// Cancel releases a call that was allowed but ended without telling whether
+// the provider is healthy, such as a cancelled request. A half-open breaker
+// lets the next call through as its trial.
+func (b *Breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trialInFlight = false
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
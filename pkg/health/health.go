@@ -0,0 +1,121 @@
+// Package health runs dependency checks for liveness and readiness probes.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Check reports whether a dependency is usable; a nil error means it is.
+type Check func(ctx context.Context) error
+
+// Report is the outcome of running every check. Status is down as soon as
+// one check is.
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Checker runs named checks concurrently, each bounded by the timeout.
+type Checker struct {
+	timeout time.Duration
+	names   []string
+	checks  []Check
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a check under name.
+func (c *Checker) Add(name string, check Check) *Checker {
+	c.names = append(c.names, name)
+	c.checks = append(c.checks, check)
+	return c
+}
+
+func (c *Checker) Run(ctx context.Context) Report {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	results := make([]CheckResult, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: make(map[string]CheckResult, len(results))}
+	for i, result := range results {
+		if result.Status == StatusDown {
+			report.Status = StatusDown
+		}
+		report.Checks[c.names[i]] = result
+	}
+	return report
+}
+
+// run gives up on a check that ignores the context once it is done.
+func run(ctx context.Context, check Check) CheckResult {
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		return CheckResult{Status: StatusDown, Error: err.Error()}
+	}
+	return CheckResult{Status: StatusUp}
+}
+
+// ReadyHandler serves the report of every check, with 503 Service
+// Unavailable while any of them is down.
+func (c *Checker) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context())
+		code := http.StatusOK
+		if report.Status != StatusUp {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, report)
+	})
+}
+
+// LiveHandler answers as long as the process can serve requests at all. It
+// runs no checks, so a dependency outage does not get the process restarted.
+func LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, Report{Status: StatusUp})
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(report)
+}
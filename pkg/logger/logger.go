@@ -37,6 +37,12 @@ func WithTraceID(ctx context.Context) context.Context {
 	return ctx
 }
 
+// ContextWithTraceID carries an existing trace ID, e.g. one received from
+// another service, in ctx.
+func ContextWithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, TraceIDKey, traceID)
+}
+
 func GetTraceID(ctx context.Context) string {
 	if traceID, ok := ctx.Value(TraceIDKey).(string); ok {
 		return traceID
@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// Middleware counts and times requests by method, matched route and status.
+// Labeling by route rather than path keeps IDs out of the label values.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		// the error handler only sets the status after the middleware returns
+		status := c.Response().StatusCode()
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			status = fiberErr.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+
+		// fiber reuses the method's buffer, while the vector keeps its labels
+		labels := []string{utils.CopyString(c.Method()), c.Route().Path, strconv.Itoa(status)}
+		HTTPRequests.WithLabelValues(labels...).Inc()
+		HTTPRequestDuration.WithLabelValues(labels...).Observe(Since(start))
+		return err
+	}
+}
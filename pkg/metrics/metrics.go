@@ -0,0 +1,98 @@
+// Package metrics holds the Prometheus collectors of the service and serves
+// them for scraping.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every collector of this package together with the Go
+// runtime and process collectors.
+var Registry = prometheus.NewRegistry()
+
+var (
+	SMSCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "sms_created_total",
+		Help: "SMS accepted and sent to billing.",
+	})
+	SMSSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sms_sent_total",
+		Help: "SMS accepted by a provider.",
+	}, []string{"provider"})
+	SMSDelivered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sms_delivered_total",
+		Help: "SMS a provider reported as delivered to the handset.",
+	}, []string{"provider"})
+	SMSFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sms_failed_total",
+		Help: "SMS that failed for good, by final status and failure code.",
+	}, []string{"provider", "status", "failure_code"})
+	SMSRefunded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sms_refunded_total",
+		Help: "Refunds requested for SMS that failed to send. Undelivered and expired SMS stay billed.",
+	}, []string{"provider", "failure_code"})
+
+	ProviderRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sms_provider_request_duration_seconds",
+		Help:    "Time a gateway took to accept or reject an SMS.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"provider", "outcome"})
+
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by route and status code.",
+	}, []string{"method", "route", "status"})
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to handle an HTTP request.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	PublishFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rabbitmq_publish_failures_total",
+		Help: "Messages that could not be published or were not confirmed by the broker.",
+	}, []string{"exchange", "routing_key"})
+	ConsumerProcessingDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rabbitmq_consumer_processing_duration_seconds",
+		Help:    "Time a queue handler took per message, by outcome.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"queue", "outcome"})
+)
+
+// Outcome labels shared by the histograms.
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		SMSCreated,
+		SMSSent,
+		SMSDelivered,
+		SMSFailed,
+		SMSRefunded,
+		ProviderRequestDuration,
+		HTTPRequests,
+		HTTPRequestDuration,
+		PublishFailures,
+		ConsumerProcessingDuration,
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Since returns the seconds elapsed since start, as histograms observe them.
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
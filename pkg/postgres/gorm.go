@@ -1,6 +1,7 @@
 package postgres
 
 import (
+	"context"
 	"fmt"
 
 	"gorm.io/driver/postgres"
@@ -35,3 +36,18 @@ func NewPsqlGormConnection(opt DBConnOptions) (*gorm.DB, error) {
 func Migrate(db *gorm.DB, models ...interface{}) error {
 	return db.AutoMigrate(models...)
 }
+
+// Transactor runs functions in transactions of a connection.
+type Transactor struct {
+	db *gorm.DB
+}
+
+func NewTransactor(db *gorm.DB) *Transactor {
+	return &Transactor{db: db}
+}
+
+// InTx runs fn in a transaction that commits when fn returns nil and rolls
+// back otherwise.
+func (t *Transactor) InTx(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return t.db.WithContext(ctx).Transaction(fn)
+}
@@ -0,0 +1,175 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/streadway/amqp"
+)
+
+var (
+	// ErrNacked is returned when the broker could not take responsibility
+	// for a published message.
+	ErrNacked     = errors.New("rabbit: message nacked by broker")
+	ErrUnroutable = errors.New("rabbit: message unroutable")
+
+	// errNotPublished means the channel closed before the message was sent,
+	// so publishing it again cannot duplicate it.
+	errNotPublished = fmt.Errorf("%w: channel closed before publishing", ErrDisconnected)
+)
+
+// publishSeqHeader carries the delivery tag of a publish, since returns carry
+// none.
+const publishSeqHeader = "x-publish-seq"
+
+// ReturnedError describes a mandatory message the broker returned because no
+// queue was bound for it.
+type ReturnedError struct {
+	Exchange   string
+	RoutingKey string
+	Code       uint16
+	Text       string
+}
+
+func (e *ReturnedError) Error() string {
+	return fmt.Sprintf("rabbit: message to exchange %q with routing key %q returned: %d %s", e.Exchange, e.RoutingKey, e.Code, e.Text)
+}
+
+func (e *ReturnedError) Is(target error) bool {
+	return target == ErrUnroutable
+}
+
+// confirmChannel is a channel in confirm mode. It publishes mandatory
+// messages and matches the broker's acks, nacks and returns to the publishes
+// waiting for them.
+type confirmChannel struct {
+	ch Channel
+
+	// publishMu keeps delivery tags in the order the broker assigns them
+	publishMu sync.Mutex
+	lastTag   uint64
+
+	mu       sync.Mutex
+	pending  map[uint64]chan error
+	returned map[uint64]error
+	closed   bool
+}
+
+func newConfirmChannel(ch Channel) (*confirmChannel, error) {
+	if err := ch.Confirm(false); err != nil {
+		return nil, err
+	}
+
+	c := &confirmChannel{
+		ch:       ch,
+		pending:  make(map[uint64]chan error),
+		returned: make(map[uint64]error),
+	}
+	// unbuffered, so a message's return is always handled before its ack
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation))
+	returns := ch.NotifyReturn(make(chan amqp.Return))
+	go c.dispatch(confirms, returns)
+	return c, nil
+}
+
+// publish sends msg as mandatory and waits until the broker confirms it.
+func (c *confirmChannel) publish(ctx context.Context, exchange, key string, msg amqp.Publishing) error {
+	done := make(chan error, 1)
+
+	c.publishMu.Lock()
+	tag := c.lastTag + 1
+	// the caller's headers are left as they are
+	headers := copyHeaders(msg.Headers)
+	headers[publishSeqHeader] = int64(tag)
+	msg.Headers = headers
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		c.publishMu.Unlock()
+		return errNotPublished
+	}
+	c.pending[tag] = done
+	c.mu.Unlock()
+
+	if err := c.ch.Publish(exchange, key, true, false, msg); err != nil {
+		c.publishMu.Unlock()
+		c.forget(tag)
+		if errors.Is(err, amqp.ErrClosed) {
+			return fmt.Errorf("%w: %w", errNotPublished, err)
+		}
+		return err
+	}
+	c.lastTag = tag
+	c.publishMu.Unlock()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		c.forget(tag)
+		return fmt.Errorf("rabbit: waiting for publish confirm: %w", ctx.Err())
+	}
+}
+
+func (c *confirmChannel) forget(tag uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, tag)
+	delete(c.returned, tag)
+}
+
+func (c *confirmChannel) dispatch(confirms <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	for {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			tag, ok := r.Headers[publishSeqHeader].(int64)
+			if !ok {
+				continue
+			}
+			c.mu.Lock()
+			c.returned[uint64(tag)] = &ReturnedError{Exchange: r.Exchange, RoutingKey: r.RoutingKey, Code: r.ReplyCode, Text: r.ReplyText}
+			c.mu.Unlock()
+
+		case confirm, ok := <-confirms:
+			if !ok {
+				c.fail()
+				return
+			}
+			c.mu.Lock()
+			var err error
+			if !confirm.Ack {
+				err = ErrNacked
+			} else if returnErr, ok := c.returned[confirm.DeliveryTag]; ok {
+				err = returnErr
+			}
+			done, ok := c.pending[confirm.DeliveryTag]
+			delete(c.pending, confirm.DeliveryTag)
+			delete(c.returned, confirm.DeliveryTag)
+			c.mu.Unlock()
+
+			if ok {
+				done <- err
+			}
+		}
+	}
+}
+
+// fail releases every publish still waiting once the channel is gone; their
+// outcome is unknown.
+func (c *confirmChannel) fail() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	for tag, done := range c.pending {
+		done <- ErrDisconnected
+		delete(c.pending, tag)
+	}
+}
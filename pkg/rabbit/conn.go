@@ -1,52 +1,401 @@
 package rabbit
 
-import "github.com/streadway/amqp"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sms/pkg/logger"
+	"sms/pkg/metrics"
+	"sync"
+	"time"
 
+	"github.com/streadway/amqp"
+)
+
+var (
+	ErrDisconnected = errors.New("rabbit: not connected")
+	ErrClosed       = errors.New("rabbit: connection closed")
+)
+
+type Options struct {
+	// ReconnectDelay is the wait before redialing a lost connection; it
+	// doubles after every failed attempt up to MaxReconnectDelay.
+	ReconnectDelay    time.Duration
+	MaxReconnectDelay time.Duration
+	// BlockPublish makes Publish wait for a lost connection to come back
+	// instead of failing with ErrDisconnected.
+	BlockPublish bool
+	// PublishTimeout bounds a Publish whose context has no deadline,
+	// including the wait for the broker's confirm.
+	PublishTimeout time.Duration
+	// Dial opens connections; Dial of this package when nil.
+	Dial   func(uri string) (Connection, error)
+	Logger *logger.Logger
+}
+
+// RabbitConn owns a connection with a channel for consuming and one in
+// confirm mode for publishing. When any of them closes it redials with
+// backoff, replays every queue declaration made through it and lets consumers
+// resubscribe.
 type RabbitConn struct {
-	Conn *amqp.Connection
-	Ch   *amqp.Channel
+	uri  string
+	opts Options
+	log  *logger.Logger
+
+	mu   sync.Mutex
+	conn Connection
+	ch   Channel
+	pub  *confirmChannel
+	// ready is closed while connected and replaced when the connection drops
+	ready    chan struct{}
+	topology []func(Channel) error
+	closed   bool
+	done     chan struct{}
 }
 
-func NewRabbitConn(uri string) *RabbitConn {
-	conn, err := amqp.Dial(uri)
-	if err != nil {
-		panic(err)
+// NewRabbitConn dials uri. Only this first dial fails; later connection
+// losses are recovered in the background.
+func NewRabbitConn(uri string, opts Options) (*RabbitConn, error) {
+	if opts.ReconnectDelay <= 0 {
+		opts.ReconnectDelay = time.Second
+	}
+	if opts.MaxReconnectDelay < opts.ReconnectDelay {
+		opts.MaxReconnectDelay = max(30*time.Second, opts.ReconnectDelay)
+	}
+	if opts.Dial == nil {
+		opts.Dial = Dial
+	}
+	if opts.Logger == nil {
+		opts.Logger = logger.NewLogger("info")
 	}
 
-	ch, err := conn.Channel()
-	if err != nil {
-		panic(err)
+	r := &RabbitConn{
+		uri:   uri,
+		opts:  opts,
+		log:   opts.Logger,
+		ready: make(chan struct{}),
+		done:  make(chan struct{}),
 	}
-	return &RabbitConn{
-		Conn: conn,
-		Ch:   ch,
+	if err := r.connect(); err != nil {
+		return nil, err
 	}
+	return r, nil
 }
 
-// using amq.topic exchnage (no need to declare exchange before)
-func (r *RabbitConn) DeclareBindQueue(name, exchange, routing string) error {
-	_, err := r.Ch.QueueDeclare(
-		name,
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
+// Channel returns the current channel, or ErrDisconnected while the
+// connection is being recovered.
+func (r *RabbitConn) Channel() (Channel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil, ErrClosed
+	}
+	if r.ch == nil {
+		return nil, ErrDisconnected
+	}
+	return r.ch, nil
+}
+
+// WaitChannel returns the current channel, waiting for the connection to be
+// recovered if needed.
+func (r *RabbitConn) WaitChannel(ctx context.Context) (Channel, error) {
+	ch, _, err := r.wait(ctx)
+	return ch, err
+}
+
+// openChannel opens a new channel on the current connection, waiting for
+// the connection to be recovered if needed.
+func (r *RabbitConn) openChannel(ctx context.Context) (Channel, error) {
+	for {
+		if _, _, err := r.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		r.mu.Lock()
+		conn := r.conn
+		r.mu.Unlock()
+		if conn != nil {
+			ch, err := conn.Channel()
+			if err == nil {
+				return ch, nil
+			}
+		}
+
+		// the connection is going away; wait for the next one
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %w", ErrDisconnected, ctx.Err())
+		case <-time.After(r.opts.ReconnectDelay):
+		}
+	}
+}
+
+func (r *RabbitConn) wait(ctx context.Context) (Channel, *confirmChannel, error) {
+	for {
+		r.mu.Lock()
+		ch, pub, ready, closed := r.ch, r.pub, r.ready, r.closed
+		r.mu.Unlock()
+
+		if closed {
+			return nil, nil, ErrClosed
+		}
+		if ch != nil {
+			return ch, pub, nil
+		}
+
+		select {
+		case <-ready:
+		case <-r.done:
+		case <-ctx.Done():
+			return nil, nil, fmt.Errorf("%w: %w", ErrDisconnected, ctx.Err())
+		}
+	}
+}
+
+// Check reports whether the connection and both of its channels are open. It
+// fails with ErrDisconnected while a lost connection is being recovered.
+func (r *RabbitConn) Check(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrClosed
+	}
+	if r.conn == nil || r.conn.IsClosed() || r.ch == nil || r.pub == nil {
+		return ErrDisconnected
+	}
+	return nil
+}
+
+// Close closes the connection for good.
+func (r *RabbitConn) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	close(r.done)
+	conn := r.conn
+	r.conn, r.ch, r.pub = nil, nil, nil
+	r.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return conn.Close()
+}
+
+// publish sends msg as a persistent, mandatory message and waits until the
+// broker confirms it. Unroutable messages fail with a ReturnedError.
+func (r *RabbitConn) publish(ctx context.Context, exchange, key string, msg amqp.Publishing) (err error) {
+	defer func() {
+		if err != nil {
+			metrics.PublishFailures.WithLabelValues(exchange, key).Inc()
+		}
+	}()
+
+	if _, ok := ctx.Deadline(); !ok && r.opts.PublishTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.opts.PublishTimeout)
+		defer cancel()
+	}
+
+	msg.DeliveryMode = amqp.Persistent
+	if !r.opts.BlockPublish {
+		r.mu.Lock()
+		closed, pub := r.closed, r.pub
+		r.mu.Unlock()
+		if closed {
+			return ErrClosed
+		}
+		if pub == nil {
+			return ErrDisconnected
+		}
+		return pub.publish(ctx, exchange, key, msg)
+	}
+
+	for {
+		_, pub, err := r.wait(ctx)
+		if err != nil {
+			return err
+		}
+		// the channel closed before watch noticed; wait for the next one
+		err = pub.publish(ctx, exchange, key, msg)
+		if !errors.Is(err, errNotPublished) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+// declare runs fn on the current channel and again on every channel opened
+// after a reconnect. While disconnected fn only runs once the connection is
+// back.
+func (r *RabbitConn) declare(fn func(ch Channel) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrClosed
+	}
+	if r.ch != nil {
+		if err := fn(r.ch); err != nil {
+			return err
+		}
+	}
+	r.topology = append(r.topology, fn)
+	return nil
+}
+
+func (r *RabbitConn) connect() error {
+	conn, err := r.opts.Dial(r.uri)
 	if err != nil {
 		return err
 	}
-
-	err = r.Ch.QueueBind(
-		name,
-		routing,
-		exchange,
-		false,
-		nil,
-	)
+	ch, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	pubCh, err := conn.Channel()
 	if err != nil {
+		_ = conn.Close()
 		return err
 	}
+	pub, err := newConfirmChannel(pubCh)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		_ = conn.Close()
+		return ErrClosed
+	}
+	for _, fn := range r.topology {
+		if err := fn(ch); err != nil {
+			_ = conn.Close()
+			return err
+		}
+	}
 
+	// registered before anyone can use the channel, so no close is missed
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+	pubClosed := pubCh.NotifyClose(make(chan *amqp.Error, 1))
+
+	r.conn, r.ch, r.pub = conn, ch, pub
+	close(r.ready)
+	go r.watch(conn, connClosed, chClosed, pubClosed)
 	return nil
 }
+
+// watch waits for the connection or one of its channels to close and
+// reconnects.
+func (r *RabbitConn) watch(conn Connection, connClosed, chClosed, pubClosed chan *amqp.Error) {
+	var reason *amqp.Error
+	select {
+	case reason = <-connClosed:
+	case reason = <-chClosed:
+	case reason = <-pubClosed:
+	}
+
+	r.mu.Lock()
+	closed := r.closed
+	if !closed {
+		r.conn, r.ch, r.pub = nil, nil, nil
+		r.ready = make(chan struct{})
+	}
+	r.mu.Unlock()
+
+	_ = conn.Close()
+	if closed {
+		return
+	}
+	r.log.Error(context.Background(), "rabbitmq connection lost", "error", reason)
+
+	delay := r.opts.ReconnectDelay
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-time.After(delay):
+		}
+
+		err := r.connect()
+		if err == nil {
+			r.log.Info(context.Background(), "rabbitmq connection restored")
+			return
+		}
+		if errors.Is(err, ErrClosed) {
+			return
+		}
+		delay = min(delay*2, r.opts.MaxReconnectDelay)
+		r.log.Error(context.Background(), "failed to reconnect to rabbitmq", "error", err, "retry_in", delay.String())
+	}
+}
+
+// using amq.topic exchnage (no need to declare exchange before)
+func (r *RabbitConn) DeclareBindQueue(name, exchange, routing string) error {
+	return r.declare(func(ch Channel) error {
+		_, err := ch.QueueDeclare(
+			name,
+			true,
+			false,
+			false,
+			false,
+			nil,
+		)
+		if err != nil {
+			return err
+		}
+
+		err = ch.QueueBind(
+			name,
+			routing,
+			exchange,
+			false,
+			nil,
+		)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// DeclareDelayQueue declares a queue nobody consumes: messages sit in it for
+// delay and are then dead-lettered to exchange with the given routing key.
+func (r *RabbitConn) DeclareDelayQueue(name string, delay time.Duration, exchange, routing string) error {
+	return r.declare(func(ch Channel) error {
+		_, err := ch.QueueDeclare(
+			name,
+			true,
+			false,
+			false,
+			false,
+			amqp.Table{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    exchange,
+				"x-dead-letter-routing-key": routing,
+			},
+		)
+		return err
+	})
+}
+
+// DelayQueueName names the delay queue holding messages for base. Every
+// delay gets its own queue since a queue's TTL cannot change once declared.
+func DelayQueueName(base string, delay time.Duration) string {
+	return fmt.Sprintf("%s.delay.%s", base, delay)
+}
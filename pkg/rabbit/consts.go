@@ -2,9 +2,20 @@ package rabbit
 
 const (
 	// consumer will use this queue
-	SMSBillingCompletedQueue = "sms_billing.debit.completed"
+	SMSBillingCompletedQueue   = "sms_billing.debit.completed"
+	BatchBillingCompletedQueue = "sms_billing.debit.batch.completed"
 	// producer will use this routing key to publish billing requested event
-	BillingRequestedRoutingKey = "billing.debit.request"
-	BillingRefundedRoutingKey  = "billing.refund.request"
-	Exchange                   = "amq.topic"
+	BillingRequestedRoutingKey      = "billing.debit.request"
+	BatchBillingRequestedRoutingKey = "billing.debit.batch.request"
+	BillingRefundedRoutingKey       = "billing.refund.request"
+	// SMS of a debited batch are dispatched one message each through here
+	DispatchQueue      = "sms.dispatch"
+	DispatchRoutingKey = "sms.dispatch"
+	// delivery retries wait in delay queues and are then routed here
+	DeliveryRetryQueue      = "sms.delivery.retry"
+	DeliveryRetryRoutingKey = "sms.delivery.retry"
+	Exchange                = "amq.topic"
 )
+
+// TraceIDHeader carries the trace ID of the request a message belongs to.
+const TraceIDHeader = "x-trace-id"
@@ -0,0 +1,187 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Headers used to track failed deliveries.
+const (
+	RedeliveryCountHeader = "x-redelivery-count"
+	DeadLetterReason      = "x-dead-letter-reason"
+	OriginalQueueHeader   = "x-original-queue"
+	FailedAtHeader        = "x-failed-at"
+)
+
+// ErrMalformedMessage marks handler errors that retrying cannot fix; such
+// messages go to the DLQ right away. Wrap it, e.g. fmt.Errorf("%w: ...", ErrMalformedMessage).
+var ErrMalformedMessage = errors.New("malformed message")
+
+// DeadLetter is a message parked in a DLQ.
+type DeadLetter struct {
+	Body          []byte
+	ContentType   string
+	Reason        string
+	OriginalQueue string
+	Redeliveries  int
+	FailedAt      time.Time
+}
+
+// DLQName returns the dead-letter queue of queue.
+func DLQName(queue string) string {
+	return queue + ".dlq"
+}
+
+// DeclareDLQ declares the dead-letter queue of queue.
+func (r *RabbitConn) DeclareDLQ(queue string) error {
+	return r.declare(func(ch Channel) error {
+		_, err := ch.QueueDeclare(
+			DLQName(queue),
+			true,
+			false,
+			false,
+			false,
+			nil,
+		)
+		return err
+	})
+}
+
+// InspectDLQ returns up to limit messages from the DLQ of queue without
+// removing them. It reads on a channel of its own, so a missing DLQ does not
+// close the channel the connection declares and consumes on.
+func (r *RabbitConn) InspectDLQ(ctx context.Context, queue string, limit int) ([]DeadLetter, error) {
+	ch, err := r.openChannel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer ch.Close()
+
+	var (
+		letters    []DeadLetter
+		deliveries []amqp.Delivery
+	)
+	// every fetched message stays unacked until the end, so none is read twice
+	defer func() {
+		for _, d := range deliveries {
+			_ = d.Nack(false, true)
+		}
+	}()
+
+	for len(letters) < limit {
+		d, ok, err := ch.Get(DLQName(queue), false)
+		if err != nil {
+			return letters, err
+		}
+		if !ok {
+			break
+		}
+		deliveries = append(deliveries, d)
+		letters = append(letters, deadLetterFrom(d))
+	}
+	return letters, nil
+}
+
+// RedriveDLQ moves up to limit messages from the DLQ of queue back to the
+// queue they failed in, with a fresh redelivery count. It returns how many
+// were moved. Like InspectDLQ it reads on a channel of its own.
+func (r *RabbitConn) RedriveDLQ(ctx context.Context, queue string, limit int) (int, error) {
+	ch, err := r.openChannel(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+
+	moved := 0
+	for moved < limit {
+		d, ok, err := ch.Get(DLQName(queue), false)
+		if err != nil {
+			return moved, err
+		}
+		if !ok {
+			break
+		}
+
+		target := deadLetterFrom(d).OriginalQueue
+		if target == "" {
+			target = queue
+		}
+		headers := copyHeaders(d.Headers)
+		for _, key := range []string{RedeliveryCountHeader, DeadLetterReason, OriginalQueueHeader, FailedAtHeader} {
+			delete(headers, key)
+		}
+
+		err = r.publish(ctx, "", target, republish(d, headers))
+		if err != nil {
+			_ = d.Nack(false, true)
+			return moved, fmt.Errorf("redrive to %s: %w", target, err)
+		}
+		if err := d.Ack(false); err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+func deadLetterFrom(d amqp.Delivery) DeadLetter {
+	letter := DeadLetter{
+		Body:         d.Body,
+		ContentType:  d.ContentType,
+		Redeliveries: RedeliveryCount(d.Headers),
+	}
+	letter.Reason, _ = d.Headers[DeadLetterReason].(string)
+	letter.OriginalQueue, _ = d.Headers[OriginalQueueHeader].(string)
+	letter.FailedAt, _ = d.Headers[FailedAtHeader].(time.Time)
+	return letter
+}
+
+// RedeliveryCount reads how many times a message was redelivered after a
+// handler error.
+func RedeliveryCount(headers amqp.Table) int {
+	switch v := headers[RedeliveryCountHeader].(type) {
+	case int:
+		return v
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	default:
+		return 0
+	}
+}
+
+// republish copies every property of d, such as the correlation ID that
+// carries the trace, onto a new message with the given headers.
+func republish(d amqp.Delivery, headers amqp.Table) amqp.Publishing {
+	return amqp.Publishing{
+		Headers:         headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    d.DeliveryMode,
+		Priority:        d.Priority,
+		CorrelationId:   d.CorrelationId,
+		ReplyTo:         d.ReplyTo,
+		Expiration:      d.Expiration,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		UserId:          d.UserId,
+		AppId:           d.AppId,
+		Body:            d.Body,
+	}
+}
+
+func copyHeaders(headers amqp.Table) amqp.Table {
+	result := make(amqp.Table, len(headers)+4)
+	for key, value := range headers {
+		result[key] = value
+	}
+	return result
+}
@@ -1,8 +1,14 @@
 package rabbit
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"sms/pkg/logger"
+	"sms/pkg/metrics"
+	"sms/pkg/tracing"
+	"sync"
+	"time"
 
 	"github.com/streadway/amqp"
 )
@@ -11,9 +17,49 @@ type Publisher struct {
 	rabbitConn *RabbitConn
 }
 
+// Consumer runs a pool of workers per subscribed queue, each queue on its
+// own channel so its prefetch count applies to it alone.
 type Consumer struct {
-	rabbitConn *RabbitConn
-	handlers   map[string]func([]byte) error
+	rabbitConn    *RabbitConn
+	subscriptions map[string]subscription
+
+	stopCtx context.Context
+	stop    context.CancelFunc
+	wg      sync.WaitGroup
+
+	mu       sync.Mutex
+	channels map[string]Channel
+	stopped  bool
+}
+
+// Defaults for queues subscribed without options.
+const (
+	DefaultMaxRedeliveries = 5
+	DefaultWorkers         = 4
+	DefaultRedeliveryDelay = 5 * time.Second
+)
+
+type QueueOptions struct {
+	// MaxRedeliveries is how often a message is redelivered after a handler
+	// error before it is moved to the DLQ.
+	MaxRedeliveries int
+	// RedeliveryDelay is how long a failed message waits in a delay queue
+	// before it is redelivered; zero redelivers it at once.
+	RedeliveryDelay time.Duration
+	// Workers is how many messages of the queue are handled in parallel.
+	Workers int
+	// Prefetch is how many unacked messages the broker hands out at once;
+	// at least Workers.
+	Prefetch int
+}
+
+// Handler handles one message. ctx carries the trace ID the message was
+// published with, or a new one.
+type Handler func(ctx context.Context, body []byte) error
+
+type subscription struct {
+	handler Handler
+	opts    QueueOptions
 }
 
 func NewPublisher(conn *RabbitConn) *Publisher {
@@ -22,45 +68,174 @@ func NewPublisher(conn *RabbitConn) *Publisher {
 	}
 }
 
-func (p *Publisher) Publish(routingKey, exchange string, body interface{}) error {
+// Publish sends body as a persistent message and returns once the broker
+// confirmed it, or failed with ErrNacked, ErrUnroutable or the context's
+// error. It fails with ErrDisconnected while the connection is down, unless
+// the connection was opened with BlockPublish.
+func (p *Publisher) Publish(ctx context.Context, routingKey, exchange string, body interface{}) error {
 	bodyJson, err := json.Marshal(body)
 	if err != nil {
 		return err
 	}
-	return p.rabbitConn.Ch.Publish(
-		exchange,
-		routingKey,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        bodyJson,
-		},
-	)
+	msg := amqp.Publishing{
+		ContentType: "application/json",
+		Headers:     amqp.Table{},
+		Body:        bodyJson,
+	}
+	if traceID := logger.GetTraceID(ctx); traceID != "" {
+		msg.Headers[TraceIDHeader] = traceID
+		msg.CorrelationId = traceID
+	}
+
+	ctx, span := startPublishSpan(ctx, exchange, routingKey, msg.Headers)
+	defer span.End()
+
+	err = p.rabbitConn.publish(ctx, exchange, routingKey, msg)
+	tracing.RecordError(span, err)
+	return err
 }
 
 func NewConsumer(conn *RabbitConn) *Consumer {
 	return &Consumer{
-		rabbitConn: conn,
-		handlers:   make(map[string]func([]byte) error),
+		rabbitConn:    conn,
+		subscriptions: make(map[string]subscription),
+		channels:      make(map[string]Channel),
 	}
 }
 
-func (c *Consumer) Subscribe(queueName string, handler func([]byte) error) {
-	c.handlers[queueName] = handler
+func (c *Consumer) Subscribe(queueName string, handler Handler) {
+	c.SubscribeWithOptions(queueName, QueueOptions{
+		MaxRedeliveries: DefaultMaxRedeliveries,
+		RedeliveryDelay: DefaultRedeliveryDelay,
+		Workers:         DefaultWorkers,
+		Prefetch:        2 * DefaultWorkers,
+	}, handler)
+}
+
+func (c *Consumer) SubscribeWithOptions(queueName string, opts QueueOptions, handler Handler) {
+	opts.Workers = max(opts.Workers, 1)
+	opts.Prefetch = max(opts.Prefetch, opts.Workers)
+	c.subscriptions[queueName] = subscription{handler: handler, opts: opts}
 }
 
 func (c *Consumer) StartConsume() error {
-	for queueName, handler := range c.handlers {
-		go c.consumeFromQueue(queueName, handler)
+	c.stopCtx, c.stop = context.WithCancel(context.Background())
+	for queueName, sub := range c.subscriptions {
+		if err := c.rabbitConn.DeclareDLQ(queueName); err != nil {
+			return err
+		}
+		if delay := sub.opts.RedeliveryDelay; delay > 0 {
+			// the default exchange routes the expired message back by name
+			if err := c.rabbitConn.DeclareDelayQueue(DelayQueueName(queueName, delay), delay, "", queueName); err != nil {
+				return err
+			}
+		}
+		c.wg.Add(1)
+		go c.consumeFromQueue(queueName, sub)
 	}
 	return nil
 }
 
-func (c *Consumer) consumeFromQueue(queueName string, handler func([]byte) error) {
-	msgs, err := c.rabbitConn.Ch.Consume(
+// Shutdown stops taking new messages and waits until the messages already
+// handed to the workers are handled and acked, or ctx ends.
+func (c *Consumer) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	if !c.stopped {
+		c.stopped = true
+		if c.stop != nil {
+			c.stop()
+		}
+		for queueName, ch := range c.channels {
+			// the delivery channel is closed once the buffered messages are read
+			if err := ch.Cancel(queueName, false); err != nil {
+				c.rabbitConn.log.Error(ctx, "failed to cancel consumer", "error", err, "queue", queueName)
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// consumeFromQueue consumes until the consumer is shut down or the
+// connection is closed for good, resubscribing on a new channel whenever the
+// old one is lost.
+func (c *Consumer) consumeFromQueue(queueName string, sub subscription) {
+	defer c.wg.Done()
+
+	for {
+		ch, err := c.rabbitConn.openChannel(c.stopCtx)
+		if err != nil {
+			c.rabbitConn.log.Info(c.stopCtx, "consumer stopped", "queue", queueName, "reason", err.Error())
+			return
+		}
+
+		msgs, err := c.subscribe(ch, queueName, sub.opts)
+		if err != nil {
+			c.rabbitConn.log.Error(c.stopCtx, "failed to start consuming", "error", err, "queue", queueName)
+			_ = ch.Close()
+			select {
+			case <-c.stopCtx.Done():
+				return
+			case <-time.After(c.rabbitConn.opts.ReconnectDelay):
+			}
+			continue
+		}
+		c.rabbitConn.log.Info(c.stopCtx, "consumer started", "queue", queueName, "workers", sub.opts.Workers, "prefetch", sub.opts.Prefetch)
+
+		// every delivery is acked through the channel it came from, so each
+		// worker acks its own delivery tags
+		var workers sync.WaitGroup
+		for i := 0; i < sub.opts.Workers; i++ {
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+				for msg := range msgs {
+					c.handle(queueName, sub, msg)
+				}
+			}()
+		}
+		workers.Wait()
+
+		c.mu.Lock()
+		delete(c.channels, queueName)
+		stopped := c.stopped
+		c.mu.Unlock()
+		_ = ch.Close()
+
+		if stopped {
+			c.rabbitConn.log.Info(c.stopCtx, "consumer drained", "queue", queueName)
+			return
+		}
+		c.rabbitConn.log.Error(c.stopCtx, "consumer lost its channel", "queue", queueName)
+	}
+}
+
+func (c *Consumer) subscribe(ch Channel, queueName string, opts QueueOptions) (<-chan amqp.Delivery, error) {
+	if err := ch.Qos(opts.Prefetch, 0, false); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return nil, ErrClosed
+	}
+
+	msgs, err := ch.Consume(
+		queueName,
 		queueName,
-		"",
 		false,
 		false,
 		false,
@@ -68,25 +243,73 @@ func (c *Consumer) consumeFromQueue(queueName string, handler func([]byte) error
 		nil,
 	)
 	if err != nil {
-		log.Printf("Failed to start consuming from %s: %v", queueName, err)
-		return
+		return nil, err
+	}
+	c.channels[queueName] = ch
+	return msgs, nil
+}
+
+func (c *Consumer) handle(queueName string, sub subscription, msg amqp.Delivery) {
+	ctx, span := startProcessSpan(messageContext(msg), queueName, msg)
+	defer span.End()
+
+	start := time.Now()
+	err := sub.handler(ctx, msg.Body)
+	outcome := metrics.OutcomeSuccess
+	if err != nil {
+		outcome = metrics.OutcomeError
 	}
-	log.Printf("Consumer started for queue: %s", queueName)
+	metrics.ConsumerProcessingDuration.WithLabelValues(queueName, outcome).Observe(metrics.Since(start))
+	tracing.RecordError(span, err)
+	if err != nil {
+		c.rabbitConn.log.Error(ctx, "failed to handle message", "error", err, "queue", queueName)
+		c.handleFailure(ctx, queueName, sub.opts, msg, err)
+	} else {
+		msg.Ack(false)
+	}
+}
+
+// handleFailure republishes a failed message with an increased redelivery
+// count to the queue's delay queue, from where it returns to the queue, or
+// moves it to the DLQ once the count is exhausted or the message is
+// malformed. The original is only acked after the copy is published; if
+// publishing fails it is requeued as is.
+func (c *Consumer) handleFailure(ctx context.Context, queueName string, opts QueueOptions, msg amqp.Delivery, cause error) {
+	count := RedeliveryCount(msg.Headers)
+	headers := copyHeaders(msg.Headers)
 
-	for msg := range msgs {
-		if err := handler(msg.Body); err != nil {
-			log.Printf("Error handling message in %s: %v", queueName, err)
-			msg.Nack(false, true)
-		} else {
-			msg.Ack(false)
+	target := queueName
+	if errors.Is(cause, ErrMalformedMessage) || count >= opts.MaxRedeliveries {
+		target = DLQName(queueName)
+		headers[DeadLetterReason] = cause.Error()
+		headers[OriginalQueueHeader] = queueName
+		headers[FailedAtHeader] = time.Now().UTC()
+		c.rabbitConn.log.Error(ctx, "moving message to dlq", "error", cause, "queue", queueName, "dlq", target, "redeliveries", count)
+	} else {
+		headers[RedeliveryCountHeader] = int32(count + 1)
+		if opts.RedeliveryDelay > 0 {
+			target = DelayQueueName(queueName, opts.RedeliveryDelay)
 		}
 	}
+
+	err := c.rabbitConn.publish(context.Background(), "", target, republish(msg, headers))
+	if err != nil {
+		c.rabbitConn.log.Error(ctx, "failed to republish message", "error", err, "queue", target)
+		msg.Nack(false, true)
+		return
+	}
+	msg.Ack(false)
 }
 
-func (c *Consumer) SetQos(prefetchCount int) error {
-	return c.rabbitConn.Ch.Qos(
-		prefetchCount,
-		0,
-		false,
-	)
+// messageContext returns a context with the trace ID of msg. Messages from
+// services that only set the correlation ID continue that trace instead.
+func messageContext(msg amqp.Delivery) context.Context {
+	ctx := context.Background()
+	if traceID, ok := msg.Headers[TraceIDHeader].(string); ok && traceID != "" {
+		return logger.ContextWithTraceID(ctx, traceID)
+	}
+	if msg.CorrelationId != "" {
+		return logger.ContextWithTraceID(ctx, msg.CorrelationId)
+	}
+	return logger.WithTraceID(ctx)
 }
@@ -0,0 +1,766 @@
+// Package rabbittest provides an in-process AMQP broker for testing
+// rabbit.RabbitConn without RabbitMQ.
+package rabbittest
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sms/pkg/rabbit"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+var ErrRefused = errors.New("rabbittest: connection refused")
+
+// Broker routes messages through the default exchange and topic exchanges
+// such as amq.topic. It confirms and returns mandatory publishes,
+// dead-letters the messages of queues with a TTL once they expire and hands
+// out deliveries within a channel's prefetch count. Pass its Dial to
+// rabbit.Options.
+type Broker struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queues   map[string]*queue
+	bindings map[string][]binding
+	conns    map[*connection]struct{}
+	dials    []time.Time
+	refuse   int
+	nack     bool
+	hold     bool
+	nextID   uint64
+	errs     []error
+}
+
+type queue struct {
+	name  string
+	ttl   time.Duration
+	dlx   string
+	dlk   string
+	ready []message
+}
+
+type binding struct {
+	queue string
+	key   string
+}
+
+type message struct {
+	id          uint64
+	exchange    string
+	key         string
+	msg         amqp.Publishing
+	redelivered bool
+}
+
+func NewBroker() *Broker {
+	b := &Broker{
+		queues:   make(map[string]*queue),
+		bindings: make(map[string][]binding),
+		conns:    make(map[*connection]struct{}),
+	}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// Dial opens a connection unless dials are being refused.
+func (b *Broker) Dial(uri string) (rabbit.Connection, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.dials = append(b.dials, time.Now())
+	if b.refuse > 0 {
+		b.refuse--
+		return nil, ErrRefused
+	}
+	c := &connection{broker: b}
+	b.conns[c] = struct{}{}
+	return c, nil
+}
+
+// RefuseDials makes the next n dials fail with ErrRefused.
+func (b *Broker) RefuseDials(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refuse = n
+}
+
+// Dials returns when every dial, refused or not, was made.
+func (b *Broker) Dials() []time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]time.Time(nil), b.dials...)
+}
+
+// SetNack makes the broker nack every following publish on confirm channels.
+func (b *Broker) SetNack(nack bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nack = nack
+}
+
+// HoldConfirms stops the broker from confirming the following publishes.
+func (b *Broker) HoldConfirms(hold bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.hold = hold
+}
+
+// DropConnections closes every open connection with an error, as a broker
+// restart would.
+func (b *Broker) DropConnections() {
+	b.mu.Lock()
+	conns := make([]*connection, 0, len(b.conns))
+	for c := range b.conns {
+		conns = append(conns, c)
+	}
+	b.mu.Unlock()
+
+	for _, c := range conns {
+		c.close(&amqp.Error{Code: amqp.ConnectionForced, Reason: "CONNECTION_FORCED - broker forced connection closure", Server: true})
+	}
+}
+
+// Connections is the number of open connections.
+func (b *Broker) Connections() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.conns)
+}
+
+// Publish routes msg as another service would, without confirms.
+func (b *Broker) Publish(exchange, key string, msg amqp.Publishing) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.route(exchange, key, msg)
+}
+
+// Messages returns the messages ready in queue, oldest first.
+func (b *Broker) Messages(name string) []amqp.Publishing {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[name]
+	if !ok {
+		return nil
+	}
+	result := make([]amqp.Publishing, 0, len(q.ready))
+	for _, m := range q.ready {
+		result = append(result, m.msg)
+	}
+	return result
+}
+
+// HasQueue reports whether name was declared.
+func (b *Broker) HasQueue(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.queues[name]
+	return ok
+}
+
+// Unacked is the number of deliveries awaiting an ack on all channels.
+func (b *Broker) Unacked() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	unacked := 0
+	for c := range b.conns {
+		for _, ch := range c.channels {
+			unacked += len(ch.unacked)
+		}
+	}
+	return unacked
+}
+
+// Errors returns the channel errors clients caused, such as acking an
+// unknown delivery tag.
+func (b *Broker) Errors() []error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]error(nil), b.errs...)
+}
+
+// route enqueues msg in every queue bound for key and reports whether there
+// was one.
+func (b *Broker) route(exchange, key string, msg amqp.Publishing) bool {
+	var targets []*queue
+	if exchange == "" {
+		if q, ok := b.queues[key]; ok {
+			targets = append(targets, q)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, bound := range b.bindings[exchange] {
+		if !seen[bound.queue] && topicMatch(bound.key, key) {
+			seen[bound.queue] = true
+			targets = append(targets, b.queues[bound.queue])
+		}
+	}
+
+	for _, q := range targets {
+		b.nextID++
+		b.enqueue(q, message{id: b.nextID, exchange: exchange, key: key, msg: msg})
+	}
+	return len(targets) > 0
+}
+
+func (b *Broker) enqueue(q *queue, m message) {
+	q.ready = append(q.ready, m)
+	if q.ttl > 0 {
+		time.AfterFunc(q.ttl, func() { b.expire(q, m) })
+	}
+	b.cond.Broadcast()
+}
+
+// expire dead-letters m if it is still waiting in q.
+func (b *Broker) expire(q *queue, m message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, ready := range q.ready {
+		if ready.id != m.id {
+			continue
+		}
+		q.ready = append(q.ready[:i], q.ready[i+1:]...)
+		key := q.dlk
+		if key == "" {
+			key = m.key
+		}
+		b.route(q.dlx, key, m.msg)
+		return
+	}
+}
+
+// requeue puts a message back at its original position in its queue, as
+// RabbitMQ does, marked redelivered.
+func (b *Broker) requeue(name string, m message) {
+	q, ok := b.queues[name]
+	if !ok {
+		return
+	}
+	m.redelivered = true
+	i := 0
+	for i < len(q.ready) && q.ready[i].id < m.id {
+		i++
+	}
+	q.ready = slices.Insert(q.ready, i, m)
+	b.cond.Broadcast()
+}
+
+// topicMatch matches a routing key against a binding key where * stands for
+// one word and # for any number of words.
+func topicMatch(pattern, key string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(key, "."))
+}
+
+func matchWords(pattern, key []string) bool {
+	if len(pattern) == 0 {
+		return len(key) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(key); i++ {
+			if matchWords(pattern[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(key) > 0 && matchWords(pattern[1:], key[1:])
+	default:
+		return len(key) > 0 && pattern[0] == key[0] && matchWords(pattern[1:], key[1:])
+	}
+}
+
+type connection struct {
+	broker   *Broker
+	channels []*channel
+	closed   bool
+	notify   []chan *amqp.Error
+}
+
+func (c *connection) Channel() (rabbit.Channel, error) {
+	b := c.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c.closed {
+		return nil, amqp.ErrClosed
+	}
+	ch := &channel{
+		conn:      c,
+		consumers: make(map[string]*consumer),
+		unacked:   make(map[uint64]delivered),
+		done:      make(chan struct{}),
+	}
+	c.channels = append(c.channels, ch)
+	return ch, nil
+}
+
+func (c *connection) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	c.notify = append(c.notify, receiver)
+	return receiver
+}
+
+func (c *connection) IsClosed() bool {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	return c.closed
+}
+
+func (c *connection) Close() error {
+	c.close(nil)
+	return nil
+}
+
+func (c *connection) close(reason *amqp.Error) {
+	b := c.broker
+	b.mu.Lock()
+	if c.closed {
+		b.mu.Unlock()
+		return
+	}
+	c.closed = true
+	delete(b.conns, c)
+	channels := append([]*channel(nil), c.channels...)
+	notify := c.notify
+	b.mu.Unlock()
+
+	for _, ch := range channels {
+		ch.close(reason)
+	}
+	signalClose(notify, reason)
+}
+
+func signalClose(receivers []chan *amqp.Error, reason *amqp.Error) {
+	for _, receiver := range receivers {
+		if reason != nil {
+			select {
+			case receiver <- reason:
+			default:
+			}
+		}
+		close(receiver)
+	}
+}
+
+type channel struct {
+	conn *connection
+
+	// all fields below are guarded by the broker's mutex
+	closed      bool
+	confirm     bool
+	publishSeq  uint64
+	deliveryTag uint64
+	prefetch    int
+	consumers   map[string]*consumer
+	unacked     map[uint64]delivered
+	confirms    []chan amqp.Confirmation
+	returns     []chan amqp.Return
+	notify      []chan *amqp.Error
+	done        chan struct{}
+
+	// notifyMu orders confirms and returns and keeps them from racing the
+	// close of their receivers
+	notifyMu sync.Mutex
+}
+
+type delivered struct {
+	queue   string
+	message message
+}
+
+type consumer struct {
+	cancelled bool
+}
+
+func (ch *channel) broker() *Broker {
+	return ch.conn.broker
+}
+
+// fail closes the channel with a channel error, as the broker does on
+// protocol violations. It is called with the broker's mutex held.
+func (ch *channel) fail(code int, reason string) error {
+	err := &amqp.Error{Code: code, Reason: reason, Server: true}
+	b := ch.broker()
+	b.errs = append(b.errs, err)
+	go ch.close(err)
+	return err
+}
+
+func (ch *channel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	b := ch.broker()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch.closed {
+		return amqp.Queue{}, amqp.ErrClosed
+	}
+	ttl := time.Duration(intArg(args["x-message-ttl"])) * time.Millisecond
+	if q, ok := b.queues[name]; ok {
+		if q.ttl != ttl {
+			return amqp.Queue{}, ch.fail(amqp.PreconditionFailed, fmt.Sprintf("PRECONDITION_FAILED - inequivalent arg 'x-message-ttl' for queue '%s'", name))
+		}
+		return amqp.Queue{Name: name, Messages: len(q.ready)}, nil
+	}
+
+	q := &queue{name: name, ttl: ttl}
+	q.dlx, _ = args["x-dead-letter-exchange"].(string)
+	q.dlk, _ = args["x-dead-letter-routing-key"].(string)
+	b.queues[name] = q
+	return amqp.Queue{Name: name}, nil
+}
+
+func intArg(value any) int64 {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	default:
+		return 0
+	}
+}
+
+func (ch *channel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	b := ch.broker()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	if _, ok := b.queues[name]; !ok {
+		return ch.fail(amqp.NotFound, fmt.Sprintf("NOT_FOUND - no queue '%s'", name))
+	}
+	for _, bound := range b.bindings[exchange] {
+		if bound.queue == name && bound.key == key {
+			return nil
+		}
+	}
+	b.bindings[exchange] = append(b.bindings[exchange], binding{queue: name, key: key})
+	return nil
+}
+
+func (ch *channel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	b := ch.broker()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	ch.prefetch = prefetchCount
+	return nil
+}
+
+func (ch *channel) Consume(name, tag string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	b := ch.broker()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch.closed {
+		return nil, amqp.ErrClosed
+	}
+	if _, ok := b.queues[name]; !ok {
+		return nil, ch.fail(amqp.NotFound, fmt.Sprintf("NOT_FOUND - no queue '%s'", name))
+	}
+	cons := &consumer{}
+	ch.consumers[tag] = cons
+
+	deliveries := make(chan amqp.Delivery)
+	go ch.deliver(name, tag, cons, deliveries)
+	return deliveries, nil
+}
+
+// deliver hands out the messages of queue one at a time while the channel
+// has fewer than prefetch unacked deliveries.
+func (ch *channel) deliver(name, tag string, cons *consumer, deliveries chan amqp.Delivery) {
+	defer close(deliveries)
+	b := ch.broker()
+
+	for {
+		b.mu.Lock()
+		for !ch.closed && !cons.cancelled && !ch.canDeliver(name) {
+			b.cond.Wait()
+		}
+		if ch.closed || cons.cancelled {
+			b.mu.Unlock()
+			return
+		}
+		d := ch.take(name, tag)
+		b.mu.Unlock()
+
+		select {
+		case deliveries <- d:
+		case <-ch.done:
+			// the delivery was requeued with the other unacked ones
+			return
+		}
+	}
+}
+
+func (ch *channel) canDeliver(name string) bool {
+	q := ch.broker().queues[name]
+	return len(q.ready) > 0 && (ch.prefetch <= 0 || len(ch.unacked) < ch.prefetch)
+}
+
+// take moves the head of queue to the channel's unacked deliveries.
+func (ch *channel) take(name, tag string) amqp.Delivery {
+	q := ch.broker().queues[name]
+	m := q.ready[0]
+	q.ready = q.ready[1:]
+
+	ch.deliveryTag++
+	ch.unacked[ch.deliveryTag] = delivered{queue: name, message: m}
+	return amqp.Delivery{
+		Acknowledger:    ch,
+		Headers:         m.msg.Headers,
+		ContentType:     m.msg.ContentType,
+		ContentEncoding: m.msg.ContentEncoding,
+		DeliveryMode:    m.msg.DeliveryMode,
+		Priority:        m.msg.Priority,
+		CorrelationId:   m.msg.CorrelationId,
+		ReplyTo:         m.msg.ReplyTo,
+		Expiration:      m.msg.Expiration,
+		MessageId:       m.msg.MessageId,
+		Timestamp:       m.msg.Timestamp,
+		Type:            m.msg.Type,
+		UserId:          m.msg.UserId,
+		AppId:           m.msg.AppId,
+		ConsumerTag:     tag,
+		MessageCount:    uint32(len(q.ready)),
+		DeliveryTag:     ch.deliveryTag,
+		Redelivered:     m.redelivered,
+		Exchange:        m.exchange,
+		RoutingKey:      m.key,
+		Body:            m.msg.Body,
+	}
+}
+
+func (ch *channel) Cancel(tag string, noWait bool) error {
+	b := ch.broker()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	if cons, ok := ch.consumers[tag]; ok {
+		cons.cancelled = true
+		delete(ch.consumers, tag)
+		b.cond.Broadcast()
+	}
+	return nil
+}
+
+func (ch *channel) Get(name string, autoAck bool) (amqp.Delivery, bool, error) {
+	b := ch.broker()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch.closed {
+		return amqp.Delivery{}, false, amqp.ErrClosed
+	}
+	q, ok := b.queues[name]
+	if !ok {
+		return amqp.Delivery{}, false, ch.fail(amqp.NotFound, fmt.Sprintf("NOT_FOUND - no queue '%s'", name))
+	}
+	if len(q.ready) == 0 {
+		return amqp.Delivery{}, false, nil
+	}
+	d := ch.take(name, "")
+	if autoAck {
+		delete(ch.unacked, d.DeliveryTag)
+	}
+	return d, true, nil
+}
+
+func (ch *channel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	b := ch.broker()
+	ch.notifyMu.Lock()
+	defer ch.notifyMu.Unlock()
+
+	b.mu.Lock()
+	if ch.closed {
+		b.mu.Unlock()
+		return amqp.ErrClosed
+	}
+	routed := b.route(exchange, key, msg)
+	var confirm *amqp.Confirmation
+	if ch.confirm {
+		ch.publishSeq++
+		if !b.hold {
+			confirm = &amqp.Confirmation{DeliveryTag: ch.publishSeq, Ack: !b.nack}
+		}
+	}
+	confirms, returns := ch.confirms, ch.returns
+	b.mu.Unlock()
+
+	if mandatory && !routed {
+		returned := amqp.Return{
+			ReplyCode:       amqp.NoRoute,
+			ReplyText:       "NO_ROUTE",
+			Exchange:        exchange,
+			RoutingKey:      key,
+			Headers:         msg.Headers,
+			ContentType:     msg.ContentType,
+			ContentEncoding: msg.ContentEncoding,
+			DeliveryMode:    msg.DeliveryMode,
+			Priority:        msg.Priority,
+			CorrelationId:   msg.CorrelationId,
+			ReplyTo:         msg.ReplyTo,
+			Expiration:      msg.Expiration,
+			MessageId:       msg.MessageId,
+			Timestamp:       msg.Timestamp,
+			Type:            msg.Type,
+			UserId:          msg.UserId,
+			AppId:           msg.AppId,
+			Body:            msg.Body,
+		}
+		for _, receiver := range returns {
+			receiver <- returned
+		}
+	}
+	if confirm != nil {
+		for _, receiver := range confirms {
+			receiver <- *confirm
+		}
+	}
+	return nil
+}
+
+func (ch *channel) Confirm(noWait bool) error {
+	b := ch.broker()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	ch.confirm = true
+	return nil
+}
+
+func (ch *channel) NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation {
+	b := ch.broker()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch.confirms = append(ch.confirms, confirm)
+	return confirm
+}
+
+func (ch *channel) NotifyReturn(returns chan amqp.Return) chan amqp.Return {
+	b := ch.broker()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch.returns = append(ch.returns, returns)
+	return returns
+}
+
+func (ch *channel) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	b := ch.broker()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch.notify = append(ch.notify, receiver)
+	return receiver
+}
+
+func (ch *channel) Close() error {
+	ch.close(nil)
+	return nil
+}
+
+// close requeues the channel's unacked deliveries, stops its consumers and
+// signals its listeners.
+func (ch *channel) close(reason *amqp.Error) {
+	b := ch.broker()
+	b.mu.Lock()
+	if ch.closed {
+		b.mu.Unlock()
+		return
+	}
+	ch.closed = true
+	close(ch.done)
+
+	tags := make([]uint64, 0, len(ch.unacked))
+	for tag := range ch.unacked {
+		tags = append(tags, tag)
+	}
+	// the oldest delivery ends up at the head of its queue
+	slices.Sort(tags)
+	for i := len(tags) - 1; i >= 0; i-- {
+		d := ch.unacked[tags[i]]
+		b.requeue(d.queue, d.message)
+	}
+	ch.unacked = make(map[uint64]delivered)
+	b.cond.Broadcast()
+
+	confirms, returns, notify := ch.confirms, ch.returns, ch.notify
+	b.mu.Unlock()
+
+	ch.notifyMu.Lock()
+	defer ch.notifyMu.Unlock()
+	for _, receiver := range confirms {
+		close(receiver)
+	}
+	for _, receiver := range returns {
+		close(receiver)
+	}
+	signalClose(notify, reason)
+}
+
+// Ack, Nack and Reject make the channel the amqp.Acknowledger of its
+// deliveries.
+
+func (ch *channel) Ack(tag uint64, multiple bool) error {
+	return ch.settle(tag, multiple, false, false)
+}
+
+func (ch *channel) Nack(tag uint64, multiple bool, requeue bool) error {
+	return ch.settle(tag, multiple, true, requeue)
+}
+
+func (ch *channel) Reject(tag uint64, requeue bool) error {
+	return ch.settle(tag, false, true, requeue)
+}
+
+func (ch *channel) settle(tag uint64, multiple, nack, requeue bool) error {
+	b := ch.broker()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	if _, ok := ch.unacked[tag]; !ok {
+		return ch.fail(amqp.PreconditionFailed, fmt.Sprintf("PRECONDITION_FAILED - unknown delivery tag %d", tag))
+	}
+
+	settled := []uint64{tag}
+	if multiple {
+		settled = settled[:0]
+		for unacked := range ch.unacked {
+			if unacked <= tag {
+				settled = append(settled, unacked)
+			}
+		}
+	}
+	for _, t := range settled {
+		d := ch.unacked[t]
+		delete(ch.unacked, t)
+		if nack && requeue {
+			b.requeue(d.queue, d.message)
+		}
+	}
+	b.cond.Broadcast()
+	return nil
+}
@@ -0,0 +1,60 @@
+package rabbit
+
+import (
+	"context"
+	"sms/pkg/tracing"
+
+	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// headerCarrier lets the propagator read and write traceparent in AMQP
+// headers.
+type headerCarrier amqp.Table
+
+func (h headerCarrier) Get(key string) string {
+	value, _ := h[key].(string)
+	return value
+}
+
+func (h headerCarrier) Set(key, value string) {
+	h[key] = value
+}
+
+func (h headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func startPublishSpan(ctx context.Context, exchange, routingKey string, headers amqp.Table) (context.Context, trace.Span) {
+	ctx, span := tracing.Tracer().Start(ctx, "publish "+routingKey,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemRabbitmq,
+			semconv.MessagingOperationTypePublish,
+			attribute.String("messaging.destination.name", exchange),
+			semconv.MessagingRabbitmqDestinationRoutingKey(routingKey),
+		),
+	)
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier(headers))
+	return ctx, span
+}
+
+func startProcessSpan(ctx context.Context, queueName string, msg amqp.Delivery) (context.Context, trace.Span) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, headerCarrier(msg.Headers))
+	return tracing.Tracer().Start(ctx, "process "+queueName,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemRabbitmq,
+			semconv.MessagingOperationTypeDeliver,
+			attribute.String("messaging.destination.name", queueName),
+			attribute.Int("messaging.rabbitmq.redelivery_count", RedeliveryCount(msg.Headers)),
+		),
+	)
+}
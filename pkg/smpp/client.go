@@ -0,0 +1,277 @@
+package smpp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrClosed          = errors.New("smpp: connection closed")
+	ErrResponseTimeout = errors.New("smpp: response timeout")
+)
+
+type Config struct {
+	Addr       string
+	SystemID   string
+	Password   string
+	SystemType string
+	// WindowSize caps how many submit_sm may await their response at once.
+	WindowSize int
+	// EnquireLinkInterval is how often enquire_link is sent to keep the bind
+	// alive; the connection is dropped when one goes unanswered.
+	EnquireLinkInterval time.Duration
+	ResponseTimeout     time.Duration
+	// OnDeliver receives every deliver_sm, such as delivery receipts. An
+	// error returned as a Status is sent back as is; any other error asks
+	// the SMSC to retry the delivery later.
+	OnDeliver func(msg ShortMessage) error
+}
+
+// Client is an ESME bound as transceiver over a single TCP connection. It is
+// safe for concurrent use; once the connection fails the client is done and a
+// new one must be dialed.
+type Client struct {
+	cfg    Config
+	conn   net.Conn
+	window chan struct{}
+	seq    atomic.Uint32
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[uint32]chan PDU
+
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// Dial connects to the SMSC and binds as transceiver.
+func Dial(ctx context.Context, cfg Config) (*Client, error) {
+	if cfg.WindowSize <= 0 {
+		cfg.WindowSize = 10
+	}
+	if cfg.ResponseTimeout <= 0 {
+		cfg.ResponseTimeout = 10 * time.Second
+	}
+	if cfg.EnquireLinkInterval <= 0 {
+		cfg.EnquireLinkInterval = 30 * time.Second
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		cfg:     cfg,
+		conn:    conn,
+		window:  make(chan struct{}, cfg.WindowSize),
+		pending: make(map[uint32]chan PDU),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop()
+
+	bind := Bind{SystemID: cfg.SystemID, Password: cfg.Password, SystemType: cfg.SystemType}
+	if _, err := c.request(ctx, CommandBindTransceiver, bind.Encode()); err != nil {
+		c.closeWith(err)
+		return nil, fmt.Errorf("smpp: bind_transceiver: %w", err)
+	}
+
+	go c.keepAlive()
+	return c, nil
+}
+
+// Submit sends one submit_sm and returns the message ID assigned by the SMSC.
+// It blocks while the window is full.
+func (c *Client) Submit(ctx context.Context, msg ShortMessage) (string, error) {
+	body, err := msg.Encode()
+	if err != nil {
+		return "", err
+	}
+
+	select {
+	case c.window <- struct{}{}:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-c.done:
+		return "", c.err
+	}
+	defer func() { <-c.window }()
+
+	resp, err := c.request(ctx, CommandSubmitSM, body)
+	if err != nil {
+		return "", err
+	}
+	return DecodeMessageID(resp.Body)
+}
+
+// Done is closed once the connection is gone.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection is gone, or nil while it is up.
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Close unbinds and closes the connection.
+func (c *Client) Close() error {
+	select {
+	case <-c.done:
+		return nil
+	default:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.ResponseTimeout)
+	defer cancel()
+	_, err := c.request(ctx, CommandUnbind, nil)
+	c.closeWith(ErrClosed)
+	return err
+}
+
+func (c *Client) request(ctx context.Context, id CommandID, body []byte) (PDU, error) {
+	seq := c.seq.Add(1)
+	respCh := make(chan PDU, 1)
+
+	c.mu.Lock()
+	c.pending[seq] = respCh
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, seq)
+		c.mu.Unlock()
+	}()
+
+	if err := c.write(PDU{CommandID: id, Sequence: seq, Body: body}); err != nil {
+		return PDU{}, err
+	}
+
+	timer := time.NewTimer(c.cfg.ResponseTimeout)
+	defer timer.Stop()
+
+	select {
+	case resp := <-respCh:
+		if resp.Status != StatusOK {
+			return resp, resp.Status
+		}
+		if resp.CommandID == CommandGenericNack {
+			return resp, StatusUnknownErr
+		}
+		return resp, nil
+	case <-timer.C:
+		return PDU{}, ErrResponseTimeout
+	case <-ctx.Done():
+		return PDU{}, ctx.Err()
+	case <-c.done:
+		return PDU{}, c.err
+	}
+}
+
+func (c *Client) write(p PDU) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	_ = c.conn.SetWriteDeadline(time.Now().Add(c.cfg.ResponseTimeout))
+	if err := WritePDU(c.conn, p); err != nil {
+		c.closeWith(err)
+		return err
+	}
+	return nil
+}
+
+func (c *Client) readLoop() {
+	for {
+		p, err := ReadPDU(c.conn)
+		if err != nil {
+			c.closeWith(err)
+			return
+		}
+
+		if p.CommandID.IsResponse() {
+			c.mu.Lock()
+			respCh, ok := c.pending[p.Sequence]
+			c.mu.Unlock()
+			if ok {
+				select {
+				case respCh <- p:
+				default: // duplicate response
+				}
+			}
+			continue
+		}
+
+		switch p.CommandID {
+		case CommandEnquireLink:
+			_ = c.write(PDU{CommandID: CommandEnquireLinkResp, Sequence: p.Sequence})
+		case CommandDeliverSM:
+			// handlers may be slow; keep reading responses meanwhile
+			go c.deliver(p)
+		case CommandUnbind:
+			_ = c.write(PDU{CommandID: CommandUnbindResp, Sequence: p.Sequence})
+			c.closeWith(ErrClosed)
+			return
+		default:
+			_ = c.write(PDU{CommandID: CommandGenericNack, Status: StatusInvCmdID, Sequence: p.Sequence})
+		}
+	}
+}
+
+func (c *Client) deliver(p PDU) {
+	resp := PDU{CommandID: CommandDeliverSMResp, Sequence: p.Sequence, Body: EncodeMessageID("")}
+
+	msg, err := DecodeShortMessage(p.Body)
+	if err == nil && c.cfg.OnDeliver != nil {
+		err = c.cfg.OnDeliver(msg)
+	}
+
+	var status Status
+	switch {
+	case err == nil:
+	case errors.As(err, &status):
+		resp.Status = status
+	case errors.Is(err, ErrMalformedPDU):
+		resp.Status = StatusXPAppn
+	default:
+		resp.Status = StatusXTAppn
+	}
+	_ = c.write(resp)
+}
+
+func (c *Client) keepAlive() {
+	ticker := time.NewTicker(c.cfg.EnquireLinkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := c.request(context.Background(), CommandEnquireLink, nil); err != nil {
+			c.closeWith(fmt.Errorf("smpp: enquire_link: %w", err))
+			return
+		}
+	}
+}
+
+func (c *Client) closeWith(err error) {
+	c.closeOnce.Do(func() {
+		c.err = err
+		close(c.done)
+		_ = c.conn.Close()
+	})
+}
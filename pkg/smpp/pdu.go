@@ -0,0 +1,307 @@
+package smpp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+type CommandID uint32
+
+const (
+	CommandGenericNack         CommandID = 0x80000000
+	CommandBindTransceiver     CommandID = 0x00000009
+	CommandBindTransceiverResp CommandID = 0x80000009
+	CommandSubmitSM            CommandID = 0x00000004
+	CommandSubmitSMResp        CommandID = 0x80000004
+	CommandDeliverSM           CommandID = 0x00000005
+	CommandDeliverSMResp       CommandID = 0x80000005
+	CommandUnbind              CommandID = 0x00000006
+	CommandUnbindResp          CommandID = 0x80000006
+	CommandEnquireLink         CommandID = 0x00000015
+	CommandEnquireLinkResp     CommandID = 0x80000015
+)
+
+// IsResponse reports whether the command answers a request of the peer.
+func (c CommandID) IsResponse() bool {
+	return c&0x80000000 != 0
+}
+
+// Status is the command_status of a PDU. Non-zero statuses are errors.
+type Status uint32
+
+const (
+	StatusOK         Status = 0x00000000
+	StatusInvMsgLen  Status = 0x00000001
+	StatusInvCmdID   Status = 0x00000003
+	StatusInvBnd     Status = 0x00000004
+	StatusAlyBnd     Status = 0x00000005
+	StatusSysErr     Status = 0x00000008
+	StatusInvDstAdr  Status = 0x0000000B
+	StatusBindFail   Status = 0x0000000D
+	StatusInvPaswd   Status = 0x0000000E
+	StatusInvSysID   Status = 0x0000000F
+	StatusMsgQFul    Status = 0x00000014
+	StatusSubmitFail Status = 0x00000045
+	StatusThrottled  Status = 0x00000058
+	StatusXTAppn     Status = 0x00000064
+	StatusXPAppn     Status = 0x00000065
+	StatusUnknownErr Status = 0x000000FF
+)
+
+const (
+	headerLen          = 16
+	maxPDULen          = 64 * 1024
+	interfaceVersion34 = 0x34
+)
+
+var statusNames = map[Status]string{
+	StatusInvMsgLen:  "ESME_RINVMSGLEN",
+	StatusInvCmdID:   "ESME_RINVCMDID",
+	StatusInvBnd:     "ESME_RINVBNDSTS",
+	StatusAlyBnd:     "ESME_RALYBND",
+	StatusSysErr:     "ESME_RSYSERR",
+	StatusInvDstAdr:  "ESME_RINVDSTADR",
+	StatusBindFail:   "ESME_RBINDFAIL",
+	StatusInvPaswd:   "ESME_RINVPASWD",
+	StatusInvSysID:   "ESME_RINVSYSID",
+	StatusMsgQFul:    "ESME_RMSGQFUL",
+	StatusSubmitFail: "ESME_RSUBMITFAIL",
+	StatusThrottled:  "ESME_RTHROTTLED",
+	StatusXTAppn:     "ESME_RX_T_APPN",
+	StatusXPAppn:     "ESME_RX_P_APPN",
+	StatusUnknownErr: "ESME_RUNKNOWNERR",
+}
+
+func (s Status) Error() string {
+	if name, ok := statusNames[s]; ok {
+		return fmt.Sprintf("smpp: %s (0x%08X)", name, uint32(s))
+	}
+	return fmt.Sprintf("smpp: command status 0x%08X", uint32(s))
+}
+
+// Temporary reports whether the SMSC may accept the same PDU later.
+func (s Status) Temporary() bool {
+	return s == StatusMsgQFul || s == StatusThrottled || s == StatusSysErr || s == StatusXTAppn
+}
+
+var ErrMalformedPDU = errors.New("smpp: malformed pdu")
+
+// PDU is a decoded header plus the raw body of one SMPP packet.
+type PDU struct {
+	CommandID CommandID
+	Status    Status
+	Sequence  uint32
+	Body      []byte
+}
+
+func ReadPDU(r io.Reader) (PDU, error) {
+	var header [headerLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return PDU{}, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length < headerLen || length > maxPDULen {
+		return PDU{}, fmt.Errorf("%w: command_length %d", ErrMalformedPDU, length)
+	}
+
+	p := PDU{
+		CommandID: CommandID(binary.BigEndian.Uint32(header[4:8])),
+		Status:    Status(binary.BigEndian.Uint32(header[8:12])),
+		Sequence:  binary.BigEndian.Uint32(header[12:16]),
+		Body:      make([]byte, length-headerLen),
+	}
+	if _, err := io.ReadFull(r, p.Body); err != nil {
+		return PDU{}, err
+	}
+	return p, nil
+}
+
+func WritePDU(w io.Writer, p PDU) error {
+	buf := make([]byte, headerLen, headerLen+len(p.Body))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(headerLen+len(p.Body)))
+	binary.BigEndian.PutUint32(buf[4:8], uint32(p.CommandID))
+	binary.BigEndian.PutUint32(buf[8:12], uint32(p.Status))
+	binary.BigEndian.PutUint32(buf[12:16], p.Sequence)
+	buf = append(buf, p.Body...)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// Bind is the body of bind_transceiver.
+type Bind struct {
+	SystemID   string
+	Password   string
+	SystemType string
+}
+
+func (b Bind) Encode() []byte {
+	var buf bytes.Buffer
+	writeCString(&buf, b.SystemID)
+	writeCString(&buf, b.Password)
+	writeCString(&buf, b.SystemType)
+	buf.WriteByte(interfaceVersion34)
+	buf.WriteByte(0) // addr_ton
+	buf.WriteByte(0) // addr_npi
+	writeCString(&buf, "")
+	return buf.Bytes()
+}
+
+func DecodeBind(body []byte) (Bind, error) {
+	d := decoder{buf: body}
+	b := Bind{
+		SystemID:   d.cString(),
+		Password:   d.cString(),
+		SystemType: d.cString(),
+	}
+	return b, d.err
+}
+
+// Type of number and numbering plan indicator values used for addresses.
+const (
+	TONUnknown       byte = 0x00
+	TONInternational byte = 0x01
+	TONAlphanumeric  byte = 0x05
+	NPIUnknown       byte = 0x00
+	NPIISDN          byte = 0x01
+)
+
+// ESM class and data coding values used when submitting messages.
+const (
+	ESMClassUDHI      byte = 0x40
+	DataCodingDefault byte = 0x00
+	DataCodingUCS2    byte = 0x08
+)
+
+const maxShortMessageLen = 254
+
+// ShortMessage is the body shared by submit_sm and deliver_sm.
+type ShortMessage struct {
+	ServiceType        string
+	SourceAddrTON      byte
+	SourceAddrNPI      byte
+	SourceAddr         string
+	DestAddrTON        byte
+	DestAddrNPI        byte
+	DestAddr           string
+	ESMClass           byte
+	ProtocolID         byte
+	PriorityFlag       byte
+	RegisteredDelivery byte
+	DataCoding         byte
+	ShortMessage       []byte
+}
+
+func (m ShortMessage) Encode() ([]byte, error) {
+	if len(m.ShortMessage) > maxShortMessageLen {
+		return nil, fmt.Errorf("smpp: short_message is %d octets, limit is %d", len(m.ShortMessage), maxShortMessageLen)
+	}
+
+	var buf bytes.Buffer
+	writeCString(&buf, m.ServiceType)
+	buf.WriteByte(m.SourceAddrTON)
+	buf.WriteByte(m.SourceAddrNPI)
+	writeCString(&buf, m.SourceAddr)
+	buf.WriteByte(m.DestAddrTON)
+	buf.WriteByte(m.DestAddrNPI)
+	writeCString(&buf, m.DestAddr)
+	buf.WriteByte(m.ESMClass)
+	buf.WriteByte(m.ProtocolID)
+	buf.WriteByte(m.PriorityFlag)
+	writeCString(&buf, "") // schedule_delivery_time
+	writeCString(&buf, "") // validity_period
+	buf.WriteByte(m.RegisteredDelivery)
+	buf.WriteByte(0) // replace_if_present_flag
+	buf.WriteByte(m.DataCoding)
+	buf.WriteByte(0) // sm_default_msg_id
+	buf.WriteByte(byte(len(m.ShortMessage)))
+	buf.Write(m.ShortMessage)
+	return buf.Bytes(), nil
+}
+
+func DecodeShortMessage(body []byte) (ShortMessage, error) {
+	d := decoder{buf: body}
+	m := ShortMessage{
+		ServiceType:   d.cString(),
+		SourceAddrTON: d.byte(),
+		SourceAddrNPI: d.byte(),
+		SourceAddr:    d.cString(),
+		DestAddrTON:   d.byte(),
+		DestAddrNPI:   d.byte(),
+		DestAddr:      d.cString(),
+		ESMClass:      d.byte(),
+		ProtocolID:    d.byte(),
+		PriorityFlag:  d.byte(),
+	}
+	d.cString() // schedule_delivery_time
+	d.cString() // validity_period
+	m.RegisteredDelivery = d.byte()
+	d.byte() // replace_if_present_flag
+	m.DataCoding = d.byte()
+	d.byte() // sm_default_msg_id
+	m.ShortMessage = d.bytes(int(d.byte()))
+	return m, d.err
+}
+
+// EncodeMessageID is the body of submit_sm_resp and deliver_sm_resp.
+func EncodeMessageID(messageID string) []byte {
+	var buf bytes.Buffer
+	writeCString(&buf, messageID)
+	return buf.Bytes()
+}
+
+func DecodeMessageID(body []byte) (string, error) {
+	d := decoder{buf: body}
+	id := d.cString()
+	return id, d.err
+}
+
+func writeCString(buf *bytes.Buffer, s string) {
+	buf.WriteString(s)
+	buf.WriteByte(0)
+}
+
+// decoder reads PDU body fields and keeps the first error it hits.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) cString() string {
+	if d.err != nil {
+		return ""
+	}
+	end := bytes.IndexByte(d.buf, 0)
+	if end < 0 {
+		d.err = fmt.Errorf("%w: unterminated c-octet string", ErrMalformedPDU)
+		return ""
+	}
+	s := string(d.buf[:end])
+	d.buf = d.buf[end+1:]
+	return s
+}
+
+func (d *decoder) byte() byte {
+	b := d.bytes(1)
+	if len(b) == 0 {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.buf) < n {
+		d.err = fmt.Errorf("%w: body too short", ErrMalformedPDU)
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
@@ -0,0 +1,66 @@
+package smpp
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// ESMClassDeliveryReceipt marks a deliver_sm that carries a delivery receipt.
+const ESMClassDeliveryReceipt byte = 0x04
+
+var ErrMalformedReceipt = errors.New("smpp: malformed delivery receipt")
+
+// Receipt is the content of a delivery receipt.
+type Receipt struct {
+	MessageID string
+	// Stat is the final message state, e.g. DELIVRD, UNDELIV or EXPIRED.
+	Stat     string
+	Err      string
+	DoneDate time.Time
+}
+
+// ParseReceipt reads the receipt text format of SMPP 3.4 Appendix B:
+//
+//	id:IIIIIIIIII sub:SSS dlvrd:DDD submit date:YYMMDDhhmm done date:YYMMDDhhmm stat:DDDDDDD err:E text:...
+func ParseReceipt(text string) (Receipt, error) {
+	// the free text at the end may contain anything, including field names
+	if i := strings.Index(text, " text:"); i >= 0 {
+		text = text[:i]
+	}
+
+	receipt := Receipt{
+		MessageID: receiptField(text, "id:"),
+		Stat:      receiptField(text, "stat:"),
+		Err:       receiptField(text, "err:"),
+	}
+	if receipt.MessageID == "" || receipt.Stat == "" {
+		return receipt, ErrMalformedReceipt
+	}
+
+	doneDate := receiptField(text, "done date:")
+	for _, layout := range []string{"0601021504", "060102150405"} {
+		if len(doneDate) == len(layout) {
+			receipt.DoneDate, _ = time.Parse(layout, doneDate)
+		}
+	}
+	return receipt, nil
+}
+
+func receiptField(text, key string) string {
+	for offset := 0; ; {
+		i := strings.Index(text[offset:], key)
+		if i < 0 {
+			return ""
+		}
+		i += offset
+		if i == 0 || text[i-1] == ' ' {
+			value := text[i+len(key):]
+			if end := strings.IndexByte(value, ' '); end >= 0 {
+				value = value[:end]
+			}
+			return value
+		}
+		offset = i + 1
+	}
+}
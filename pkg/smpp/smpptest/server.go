@@ -0,0 +1,332 @@
+// Package smpptest provides an in-process SMSC for testing SMPP clients.
+package smpptest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sms/pkg/smpp"
+	"sync"
+	"time"
+)
+
+// Server is a fake SMSC accepting transceiver binds on a loopback port. It
+// answers submit_sm with generated message IDs, records what it received and
+// can push deliver_sm such as delivery receipts to bound clients.
+type Server struct {
+	listener net.Listener
+	systemID string
+	password string
+
+	mu             sync.Mutex
+	conns          map[net.Conn]*session
+	responses      map[uint32]chan smpp.PDU
+	sequence       uint32
+	submitted      []smpp.ShortMessage
+	binds          int
+	enquireLinks   int
+	inFlight       int
+	maxInFlight    int
+	submitStatus   smpp.Status
+	acceptBefore   int
+	responseDelay  time.Duration
+	silentEnquires bool
+	nextID         int
+
+	wg sync.WaitGroup
+}
+
+// NewServer starts a fake SMSC accepting the given credentials. It panics if
+// it cannot listen, like httptest.NewServer.
+func NewServer(systemID, password string) *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("smpptest: failed to listen: %v", err))
+	}
+
+	s := &Server{
+		listener:  listener,
+		systemID:  systemID,
+		password:  password,
+		conns:     make(map[net.Conn]*session),
+		responses: make(map[uint32]chan smpp.PDU),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// SetSubmitStatus makes every following submit_sm fail with status.
+func (s *Server) SetSubmitStatus(status smpp.Status) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.submitStatus = status
+	s.acceptBefore = 0
+}
+
+// FailSubmitsAfter accepts the next n submit_sm and fails every following
+// one with status.
+func (s *Server) FailSubmitsAfter(n int, status smpp.Status) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.submitStatus = status
+	s.acceptBefore = n
+}
+
+// SetResponseDelay delays every following submit_sm_resp.
+func (s *Server) SetResponseDelay(delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responseDelay = delay
+}
+
+// SetSilentEnquireLinks stops the server from answering enquire_link.
+func (s *Server) SetSilentEnquireLinks(silent bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.silentEnquires = silent
+}
+
+func (s *Server) Submitted() []smpp.ShortMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smpp.ShortMessage(nil), s.submitted...)
+}
+
+func (s *Server) Binds() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.binds
+}
+
+func (s *Server) EnquireLinks() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enquireLinks
+}
+
+// MaxInFlight is the largest number of submit_sm awaiting a response at once.
+func (s *Server) MaxInFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxInFlight
+}
+
+// DropConnections closes every open client connection without unbinding.
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+}
+
+func (s *Server) Close() {
+	_ = s.listener.Close()
+	s.DropConnections()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		sess := &session{conn: conn}
+		s.mu.Lock()
+		s.conns[conn] = sess
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(sess)
+	}
+}
+
+// session is one client connection.
+type session struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+	bound   bool
+}
+
+func (sess *session) write(p smpp.PDU) {
+	sess.writeMu.Lock()
+	defer sess.writeMu.Unlock()
+	_ = smpp.WritePDU(sess.conn, p)
+}
+
+// Deliver sends a deliver_sm to a bound client and returns the status of
+// its deliver_sm_resp.
+func (s *Server) Deliver(msg smpp.ShortMessage) (smpp.Status, error) {
+	body, err := msg.Encode()
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	var target *session
+	for _, sess := range s.conns {
+		if sess.bound {
+			target = sess
+			break
+		}
+	}
+	s.sequence++
+	seq := s.sequence
+	respCh := make(chan smpp.PDU, 1)
+	s.responses[seq] = respCh
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.responses, seq)
+		s.mu.Unlock()
+	}()
+
+	if target == nil {
+		return 0, errors.New("smpptest: no bound client")
+	}
+	target.write(smpp.PDU{CommandID: smpp.CommandDeliverSM, Sequence: seq, Body: body})
+
+	select {
+	case resp := <-respCh:
+		return resp.Status, nil
+	case <-time.After(5 * time.Second):
+		return 0, errors.New("smpptest: no deliver_sm_resp")
+	}
+}
+
+// DeliverReceipt sends a delivery receipt for messageID with the given final
+// state (e.g. DELIVRD) and error code.
+func (s *Server) DeliverReceipt(messageID, stat, errCode string) (smpp.Status, error) {
+	date := time.Now().UTC().Format("0601021504")
+	text := fmt.Sprintf("id:%s sub:001 dlvrd:001 submit date:%s done date:%s stat:%s err:%s text:", messageID, date, date, stat, errCode)
+	return s.Deliver(smpp.ShortMessage{
+		ESMClass:     smpp.ESMClassDeliveryReceipt,
+		ShortMessage: []byte(text),
+	})
+}
+
+func (s *Server) handle(sess *session) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, sess.conn)
+		s.mu.Unlock()
+		_ = sess.conn.Close()
+	}()
+
+	var handlers sync.WaitGroup
+	defer handlers.Wait()
+
+	conn, write := sess.conn, sess.write
+	for {
+		p, err := smpp.ReadPDU(conn)
+		if err != nil {
+			return
+		}
+
+		switch p.CommandID {
+		case smpp.CommandBindTransceiver:
+			resp := smpp.PDU{CommandID: smpp.CommandBindTransceiverResp, Sequence: p.Sequence, Body: smpp.EncodeMessageID("smpptest")}
+			bind, err := smpp.DecodeBind(p.Body)
+			switch {
+			case err != nil:
+				resp.Status = smpp.StatusInvMsgLen
+			case bind.SystemID != s.systemID:
+				resp.Status = smpp.StatusInvSysID
+			case bind.Password != s.password:
+				resp.Status = smpp.StatusInvPaswd
+			default:
+				s.mu.Lock()
+				sess.bound = true
+				s.binds++
+				s.mu.Unlock()
+			}
+			write(resp)
+
+		case smpp.CommandSubmitSM:
+			s.mu.Lock()
+			bound := sess.bound
+			s.mu.Unlock()
+			if !bound {
+				write(smpp.PDU{CommandID: smpp.CommandSubmitSMResp, Status: smpp.StatusInvBnd, Sequence: p.Sequence})
+				continue
+			}
+			handlers.Add(1)
+			go func(p smpp.PDU) {
+				defer handlers.Done()
+				write(s.submit(p))
+			}(p)
+
+		case smpp.CommandEnquireLink:
+			s.mu.Lock()
+			s.enquireLinks++
+			silent := s.silentEnquires
+			s.mu.Unlock()
+			if !silent {
+				write(smpp.PDU{CommandID: smpp.CommandEnquireLinkResp, Sequence: p.Sequence})
+			}
+
+		case smpp.CommandUnbind:
+			write(smpp.PDU{CommandID: smpp.CommandUnbindResp, Sequence: p.Sequence})
+			return
+
+		case smpp.CommandDeliverSMResp:
+			s.mu.Lock()
+			respCh, ok := s.responses[p.Sequence]
+			s.mu.Unlock()
+			if ok {
+				select {
+				case respCh <- p:
+				default:
+				}
+			}
+
+		default:
+			if !p.CommandID.IsResponse() {
+				write(smpp.PDU{CommandID: smpp.CommandGenericNack, Status: smpp.StatusInvCmdID, Sequence: p.Sequence})
+			}
+		}
+	}
+}
+
+func (s *Server) submit(p smpp.PDU) smpp.PDU {
+	resp := smpp.PDU{CommandID: smpp.CommandSubmitSMResp, Sequence: p.Sequence}
+
+	msg, err := smpp.DecodeShortMessage(p.Body)
+	if err != nil {
+		resp.Status = smpp.StatusInvMsgLen
+		return resp
+	}
+
+	s.mu.Lock()
+	s.inFlight++
+	s.maxInFlight = max(s.maxInFlight, s.inFlight)
+	delay := s.responseDelay
+	s.mu.Unlock()
+
+	time.Sleep(delay)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+
+	if s.submitStatus != smpp.StatusOK && s.acceptBefore == 0 {
+		resp.Status = s.submitStatus
+		return resp
+	}
+	s.acceptBefore = max(s.acceptBefore-1, 0)
+
+	s.nextID++
+	s.submitted = append(s.submitted, msg)
+	resp.Body = smpp.EncodeMessageID(fmt.Sprintf("smsc-%d", s.nextID))
+	return resp
+}
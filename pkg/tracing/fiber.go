@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware starts a server span per request, continuing the trace of a
+// caller that sent traceparent, and passes it on in the user context.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), requestCarrier{c})
+		ctx, span := Tracer().Start(ctx, c.Method()+" "+c.Path(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Method()),
+				semconv.URLPath(c.Path()),
+			),
+		)
+		defer span.End()
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+
+		// the route is only known once the request was matched
+		route := c.Route().Path
+		span.SetName(c.Method() + " " + route)
+
+		status := c.Response().StatusCode()
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			status = fiberErr.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+		span.SetAttributes(semconv.HTTPRoute(route), semconv.HTTPResponseStatusCode(status))
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", status))
+		}
+		RecordError(span, err)
+		return err
+	}
+}
+
+// requestCarrier reads propagation headers from a request.
+type requestCarrier struct {
+	c *fiber.Ctx
+}
+
+func (r requestCarrier) Get(key string) string {
+	return r.c.Get(key)
+}
+
+func (r requestCarrier) Set(key, value string) {
+	r.c.Request().Header.Set(key, value)
+}
+
+func (r requestCarrier) Keys() []string {
+	var keys []string
+	r.c.Request().Header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
@@ -0,0 +1,87 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const (
+	gormSpanKey   = "tracing:span"
+	gormParentKey = "tracing:parent"
+)
+
+// GormPlugin wraps every gorm operation in a client span carrying the SQL
+// statement. Register it with db.Use.
+type GormPlugin struct{}
+
+func (GormPlugin) Name() string {
+	return "tracing"
+}
+
+func (GormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("tracing:before_create", startGormSpan("create")),
+		cb.Create().After("gorm:create").Register("tracing:after_create", endGormSpan),
+		cb.Query().Before("gorm:query").Register("tracing:before_query", startGormSpan("query")),
+		cb.Query().After("gorm:query").Register("tracing:after_query", endGormSpan),
+		cb.Update().Before("gorm:update").Register("tracing:before_update", startGormSpan("update")),
+		cb.Update().After("gorm:update").Register("tracing:after_update", endGormSpan),
+		cb.Delete().Before("gorm:delete").Register("tracing:before_delete", startGormSpan("delete")),
+		cb.Delete().After("gorm:delete").Register("tracing:after_delete", endGormSpan),
+		cb.Row().Before("gorm:row").Register("tracing:before_row", startGormSpan("row")),
+		cb.Row().After("gorm:row").Register("tracing:after_row", endGormSpan),
+		cb.Raw().Before("gorm:raw").Register("tracing:before_raw", startGormSpan("raw")),
+		cb.Raw().After("gorm:raw").Register("tracing:after_raw", endGormSpan),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startGormSpan(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		parent := db.Statement.Context
+		if parent == nil {
+			parent = context.Background()
+		}
+		ctx, span := Tracer().Start(parent, "gorm."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemPostgreSQL, attribute.String("db.operation", operation)),
+		)
+		db.Statement.Context = ctx
+		db.InstanceSet(gormSpanKey, span)
+		db.InstanceSet(gormParentKey, parent)
+	}
+}
+
+func endGormSpan(db *gorm.DB) {
+	value, ok := db.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	defer span.End()
+
+	if parent, ok := db.InstanceGet(gormParentKey); ok {
+		db.Statement.Context = parent.(context.Context)
+	}
+
+	if table := db.Statement.Table; table != "" {
+		span.SetAttributes(attribute.String("db.sql.table", table))
+	}
+	span.SetAttributes(
+		attribute.String("db.statement", db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.RowsAffected),
+	)
+	if !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		RecordError(span, db.Error)
+	}
+}
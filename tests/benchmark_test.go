@@ -20,8 +20,8 @@ func BenchmarkSMSMessage_MarkAsSent(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		message.Status = sms.SMSStatusPending
-		message.MarkAsSent(provider)
+		message.Status = sms.SMSStatusSending
+		message.MarkAsSent(provider, "provider-msg-1")
 	}
 }
 
@@ -161,9 +161,9 @@ func BenchmarkSMSMessage_MarkAsSent_Parallel(b *testing.B) {
 				UserID:   "user-123",
 				Content:  "Test message",
 				Receiver: "+1234567890",
-				Status:   sms.SMSStatusPending,
+				Status:   sms.SMSStatusSending,
 			}
-			message.MarkAsSent(provider)
+			message.MarkAsSent(provider, "provider-msg-1")
 		}
 	})
 }
@@ -0,0 +1,255 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sms/config"
+	"sms/internal/api/dto"
+	handlers "sms/internal/api/handlers/http"
+	"sms/internal/domain/sms"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type mockBatchRepo struct {
+	batches map[string]*sms.SMSBatch
+	smsRepo *mockSMSRepo
+}
+
+func newMockBatchRepo(smsRepo *mockSMSRepo) *mockBatchRepo {
+	return &mockBatchRepo{
+		batches: make(map[string]*sms.SMSBatch),
+		smsRepo: smsRepo,
+	}
+}
+
+func (m *mockBatchRepo) Create(ctx context.Context, batch *sms.SMSBatch) error {
+	m.batches[batch.ID] = batch
+	return nil
+}
+
+func (m *mockBatchRepo) Get(ctx context.Context, ID string) (*sms.SMSBatch, error) {
+	batch, ok := m.batches[ID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return batch, nil
+}
+
+func (m *mockBatchRepo) StatusCounts(ctx context.Context, batchID string) (map[sms.SMSStatus]int64, error) {
+	counts := make(map[sms.SMSStatus]int64)
+	for _, msg := range m.smsRepo.messages {
+		if msg.BatchID == batchID {
+			counts[msg.Status]++
+		}
+	}
+	return counts, nil
+}
+
+func (m *mockBatchRepo) WithTx(tx *gorm.DB) sms.BatchRepo {
+	return m
+}
+
+func newBulkMessages(userID string, receivers ...string) []*sms.SMSMessage {
+	messages := make([]*sms.SMSMessage, 0, len(receivers))
+	for i, receiver := range receivers {
+		messages = append(messages, &sms.SMSMessage{
+			ID:        "00000000-0000-0000-0000-00000000000" + string(rune('1'+i)),
+			UserID:    userID,
+			Content:   "Hello",
+			Receiver:  receiver,
+			Status:    sms.SMSStatusPending,
+			CreatedAt: time.Now(),
+		})
+	}
+	return messages
+}
+
+func TestSMSHandler_SendBulkSMS(t *testing.T) {
+	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
+	batches := newMockBatchRepo(repo)
+	service := newTestService(repo, outbox, newMockEventPublisher(), newMockSMSProvider()).
+		WithBatches(batches, sms.BulkPolicy{BillingMode: sms.BillingPerBatch, InsertBatchSize: 2})
+	handler := handlers.NewSMSHandler(service)
+	app := fiber.New()
+	app.Post("/api/v1/sms/bulk", handler.SendBulkSMS)
+	app.Get("/api/v1/sms/bulk/:id", handler.GetBatchProgress)
+
+	body := `{"user_id":"550e8400-e29b-41d4-a716-446655440000","content":"Hello","recipients":[
+		{"receiver":"09123456789"},
+		{"receiver":"+989351234567"},
+		{"receiver":"+989221234567","content":"Hello again"}]}`
+	resp, _ := postJSON(t, app, "/api/v1/sms/bulk", body)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", resp.StatusCode)
+	}
+	var sent dto.BulkSendResponse
+	if err := json.NewDecoder(resp.Body).Decode(&sent); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if sent.Total != 3 || sent.Amount != 3 || sent.BillingMode != "batch" {
+		t.Errorf("Expected 3 SMS billed 3 per batch, got %+v", sent)
+	}
+
+	if len(repo.messages) != 3 {
+		t.Fatalf("Expected 3 SMS stored, got %d", len(repo.messages))
+	}
+	contents := make(map[string]string)
+	for _, msg := range repo.messages {
+		if msg.BatchID != sent.BatchID || msg.Status != sms.SMSStatusBillingRequested {
+			t.Errorf("Expected SMS of batch %s awaiting billing, got %+v", sent.BatchID, msg)
+		}
+		contents[msg.Receiver] = msg.Content
+	}
+	if contents["+989123456789"] != "Hello" || contents["+989221234567"] != "Hello again" {
+		t.Errorf("Expected shared and per-recipient content, got %v", contents)
+	}
+
+	if len(outbox.messages) != 1 || outbox.messages[0].EventType != sms.EventTypeBatchBillingRequested {
+		t.Fatalf("Expected one batch billing request, got %d events", len(outbox.messages))
+	}
+	var billing sms.RequestBatchBilling
+	if err := json.Unmarshal(outbox.messages[0].Payload, &billing); err != nil {
+		t.Fatalf("Failed to decode billing request: %v", err)
+	}
+	if billing.BatchID != sent.BatchID || billing.Count != 3 || billing.Amount != 3 {
+		t.Errorf("Expected a debit of 3 for 3 SMS, got %+v", billing)
+	}
+
+	progressResp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/v1/sms/bulk/"+sent.BatchID, nil))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var progress dto.BatchProgressResponse
+	if err := json.NewDecoder(progressResp.Body).Decode(&progress); err != nil {
+		t.Fatalf("Failed to decode progress: %v", err)
+	}
+	if progress.Statuses["billing_requested"] != 3 || progress.Processed != 0 || progress.Done {
+		t.Errorf("Expected 3 SMS awaiting billing, got %+v", progress)
+	}
+
+	resp, errResp := postJSON(t, app, "/api/v1/sms/bulk", `{"user_id":"550e8400-e29b-41d4-a716-446655440000","recipients":[{"receiver":"+989123456789","content":"hi"},{"receiver":"+989123456789"}]}`)
+	if resp.StatusCode != http.StatusUnprocessableEntity || len(errResp.Fields) != 1 || errResp.Fields[0].Field != "recipients[1].content" {
+		t.Errorf("Expected 422 for a recipient without content, got %d %+v", resp.StatusCode, errResp)
+	}
+
+	notFound, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/v1/sms/bulk/6ba7b810-9dad-11d1-80b4-00c04fd430c8", nil))
+	if err != nil || notFound.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown batch, got %v %v", notFound.StatusCode, err)
+	}
+}
+
+func TestSMSService_CreateAndBillBatch_PerMessage(t *testing.T) {
+	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
+	service := newTestService(repo, outbox, newMockEventPublisher(), newMockSMSProvider()).
+		WithBatches(newMockBatchRepo(repo), sms.BulkPolicy{BillingMode: sms.BillingPerMessage, InsertBatchSize: 500})
+
+	batch := &sms.SMSBatch{ID: "6ba7b810-9dad-11d1-80b4-00c04fd430c8", UserID: listUserA}
+	if err := service.CreateAndBillBatch(context.Background(), batch, newBulkMessages(listUserA, "+989123456789", "+989351234567")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(outbox.messages) != 2 {
+		t.Fatalf("Expected a billing request per SMS, got %d", len(outbox.messages))
+	}
+	for _, msg := range outbox.messages {
+		if msg.EventType != sms.EventTypeBillingRequested {
+			t.Errorf("Expected %s, got %s", sms.EventTypeBillingRequested, msg.EventType)
+		}
+	}
+}
+
+func TestSMSService_CreateAndBillBatch_RejectsWholeBatch(t *testing.T) {
+	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
+	batches := newMockBatchRepo(repo)
+	service := newTestService(repo, outbox, newMockEventPublisher(), newMockSMSProvider()).
+		WithBatches(batches, sms.BulkPolicy{BillingMode: sms.BillingPerBatch, InsertBatchSize: 500})
+
+	messages := newBulkMessages(listUserA, "+989123456789", "+989351234567")
+	messages[1].Content = strings.Repeat("a", 2000)
+	err := service.CreateAndBillBatch(context.Background(), &sms.SMSBatch{ID: "6ba7b810-9dad-11d1-80b4-00c04fd430c8", UserID: listUserA}, messages)
+	if !errors.Is(err, sms.ErrContentTooLong) || !strings.HasPrefix(err.Error(), "recipient 1:") {
+		t.Fatalf("Expected recipient 1 to be too long, got %v", err)
+	}
+	if len(repo.messages) != 0 || len(batches.batches) != 0 || len(outbox.messages) != 0 {
+		t.Errorf("Expected nothing stored, got %d SMS, %d batches and %d events", len(repo.messages), len(batches.batches), len(outbox.messages))
+	}
+}
+
+func TestSMSService_ProcessDebitedBatch(t *testing.T) {
+	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
+	provider := newMockSMSProvider()
+	service := newTestService(repo, outbox, newMockEventPublisher(), provider).
+		WithBatches(newMockBatchRepo(repo), sms.BulkPolicy{BillingMode: sms.BillingPerBatch, InsertBatchSize: 500})
+	ctx := context.Background()
+
+	batch := &sms.SMSBatch{ID: "6ba7b810-9dad-11d1-80b4-00c04fd430c8", UserID: listUserA}
+	if err := service.CreateAndBillBatch(ctx, batch, newBulkMessages(listUserA, "+989123456789", "+989351234567", "+989221234567")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	outbox.messages = nil
+
+	debited := sms.BatchBillingCompleted{UserID: listUserA, BatchID: batch.ID, Amount: 3, TransactionID: "txn-batch"}
+	for range 2 {
+		// the redelivery is a no-op
+		if err := service.ProcessDebitedBatch(ctx, debited); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if len(outbox.messages) != 3 {
+		t.Fatalf("Expected a dispatch request per SMS, got %d", len(outbox.messages))
+	}
+	if provider.calls != 0 {
+		t.Errorf("Expected no SMS sent before dispatch, got %d", provider.calls)
+	}
+
+	for _, msg := range outbox.messages {
+		event, err := sms.DecodeEvent(msg.EventType, msg.Payload)
+		if err != nil {
+			t.Fatalf("Failed to decode dispatch request: %v", err)
+		}
+		if err := service.DispatchBatchSMS(ctx, event.(sms.SMSDispatchRequested)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if provider.calls != 3 {
+		t.Errorf("Expected 3 SMS sent, got %d", provider.calls)
+	}
+
+	progress, err := service.GetBatchProgress(ctx, batch.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if progress.Counts[sms.SMSStatusSent] != 3 || !progress.Done() {
+		t.Errorf("Expected every SMS sent, got %v", progress.Counts)
+	}
+}
+
+func TestReadConfig_BulkDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("bulk:\n  insert_batch_size: 100\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.ReadConfig(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// batch debits need a billing service that implements them
+	if mode := sms.BillingMode(cfg.Bulk.BillingMode); mode != sms.BillingPerMessage {
+		t.Errorf("Expected per-message billing by default, got %q", mode)
+	}
+}
@@ -0,0 +1,373 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sms/internal/api/dto"
+	handlers "sms/internal/api/handlers/http"
+	"sms/internal/domain/sms"
+	smsService "sms/internal/usecase/sms"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type mockCampaignRepo struct {
+	campaigns  map[string]*sms.Campaign
+	recipients []*sms.CampaignRecipient
+	smsRepo    *mockSMSRepo
+}
+
+func newMockCampaignRepo(smsRepo *mockSMSRepo) *mockCampaignRepo {
+	return &mockCampaignRepo{
+		campaigns: make(map[string]*sms.Campaign),
+		smsRepo:   smsRepo,
+	}
+}
+
+func (m *mockCampaignRepo) Create(ctx context.Context, campaign *sms.Campaign) error {
+	stored := *campaign
+	m.campaigns[campaign.ID] = &stored
+	return nil
+}
+
+func (m *mockCampaignRepo) Get(ctx context.Context, ID string) (*sms.Campaign, error) {
+	campaign, ok := m.campaigns[ID]
+	if !ok {
+		return nil, sms.ErrCampaignNotFound
+	}
+	// callers change their copy until they Update it
+	copied := *campaign
+	return &copied, nil
+}
+
+func (m *mockCampaignRepo) Lock(ctx context.Context, ID string) (*sms.Campaign, error) {
+	return m.Get(ctx, ID)
+}
+
+func (m *mockCampaignRepo) ClaimNext(ctx context.Context, status sms.CampaignStatus, dueBy time.Time) (*sms.Campaign, error) {
+	var next *sms.Campaign
+	for _, campaign := range m.campaigns {
+		switch {
+		case campaign.Status != status,
+			!dueBy.IsZero() && campaign.StartAt.After(dueBy),
+			next != nil && !campaign.CreatedAt.Before(next.CreatedAt):
+			continue
+		}
+		next = campaign
+	}
+	if next == nil {
+		return nil, nil
+	}
+	return m.Get(ctx, next.ID)
+}
+
+func (m *mockCampaignRepo) Update(ctx context.Context, campaign *sms.Campaign) error {
+	return m.Create(ctx, campaign)
+}
+
+func (m *mockCampaignRepo) AddRecipients(ctx context.Context, recipients []*sms.CampaignRecipient, batchSize int) error {
+	m.recipients = append(m.recipients, recipients...)
+	return nil
+}
+
+func (m *mockCampaignRepo) find(campaignID string, status sms.RecipientStatus, afterLine, limit int) []*sms.CampaignRecipient {
+	var result []*sms.CampaignRecipient
+	for _, recipient := range m.recipients {
+		if recipient.CampaignID == campaignID && recipient.Status == status && recipient.Line > afterLine {
+			result = append(result, recipient)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Line < result[j].Line })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+func (m *mockCampaignRepo) PendingRecipients(ctx context.Context, campaignID string, limit int) ([]*sms.CampaignRecipient, error) {
+	return m.find(campaignID, sms.RecipientStatusPending, 0, limit), nil
+}
+
+func (m *mockCampaignRepo) UpdateRecipients(ctx context.Context, recipients []*sms.CampaignRecipient) error {
+	// recipients are shared pointers, so they are up to date already
+	return nil
+}
+
+func (m *mockCampaignRepo) CancelPending(ctx context.Context, campaignID string) (int64, error) {
+	var cancelled int64
+	for _, recipient := range m.recipients {
+		if recipient.CampaignID == campaignID && recipient.Status == sms.RecipientStatusPending {
+			recipient.Status = sms.RecipientStatusCancelled
+			cancelled++
+		}
+	}
+	return cancelled, nil
+}
+
+func (m *mockCampaignRepo) InvalidRecipients(ctx context.Context, campaignID string, afterLine, limit int) ([]*sms.CampaignRecipient, error) {
+	return m.find(campaignID, sms.RecipientStatusInvalid, afterLine, limit), nil
+}
+
+func (m *mockCampaignRepo) SMSStatusCounts(ctx context.Context, campaignID string) (map[sms.SMSStatus]int64, error) {
+	counts := make(map[sms.SMSStatus]int64)
+	for _, recipient := range m.find(campaignID, sms.RecipientStatusQueued, 0, len(m.recipients)) {
+		if msg, ok := m.smsRepo.messages[recipient.ID]; ok {
+			counts[msg.Status]++
+		}
+	}
+	return counts, nil
+}
+
+func (m *mockCampaignRepo) WithTx(tx *gorm.DB) sms.CampaignRepo {
+	return m
+}
+
+const campaignCSV = "receiver,Name,code\n" +
+	"09123456789,Ali,1234\n" +
+	"not-a-number,Sara,99\n" +
+	"+989351234567,,55\n" +
+	"+989221234567,Reza,77\n"
+
+func newCampaignService(chunkSize int) (*smsService.Service, *mockCampaignRepo, *mockSMSRepo, *mockOutboxRepo) {
+	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
+	campaigns := newMockCampaignRepo(repo)
+	service := newTestService(repo, outbox, newMockEventPublisher(), newMockSMSProvider()).
+		WithBatches(newMockBatchRepo(repo), sms.BulkPolicy{BillingMode: sms.BillingPerBatch, InsertBatchSize: 500}).
+		WithCampaigns(campaigns, sms.CampaignPolicy{ChunkSize: chunkSize, MaxRows: 100})
+	return service, campaigns, repo, outbox
+}
+
+func TestTemplate(t *testing.T) {
+	template, err := sms.ParseTemplate("Hi {{name}}, your code is {{ code }}. Bye {{name}}")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := strings.Join(template.Variables(), ","); got != "name,code" {
+		t.Errorf("Expected variables name,code, got %s", got)
+	}
+
+	content, err := template.Render(map[string]string{"name": "Ali", "code": "1234"})
+	if err != nil || content != "Hi Ali, your code is 1234. Bye Ali" {
+		t.Errorf("Expected the rendered content, got %q %v", content, err)
+	}
+	if _, err := template.Render(map[string]string{"name": "Ali"}); !errors.Is(err, sms.ErrMissingVariable) {
+		t.Errorf("Expected ErrMissingVariable, got %v", err)
+	}
+
+	for _, text := range []string{"Hi {{name", "Hi {{}}", "Hi {{first name}}"} {
+		if _, err := sms.ParseTemplate(text); !errors.Is(err, sms.ErrInvalidTemplate) {
+			t.Errorf("Expected ErrInvalidTemplate for %q, got %v", text, err)
+		}
+	}
+}
+
+func TestSMSService_Campaign_SendsValidRows(t *testing.T) {
+	service, _, repo, outbox := newCampaignService(1)
+	ctx := context.Background()
+
+	campaign := &sms.Campaign{
+		ID:       "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+		UserID:   listUserA,
+		Name:     "launch",
+		Template: "Hi {{name}}, your code is {{code}}",
+		Source:   []byte(campaignCSV),
+	}
+	if err := service.CreateCampaign(ctx, campaign); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// parsing
+	if worked, err := service.ProcessCampaigns(ctx); !worked || err != nil {
+		t.Fatalf("Expected the CSV parsed, got %v %v", worked, err)
+	}
+	progress, _ := service.GetCampaignProgress(ctx, campaign.ID)
+	parsed := progress.Campaign
+	if parsed.Status != sms.CampaignStatusRunning || parsed.TotalRows != 4 || parsed.InvalidRows != 2 || parsed.Source != nil {
+		t.Fatalf("Expected a running campaign with 2 of 4 rows invalid, got %+v", parsed)
+	}
+	invalid, err := service.CampaignErrors(ctx, campaign.ID, 0, 10)
+	if err != nil || len(invalid) != 2 || invalid[0].Line != 3 || invalid[1].Line != 4 {
+		t.Fatalf("Expected lines 3 and 4 reported, got %+v %v", invalid, err)
+	}
+	if !strings.Contains(invalid[1].Error, "name") {
+		t.Errorf("Expected the missing name reported, got %q", invalid[1].Error)
+	}
+
+	// one row per chunk, then a pause holds the rest
+	if worked, err := service.ProcessCampaigns(ctx); !worked || err != nil {
+		t.Fatalf("Expected a chunk sent, got %v %v", worked, err)
+	}
+	if _, err := service.PauseCampaign(ctx, campaign.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if worked, _ := service.ProcessCampaigns(ctx); worked {
+		t.Errorf("Expected a paused campaign to be left alone")
+	}
+	if len(repo.messages) != 1 {
+		t.Fatalf("Expected 1 SMS before the pause, got %d", len(repo.messages))
+	}
+
+	if _, err := service.ResumeCampaign(ctx, campaign.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for {
+		worked, err := service.ProcessCampaigns(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !worked {
+			break
+		}
+	}
+
+	progress, _ = service.GetCampaignProgress(ctx, campaign.ID)
+	if progress.Campaign.Status != sms.CampaignStatusCompleted || progress.Campaign.QueuedRows != 2 || progress.SMS[sms.SMSStatusBillingRequested] != 2 {
+		t.Errorf("Expected a completed campaign with 2 SMS awaiting billing, got %+v %v", progress.Campaign, progress.SMS)
+	}
+	contents := make(map[string]string)
+	for _, msg := range repo.messages {
+		contents[msg.Receiver] = msg.Content
+	}
+	if contents["+989123456789"] != "Hi Ali, your code is 1234" || contents["+989221234567"] != "Hi Reza, your code is 77" {
+		t.Errorf("Expected rendered content per row, got %v", contents)
+	}
+	billing := 0
+	for _, msg := range outbox.messages {
+		if msg.EventType == sms.EventTypeBatchBillingRequested {
+			billing++
+		}
+	}
+	if billing != 2 {
+		t.Errorf("Expected a batch billing request per chunk, got %d", billing)
+	}
+	if _, err := service.PauseCampaign(ctx, campaign.ID); !errors.Is(err, sms.ErrInvalidCampaignTransition) {
+		t.Errorf("Expected a completed campaign not to pause, got %v", err)
+	}
+}
+
+func TestSMSService_Campaign_ScheduledAndCancelled(t *testing.T) {
+	service, campaigns, repo, _ := newCampaignService(10)
+	ctx := context.Background()
+
+	campaign := &sms.Campaign{
+		ID:       "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+		UserID:   listUserA,
+		Template: "Hi {{name}}",
+		StartAt:  time.Now().Add(time.Hour),
+		Source:   []byte(campaignCSV),
+	}
+	if err := service.CreateCampaign(ctx, campaign); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if worked, err := service.ProcessCampaigns(ctx); !worked || err != nil {
+		t.Fatalf("Expected the CSV parsed, got %v %v", worked, err)
+	}
+	if worked, _ := service.ProcessCampaigns(ctx); worked {
+		t.Errorf("Expected nothing sent before the start time")
+	}
+
+	cancelled, err := service.CancelCampaign(ctx, campaign.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cancelled.Status != sms.CampaignStatusCancelled || cancelled.CancelledRows != 2 || cancelled.PendingRows() != 0 {
+		t.Errorf("Expected 2 rows cancelled, got %+v", cancelled)
+	}
+	if len(repo.messages) != 0 {
+		t.Errorf("Expected no SMS for a cancelled campaign, got %d", len(repo.messages))
+	}
+
+	// a CSV the template does not fit fails as a whole
+	broken := &sms.Campaign{ID: "550e8400-e29b-41d4-a716-446655440001", UserID: listUserA, Template: "Hi {{nickname}}", Source: []byte(campaignCSV)}
+	if err := service.CreateCampaign(ctx, broken); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := service.ProcessCampaigns(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stored := campaigns.campaigns[broken.ID]; stored.Status != sms.CampaignStatusFailed || !strings.Contains(stored.Error, "nickname") {
+		t.Errorf("Expected the campaign failed over the nickname column, got %+v", stored)
+	}
+}
+
+func TestCampaignHandler(t *testing.T) {
+	service, _, _, _ := newCampaignService(10)
+	handler := handlers.NewCampaignHandler(service, 1<<10)
+	app := fiber.New()
+	app.Post("/api/v1/campaigns", handler.CreateCampaign)
+	app.Get("/api/v1/campaigns/:id", handler.GetCampaign)
+	app.Post("/api/v1/campaigns/:id/pause", handler.PauseCampaign)
+
+	upload := func(fields map[string]string, csv string) *http.Response {
+		t.Helper()
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		for name, value := range fields {
+			_ = form.WriteField(name, value)
+		}
+		if csv != "" {
+			file, _ := form.CreateFormFile("file", "receivers.csv")
+			_, _ = file.Write([]byte(csv))
+		}
+		_ = form.Close()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/campaigns", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return resp
+	}
+
+	fields := map[string]string{"user_id": listUserA, "name": "launch", "template": "Hi {{name}}"}
+	resp := upload(fields, campaignCSV)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", resp.StatusCode)
+	}
+	var created dto.CampaignResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode campaign: %v", err)
+	}
+	if created.Status != "uploaded" {
+		t.Errorf("Expected an uploaded campaign, got %s", created.Status)
+	}
+
+	got, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/v1/campaigns/"+created.ID, nil))
+	if err != nil || got.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200, got %v %v", got.StatusCode, err)
+	}
+	// the CSV has not been parsed yet
+	paused, err := app.Test(httptest.NewRequest(http.MethodPost, "/api/v1/campaigns/"+created.ID+"/pause", nil))
+	if err != nil || paused.StatusCode != http.StatusConflict {
+		t.Errorf("Expected 409, got %v %v", paused.StatusCode, err)
+	}
+	missing, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/v1/campaigns/550e8400-e29b-41d4-a716-446655440009", nil))
+	if err != nil || missing.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404, got %v %v", missing.StatusCode, err)
+	}
+
+	if resp := upload(fields, ""); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a file, got %d", resp.StatusCode)
+	}
+	if resp := upload(fields, strings.Repeat("x", 2<<10)); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a large file, got %d", resp.StatusCode)
+	}
+	fields["template"] = "Hi {{name"
+	if resp := upload(fields, campaignCSV); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a broken template, got %d", resp.StatusCode)
+	}
+	if resp := upload(map[string]string{"name": "launch"}, campaignCSV); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 without user_id and template, got %d", resp.StatusCode)
+	}
+}
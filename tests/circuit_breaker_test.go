@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"sms/pkg/circuitbreaker"
+	"testing"
+	"time"
+)
+
+func TestBreaker_OpensAfterThreshold(t *testing.T) {
+	breaker := circuitbreaker.New(3, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		breaker.Failure()
+		if !breaker.Allow() {
+			t.Fatalf("Expected breaker to stay closed after %d failures", i+1)
+		}
+	}
+
+	breaker.Failure()
+	if breaker.State() != circuitbreaker.StateOpen {
+		t.Fatalf("Expected breaker to be open, got %s", breaker.State())
+	}
+	if breaker.Allow() {
+		t.Error("Expected open breaker to reject calls")
+	}
+}
+
+func TestBreaker_SuccessResetsFailures(t *testing.T) {
+	breaker := circuitbreaker.New(2, time.Hour)
+
+	breaker.Failure()
+	breaker.Success()
+	breaker.Failure()
+
+	if breaker.State() != circuitbreaker.StateClosed {
+		t.Errorf("Expected breaker to stay closed, got %s", breaker.State())
+	}
+}
+
+func TestBreaker_HalfOpenTrial(t *testing.T) {
+	breaker := circuitbreaker.New(1, 20*time.Millisecond)
+	breaker.Failure()
+	if breaker.Allow() {
+		t.Fatal("Expected open breaker to reject calls")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !breaker.Allow() {
+		t.Fatal("Expected a trial call after the open timeout")
+	}
+	if breaker.Allow() {
+		t.Error("Expected only one trial call while half-open")
+	}
+
+	breaker.Failure()
+	if breaker.State() != circuitbreaker.StateOpen || breaker.Allow() {
+		t.Fatal("Expected failed trial to re-open the breaker")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !breaker.Allow() {
+		t.Fatal("Expected a second trial call")
+	}
+	breaker.Success()
+	if breaker.State() != circuitbreaker.StateClosed || !breaker.Allow() {
+		t.Error("Expected successful trial to close the breaker")
+	}
+}
+
+func TestBreaker_CancelledTrial(t *testing.T) {
+	breaker := circuitbreaker.New(1, 20*time.Millisecond)
+	breaker.Failure()
+
+	time.Sleep(30 * time.Millisecond)
+	if !breaker.Allow() {
+		t.Fatal("Expected a trial call after the open timeout")
+	}
+	breaker.Cancel()
+	if breaker.State() != circuitbreaker.StateHalfOpen {
+		t.Errorf("Expected a cancelled trial to leave the breaker half-open, got %s", breaker.State())
+	}
+	if !breaker.Allow() {
+		t.Error("Expected another trial call after the cancelled one")
+	}
+}
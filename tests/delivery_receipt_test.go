@@ -0,0 +1,307 @@
+package tests
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	handlers "sms/internal/api/handlers/http"
+	"sms/internal/domain/sms"
+	"sms/internal/infra/external"
+	smsService "sms/internal/usecase/sms"
+	"sms/pkg/smpp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func newSentTestSMS(repo *mockSMSRepo) *sms.SMSMessage {
+	message := &sms.SMSMessage{
+		ID:                "sms-1",
+		Receiver:          "+989123456789",
+		Provider:          "smpp-gateway",
+		ProviderMessageID: "smsc-1",
+		Status:            sms.SMSStatusSent,
+	}
+	repo.messages[message.ID] = message
+	return message
+}
+
+func TestParseReceiptStatus(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected sms.SMSStatus
+	}{
+		{"delivered", sms.SMSStatusDelivered},
+		{"DELIVRD", sms.SMSStatusDelivered},
+		{"UNDELIV", sms.SMSStatusUndelivered},
+		{"REJECTD", sms.SMSStatusUndelivered},
+		{"Expired", sms.SMSStatusExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			status, err := sms.ParseReceiptStatus(tt.value)
+			if err != nil || status != tt.expected {
+				t.Errorf("Expected %s, got %s (%v)", tt.expected, status, err)
+			}
+		})
+	}
+
+	if _, err := sms.ParseReceiptStatus("ENROUTE"); !errors.Is(err, sms.ErrUnknownReceiptStatus) {
+		t.Errorf("Expected ErrUnknownReceiptStatus for an intermediate state, got %v", err)
+	}
+}
+
+func TestSMSMessage_ApplyDeliveryReceipt(t *testing.T) {
+	doneAt := time.Date(2025, 1, 2, 3, 4, 0, 0, time.UTC)
+
+	delivered := &sms.SMSMessage{Status: sms.SMSStatusSent}
+	if err := delivered.ApplyDeliveryReceipt(sms.DeliveryReceipt{Status: sms.SMSStatusDelivered, DoneAt: doneAt}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if delivered.Status != sms.SMSStatusDelivered || !delivered.DeliveredAt.Equal(doneAt) {
+		t.Errorf("Expected delivered at %v, got %s at %v", doneAt, delivered.Status, delivered.DeliveredAt)
+	}
+
+	undelivered := &sms.SMSMessage{Status: sms.SMSStatusSent}
+	if err := undelivered.ApplyDeliveryReceipt(sms.DeliveryReceipt{Status: sms.SMSStatusUndelivered, ErrorCode: "011"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if undelivered.Status != sms.SMSStatusUndelivered || undelivered.FailureCode != "011" || !undelivered.DeliveredAt.IsZero() {
+		t.Errorf("Expected undelivered with code 011, got %+v", undelivered)
+	}
+
+	if err := delivered.ApplyDeliveryReceipt(sms.DeliveryReceipt{Status: sms.SMSStatusExpired}); !errors.Is(err, sms.ErrInvalidStatusTransition) {
+		t.Errorf("Expected ErrInvalidStatusTransition for a delivered message, got %v", err)
+	}
+	if err := (&sms.SMSMessage{Status: sms.SMSStatusSent}).ApplyDeliveryReceipt(sms.DeliveryReceipt{Status: sms.SMSStatusSent}); !errors.Is(err, sms.ErrUnknownReceiptStatus) {
+		t.Errorf("Expected ErrUnknownReceiptStatus, got %v", err)
+	}
+}
+
+func TestParseSMPPReceipt(t *testing.T) {
+	receipt, err := smpp.ParseReceipt("id:1a2b3c sub:001 dlvrd:000 submit date:2501020304 done date:2501020305 stat:UNDELIV err:011 text:id:fake stat:DELIVRD")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if receipt.MessageID != "1a2b3c" || receipt.Stat != "UNDELIV" || receipt.Err != "011" {
+		t.Errorf("Unexpected receipt %+v", receipt)
+	}
+	if expected := time.Date(2025, 1, 2, 3, 5, 0, 0, time.UTC); !receipt.DoneDate.Equal(expected) {
+		t.Errorf("Expected done date %v, got %v", expected, receipt.DoneDate)
+	}
+
+	if _, err := smpp.ParseReceipt("hello there"); !errors.Is(err, smpp.ErrMalformedReceipt) {
+		t.Errorf("Expected ErrMalformedReceipt, got %v", err)
+	}
+}
+
+func TestSMSService_ProcessDeliveryReceipt(t *testing.T) {
+	repo := newMockSMSRepo()
+	service := newTestService(repo, newMockOutboxRepo(), newMockEventPublisher(), newMockSMSProvider())
+	message := newSentTestSMS(repo)
+	ctx := context.Background()
+
+	receipt := sms.DeliveryReceipt{Provider: "smpp-gateway", MessageID: "smsc-1", Status: sms.SMSStatusUndelivered, ErrorCode: "011"}
+	if err := service.ProcessDeliveryReceipt(ctx, receipt); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	message = repo.messages[message.ID]
+	if message.Status != sms.SMSStatusUndelivered || message.FailureCode != "011" {
+		t.Errorf("Expected undelivered with code 011, got %s %q", message.Status, message.FailureCode)
+	}
+
+	// repeated receipts are acknowledged without changing the message
+	receipt.Status = sms.SMSStatusDelivered
+	if err := service.ProcessDeliveryReceipt(ctx, receipt); err != nil {
+		t.Fatalf("Expected duplicate receipt to be ignored, got %v", err)
+	}
+	if message = repo.messages[message.ID]; message.Status != sms.SMSStatusUndelivered {
+		t.Errorf("Expected status to stay undelivered, got %s", message.Status)
+	}
+}
+
+func TestSMSService_ProcessDeliveryReceipt_Unknown(t *testing.T) {
+	repo := newMockSMSRepo()
+	service := newTestService(repo, newMockOutboxRepo(), newMockEventPublisher(), newMockSMSProvider())
+	newSentTestSMS(repo)
+
+	for _, receipt := range []sms.DeliveryReceipt{
+		{Provider: "smpp-gateway", MessageID: "other", Status: sms.SMSStatusDelivered},
+		{Provider: "http-gateway", MessageID: "smsc-1", Status: sms.SMSStatusDelivered},
+		{Provider: "smpp-gateway", MessageID: "", Status: sms.SMSStatusDelivered},
+	} {
+		if err := service.ProcessDeliveryReceipt(context.Background(), receipt); !errors.Is(err, sms.ErrUnknownReceipt) {
+			t.Errorf("Expected ErrUnknownReceipt for %+v, got %v", receipt, err)
+		}
+	}
+}
+
+func TestSMPPProvider_DeliveryReceipt(t *testing.T) {
+	repo := newMockSMSRepo()
+	smsc := newTestSMSC(t)
+
+	var service *smsService.Service
+	provider := newTestSMPPProvider(t, smsc, func(cfg *external.SMPPProviderConfig) {
+		cfg.Receipts = func(ctx context.Context, receipt sms.DeliveryReceipt) error {
+			return service.ProcessDeliveryReceipt(ctx, receipt)
+		}
+	})
+	service = newTestService(repo, newMockOutboxRepo(), newMockEventPublisher(), provider)
+
+	repo.messages["sms-1"] = &sms.SMSMessage{ID: "sms-1", Receiver: "+989123456789", Content: "hi", Status: sms.SMSStatusBillingRequested}
+	if err := service.ProcessDebitedSMS(context.Background(), sms.SMSBillingCompleted{SMSID: "sms-1", TransactionID: "txn-1"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	message := repo.messages["sms-1"]
+	if message.Status != sms.SMSStatusSent || message.ProviderMessageID != "smsc-1" {
+		t.Fatalf("Expected sent with provider message ID smsc-1, got %s %q", message.Status, message.ProviderMessageID)
+	}
+
+	status, err := smsc.DeliverReceipt("smsc-1", "DELIVRD", "000")
+	if err != nil || status != smpp.StatusOK {
+		t.Fatalf("Expected receipt to be acknowledged, got %v %v", status, err)
+	}
+	message = repo.messages["sms-1"]
+	if message.Status != sms.SMSStatusDelivered || message.DeliveredAt.IsZero() {
+		t.Errorf("Expected delivered with a delivery time, got %s at %v", message.Status, message.DeliveredAt)
+	}
+
+	// a receipt for an unknown message is retried by the SMSC later
+	if status, _ := smsc.DeliverReceipt("smsc-404", "DELIVRD", "000"); status != smpp.StatusXTAppn {
+		t.Errorf("Expected ESME_RX_T_APPN for an unknown message, got %v", status)
+	}
+	// intermediate states are acknowledged and ignored
+	if status, _ := smsc.DeliverReceipt("smsc-1", "ENROUTE", "000"); status != smpp.StatusOK {
+		t.Errorf("Expected ENROUTE to be acknowledged, got %v", status)
+	}
+}
+
+func TestSMPPProvider_MultipartDeliveryReceipt(t *testing.T) {
+	repo := newMockSMSRepo()
+	smsc := newTestSMSC(t)
+
+	var service *smsService.Service
+	provider := newTestSMPPProvider(t, smsc, func(cfg *external.SMPPProviderConfig) {
+		cfg.Receipts = func(ctx context.Context, receipt sms.DeliveryReceipt) error {
+			return service.ProcessDeliveryReceipt(ctx, receipt)
+		}
+	})
+	service = newTestService(repo, newMockOutboxRepo(), newMockEventPublisher(), provider)
+
+	repo.messages["sms-1"] = &sms.SMSMessage{ID: "sms-1", Receiver: "+989123456789", Content: strings.Repeat("ک", 100), Status: sms.SMSStatusBillingRequested}
+	if err := service.ProcessDebitedSMS(context.Background(), sms.SMSBillingCompleted{SMSID: "sms-1", TransactionID: "txn-1"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	message := repo.messages["sms-1"]
+	if message.Status != sms.SMSStatusSent || !slices.Equal(message.ProviderPartIDs, []string{"smsc-1", "smsc-2"}) {
+		t.Fatalf("Expected sent with the IDs of both parts, got %s %v", message.Status, message.ProviderPartIDs)
+	}
+
+	// the receipt of the second part arrives first and, repeated, still
+	// leaves the first part outstanding
+	for range 2 {
+		if status, err := smsc.DeliverReceipt("smsc-2", "DELIVRD", "000"); err != nil || status != smpp.StatusOK {
+			t.Fatalf("Expected receipt to be acknowledged, got %v %v", status, err)
+		}
+	}
+	if message = repo.messages["sms-1"]; message.Status != sms.SMSStatusSent || !slices.Equal(message.DeliveredPartIDs, []string{"smsc-2"}) {
+		t.Fatalf("Expected sent with the second part delivered, got %s %v", message.Status, message.DeliveredPartIDs)
+	}
+
+	if status, _ := smsc.DeliverReceipt("smsc-1", "DELIVRD", "000"); status != smpp.StatusOK {
+		t.Errorf("Expected the receipt of the first part to be acknowledged, got %v", status)
+	}
+	if message = repo.messages["sms-1"]; message.Status != sms.SMSStatusDelivered || message.DeliveredAt.IsZero() {
+		t.Errorf("Expected delivered once every part is, got %s at %v", message.Status, message.DeliveredAt)
+	}
+}
+
+func TestSMSMessage_ApplyDeliveryReceipt_UndeliveredPart(t *testing.T) {
+	message := &sms.SMSMessage{
+		Status:            sms.SMSStatusSent,
+		ProviderMessageID: "smsc-1",
+		ProviderPartIDs:   []string{"smsc-1", "smsc-2", "smsc-3"},
+	}
+
+	if err := message.ApplyDeliveryReceipt(sms.DeliveryReceipt{MessageID: "smsc-1", Status: sms.SMSStatusDelivered}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if message.Status != sms.SMSStatusSent {
+		t.Fatalf("Expected sent while parts are outstanding, got %s", message.Status)
+	}
+
+	// one lost part means the receiver did not get the whole message
+	err := message.ApplyDeliveryReceipt(sms.DeliveryReceipt{MessageID: "smsc-3", Status: sms.SMSStatusUndelivered, ErrorCode: "UND01"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if message.Status != sms.SMSStatusUndelivered || message.FailureCode != "UND01" {
+		t.Errorf("Expected undelivered with code UND01, got %s %q", message.Status, message.FailureCode)
+	}
+
+	// later receipts for the remaining part find the message settled
+	err = message.ApplyDeliveryReceipt(sms.DeliveryReceipt{MessageID: "smsc-2", Status: sms.SMSStatusDelivered})
+	if !errors.Is(err, sms.ErrInvalidStatusTransition) {
+		t.Errorf("Expected ErrInvalidStatusTransition, got %v", err)
+	}
+}
+
+func TestSMSHandler_ReceiveDeliveryReceipt(t *testing.T) {
+	repo := newMockSMSRepo()
+	service := newTestService(repo, newMockOutboxRepo(), newMockEventPublisher(), newMockSMSProvider())
+	message := newSentTestSMS(repo)
+	message.Provider = "http-gateway"
+
+	secrets := map[string]string{"http-gateway": "http-secret", "other-gateway": "other-secret"}
+	app := fiber.New()
+	app.Post("/api/v1/dlr/:provider", handlers.VerifyReceiptSignature(secrets), handlers.NewSMSHandler(service).ReceiveDeliveryReceipt)
+
+	tests := []struct {
+		name     string
+		provider string
+		secret   string
+		body     string
+		expected int
+	}{
+		{"Unsigned", "http-gateway", "", `{"message_id":"smsc-1","status":"delivered"}`, http.StatusUnauthorized},
+		{"Wrong secret", "http-gateway", "other-secret", `{"message_id":"smsc-1","status":"delivered"}`, http.StatusUnauthorized},
+		{"Gateway without secret", "smpp-gateway", "http-secret", `{"message_id":"smsc-1","status":"delivered"}`, http.StatusUnauthorized},
+		{"Unknown status", "http-gateway", "http-secret", `{"message_id":"smsc-1","status":"ENROUTE"}`, http.StatusBadRequest},
+		{"Unknown message", "http-gateway", "http-secret", `{"message_id":"nope","status":"delivered"}`, http.StatusNotFound},
+		{"Other provider", "other-gateway", "other-secret", `{"message_id":"smsc-1","status":"delivered"}`, http.StatusNotFound},
+		{"Expired", "http-gateway", "http-secret", `{"message_id":"smsc-1","status":"expired","error_code":"EXP01"}`, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/dlr/"+tt.provider, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.secret != "" {
+				mac := hmac.New(sha256.New, []byte(tt.secret))
+				mac.Write([]byte(tt.body))
+				req.Header.Set(handlers.ReceiptSignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if resp.StatusCode != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, resp.StatusCode)
+			}
+		})
+	}
+
+	message = repo.messages[message.ID]
+	if message.Status != sms.SMSStatusExpired || message.FailureCode != "EXP01" {
+		t.Errorf("Expected expired with code EXP01, got %s %q", message.Status, message.FailureCode)
+	}
+}
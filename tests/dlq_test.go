@@ -0,0 +1,249 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sms/config"
+	"sms/internal/api/handlers/messaging"
+	"sms/pkg/logger"
+	"sms/pkg/rabbit"
+	"sms/pkg/rabbit/rabbittest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func TestRedeliveryCount(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  amqp.Table
+		expected int
+	}{
+		{"No headers", nil, 0},
+		{"Published by us", amqp.Table{rabbit.RedeliveryCountHeader: int32(3)}, 3},
+		{"Decoded as int64", amqp.Table{rabbit.RedeliveryCountHeader: int64(4)}, 4},
+		{"Wrong type", amqp.Table{rabbit.RedeliveryCountHeader: "5"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rabbit.RedeliveryCount(tt.headers); got != tt.expected {
+				t.Errorf("Expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+
+	if name := rabbit.DLQName("sms_billing.debit.completed"); name != "sms_billing.debit.completed.dlq" {
+		t.Errorf("Unexpected DLQ name %s", name)
+	}
+}
+
+func TestConsumerHandler_MalformedMessage(t *testing.T) {
+	service := newTestService(newMockSMSRepo(), newMockOutboxRepo(), newMockEventPublisher(), newMockSMSProvider())
+	handler := messaging.NewSMSConsumer(*service, logger.NewLogger("info"), nil, config.Config{})
+	ctx := context.Background()
+
+	if err := handler.HandleDebitedSMS(ctx, []byte("{not json")); !errors.Is(err, rabbit.ErrMalformedMessage) {
+		t.Errorf("Expected ErrMalformedMessage for invalid JSON, got %v", err)
+	}
+	if err := handler.HandleDeliveryRetry(ctx, []byte(`{"sms_id": 1}`)); !errors.Is(err, rabbit.ErrMalformedMessage) {
+		t.Errorf("Expected ErrMalformedMessage for a wrong field type, got %v", err)
+	}
+
+	// processing errors are retried rather than dead-lettered right away
+	err := handler.HandleDebitedSMS(ctx, []byte(`{"sms_id":"missing","transaction_id":"txn-1"}`))
+	if err == nil || errors.Is(err, rabbit.ErrMalformedMessage) {
+		t.Errorf("Expected a retryable error for an unknown SMS, got %v", err)
+	}
+}
+
+func TestReadConfig_QueueDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `
+rabbitmq:
+  queues:
+    - name: "a"
+    - name: "b"
+      max_redeliveries: 2
+      redelivery_delay: "1m"
+      workers: 3
+  dispatch:
+    redelivery_delay: "1s"
+    workers: 1
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.ReadConfig(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := cfg.RabbitMQ.Queues[0].MaxRedeliveries; got != rabbit.DefaultMaxRedeliveries {
+		t.Errorf("Expected default of %d redeliveries, got %d", rabbit.DefaultMaxRedeliveries, got)
+	}
+	if got := cfg.RabbitMQ.Queues[1].MaxRedeliveries; got != 2 {
+		t.Errorf("Expected 2 redeliveries, got %d", got)
+	}
+	if q := cfg.RabbitMQ.Queues[0]; q.RedeliveryDelay != rabbit.DefaultRedeliveryDelay {
+		t.Errorf("Expected a default redelivery delay of %v, got %v", rabbit.DefaultRedeliveryDelay, q.RedeliveryDelay)
+	}
+	if q := cfg.RabbitMQ.Queues[1]; q.RedeliveryDelay != time.Minute {
+		t.Errorf("Expected a 1m redelivery delay, got %v", q.RedeliveryDelay)
+	}
+	if q := cfg.RabbitMQ.Queues[0]; q.Workers != 4 || q.Prefetch != 8 {
+		t.Errorf("Expected 4 workers prefetching 8 by default, got %d and %d", q.Workers, q.Prefetch)
+	}
+	if q := cfg.RabbitMQ.Queues[1]; q.Workers != 3 || q.Prefetch != 6 {
+		t.Errorf("Expected prefetch to follow the worker count, got %d and %d", q.Workers, q.Prefetch)
+	}
+	if c := cfg.RabbitMQ.DeliveryRetry; c.MaxRedeliveries != 5 || c.Workers != 4 || c.Prefetch != 8 {
+		t.Errorf("Expected the delivery retry consumer to get the defaults, got %+v", c)
+	}
+	if c := cfg.RabbitMQ.Dispatch; c.Workers != 1 || c.Prefetch != 2 || c.RedeliveryDelay != time.Second {
+		t.Errorf("Expected the configured dispatch consumer, got %+v", c)
+	}
+	if cfg.RabbitMQ.DrainTimeout != 30*time.Second {
+		t.Errorf("Expected a 30s drain timeout, got %v", cfg.RabbitMQ.DrainTimeout)
+	}
+}
+
+func TestConsumer_DelaysRedeliveries(t *testing.T) {
+	broker := rabbittest.NewBroker()
+	conn := newTestRabbitConn(t, broker.Dial, nil)
+	if err := conn.DeclareBindQueue("sms.test", rabbit.Exchange, "sms.test"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	const delay = 50 * time.Millisecond
+	var (
+		mu       sync.Mutex
+		attempts []time.Time
+	)
+	consumer := rabbit.NewConsumer(conn)
+	opts := rabbit.QueueOptions{MaxRedeliveries: 2, RedeliveryDelay: delay, Workers: 1}
+	consumer.SubscribeWithOptions("sms.test", opts, func(ctx context.Context, body []byte) error {
+		mu.Lock()
+		attempts = append(attempts, time.Now())
+		mu.Unlock()
+		return errors.New("provider down")
+	})
+	if err := consumer.StartConsume(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() { _ = consumer.Shutdown(context.Background()) })
+
+	if name := rabbit.DelayQueueName("sms.test", delay); !broker.HasQueue(name) {
+		t.Fatalf("Expected the delay queue %s to be declared", name)
+	}
+
+	broker.Publish(rabbit.Exchange, "sms.test", amqp.Publishing{
+		MessageId:     "msg-1",
+		CorrelationId: "corr-1",
+		Body:          []byte("poison"),
+	})
+	waitFor(t, "the message to be dead-lettered", func() bool {
+		return len(broker.Messages(rabbit.DLQName("sms.test"))) == 1
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(attempts) != 3 {
+		t.Fatalf("Expected the first delivery and 2 redeliveries, got %d", len(attempts))
+	}
+	for i := 1; i < len(attempts); i++ {
+		if gap := attempts[i].Sub(attempts[i-1]); gap < delay {
+			t.Errorf("Expected redelivery %d to wait at least %v, got %v", i, delay, gap)
+		}
+	}
+	letter := broker.Messages(rabbit.DLQName("sms.test"))[0]
+	if letter.MessageId != "msg-1" || letter.CorrelationId != "corr-1" {
+		t.Errorf("Expected the message properties to survive, got %q and %q", letter.MessageId, letter.CorrelationId)
+	}
+}
+
+func TestRabbitConn_InspectAndRedriveDLQ(t *testing.T) {
+	broker := rabbittest.NewBroker()
+	conn := newTestRabbitConn(t, broker.Dial, nil)
+	if err := conn.DeclareBindQueue("sms.test", rabbit.Exchange, "sms.test"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := conn.DeclareDLQ("sms.test"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ctx := context.Background()
+
+	failedAt := time.Now().UTC().Truncate(time.Second)
+	for _, id := range []string{"msg-1", "msg-2"} {
+		broker.Publish("", rabbit.DLQName("sms.test"), amqp.Publishing{
+			MessageId:     id,
+			CorrelationId: "corr-" + id,
+			Body:          []byte(id),
+			Headers: amqp.Table{
+				rabbit.RedeliveryCountHeader: int32(5),
+				rabbit.DeadLetterReason:      "provider down",
+				rabbit.OriginalQueueHeader:   "sms.test",
+				rabbit.FailedAtHeader:        failedAt,
+				"x-trace":                    "kept",
+			},
+		})
+	}
+
+	letters, err := conn.InspectDLQ(ctx, "sms.test", 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(letters) != 2 {
+		t.Fatalf("Expected 2 dead letters, got %d", len(letters))
+	}
+	if l := letters[0]; l.Reason != "provider down" || l.OriginalQueue != "sms.test" || l.Redeliveries != 5 || !l.FailedAt.Equal(failedAt) || string(l.Body) != "msg-1" {
+		t.Errorf("Unexpected dead letter %+v", l)
+	}
+	if got := len(broker.Messages(rabbit.DLQName("sms.test"))); got != 2 {
+		t.Errorf("Expected inspecting to leave the DLQ alone, got %d messages", got)
+	}
+
+	moved, err := conn.RedriveDLQ(ctx, "sms.test", 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if moved != 1 {
+		t.Fatalf("Expected 1 message moved, got %d", moved)
+	}
+	if got := len(broker.Messages(rabbit.DLQName("sms.test"))); got != 1 {
+		t.Errorf("Expected 1 message left in the DLQ, got %d", got)
+	}
+	redriven := broker.Messages("sms.test")
+	if len(redriven) != 1 {
+		t.Fatalf("Expected 1 message back in the queue, got %d", len(redriven))
+	}
+	if m := redriven[0]; m.MessageId != "msg-1" || m.CorrelationId != "corr-msg-1" {
+		t.Errorf("Expected the message properties to survive, got %q and %q", m.MessageId, m.CorrelationId)
+	}
+	for _, key := range []string{rabbit.RedeliveryCountHeader, rabbit.DeadLetterReason, rabbit.OriginalQueueHeader, rabbit.FailedAtHeader} {
+		if _, ok := redriven[0].Headers[key]; ok {
+			t.Errorf("Expected header %s to be cleared", key)
+		}
+	}
+	if redriven[0].Headers["x-trace"] != "kept" {
+		t.Errorf("Expected other headers to be kept, got %v", redriven[0].Headers)
+	}
+	if broker.Unacked() != 0 {
+		t.Errorf("Expected nothing left unacked, got %d", broker.Unacked())
+	}
+
+	// a missing DLQ closes only the tool's own channel
+	if _, err := conn.InspectDLQ(ctx, "sms.missing", 10); err == nil {
+		t.Error("Expected an error for a missing DLQ")
+	}
+	if err := conn.Check(ctx); err != nil {
+		t.Errorf("Expected the connection to stay up, got %v", err)
+	}
+	if dials := len(broker.Dials()); dials != 1 {
+		t.Errorf("Expected no reconnect, got %d dials", dials)
+	}
+}
@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"sms/internal/domain/sms"
+	"strings"
+	"testing"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected sms.Encoding
+	}{
+		{"Plain ASCII", "Your code is 123456", sms.EncodingGSM7},
+		{"GSM extension characters", "Price: 10€ [promo] {x}", sms.EncodingGSM7},
+		{"GSM accented characters", "Café à Paris", sms.EncodingGSM7},
+		{"Persian", "کد تایید شما ۱۲۳۴ است", sms.EncodingUCS2},
+		{"Emoji", "Hello 😊", sms.EncodingUCS2},
+		{"Empty", "", sms.EncodingGSM7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sms.DetectEncoding(tt.content); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCountSegments(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected int
+	}{
+		{"GSM-7 single part limit", strings.Repeat("a", 160), 1},
+		{"GSM-7 one over single part", strings.Repeat("a", 161), 2},
+		{"GSM-7 two full parts", strings.Repeat("a", 306), 2},
+		{"GSM-7 three parts", strings.Repeat("a", 307), 3},
+		{"GSM-7 extension counts twice", strings.Repeat("€", 80), 1},
+		{"GSM-7 extension over single part", strings.Repeat("€", 81), 2},
+		{"UCS-2 single part limit", strings.Repeat("س", 70), 1},
+		{"UCS-2 one over single part", strings.Repeat("س", 71), 2},
+		{"UCS-2 two full parts", strings.Repeat("س", 134), 2},
+		{"UCS-2 three parts", strings.Repeat("س", 135), 3},
+		{"UCS-2 surrogate pairs count twice", strings.Repeat("😊", 35), 1},
+		{"Empty", "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sms.CountSegments(tt.content); got != tt.expected {
+				t.Errorf("Expected %d segments, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestEncodeContent_Multipart(t *testing.T) {
+	content := strings.Repeat("ب", 100)
+	encoded := sms.EncodeContent(content, 0x2A)
+
+	if encoded.Encoding != sms.EncodingUCS2 {
+		t.Fatalf("Expected UCS-2, got %s", encoded.Encoding)
+	}
+	if len(encoded.Segments) != 2 {
+		t.Fatalf("Expected 2 segments, got %d", len(encoded.Segments))
+	}
+
+	var joined strings.Builder
+	for i, segment := range encoded.Segments {
+		expectedUDH := []byte{0x05, 0x00, 0x03, 0x2A, 0x02, byte(i + 1)}
+		if !bytes.Equal(segment.UDH, expectedUDH) {
+			t.Errorf("Expected UDH %x for part %d, got %x", expectedUDH, i+1, segment.UDH)
+		}
+		if segment.Sequence != i+1 {
+			t.Errorf("Expected sequence %d, got %d", i+1, segment.Sequence)
+		}
+		joined.WriteString(segment.Text)
+	}
+	if joined.String() != content {
+		t.Error("Expected segments to join back into the original content")
+	}
+	if n := len([]rune(encoded.Segments[0].Text)); n != 67 {
+		t.Errorf("Expected first UCS-2 part to hold 67 characters, got %d", n)
+	}
+}
+
+func TestEncodeContent_DoesNotSplitEscapeSequence(t *testing.T) {
+	// 152 septets followed by a two-septet character: it must move to part two
+	content := strings.Repeat("a", 152) + "€" + strings.Repeat("a", 10)
+	encoded := sms.EncodeContent(content, 1)
+
+	if len(encoded.Segments) != 2 {
+		t.Fatalf("Expected 2 segments, got %d", len(encoded.Segments))
+	}
+	if encoded.Segments[0].Text != strings.Repeat("a", 152) {
+		t.Errorf("Expected first part to stop before the escape sequence, got %d bytes", len(encoded.Segments[0].Text))
+	}
+	if !strings.HasPrefix(encoded.Segments[1].Text, "€") {
+		t.Error("Expected second part to start with the extension character")
+	}
+}
+
+func TestEncodeContent_SinglePartHasNoUDH(t *testing.T) {
+	encoded := sms.EncodeContent("Hello", 7)
+	if len(encoded.Segments) != 1 || encoded.Segments[0].UDH != nil {
+		t.Errorf("Expected one segment without UDH, got %+v", encoded.Segments)
+	}
+}
+
+func TestSMSMessage_SetSegmentCount(t *testing.T) {
+	message := &sms.SMSMessage{ID: "test-id", Content: strings.Repeat("ک", 200)}
+	if err := message.SetSegmentCount(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if message.SegmentCount != 3 {
+		t.Errorf("Expected 3 segments, got %d", message.SegmentCount)
+	}
+
+	message.Content = strings.Repeat("a", sms.MaxSegments*153+1)
+	if err := message.SetSegmentCount(); !errors.Is(err, sms.ErrContentTooLong) {
+		t.Errorf("Expected ErrContentTooLong, got %v", err)
+	}
+}
+
+func TestEncodeText(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		encoding sms.Encoding
+		expected []byte
+	}{
+		{"GSM basic characters", "@A£a", sms.EncodingGSM7, []byte{0x00, 0x41, 0x01, 0x61}},
+		{"GSM codes after the escape", "ÆæßÉ ", sms.EncodingGSM7, []byte{0x1C, 0x1D, 0x1E, 0x1F, 0x20}},
+		{"GSM extension characters", "€[", sms.EncodingGSM7, []byte{0x1B, 0x65, 0x1B, 0x3C}},
+		{"GSM last code", "à", sms.EncodingGSM7, []byte{0x7F}},
+		{"UCS-2", "سلام", sms.EncodingUCS2, []byte{0x06, 0x33, 0x06, 0x44, 0x06, 0x27, 0x06, 0x45}},
+		{"UCS-2 surrogate pair", "😊", sms.EncodingUCS2, []byte{0xD8, 0x3D, 0xDE, 0x0A}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sms.EncodeText(tt.text, tt.encoding); !bytes.Equal(got, tt.expected) {
+				t.Errorf("Expected % X, got % X", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sms/internal/domain/sms"
+	"sms/internal/infra/pricing"
+	"testing"
+)
+
+func TestTariff_Price(t *testing.T) {
+	tariff := sms.Tariff{
+		Plan: "standard",
+		Rates: []sms.TariffRate{
+			{Prefix: "+98", PricePerSegment: 2},
+			{Prefix: "+98921", PricePerSegment: 3},
+			{Prefix: "+1", PricePerSegment: 10},
+			{Prefix: "+98990", PricePerSegment: 0},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		receiver string
+		segments int
+		expected int64
+		err      error
+	}{
+		{"Country prefix", "+989123456789", 1, 2, nil},
+		{"Operator prefix wins over country", "+989211234567", 1, 3, nil},
+		{"Multiplied by segments", "+989211234567", 3, 9, nil},
+		{"Other country", "+14155550100", 2, 20, nil},
+		{"Free rate", "+989901234567", 2, 0, nil},
+		{"No matching rate", "+447700900123", 1, 0, sms.ErrNoTariffRate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, err := tariff.Price(tt.receiver, tt.segments)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected error %v, got %v", tt.err, err)
+			}
+			if amount != tt.expected {
+				t.Errorf("Expected amount %d, got %d", tt.expected, amount)
+			}
+		})
+	}
+
+	tariff.DefaultPricePerSegment = 7
+	amount, err := tariff.Price("+447700900123", 2)
+	if err != nil || amount != 14 {
+		t.Errorf("Expected default price 14, got %d (%v)", amount, err)
+	}
+}
+
+func TestStaticTariffRepo_GetTariff(t *testing.T) {
+	repo := pricing.NewStaticTariffRepo([]sms.Tariff{
+		{Plan: "standard", DefaultPricePerSegment: 1},
+		{Plan: "premium", DefaultPricePerSegment: 3},
+	}, map[string]string{"vip-user": "premium"}, "standard")
+
+	ctx := context.Background()
+	tariff, err := repo.GetTariff(ctx, "vip-user")
+	if err != nil || tariff.Plan != "premium" {
+		t.Errorf("Expected premium plan, got %q (%v)", tariff.Plan, err)
+	}
+
+	tariff, err = repo.GetTariff(ctx, "someone-else")
+	if err != nil || tariff.Plan != "standard" {
+		t.Errorf("Expected default standard plan, got %q (%v)", tariff.Plan, err)
+	}
+
+	broken := pricing.NewStaticTariffRepo(nil, nil, "missing")
+	if _, err := broken.GetTariff(ctx, "user"); err == nil {
+		t.Error("Expected error for unknown default plan, got nil")
+	}
+}
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"errors"
 	"sms/internal/domain/sms"
 	"testing"
 	"time"
@@ -12,20 +13,25 @@ func TestSMSMessage_MarkAsSent(t *testing.T) {
 		UserID:   "user-123",
 		Content:  "Test message",
 		Receiver: "+1234567890",
-		Status:   sms.SMSStatusPending,
+		Status:   sms.SMSStatusSending,
 	}
 	provider := "test-provider"
 	beforeTime := time.Now()
 
-	message.MarkAsSent(provider)
-	if message.Status != sms.SMSStatusDelivered {
-		t.Errorf("Expected status to be %s, got %s", sms.SMSStatusDelivered, message.Status)
+	if err := message.MarkAsSent(provider, "provider-msg-1"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if message.Status != sms.SMSStatusSent {
+		t.Errorf("Expected status to be %s, got %s", sms.SMSStatusSent, message.Status)
 	}
 	if message.Provider != provider {
 		t.Errorf("Expected provider to be %s, got %s", provider, message.Provider)
 	}
-	if message.DeliveredAt.Before(beforeTime) {
-		t.Error("DeliveredAt should be set to current time")
+	if message.ProviderMessageID != "provider-msg-1" {
+		t.Errorf("Expected provider message ID provider-msg-1, got %s", message.ProviderMessageID)
+	}
+	if !message.DeliveredAt.IsZero() {
+		t.Error("DeliveredAt should stay unset until a delivery receipt arrives")
 	}
 	if message.UpdatedAt.Before(beforeTime) {
 		t.Error("UpdatedAt should be set to current time")
@@ -44,7 +50,9 @@ func TestSMSMessage_MarkAsFailed(t *testing.T) {
 	failureCode := "NETWORK_ERROR"
 	beforeTime := time.Now()
 
-	message.MarkAsFailed(provider, failureCode)
+	if err := message.MarkAsFailed(provider, failureCode); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
 	if message.Status != sms.SMSStatusFailed {
 		t.Errorf("Expected status to be %s, got %s", sms.SMSStatusFailed, message.Status)
 	}
@@ -59,6 +67,62 @@ func TestSMSMessage_MarkAsFailed(t *testing.T) {
 	}
 }
 
+func TestSMSMessage_MarkAsSent_InvalidTransition(t *testing.T) {
+	for _, status := range []sms.SMSStatus{sms.SMSStatusPending, sms.SMSStatusDelivered, sms.SMSStatusFailed, sms.SMSStatusCancelled} {
+		t.Run(string(status), func(t *testing.T) {
+			message := &sms.SMSMessage{ID: "test-id", Status: status}
+
+			err := message.MarkAsSent("test-provider", "provider-msg-1")
+			if !errors.Is(err, sms.ErrInvalidStatusTransition) {
+				t.Fatalf("Expected ErrInvalidStatusTransition, got %v", err)
+			}
+			var transitionErr *sms.InvalidTransitionError
+			if !errors.As(err, &transitionErr) || transitionErr.From != status || transitionErr.To != sms.SMSStatusSent {
+				t.Errorf("Expected transition error %s -> %s, got %v", status, sms.SMSStatusSent, err)
+			}
+			if message.Status != status || message.Provider != "" {
+				t.Errorf("Expected message to be unchanged, got status %s provider %q", message.Status, message.Provider)
+			}
+		})
+	}
+}
+
+func TestSMSStatus_Transitions(t *testing.T) {
+	tests := []struct {
+		from  sms.SMSStatus
+		to    sms.SMSStatus
+		valid bool
+	}{
+		{sms.SMSStatusPending, sms.SMSStatusBillingRequested, true},
+		{sms.SMSStatusBillingRequested, sms.SMSStatusBilled, true},
+		{sms.SMSStatusBilled, sms.SMSStatusSending, true},
+		{sms.SMSStatusSending, sms.SMSStatusSent, true},
+		{sms.SMSStatusSent, sms.SMSStatusDelivered, true},
+		{sms.SMSStatusSent, sms.SMSStatusUndelivered, true},
+		{sms.SMSStatusSending, sms.SMSStatusRetryScheduled, true},
+		{sms.SMSStatusRetryScheduled, sms.SMSStatusSending, true},
+		{sms.SMSStatusRetryScheduled, sms.SMSStatusFailed, false},
+		{sms.SMSStatusUndelivered, sms.SMSStatusDelivered, false},
+		{sms.SMSStatusSent, sms.SMSStatusExpired, true},
+		{sms.SMSStatusFailed, sms.SMSStatusPending, false},
+		{sms.SMSStatusBillingRequested, sms.SMSStatusCancelled, true},
+		{sms.SMSStatusBillingRequested, sms.SMSStatusSending, false},
+		{sms.SMSStatusSent, sms.SMSStatusCancelled, false},
+		{sms.SMSStatusDelivered, sms.SMSStatusFailed, false},
+		{sms.SMSStatusFailed, sms.SMSStatusDelivered, false},
+		{sms.SMSStatusExpired, sms.SMSStatusPending, false},
+		{sms.SMSStatusCancelled, sms.SMSStatusBillingRequested, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			if got := tt.from.CanTransitionTo(tt.to); got != tt.valid {
+				t.Errorf("Expected transition %s -> %s valid: %v, got %v", tt.from, tt.to, tt.valid, got)
+			}
+		})
+	}
+}
+
 func TestSMSStatus_Constants(t *testing.T) {
 	tests := []struct {
 		name     string
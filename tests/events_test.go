@@ -2,6 +2,7 @@ package tests
 
 import (
 	"context"
+	"encoding/json"
 	"sms/internal/domain/sms"
 	"testing"
 	"time"
@@ -142,3 +143,35 @@ func TestSMSProviderFunc(t *testing.T) {
 		t.Errorf("Expected provider name to be 'test-provider', got %s", result)
 	}
 }
+
+func TestDecodeEvent(t *testing.T) {
+	original := sms.RequestSMSBilling{
+		UserID:    "user-123",
+		SMSID:     "sms-456",
+		Amount:    2,
+		TimeStamp: time.Now().UTC(),
+	}
+	payload, err := json.Marshal(original)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	event, err := sms.DecodeEvent(sms.EventTypeBillingRequested, payload)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	decoded, ok := event.(sms.RequestSMSBilling)
+	if !ok {
+		t.Fatalf("Expected RequestSMSBilling, got %T", event)
+	}
+	if decoded.SMSID != original.SMSID || decoded.Amount != original.Amount || !decoded.TimeStamp.Equal(original.TimeStamp) {
+		t.Errorf("Expected %+v, got %+v", original, decoded)
+	}
+
+	if _, err := sms.DecodeEvent(sms.EventType("Unknown"), payload); err == nil {
+		t.Error("Expected error for unknown event type, got nil")
+	}
+	if _, err := sms.DecodeEvent(sms.EventTypeBillingRefunded, []byte("{")); err == nil {
+		t.Error("Expected error for malformed payload, got nil")
+	}
+}
@@ -0,0 +1,183 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sms/internal/domain/sms"
+	"sms/internal/infra/external"
+	"sms/pkg/logger"
+	"testing"
+	"time"
+)
+
+type mockAttemptRecorder struct {
+	attempts []sms.DeliveryAttempt
+}
+
+func (m *mockAttemptRecorder) RecordAttempt(ctx context.Context, attempt sms.DeliveryAttempt) error {
+	m.attempts = append(m.attempts, attempt)
+	return nil
+}
+
+func newFailoverTestProvider(recorder sms.AttemptRecorder, providers ...*mockSMSProvider) *external.FailoverProvider {
+	chain := make([]external.NamedProvider, 0, len(providers))
+	for _, p := range providers {
+		chain = append(chain, external.NamedProvider{Name: p.providerName, Provider: p})
+	}
+	return external.NewFailoverProvider(chain, external.BreakerOptions{
+		FailureThreshold: 2,
+		OpenTimeout:      time.Hour,
+	}, recorder, logger.NewLogger("info"))
+}
+
+func TestFailoverProvider_FallsBackToNextProvider(t *testing.T) {
+	primary := &mockSMSProvider{providerName: "primary", sendError: errors.New("timeout")}
+	backup := &mockSMSProvider{providerName: "backup"}
+	recorder := &mockAttemptRecorder{}
+	provider := newFailoverTestProvider(recorder, primary, backup)
+
+	name, err := provider.SendSMS(context.Background(), &sms.SMSMessage{ID: "sms-1"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if name != "backup" {
+		t.Errorf("Expected backup provider, got %s", name)
+	}
+
+	if len(recorder.attempts) != 2 {
+		t.Fatalf("Expected 2 recorded attempts, got %d", len(recorder.attempts))
+	}
+	if recorder.attempts[0].Provider != "primary" || recorder.attempts[0].Error != "timeout" {
+		t.Errorf("Expected failed primary attempt, got %+v", recorder.attempts[0])
+	}
+	if recorder.attempts[1].Provider != "backup" || recorder.attempts[1].Error != "" || recorder.attempts[1].SMSID != "sms-1" {
+		t.Errorf("Expected successful backup attempt, got %+v", recorder.attempts[1])
+	}
+}
+
+func TestFailoverProvider_SkipsOpenCircuit(t *testing.T) {
+	primary := &mockSMSProvider{providerName: "primary", sendError: errors.New("timeout")}
+	backup := &mockSMSProvider{providerName: "backup"}
+	provider := newFailoverTestProvider(nil, primary, backup)
+
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		if _, err := provider.SendSMS(ctx, &sms.SMSMessage{ID: "sms"}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	if primary.calls != 2 {
+		t.Errorf("Expected primary to be skipped after 2 failures, got %d calls", primary.calls)
+	}
+	if backup.calls != 5 {
+		t.Errorf("Expected backup to handle every message, got %d calls", backup.calls)
+	}
+}
+
+func TestFailoverProvider_CancelledTrialReleasesBreaker(t *testing.T) {
+	primary := &mockSMSProvider{providerName: "primary", sendError: errors.New("timeout")}
+	provider := external.NewFailoverProvider([]external.NamedProvider{{Name: "primary", Provider: primary}}, external.BreakerOptions{
+		FailureThreshold: 1,
+		OpenTimeout:      20 * time.Millisecond,
+	}, nil, logger.NewLogger("info"))
+	ctx := context.Background()
+
+	if _, err := provider.SendSMS(ctx, &sms.SMSMessage{ID: "sms"}); err == nil {
+		t.Fatal("Expected the primary failure to open the breaker")
+	}
+
+	// the half-open trial is cancelled by the caller
+	time.Sleep(30 * time.Millisecond)
+	primary.sendError = context.Canceled
+	if _, err := provider.SendSMS(ctx, &sms.SMSMessage{ID: "sms"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	primary.sendError = nil
+	if _, err := provider.SendSMS(ctx, &sms.SMSMessage{ID: "sms"}); err != nil {
+		t.Fatalf("Expected the next call to be let through as the trial, got %v", err)
+	}
+	if primary.calls != 3 {
+		t.Errorf("Expected 3 primary calls, got %d", primary.calls)
+	}
+}
+
+func TestFailoverProvider_Exhausted(t *testing.T) {
+	primary := &mockSMSProvider{providerName: "primary", sendError: errors.New("timeout")}
+	backup := &mockSMSProvider{providerName: "backup", sendError: errors.New("rejected")}
+	provider := newFailoverTestProvider(nil, primary, backup)
+
+	name, err := provider.SendSMS(context.Background(), &sms.SMSMessage{ID: "sms"})
+	if !errors.Is(err, sms.ErrProvidersExhausted) {
+		t.Fatalf("Expected ErrProvidersExhausted, got %v", err)
+	}
+	if name != "backup" {
+		t.Errorf("Expected last tried provider to be reported, got %s", name)
+	}
+
+	var exhausted *sms.ProvidersExhaustedError
+	if !errors.As(err, &exhausted) || len(exhausted.Attempts) != 2 {
+		t.Fatalf("Expected 2 attempts in error, got %v", err)
+	}
+}
+
+func TestSMSService_ProcessDebitedSMS_ChainExhausted(t *testing.T) {
+	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
+	publisher := newMockEventPublisher()
+	primary := &mockSMSProvider{providerName: "primary", sendError: errors.New("timeout")}
+	backup := &mockSMSProvider{providerName: "backup", sendError: errors.New("rejected")}
+	service := newTestService(repo, outbox, publisher, newFailoverTestProvider(nil, primary, backup))
+
+	repo.messages["test-sms-id"] = &sms.SMSMessage{
+		ID:       "test-sms-id",
+		UserID:   "user-123",
+		Receiver: "+989123456789",
+		Status:   sms.SMSStatusBillingRequested,
+	}
+
+	err := service.ProcessDebitedSMS(context.Background(), sms.SMSBillingCompleted{
+		SMSID:         "test-sms-id",
+		TransactionID: "txn-1",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	msg := repo.messages["test-sms-id"]
+	if msg.Status != sms.SMSStatusFailed || msg.FailureCode != sms.ProvidersExhausted {
+		t.Errorf("Expected failed with %s, got %s/%s", sms.ProvidersExhausted, msg.Status, msg.FailureCode)
+	}
+	if outbox.pending() != 1 {
+		t.Errorf("Expected one refund request, got %d", outbox.pending())
+	}
+}
+
+func TestSMSService_ProcessDebitedSMS_ChainExhaustedKeepsProviderCode(t *testing.T) {
+	repo := newMockSMSRepo()
+	primary := &mockSMSProvider{providerName: "primary", sendError: &sms.ProviderError{Provider: "primary", Code: sms.ProviderTimeout, Err: errors.New("timeout")}}
+	backup := &mockSMSProvider{providerName: "backup", sendError: &sms.ProviderError{Provider: "backup", Code: "MNO-21", Permanent: true, Err: errors.New("barred")}}
+	recorder := &mockAttemptRecorder{}
+	service := newTestService(repo, newMockOutboxRepo(), newMockEventPublisher(), newFailoverTestProvider(recorder, primary, backup))
+	repo.messages["sms-1"] = &sms.SMSMessage{ID: "sms-1", Receiver: "+989123456789", Status: sms.SMSStatusBillingRequested}
+
+	if err := service.ProcessDebitedSMS(context.Background(), sms.SMSBillingCompleted{SMSID: "sms-1", TransactionID: "txn-1"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if msg := repo.messages["sms-1"]; msg.FailureCode != "MNO-21" {
+		t.Errorf("Expected the last provider's code MNO-21, got %s", msg.FailureCode)
+	}
+	if len(recorder.attempts) != 2 || recorder.attempts[0].Code != sms.ProviderTimeout {
+		t.Errorf("Expected the attempts to record their codes, got %+v", recorder.attempts)
+	}
+
+	// a skipped provider does not hide the code of the one called before it
+	err := &sms.ProvidersExhaustedError{Attempts: []sms.DeliveryAttempt{
+		{Provider: "primary", Code: sms.ProviderRejected},
+		{Provider: "backup", Skipped: true},
+	}}
+	if code := err.FailureCode(); code != sms.ProviderRejected {
+		t.Errorf("Expected %s, got %s", sms.ProviderRejected, code)
+	}
+}
@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sms/internal/infra/external"
+	"sms/pkg/circuitbreaker"
+	"sms/pkg/health"
+	"testing"
+	"time"
+)
+
+func TestChecker_ReadyHandler(t *testing.T) {
+	hang := make(chan struct{})
+	defer close(hang)
+
+	checker := health.NewChecker(50*time.Millisecond).
+		Add("database", func(ctx context.Context) error { return nil }).
+		Add("rabbitmq", func(ctx context.Context) error { return errors.New("not connected") }).
+		// ignores its context, like a stuck driver call
+		Add("providers", func(ctx context.Context) error { <-hang; return nil })
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	checker.ReadyHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the probe to give up after its timeout, took %v", elapsed)
+	}
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", rec.Code)
+	}
+	var report health.Report
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if report.Status != health.StatusDown {
+		t.Errorf("Expected status down, got %s", report.Status)
+	}
+	if check := report.Checks["database"]; check.Status != health.StatusUp {
+		t.Errorf("Expected database up, got %+v", check)
+	}
+	if check := report.Checks["rabbitmq"]; check.Status != health.StatusDown || check.Error != "not connected" {
+		t.Errorf("Expected rabbitmq down with its error, got %+v", check)
+	}
+	if check := report.Checks["providers"]; check.Status != health.StatusDown {
+		t.Errorf("Expected the hung check to be down, got %+v", check)
+	}
+}
+
+func TestChecker_AllUp(t *testing.T) {
+	checker := health.NewChecker(time.Second).Add("database", func(ctx context.Context) error { return nil })
+
+	rec := httptest.NewRecorder()
+	checker.ReadyHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	health.LiveHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected liveness to answer 200, got %d", rec.Code)
+	}
+}
+
+func TestCheckGateways(t *testing.T) {
+	a := external.NamedProvider{Name: "gateway-a", Breaker: circuitbreaker.New(1, time.Minute)}
+	b := external.NamedProvider{Name: "gateway-b", Breaker: circuitbreaker.New(1, time.Minute)}
+	check := external.CheckGateways([]external.NamedProvider{a, b})
+	ctx := context.Background()
+
+	if err := external.CheckGateways(nil)(ctx); err != nil {
+		t.Errorf("Expected no gateways to be healthy, got %v", err)
+	}
+
+	a.Breaker.Failure()
+	if err := check(ctx); err != nil {
+		t.Errorf("Expected healthy while gateway-b is available, got %v", err)
+	}
+
+	b.Breaker.Failure()
+	if err := check(ctx); err == nil {
+		t.Error("Expected an error once every breaker is open")
+	}
+}
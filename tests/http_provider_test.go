@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sms/internal/domain/sms"
+	"sms/internal/infra/external"
+	"testing"
+	"time"
+)
+
+type fakeGateway struct {
+	server   *httptest.Server
+	lastAuth string
+	lastBody map[string]any
+	status   int
+	response string
+	delay    time.Duration
+}
+
+func newFakeGateway(t *testing.T) *fakeGateway {
+	gw := &fakeGateway{status: http.StatusOK, response: `{"status":"queued","id":"gw-1"}`}
+	gw.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gw.lastAuth = r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		gw.lastBody = nil
+		_ = json.Unmarshal(body, &gw.lastBody)
+
+		if gw.delay > 0 {
+			select {
+			case <-time.After(gw.delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.WriteHeader(gw.status)
+		_, _ = w.Write([]byte(gw.response))
+	}))
+	t.Cleanup(gw.server.Close)
+	return gw
+}
+
+func newTestHTTPProvider(t *testing.T, url string) *external.HTTPProvider {
+	provider, err := external.NewHTTPProvider(external.HTTPProviderConfig{
+		Name:         "test-gateway",
+		URL:          url,
+		Headers:      map[string]string{"Authorization": "Bearer secret"},
+		BodyTemplate: `{"to": {{json .Receiver}}, "text": {{json .Content}}, "ref": {{json .ID}}}`,
+		Timeout:      100 * time.Millisecond,
+		Response: external.HTTPResponseMapping{
+			SuccessField:   "status",
+			SuccessValue:   "queued",
+			MessageIDField: "id",
+			ErrorCodeField: "error.code",
+			ErrorCodes:     map[string]string{"1001": "InvalidReceiver"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error creating provider, got %v", err)
+	}
+	return provider
+}
+
+func sendTestHTTPSMS(provider *external.HTTPProvider) (string, error) {
+	_, name, err := sendTestHTTPMessage(provider)
+	return name, err
+}
+
+func sendTestHTTPMessage(provider *external.HTTPProvider) (*sms.SMSMessage, string, error) {
+	message := &sms.SMSMessage{
+		ID:       "sms-1",
+		Receiver: "+989123456789",
+		Content:  `Say "hi"`,
+	}
+	name, err := provider.SendSMS(context.Background(), message)
+	return message, name, err
+}
+
+func TestHTTPProvider_Success(t *testing.T) {
+	gw := newFakeGateway(t)
+	provider := newTestHTTPProvider(t, gw.server.URL)
+
+	message, name, err := sendTestHTTPMessage(provider)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if name != "test-gateway" {
+		t.Errorf("Expected provider name test-gateway, got %s", name)
+	}
+	if message.ProviderMessageID != "gw-1" {
+		t.Errorf("Expected provider message ID gw-1, got %q", message.ProviderMessageID)
+	}
+	if gw.lastAuth != "Bearer secret" {
+		t.Errorf("Expected auth header to be sent, got %q", gw.lastAuth)
+	}
+	if gw.lastBody["to"] != "+989123456789" || gw.lastBody["text"] != `Say "hi"` || gw.lastBody["ref"] != "sms-1" {
+		t.Errorf("Expected rendered body, got %v", gw.lastBody)
+	}
+}
+
+func TestHTTPProvider_FailureMapping(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		delay    time.Duration
+		code     string
+	}{
+		{"Client error", http.StatusBadRequest, `{"error":{"code":"9"}}`, 0, sms.ProviderRejected},
+		{"Client error with mapped code", http.StatusUnprocessableEntity, `{"error":{"code":1001}}`, 0, "InvalidReceiver"},
+		{"Server error", http.StatusBadGateway, `upstream down`, 0, sms.ProviderUnavailable},
+		{"Rate limited", http.StatusTooManyRequests, `slow down`, 0, sms.ProviderUnavailable},
+		{"Success status with failure body", http.StatusOK, `{"status":"rejected"}`, 0, sms.ProviderRejected},
+		{"Timeout", http.StatusOK, `{"status":"queued"}`, time.Second, sms.ProviderTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newFakeGateway(t)
+			gw.status, gw.response, gw.delay = tt.status, tt.response, tt.delay
+			provider := newTestHTTPProvider(t, gw.server.URL)
+
+			_, err := sendTestHTTPSMS(provider)
+			var providerErr *sms.ProviderError
+			if !errors.As(err, &providerErr) {
+				t.Fatalf("Expected ProviderError, got %v", err)
+			}
+			if providerErr.Code != tt.code {
+				t.Errorf("Expected failure code %s, got %s", tt.code, providerErr.Code)
+			}
+			if providerErr.Provider != "test-gateway" {
+				t.Errorf("Expected provider test-gateway, got %s", providerErr.Provider)
+			}
+			if transient := tt.code == sms.ProviderUnavailable || tt.code == sms.ProviderTimeout; sms.IsTransient(err) != transient {
+				t.Errorf("Expected transient %v for %s", transient, tt.code)
+			}
+		})
+	}
+}
+
+func TestHTTPProvider_Unreachable(t *testing.T) {
+	gw := newFakeGateway(t)
+	url := gw.server.URL
+	gw.server.Close()
+	provider := newTestHTTPProvider(t, url)
+
+	_, err := sendTestHTTPSMS(provider)
+	var providerErr *sms.ProviderError
+	if !errors.As(err, &providerErr) || providerErr.Code != sms.ProviderUnavailable {
+		t.Errorf("Expected %s, got %v", sms.ProviderUnavailable, err)
+	}
+}
+
+func TestHTTPProvider_CallerCancelled(t *testing.T) {
+	gw := newFakeGateway(t)
+	gw.delay = time.Second
+	provider := newTestHTTPProvider(t, gw.server.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	_, err := provider.SendSMS(ctx, &sms.SMSMessage{ID: "sms-1", Receiver: "+989123456789"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestSMSService_ProcessDebitedSMS_ProviderFailureCode(t *testing.T) {
+	gw := newFakeGateway(t)
+	gw.status, gw.response = http.StatusBadRequest, `{"error":{"code":"1001"}}`
+
+	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
+	service := newTestService(repo, outbox, newMockEventPublisher(), newTestHTTPProvider(t, gw.server.URL))
+	repo.messages["sms-1"] = &sms.SMSMessage{ID: "sms-1", Receiver: "+989123456789", Status: sms.SMSStatusBillingRequested}
+
+	if err := service.ProcessDebitedSMS(context.Background(), sms.SMSBillingCompleted{SMSID: "sms-1", TransactionID: "txn-1"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if msg := repo.messages["sms-1"]; msg.FailureCode != "InvalidReceiver" || msg.Provider != "test-gateway" {
+		t.Errorf("Expected InvalidReceiver from test-gateway, got %s from %s", msg.FailureCode, msg.Provider)
+	}
+}
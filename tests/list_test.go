@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sms/internal/api/dto"
+	handlers "sms/internal/api/handlers/http"
+	"sms/internal/domain/sms"
+	"sms/internal/infra/storage"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+const (
+	listUserA = "550e8400-e29b-41d4-a716-446655440000"
+	listUserB = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+)
+
+func TestCursor_RoundTrip(t *testing.T) {
+	cursor := sms.Cursor{CreatedAt: time.Date(2025, 1, 2, 3, 4, 5, 123456000, time.UTC), ID: "sms-1"}
+
+	parsed, err := sms.ParseCursor(cursor.Encode())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !parsed.CreatedAt.Equal(cursor.CreatedAt) || parsed.ID != cursor.ID {
+		t.Errorf("Expected %+v, got %+v", cursor, parsed)
+	}
+
+	for _, token := range []string{"", "not base64!", "bm8tc2VwYXJhdG9y"} {
+		if _, err := sms.ParseCursor(token); !errors.Is(err, sms.ErrInvalidCursor) {
+			t.Errorf("Expected ErrInvalidCursor for %q, got %v", token, err)
+		}
+	}
+}
+
+func listSMS(t *testing.T, app *fiber.App, query url.Values) (int, dto.ListSMSResponse) {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/v1/sms?"+query.Encode(), nil))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var list dto.ListSMSResponse
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+			t.Fatalf("Failed to decode list: %v", err)
+		}
+	}
+	return resp.StatusCode, list
+}
+
+func TestSMSHandler_ListSMS(t *testing.T) {
+	repo := newMockSMSRepo()
+	service := newTestService(repo, newMockOutboxRepo(), newMockEventPublisher(), newMockSMSProvider())
+	app := fiber.New()
+	app.Get("/api/v1/sms", handlers.NewSMSHandler(service).ListSMS)
+
+	base := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := range 5 {
+		// two messages share a timestamp, so the ID has to break the tie
+		createdAt := base.Add(time.Duration(min(i, 3)) * time.Minute)
+		repo.messages[fmt.Sprintf("sms-%d", i)] = &sms.SMSMessage{
+			ID: fmt.Sprintf("sms-%d", i), UserID: listUserA, Receiver: "+989123456789", Status: sms.SMSStatusSent, CreatedAt: createdAt,
+		}
+	}
+	repo.messages["sms-b"] = &sms.SMSMessage{ID: "sms-b", UserID: listUserB, Status: sms.SMSStatusFailed, CreatedAt: base}
+
+	query := url.Values{"user_id": {listUserA}, "limit": {"2"}, "with_total": {"true"}}
+	var ids []string
+	for page := 0; ; page++ {
+		status, list := listSMS(t, app, query)
+		if status != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", status)
+		}
+		if page == 0 && (list.Total == nil || *list.Total != 5) {
+			t.Errorf("Expected a total of 5, got %v", list.Total)
+		}
+		for _, item := range list.Items {
+			ids = append(ids, item.ID)
+		}
+		if list.NextCursor == "" {
+			break
+		}
+		query.Set("cursor", list.NextCursor)
+	}
+	if got := strings.Join(ids, ","); got != "sms-4,sms-3,sms-2,sms-1,sms-0" {
+		t.Errorf("Expected every message once, newest first, got %s", got)
+	}
+
+	status, list := listSMS(t, app, url.Values{"status": {"failed"}})
+	if status != http.StatusOK || len(list.Items) != 1 || list.Items[0].ID != "sms-b" {
+		t.Errorf("Expected only the failed SMS, got %d %+v", status, list.Items)
+	}
+	status, list = listSMS(t, app, url.Values{"receiver": {"09123456789"}, "created_from": {base.Add(time.Minute).Format(time.RFC3339)}})
+	if status != http.StatusOK || len(list.Items) != 4 {
+		t.Errorf("Expected 4 messages to the normalized receiver since the first minute, got %d %d", status, len(list.Items))
+	}
+
+	if status, _ := listSMS(t, app, url.Values{"status": {"lost"}, "limit": {"500"}}); status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for an unknown status and oversized limit, got %d", status)
+	}
+	if status, _ := listSMS(t, app, url.Values{"cursor": {"garbage"}}); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a bad cursor, got %d", status)
+	}
+}
+
+func TestSMSRepository_List_Query(t *testing.T) {
+	// DryRun builds the SQL without a database
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 port=1"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 gormlogger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var queries []string
+	capture := func(tx *gorm.DB) { queries = append(queries, tx.Statement.SQL.String()) }
+	if err := db.Callback().Query().After("gorm:query").Register("test:capture", capture); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	userID := listUserA
+	cursor := &sms.Cursor{CreatedAt: time.Now(), ID: "sms-1"}
+	_, err = storage.NewSMSRepository(db).List(context.Background(), sms.ListFilter{UserID: &userID}, sms.Page{Limit: 2, Cursor: cursor, WithTotal: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(queries) != 2 {
+		t.Fatalf("Expected a count and a page query, got %q", queries)
+	}
+	if count := queries[0]; !strings.Contains(count, "count(*)") || strings.Contains(count, "(created_at, id) <") {
+		t.Errorf("Expected the count to ignore the cursor, got %s", count)
+	}
+	page := queries[1]
+	for _, part := range []string{"user_id = $1", "(created_at, id) < ($2, $3)", "ORDER BY created_at DESC,id DESC", "LIMIT $4"} {
+		if !strings.Contains(page, part) {
+			t.Errorf("Expected %q in %s", part, page)
+		}
+	}
+}
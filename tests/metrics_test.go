@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sms/internal/domain/sms"
+	"sms/internal/infra/external"
+	"sms/pkg/metrics"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/adaptor/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// histogramCount returns how many observations the series of a histogram
+// with the given label values holds.
+func histogramCount(t *testing.T, name string, labels map[string]string) uint64 {
+	t.Helper()
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	series:
+		for _, metric := range family.GetMetric() {
+			for _, pair := range metric.GetLabel() {
+				if labels[pair.GetName()] != pair.GetValue() {
+					continue series
+				}
+			}
+			return metric.GetHistogram().GetSampleCount()
+		}
+	}
+	return 0
+}
+
+func TestMetricsMiddleware_LabelsByRoute(t *testing.T) {
+	app := fiber.New()
+	app.Use(metrics.Middleware())
+	app.Get("/api/v1/sms/:id", func(c *fiber.Ctx) error {
+		if c.Params("id") == "missing" {
+			return fiber.ErrNotFound
+		}
+		return c.SendStatus(http.StatusOK)
+	})
+
+	found := metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/api/v1/sms/:id", "200")
+	notFound := metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/api/v1/sms/:id", "404")
+	foundBefore, notFoundBefore := testutil.ToFloat64(found), testutil.ToFloat64(notFound)
+
+	for _, id := range []string{"sms-1", "sms-2", "missing"} {
+		if _, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/v1/sms/"+id, nil)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	if got := testutil.ToFloat64(found) - foundBefore; got != 2 {
+		t.Errorf("Expected 2 requests counted under the route, got %v", got)
+	}
+	if got := testutil.ToFloat64(notFound) - notFoundBefore; got != 1 {
+		t.Errorf("Expected the handler error counted as 404, got %v", got)
+	}
+}
+
+func TestMetricsHandler_ServesRegistry(t *testing.T) {
+	metrics.SMSCreated.Add(0)
+	app := fiber.New()
+	app.Get("/metrics", adaptor.HTTPHandler(metrics.Handler()))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "sms_created_total") {
+		t.Errorf("Expected the SMS counters to be exposed, got %d: %s", resp.StatusCode, body)
+	}
+}
+
+func TestInstrumentedProvider_ObservesLatency(t *testing.T) {
+	failing := newMockSMSProvider()
+	failing.sendError = &sms.ProviderError{Provider: "gateway-m", Code: sms.ProviderTimeout, Err: errors.New("timeout")}
+	provider := external.NewInstrumentedProvider("gateway-m", failing)
+
+	before := histogramCount(t, "sms_provider_request_duration_seconds", map[string]string{"provider": "gateway-m", "outcome": sms.ProviderTimeout})
+	_, _ = provider.SendSMS(context.Background(), &sms.SMSMessage{ID: "sms-1"})
+
+	after := histogramCount(t, "sms_provider_request_duration_seconds", map[string]string{"provider": "gateway-m", "outcome": sms.ProviderTimeout})
+	if after-before != 1 {
+		t.Errorf("Expected one observation labeled with the failure code, got %d", after-before)
+	}
+}
+
+func TestSMSService_StatusMetrics(t *testing.T) {
+	repo := newMockSMSRepo()
+	provider := newMockSMSProvider()
+	provider.sendError = &sms.ProviderError{Provider: "mock-provider", Code: sms.ProviderRejected, Permanent: true, Err: errors.New("bad receiver")}
+	service := newTestService(repo, newMockOutboxRepo(), newMockEventPublisher(), provider)
+	ctx := context.Background()
+
+	created := testutil.ToFloat64(metrics.SMSCreated)
+	failed := metrics.SMSFailed.WithLabelValues("mock-provider", string(sms.SMSStatusFailed), sms.ProviderRejected)
+	refunded := metrics.SMSRefunded.WithLabelValues("mock-provider", sms.ProviderRejected)
+	failedBefore, refundedBefore := testutil.ToFloat64(failed), testutil.ToFloat64(refunded)
+
+	message := &sms.SMSMessage{ID: "sms-1", UserID: "user-1", Content: "hi", Receiver: "+989123456789", Status: sms.SMSStatusPending}
+	if err := service.CreateAndBillSMS(ctx, message); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.SMSCreated) - created; got != 1 {
+		t.Errorf("Expected 1 created SMS, got %v", got)
+	}
+
+	if err := service.ProcessDebitedSMS(ctx, sms.SMSBillingCompleted{SMSID: "sms-1", TransactionID: "txn-1"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// a redelivered billing event is not counted again
+	if err := service.ProcessDebitedSMS(ctx, sms.SMSBillingCompleted{SMSID: "sms-1", TransactionID: "txn-1"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := testutil.ToFloat64(failed) - failedBefore; got != 1 {
+		t.Errorf("Expected 1 failed SMS with code %s, got %v", sms.ProviderRejected, got)
+	}
+	if got := testutil.ToFloat64(refunded) - refundedBefore; got != 1 {
+		t.Errorf("Expected 1 refund with code %s, got %v", sms.ProviderRejected, got)
+	}
+}
+
+func TestSMSService_DeliveryReceiptMetrics(t *testing.T) {
+	repo := newMockSMSRepo()
+	service := newTestService(repo, newMockOutboxRepo(), newMockEventPublisher(), newMockSMSProvider())
+	newSentTestSMS(repo)
+
+	delivered := metrics.SMSDelivered.WithLabelValues("smpp-gateway")
+	before := testutil.ToFloat64(delivered)
+
+	receipt := sms.DeliveryReceipt{Provider: "smpp-gateway", MessageID: "smsc-1", Status: sms.SMSStatusDelivered}
+	for range 2 {
+		if err := service.ProcessDeliveryReceipt(context.Background(), receipt); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if got := testutil.ToFloat64(delivered) - before; got != 1 {
+		t.Errorf("Expected a repeated receipt to be counted once, got %v", got)
+	}
+}
@@ -0,0 +1,496 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sms/config"
+	"sms/internal/domain/sms"
+	"sms/internal/infra/messaging"
+	"sms/pkg/logger"
+	"sms/pkg/rabbit"
+	"sms/pkg/rabbit/rabbittest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func TestNewRabbitConn_Unreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	conn, err := rabbit.NewRabbitConn("amqp://guest:guest@"+addr+"/", rabbit.Options{})
+	if err == nil || conn != nil {
+		t.Fatalf("Expected an error for an unreachable broker, got %v", conn)
+	}
+}
+
+func TestReadConfig_ReconnectDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("rabbitmq:\n  reconnect:\n    publish_mode: \"fail\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.ReadConfig(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	reconnect := cfg.RabbitMQ.Reconnect
+	if reconnect.InitialDelay != time.Second || reconnect.MaxDelay != 30*time.Second || reconnect.PublishTimeout != 5*time.Second {
+		t.Errorf("Unexpected reconnect defaults %+v", reconnect)
+	}
+	if reconnect.PublishMode != "fail" {
+		t.Errorf("Expected the configured publish mode to be kept, got %q", reconnect.PublishMode)
+	}
+}
+
+func TestReturnedError(t *testing.T) {
+	err := fmt.Errorf("publish billing request: %w", &rabbit.ReturnedError{Exchange: "amq.topic", RoutingKey: "billing.debit.request", Code: 312, Text: "NO_ROUTE"})
+
+	if !errors.Is(err, rabbit.ErrUnroutable) {
+		t.Errorf("Expected ErrUnroutable, got %v", err)
+	}
+	if errors.Is(err, rabbit.ErrNacked) {
+		t.Errorf("Expected a return not to count as a nack")
+	}
+	var returned *rabbit.ReturnedError
+	if !errors.As(err, &returned) || returned.RoutingKey != "billing.debit.request" {
+		t.Errorf("Expected the returned routing key, got %v", err)
+	}
+}
+
+func newTestRabbitConn(t *testing.T, dial func(uri string) (rabbit.Connection, error), modify func(*rabbit.Options)) *rabbit.RabbitConn {
+	t.Helper()
+	opts := rabbit.Options{
+		ReconnectDelay:    10 * time.Millisecond,
+		MaxReconnectDelay: 40 * time.Millisecond,
+		PublishTimeout:    time.Second,
+		Dial:              dial,
+		Logger:            logger.NewLogger("info"),
+	}
+	if modify != nil {
+		modify(&opts)
+	}
+	conn, err := rabbit.NewRabbitConn("amqp://test/", opts)
+	if err != nil {
+		t.Fatalf("Expected to connect, got %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func waitConnected(t *testing.T, conn *rabbit.RabbitConn) {
+	t.Helper()
+	waitFor(t, "the connection", func() bool { return conn.Check(context.Background()) == nil })
+}
+
+func waitDisconnected(t *testing.T, conn *rabbit.RabbitConn) {
+	t.Helper()
+	waitFor(t, "the connection to drop", func() bool {
+		return errors.Is(conn.Check(context.Background()), rabbit.ErrDisconnected)
+	})
+}
+
+func TestRabbitConn_ReconnectBackoff(t *testing.T) {
+	broker := rabbittest.NewBroker()
+	conn := newTestRabbitConn(t, broker.Dial, nil)
+
+	broker.RefuseDials(3)
+	dropped := time.Now()
+	broker.DropConnections()
+	waitDisconnected(t, conn)
+	waitConnected(t, conn)
+
+	dials := broker.Dials()
+	if len(dials) != 5 {
+		t.Fatalf("Expected the first dial, 3 refused ones and a successful one, got %d", len(dials))
+	}
+	// the delay doubles after every refused dial up to the maximum
+	previous := dropped
+	for i, minimum := range []time.Duration{10, 20, 40, 40} {
+		if gap := dials[i+1].Sub(previous); gap < minimum*time.Millisecond {
+			t.Errorf("Expected dial %d at least %dms after the previous one, got %s", i+2, minimum, gap)
+		}
+		previous = dials[i+1]
+	}
+}
+
+func TestRabbitConn_ReplaysTopology(t *testing.T) {
+	var current atomic.Pointer[rabbittest.Broker]
+	current.Store(rabbittest.NewBroker())
+	first := current.Load()
+	conn := newTestRabbitConn(t, func(uri string) (rabbit.Connection, error) { return current.Load().Dial(uri) }, nil)
+
+	if err := conn.DeclareBindQueue("sms.test", rabbit.Exchange, "sms.test.#"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := conn.DeclareDelayQueue("sms.test.delay", time.Minute, rabbit.Exchange, "sms.test.retry"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// the connection comes back to a broker that lost every queue
+	second := rabbittest.NewBroker()
+	current.Store(second)
+	first.DropConnections()
+	waitDisconnected(t, conn)
+	waitConnected(t, conn)
+
+	if !second.HasQueue("sms.test") || !second.HasQueue("sms.test.delay") {
+		t.Fatalf("Expected the queues to be declared again")
+	}
+	if err := rabbit.NewPublisher(conn).Publish(context.Background(), "sms.test.created", rabbit.Exchange, "hi"); err != nil {
+		t.Errorf("Expected the binding to be declared again, got %v", err)
+	}
+	if messages := second.Messages("sms.test"); len(messages) != 1 {
+		t.Errorf("Expected 1 routed message, got %d", len(messages))
+	}
+}
+
+func TestConsumer_ResubscribesAfterReconnect(t *testing.T) {
+	broker := rabbittest.NewBroker()
+	conn := newTestRabbitConn(t, broker.Dial, nil)
+	if err := conn.DeclareBindQueue("sms.test", rabbit.Exchange, "sms.test"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var handled atomic.Int32
+	consumer := rabbit.NewConsumer(conn)
+	consumer.Subscribe("sms.test", func(ctx context.Context, body []byte) error {
+		handled.Add(1)
+		return nil
+	})
+	if err := consumer.StartConsume(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() { _ = consumer.Shutdown(context.Background()) })
+
+	broker.Publish(rabbit.Exchange, "sms.test", amqp.Publishing{Body: []byte("1")})
+	waitFor(t, "the first message", func() bool { return handled.Load() == 1 })
+
+	broker.DropConnections()
+	waitDisconnected(t, conn)
+	broker.Publish(rabbit.Exchange, "sms.test", amqp.Publishing{Body: []byte("2")})
+	waitFor(t, "the message sent while disconnected", func() bool { return handled.Load() == 2 })
+	waitFor(t, "the ack", func() bool { return broker.Unacked() == 0 })
+}
+
+// startTestConsumer consumes sms.test with opts until the test ends.
+func startTestConsumer(t *testing.T, broker *rabbittest.Broker, opts rabbit.QueueOptions, handler rabbit.Handler) *rabbit.Consumer {
+	t.Helper()
+	conn := newTestRabbitConn(t, broker.Dial, nil)
+	if err := conn.DeclareBindQueue("sms.test", rabbit.Exchange, "sms.test"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	consumer := rabbit.NewConsumer(conn)
+	consumer.SubscribeWithOptions("sms.test", opts, handler)
+	if err := consumer.StartConsume(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() { _ = consumer.Shutdown(context.Background()) })
+	return consumer
+}
+
+func TestConsumer_WorkerPool(t *testing.T) {
+	broker := rabbittest.NewBroker()
+	release := make(chan struct{})
+	var inFlight, peak, handled atomic.Int32
+	startTestConsumer(t, broker, rabbit.QueueOptions{Workers: 3, Prefetch: 3}, func(ctx context.Context, body []byte) error {
+		n := inFlight.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		<-release
+		inFlight.Add(-1)
+		handled.Add(1)
+		return nil
+	})
+
+	for i := 0; i < 9; i++ {
+		broker.Publish(rabbit.Exchange, "sms.test", amqp.Publishing{Body: []byte(strconv.Itoa(i))})
+	}
+	waitFor(t, "every worker to be busy", func() bool { return inFlight.Load() == 3 })
+	time.Sleep(20 * time.Millisecond)
+	if n := inFlight.Load(); n != 3 {
+		t.Errorf("Expected 3 messages in flight, got %d", n)
+	}
+	if n := broker.Unacked(); n != 3 {
+		t.Errorf("Expected the prefetch to hold back the rest, got %d unacked", n)
+	}
+
+	close(release)
+	waitFor(t, "every message", func() bool { return handled.Load() == 9 })
+	waitFor(t, "the acks", func() bool { return broker.Unacked() == 0 })
+	if p := peak.Load(); p != 3 {
+		t.Errorf("Expected at most 3 messages handled at once, got %d", p)
+	}
+}
+
+func TestConsumer_AcksUnderConcurrency(t *testing.T) {
+	broker := rabbittest.NewBroker()
+	var (
+		handled  atomic.Int32
+		attempts sync.Map
+	)
+	opts := rabbit.QueueOptions{MaxRedeliveries: 1, RedeliveryDelay: 10 * time.Millisecond, Workers: 8, Prefetch: 16}
+	startTestConsumer(t, broker, opts, func(ctx context.Context, body []byte) error {
+		n, _ := strconv.Atoi(string(body))
+		count, _ := attempts.LoadOrStore(n, new(atomic.Int32))
+		attempt := count.(*atomic.Int32).Add(1)
+		switch {
+		case n%3 == 0:
+			return fmt.Errorf("%w: %d", rabbit.ErrMalformedMessage, n)
+		case n%3 == 1 && attempt == 1:
+			return errors.New("provider down")
+		}
+		handled.Add(1)
+		return nil
+	})
+
+	const total = 90
+	for i := 0; i < total; i++ {
+		broker.Publish(rabbit.Exchange, "sms.test", amqp.Publishing{Body: []byte(strconv.Itoa(i))})
+	}
+	waitFor(t, "the handled messages", func() bool { return handled.Load() == total*2/3 })
+	waitFor(t, "the malformed messages to be dead-lettered", func() bool {
+		return len(broker.Messages(rabbit.DLQName("sms.test"))) == total/3
+	})
+	waitFor(t, "the acks", func() bool { return broker.Unacked() == 0 })
+
+	if errs := broker.Errors(); len(errs) != 0 {
+		t.Errorf("Expected every delivery to be acked once, got %v", errs)
+	}
+	if n := len(broker.Messages("sms.test")); n != 0 {
+		t.Errorf("Expected the queue to be empty, got %d messages", n)
+	}
+}
+
+func TestConsumer_DrainTimeout(t *testing.T) {
+	broker := rabbittest.NewBroker()
+	release := make(chan struct{})
+	var started, handled atomic.Int32
+	consumer := startTestConsumer(t, broker, rabbit.QueueOptions{Workers: 1}, func(ctx context.Context, body []byte) error {
+		started.Add(1)
+		<-release
+		handled.Add(1)
+		return nil
+	})
+
+	broker.Publish(rabbit.Exchange, "sms.test", amqp.Publishing{Body: []byte("1")})
+	waitFor(t, "the handler", func() bool { return started.Load() == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := consumer.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the drain to time out, got %v", err)
+	}
+
+	// a stopped consumer takes no new messages but still acks the ones in flight
+	broker.Publish(rabbit.Exchange, "sms.test", amqp.Publishing{Body: []byte("2")})
+	close(release)
+	if err := consumer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Expected the drain to finish, got %v", err)
+	}
+	if n := handled.Load(); n != 1 {
+		t.Errorf("Expected only the message in flight to be handled, got %d", n)
+	}
+	if n := broker.Unacked(); n != 0 {
+		t.Errorf("Expected the message in flight to be acked, got %d unacked", n)
+	}
+	if n := len(broker.Messages("sms.test")); n != 1 {
+		t.Errorf("Expected the new message to stay queued, got %d", n)
+	}
+}
+
+func TestRabbitConn_PublishWhileDisconnected(t *testing.T) {
+	t.Run("Fail", func(t *testing.T) {
+		broker := rabbittest.NewBroker()
+		conn := newTestRabbitConn(t, broker.Dial, func(opts *rabbit.Options) { opts.ReconnectDelay = time.Hour })
+		broker.DropConnections()
+		waitDisconnected(t, conn)
+
+		err := rabbit.NewPublisher(conn).Publish(context.Background(), "sms.test", rabbit.Exchange, "hi")
+		if !errors.Is(err, rabbit.ErrDisconnected) {
+			t.Errorf("Expected ErrDisconnected, got %v", err)
+		}
+	})
+
+	t.Run("Block", func(t *testing.T) {
+		broker := rabbittest.NewBroker()
+		conn := newTestRabbitConn(t, broker.Dial, func(opts *rabbit.Options) { opts.BlockPublish = true })
+		if err := conn.DeclareBindQueue("sms.test", rabbit.Exchange, "sms.test"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		publisher := rabbit.NewPublisher(conn)
+
+		broker.RefuseDials(1000)
+		broker.DropConnections()
+		waitDisconnected(t, conn)
+
+		// gives up once its context ends
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+		defer cancel()
+		if err := publisher.Publish(ctx, "sms.test", rabbit.Exchange, "hi"); !errors.Is(err, rabbit.ErrDisconnected) {
+			t.Errorf("Expected ErrDisconnected after the deadline, got %v", err)
+		}
+
+		// otherwise waits for the connection to come back
+		published := make(chan error, 1)
+		go func() { published <- publisher.Publish(context.Background(), "sms.test", rabbit.Exchange, "hi") }()
+		time.Sleep(20 * time.Millisecond)
+		broker.RefuseDials(0)
+		if err := <-published; err != nil {
+			t.Fatalf("Expected the publish to wait for the connection, got %v", err)
+		}
+		if messages := broker.Messages("sms.test"); len(messages) != 1 {
+			t.Errorf("Expected 1 message once reconnected, got %d", len(messages))
+		}
+	})
+}
+
+func TestPublisher_Confirms(t *testing.T) {
+	broker := rabbittest.NewBroker()
+	conn := newTestRabbitConn(t, broker.Dial, nil)
+	if err := conn.DeclareBindQueue("sms.test", rabbit.Exchange, "sms.test"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	publisher := rabbit.NewPublisher(conn)
+	ctx := logger.ContextWithTraceID(context.Background(), "trace-1")
+
+	t.Run("Ack", func(t *testing.T) {
+		if err := publisher.Publish(ctx, "sms.test", rabbit.Exchange, "hi"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		messages := broker.Messages("sms.test")
+		if len(messages) != 1 || messages[0].CorrelationId != "trace-1" || messages[0].MessageId != "" {
+			t.Errorf("Expected the message with its own properties, got %+v", messages)
+		}
+	})
+
+	t.Run("Nack", func(t *testing.T) {
+		broker.SetNack(true)
+		defer broker.SetNack(false)
+		if err := publisher.Publish(ctx, "sms.test", rabbit.Exchange, "hi"); !errors.Is(err, rabbit.ErrNacked) {
+			t.Errorf("Expected ErrNacked, got %v", err)
+		}
+	})
+
+	t.Run("Return then ack", func(t *testing.T) {
+		err := publisher.Publish(ctx, "sms.unbound", rabbit.Exchange, "hi")
+		var returned *rabbit.ReturnedError
+		if !errors.As(err, &returned) || returned.RoutingKey != "sms.unbound" {
+			t.Fatalf("Expected the message to be returned, got %v", err)
+		}
+		// the return belongs to that message alone
+		if err := publisher.Publish(ctx, "sms.test", rabbit.Exchange, "hi"); err != nil {
+			t.Errorf("Expected the next message to be confirmed, got %v", err)
+		}
+	})
+
+	t.Run("Concurrent returns", func(t *testing.T) {
+		results := make([]error, 20)
+		var wg sync.WaitGroup
+		for i := range results {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				key := "sms.test"
+				if i%2 == 1 {
+					key = "sms.unbound"
+				}
+				results[i] = publisher.Publish(ctx, key, rabbit.Exchange, i)
+			}()
+		}
+		wg.Wait()
+		for i, err := range results {
+			if unroutable := errors.Is(err, rabbit.ErrUnroutable); unroutable != (i%2 == 1) || (!unroutable && err != nil) {
+				t.Errorf("Unexpected result for publish %d: %v", i, err)
+			}
+		}
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		broker.HoldConfirms(true)
+		defer broker.HoldConfirms(false)
+		deadline, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if err := publisher.Publish(deadline, "sms.test", rabbit.Exchange, "hi"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected the wait for the confirm to time out, got %v", err)
+		}
+	})
+
+	t.Run("Channel closed", func(t *testing.T) {
+		broker.HoldConfirms(true)
+		defer broker.HoldConfirms(false)
+		queued := len(broker.Messages("sms.test"))
+		published := make(chan error, 1)
+		go func() { published <- publisher.Publish(ctx, "sms.test", rabbit.Exchange, "hi") }()
+		waitFor(t, "the publish", func() bool { return len(broker.Messages("sms.test")) > queued })
+		broker.DropConnections()
+		if err := <-published; !errors.Is(err, rabbit.ErrDisconnected) {
+			t.Errorf("Expected ErrDisconnected for an unconfirmed publish, got %v", err)
+		}
+	})
+}
+
+func TestSMSPublisher_RejectedEvents(t *testing.T) {
+	event := sms.RequestSMSBilling{SMSID: "sms-1", Amount: 1}
+
+	t.Run("Unroutable", func(t *testing.T) {
+		broker := rabbittest.NewBroker()
+		publisher := messaging.NewSMSPublisher(newTestRabbitConn(t, broker.Dial, nil), logger.NewLogger("info"))
+		err := publisher.PublishEvent(context.Background(), event)
+		if !errors.Is(err, sms.ErrEventRejected) || !errors.Is(err, rabbit.ErrUnroutable) {
+			t.Errorf("Expected a rejected unroutable event, got %v", err)
+		}
+	})
+
+	t.Run("Nacked", func(t *testing.T) {
+		broker := rabbittest.NewBroker()
+		conn := newTestRabbitConn(t, broker.Dial, nil)
+		if err := conn.DeclareBindQueue("sms.test", rabbit.Exchange, rabbit.BillingRequestedRoutingKey); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		broker.SetNack(true)
+		err := messaging.NewSMSPublisher(conn, logger.NewLogger("info")).PublishEvent(context.Background(), event)
+		if !errors.Is(err, sms.ErrEventRejected) || !errors.Is(err, rabbit.ErrNacked) {
+			t.Errorf("Expected a rejected nacked event, got %v", err)
+		}
+	})
+
+	t.Run("Disconnected", func(t *testing.T) {
+		broker := rabbittest.NewBroker()
+		conn := newTestRabbitConn(t, broker.Dial, func(opts *rabbit.Options) { opts.ReconnectDelay = time.Hour })
+		broker.DropConnections()
+		waitDisconnected(t, conn)
+		err := messaging.NewSMSPublisher(conn, logger.NewLogger("info")).PublishEvent(context.Background(), event)
+		if err == nil || errors.Is(err, sms.ErrEventRejected) {
+			t.Errorf("Expected a retryable error, got %v", err)
+		}
+	})
+}
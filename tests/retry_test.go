@@ -0,0 +1,178 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sms/internal/domain/sms"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = sms.RetryPolicy{
+	MaxAttempts:  3,
+	InitialDelay: 10 * time.Second,
+	Multiplier:   2,
+	MaxDelay:     time.Minute,
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	policy := sms.RetryPolicy{MaxAttempts: 6, InitialDelay: 10 * time.Second, Multiplier: 2, MaxDelay: 45 * time.Second}
+
+	expected := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 45 * time.Second, 45 * time.Second}
+	for i, delay := range expected {
+		if got := policy.Delay(i + 1); got != delay {
+			t.Errorf("Expected delay %v after %d attempts, got %v", delay, i+1, got)
+		}
+	}
+
+	delays := policy.Delays()
+	if len(delays) != 4 || delays[3] != 45*time.Second {
+		t.Errorf("Expected 4 distinct delays ending at the cap, got %v", delays)
+	}
+	if policy.ShouldRetry(6) || !policy.ShouldRetry(5) {
+		t.Error("Expected retries up to 6 attempts in total")
+	}
+	if delays := (sms.RetryPolicy{MaxAttempts: 1, InitialDelay: time.Second}).Delays(); len(delays) != 0 {
+		t.Errorf("Expected no delays without retries, got %v", delays)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"Timeout", &sms.ProviderError{Code: sms.ProviderTimeout}, true},
+		{"Rejected", &sms.ProviderError{Code: sms.ProviderRejected, Permanent: true}, false},
+		{"Mapped rejection", &sms.ProviderError{Code: "InvalidReceiver", Permanent: true}, false},
+		{"No route", sms.ErrNoProviderRoute, false},
+		{"Unclassified", errors.New("network error"), true},
+		{"Chain with a transient failure", &sms.ProvidersExhaustedError{Attempts: []sms.DeliveryAttempt{{Permanent: true}, {Permanent: false}}}, true},
+		{"Chain rejecting everywhere", &sms.ProvidersExhaustedError{Attempts: []sms.DeliveryAttempt{{Permanent: true}, {Permanent: true}}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sms.IsTransient(tt.err); got != tt.transient {
+				t.Errorf("Expected transient %v, got %v", tt.transient, got)
+			}
+		})
+	}
+}
+
+func decodeOutboxEvents(t *testing.T, outbox *mockOutboxRepo, eventType sms.EventType) []sms.DomainEvent {
+	t.Helper()
+	var events []sms.DomainEvent
+	for _, msg := range outbox.messages {
+		if msg.EventType != eventType {
+			continue
+		}
+		event, err := sms.DecodeEvent(msg.EventType, msg.Payload)
+		if err != nil {
+			t.Fatalf("Failed to decode outbox event: %v", err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestSMSService_TransientFailureSchedulesRetry(t *testing.T) {
+	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
+	provider := newMockSMSProvider()
+	provider.sendError = &sms.ProviderError{Provider: "mock-provider", Code: sms.ProviderTimeout, Err: errors.New("timeout")}
+	service := newTestService(repo, outbox, newMockEventPublisher(), provider).WithRetryPolicy(testRetryPolicy)
+	repo.messages["sms-1"] = &sms.SMSMessage{ID: "sms-1", Receiver: "+989123456789", Amount: 3, Status: sms.SMSStatusBillingRequested}
+	ctx := context.Background()
+
+	if err := service.ProcessDebitedSMS(ctx, sms.SMSBillingCompleted{SMSID: "sms-1", TransactionID: "txn-1"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	message := repo.messages["sms-1"]
+	if message.Status != sms.SMSStatusRetryScheduled || message.FailureCode != sms.ProviderTimeout {
+		t.Fatalf("Expected retry_scheduled after a timeout, got %s %q", message.Status, message.FailureCode)
+	}
+	if refunds := decodeOutboxEvents(t, outbox, sms.EventTypeBillingRefunded); len(refunds) != 0 {
+		t.Fatalf("Expected no refund before retries are exhausted, got %d", len(refunds))
+	}
+	retries := decodeOutboxEvents(t, outbox, sms.EventTypeDeliveryRetry)
+	if len(retries) != 1 {
+		t.Fatalf("Expected 1 retry event, got %d", len(retries))
+	}
+	retry := retries[0].(sms.SMSDeliveryRetry)
+	if retry.Attempt != 2 || retry.Delay != 10*time.Second || retry.TransactionID != "txn-1" {
+		t.Errorf("Unexpected retry event %+v", retry)
+	}
+
+	// second attempt fails as well and is retried with a longer delay
+	if err := service.RetrySMSDelivery(ctx, retry); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	retries = decodeOutboxEvents(t, outbox, sms.EventTypeDeliveryRetry)
+	if len(retries) != 2 || retries[1].(sms.SMSDeliveryRetry).Delay != 20*time.Second {
+		t.Fatalf("Expected a second retry after 20s, got %+v", retries)
+	}
+
+	// the last attempt exhausts the policy and refunds the user
+	if err := service.RetrySMSDelivery(ctx, retries[1].(sms.SMSDeliveryRetry)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if message = repo.messages["sms-1"]; message.Status != sms.SMSStatusFailed {
+		t.Errorf("Expected failed after %d attempts, got %s", testRetryPolicy.MaxAttempts, message.Status)
+	}
+	if provider.calls != 3 {
+		t.Errorf("Expected 3 provider calls, got %d", provider.calls)
+	}
+	refunds := decodeOutboxEvents(t, outbox, sms.EventTypeBillingRefunded)
+	if len(refunds) != 1 || refunds[0].(sms.RequestBillingRefund).Amount != 3 {
+		t.Errorf("Expected a single refund of 3, got %+v", refunds)
+	}
+}
+
+func TestSMSService_RetrySucceeds(t *testing.T) {
+	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
+	provider := newMockSMSProvider()
+	service := newTestService(repo, outbox, newMockEventPublisher(), provider).WithRetryPolicy(testRetryPolicy)
+	repo.messages["sms-1"] = &sms.SMSMessage{ID: "sms-1", Status: sms.SMSStatusRetryScheduled, FailureCode: sms.ProviderTimeout}
+
+	retry := sms.SMSDeliveryRetry{SMSID: "sms-1", TransactionID: "txn-1", Attempt: 2}
+	if err := service.RetrySMSDelivery(context.Background(), retry); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	message := repo.messages["sms-1"]
+	if message.Status != sms.SMSStatusSent || message.FailureCode != "" {
+		t.Errorf("Expected sent without failure code, got %s %q", message.Status, message.FailureCode)
+	}
+
+	// a redelivered retry event does not send the SMS again
+	if err := service.RetrySMSDelivery(context.Background(), retry); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if provider.calls != 1 {
+		t.Errorf("Expected 1 provider call, got %d", provider.calls)
+	}
+}
+
+func TestSMSService_PermanentFailureIsNotRetried(t *testing.T) {
+	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
+	provider := newMockSMSProvider()
+	provider.sendError = &sms.ProviderError{Provider: "mock-provider", Code: sms.ProviderRejected, Permanent: true, Err: errors.New("bad receiver")}
+	service := newTestService(repo, outbox, newMockEventPublisher(), provider).WithRetryPolicy(testRetryPolicy)
+	repo.messages["sms-1"] = &sms.SMSMessage{ID: "sms-1", Status: sms.SMSStatusBillingRequested}
+
+	if err := service.ProcessDebitedSMS(context.Background(), sms.SMSBillingCompleted{SMSID: "sms-1", TransactionID: "txn-1"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if status := repo.messages["sms-1"].Status; status != sms.SMSStatusFailed {
+		t.Errorf("Expected failed, got %s", status)
+	}
+	if retries := decodeOutboxEvents(t, outbox, sms.EventTypeDeliveryRetry); len(retries) != 0 {
+		t.Errorf("Expected no retry for a permanent failure, got %d", len(retries))
+	}
+	if refunds := decodeOutboxEvents(t, outbox, sms.EventTypeBillingRefunded); len(refunds) != 1 {
+		t.Errorf("Expected an immediate refund, got %d", len(refunds))
+	}
+}
@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sms/internal/domain/sms"
+	"sms/internal/infra/external"
+	"testing"
+)
+
+func newIranRouter(fallback sms.SMSProvider) (*external.PrefixRouter, map[string]*mockSMSProvider) {
+	providers := map[string]*mockSMSProvider{
+		"mci":      {providerName: "mci"},
+		"irancell": {providerName: "irancell"},
+		"rightel":  {providerName: "rightel"},
+		"mci-vip":  {providerName: "mci-vip"},
+	}
+	router := external.NewPrefixRouter([]external.Route{
+		{Name: "mci", Prefixes: []string{"+9891", "+9899"}, Provider: providers["mci"]},
+		{Name: "irancell", Prefixes: []string{"+9893", "+9890"}, Provider: providers["irancell"]},
+		{Name: "rightel", Prefixes: []string{"+9892"}, Provider: providers["rightel"]},
+		{Name: "mci-vip", Prefixes: []string{"+989121"}, Provider: providers["mci-vip"]},
+	}, fallback)
+	return router, providers
+}
+
+func TestPrefixRouter_Route(t *testing.T) {
+	router, _ := newIranRouter(&mockSMSProvider{providerName: "international"})
+
+	tests := []struct {
+		receiver string
+		route    string
+	}{
+		{"+989101234567", "mci"},
+		{"+989901234567", "mci"},
+		{"+989351234567", "irancell"},
+		{"+989011234567", "irancell"},
+		{"+989211234567", "rightel"},
+		{"+989121234567", "mci-vip"},
+		{"989121234567", "mci-vip"},
+		{"+14155550100", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.receiver, func(t *testing.T) {
+			route, provider := router.Route(tt.receiver)
+			if route != tt.route {
+				t.Errorf("Expected route %q, got %q", tt.route, route)
+			}
+			if provider == nil {
+				t.Error("Expected a provider")
+			}
+		})
+	}
+}
+
+func TestPrefixRouter_SendSMS(t *testing.T) {
+	fallback := &mockSMSProvider{providerName: "international"}
+	router, providers := newIranRouter(fallback)
+	ctx := context.Background()
+
+	name, err := router.SendSMS(ctx, &sms.SMSMessage{Receiver: "+989351234567"})
+	if err != nil || name != "irancell" {
+		t.Errorf("Expected irancell, got %s (%v)", name, err)
+	}
+	if providers["irancell"].calls != 1 || providers["mci"].calls != 0 {
+		t.Error("Expected only the irancell provider to be called")
+	}
+
+	name, err = router.SendSMS(ctx, &sms.SMSMessage{Receiver: "+447700900123"})
+	if err != nil || name != "international" {
+		t.Errorf("Expected fallback provider, got %s (%v)", name, err)
+	}
+}
+
+func TestPrefixRouter_NoFallback(t *testing.T) {
+	router, _ := newIranRouter(nil)
+
+	_, err := router.SendSMS(context.Background(), &sms.SMSMessage{Receiver: "+447700900123"})
+	if !errors.Is(err, sms.ErrNoProviderRoute) {
+		t.Errorf("Expected ErrNoProviderRoute, got %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sms/internal/api/dto"
+	handlers "sms/internal/api/handlers/http"
+	"sms/internal/domain/sms"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func newScheduledSMS(id string, sendAt time.Time) *sms.SMSMessage {
+	return &sms.SMSMessage{
+		ID:       id,
+		UserID:   listUserA,
+		Content:  "Meeting at 10",
+		Receiver: "+989123456789",
+		Status:   sms.SMSStatusPending,
+		SendAt:   sendAt,
+	}
+}
+
+func TestSMSService_ScheduledSMS_BilledOnceDue(t *testing.T) {
+	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
+	service := newTestService(repo, outbox, newMockEventPublisher(), newMockSMSProvider())
+	ctx := context.Background()
+
+	later := newScheduledSMS("sms-later", time.Now().Add(time.Hour))
+	if err := service.CreateAndBillSMS(ctx, later); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if later.Status != sms.SMSStatusScheduled || later.Amount != 1 {
+		t.Errorf("Expected a priced scheduled SMS, got %s with amount %d", later.Status, later.Amount)
+	}
+	if len(outbox.messages) != 0 {
+		t.Fatalf("Expected no billing request before the SMS is due, got %d", len(outbox.messages))
+	}
+
+	// a send time that has passed is sent at once
+	past := newScheduledSMS("sms-past", time.Now().Add(-time.Minute))
+	if err := service.CreateAndBillSMS(ctx, past); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if past.Status != sms.SMSStatusBillingRequested || len(outbox.messages) != 1 {
+		t.Errorf("Expected billing requested at once, got %s with %d events", past.Status, len(outbox.messages))
+	}
+
+	if released, err := service.ProcessScheduledSMS(ctx, 10); released != 0 || err != nil {
+		t.Errorf("Expected nothing due, got %d %v", released, err)
+	}
+
+	// three SMS fall due, released two at a time
+	for i := 1; i <= 3; i++ {
+		msg := newScheduledSMS(fmt.Sprintf("sms-due-%d", i), time.Now().Add(time.Hour))
+		if err := service.CreateAndBillSMS(ctx, msg); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		repo.messages[msg.ID].SendAt = time.Now().Add(-time.Duration(i) * time.Second)
+	}
+	if released, err := service.ProcessScheduledSMS(ctx, 2); released != 2 || err != nil {
+		t.Fatalf("Expected 2 SMS released, got %d %v", released, err)
+	}
+	if repo.messages["sms-due-3"].Status != sms.SMSStatusBillingRequested {
+		t.Errorf("Expected the SMS due first to be released first")
+	}
+	if released, err := service.ProcessScheduledSMS(ctx, 2); released != 1 || err != nil {
+		t.Fatalf("Expected 1 SMS released, got %d %v", released, err)
+	}
+
+	billed := make(map[string]int64)
+	for _, msg := range outbox.messages {
+		if msg.EventType != sms.EventTypeBillingRequested {
+			continue
+		}
+		var event sms.RequestSMSBilling
+		if err := json.Unmarshal(msg.Payload, &event); err != nil {
+			t.Fatalf("Failed to decode billing request: %v", err)
+		}
+		billed[event.SMSID] = event.Amount
+	}
+	if len(billed) != 4 || billed["sms-due-1"] != 1 {
+		t.Errorf("Expected billing requested for the past and the due SMS, got %v", billed)
+	}
+	if repo.messages["sms-later"].Status != sms.SMSStatusScheduled {
+		t.Errorf("Expected the SMS not due to stay scheduled, got %s", repo.messages["sms-later"].Status)
+	}
+}
+
+func TestSMSService_CancelSMS(t *testing.T) {
+	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
+	service := newTestService(repo, outbox, newMockEventPublisher(), newMockSMSProvider())
+	ctx := context.Background()
+
+	msg := newScheduledSMS("sms-cancel", time.Now().Add(time.Hour))
+	if err := service.CreateAndBillSMS(ctx, msg); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	cancelled, err := service.CancelSMS(ctx, msg.ID)
+	if err != nil || cancelled.Status != sms.SMSStatusCancelled {
+		t.Fatalf("Expected the SMS cancelled, got %v", err)
+	}
+
+	repo.messages[msg.ID].SendAt = time.Now().Add(-time.Second)
+	if released, _ := service.ProcessScheduledSMS(ctx, 10); released != 0 || len(outbox.messages) != 0 {
+		t.Errorf("Expected a cancelled SMS never to be billed, got %d released", released)
+	}
+	if _, err := service.CancelSMS(ctx, msg.ID); !errors.Is(err, sms.ErrInvalidStatusTransition) {
+		t.Errorf("Expected ErrInvalidStatusTransition, got %v", err)
+	}
+	if _, err := service.CancelSMS(ctx, "missing"); !errors.Is(err, sms.ErrSMSNotFound) {
+		t.Errorf("Expected ErrSMSNotFound, got %v", err)
+	}
+}
+
+func TestSMSHandler_ScheduledSMS(t *testing.T) {
+	repo := newMockSMSRepo()
+	service := newTestService(repo, newMockOutboxRepo(), newMockEventPublisher(), newMockSMSProvider())
+	handler := handlers.NewSMSHandler(service)
+	app := fiber.New()
+	app.Post("/api/v1/sms", handler.SendSMS)
+	app.Post("/api/v1/sms/:id/cancel", handler.CancelSMS)
+
+	sendAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	body := fmt.Sprintf(`{"content":"Hi","receiver":"09123456789","user_id":%q,"send_at":%q}`, listUserA, sendAt)
+	resp, _ := postJSON(t, app, "/api/v1/sms", body)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", resp.StatusCode)
+	}
+	var created dto.SendSMSResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if created.Status != "scheduled" {
+		t.Errorf("Expected a scheduled SMS, got %s", created.Status)
+	}
+
+	resp, _ = postJSON(t, app, "/api/v1/sms/"+created.ID+"/cancel", "")
+	var cancelled dto.GetSMSResponse
+	if err := json.NewDecoder(resp.Body).Decode(&cancelled); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %v", resp.StatusCode, err)
+	}
+	if cancelled.Status != "cancelled" || cancelled.SendAt == nil || cancelled.SendAt.Format(time.RFC3339) != sendAt {
+		t.Errorf("Expected a cancelled SMS keeping its send_at, got %+v", cancelled)
+	}
+
+	if resp, errResp := postJSON(t, app, "/api/v1/sms/"+created.ID+"/cancel", ""); resp.StatusCode != http.StatusConflict || errResp.Error != "invalid_transition" {
+		t.Errorf("Expected 409 when cancelling twice, got %d %+v", resp.StatusCode, errResp)
+	}
+	resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/api/v1/sms/missing/cancel", nil))
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d %v", resp.StatusCode, err)
+	}
+}
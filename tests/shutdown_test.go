@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sms/config"
+	handlers "sms/internal/api/handlers/http"
+	"sms/internal/domain/sms"
+	smsService "sms/internal/usecase/sms"
+	"sms/pkg/health"
+	"sms/pkg/rabbit"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// fakeApp serves a service built on the in-memory mocks.
+type fakeApp struct {
+	service *smsService.Service
+	health  *health.Checker
+}
+
+func (a *fakeApp) Config() config.Config                              { return config.Config{} }
+func (a *fakeApp) DB() *gorm.DB                                       { return nil }
+func (a *fakeApp) RabbitConn() *rabbit.RabbitConn                     { return nil }
+func (a *fakeApp) SMSService(ctx context.Context) *smsService.Service { return a.service }
+func (a *fakeApp) Health() *health.Checker                            { return a.health }
+func (a *fakeApp) Close() error                                       { return nil }
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestRun_DrainsInFlightRequests(t *testing.T) {
+	// a slow readiness check stands in for a slow request
+	slow := health.NewChecker(time.Second).Add("slow", func(ctx context.Context) error {
+		time.Sleep(300 * time.Millisecond)
+		return nil
+	})
+	appContainer := &fakeApp{
+		service: newTestService(newMockSMSRepo(), newMockOutboxRepo(), newMockEventPublisher(), newMockSMSProvider()),
+		health:  slow,
+	}
+	port := freePort(t)
+	baseURL := fmt.Sprintf("http://127.0.0.1:%d", port)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- handlers.Run(ctx, appContainer, config.Server{Port: port, ShutdownTimeout: 5 * time.Second})
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(baseURL + "/healthz")
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Server did not start: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	inFlight := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(baseURL + "/readyz")
+		if err != nil {
+			inFlight <- 0
+			return
+		}
+		resp.Body.Close()
+		inFlight <- resp.StatusCode
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	// the request is answered rather than cut off; readiness already reports
+	// down as its context ends with the shutdown
+	if status := <-inFlight; status != http.StatusServiceUnavailable {
+		t.Errorf("Expected the in-flight readiness probe to complete with 503, got %d", status)
+	}
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Errorf("Expected a clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after shutdown")
+	}
+
+	if _, err := http.Get(baseURL + "/healthz"); err == nil {
+		t.Error("Expected new connections to be refused after shutdown")
+	}
+}
+
+func TestSMSService_FlushOutbox(t *testing.T) {
+	outbox := newMockOutboxRepo()
+	publisher := newMockEventPublisher()
+	service := newTestService(newMockSMSRepo(), outbox, publisher, newMockSMSProvider())
+	ctx := context.Background()
+
+	for i := range 5 {
+		if err := outbox.Add(ctx, sms.RequestSMSBilling{SMSID: fmt.Sprintf("sms-%d", i), Amount: 1}); err != nil {
+			t.Fatalf("Failed to add outbox event: %v", err)
+		}
+	}
+
+	relayed, err := service.FlushOutbox(ctx, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if relayed != 5 || outbox.pending() != 0 {
+		t.Errorf("Expected all 5 events relayed across batches, got %d with %d pending", relayed, outbox.pending())
+	}
+}
@@ -0,0 +1,282 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"sms/internal/domain/sms"
+	"sms/internal/infra/external"
+	"sms/pkg/logger"
+	"sms/pkg/smpp"
+	"sms/pkg/smpp/smpptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestSMSC(t *testing.T) *smpptest.Server {
+	smsc := smpptest.NewServer("arvan", "secret")
+	t.Cleanup(smsc.Close)
+	return smsc
+}
+
+func newTestSMPPProvider(t *testing.T, smsc *smpptest.Server, modify func(*external.SMPPProviderConfig)) *external.SMPPProvider {
+	cfg := external.SMPPProviderConfig{
+		Name:                "smpp-gateway",
+		Addr:                smsc.Addr(),
+		SystemID:            "arvan",
+		Password:            "secret",
+		SourceAddr:          "ArvanSMS",
+		WindowSize:          10,
+		EnquireLinkInterval: time.Minute,
+		Timeout:             time.Second,
+	}
+	if modify != nil {
+		modify(&cfg)
+	}
+	provider := external.NewSMPPProvider(cfg)
+	t.Cleanup(func() { _ = provider.Close() })
+	return provider
+}
+
+func expectProviderErrorCode(t *testing.T, err error, code string) {
+	t.Helper()
+	var providerErr *sms.ProviderError
+	if !errors.As(err, &providerErr) {
+		t.Fatalf("Expected ProviderError, got %v", err)
+	}
+	if providerErr.Code != code {
+		t.Errorf("Expected failure code %s, got %s (%v)", code, providerErr.Code, err)
+	}
+}
+
+func TestSMPPProvider_SubmitSingleSegment(t *testing.T) {
+	smsc := newTestSMSC(t)
+	provider := newTestSMPPProvider(t, smsc, nil)
+
+	name, err := provider.SendSMS(context.Background(), &sms.SMSMessage{ID: "sms-1", Receiver: "+989123456789", Content: "Code: 1234"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if name != "smpp-gateway" {
+		t.Errorf("Expected provider name smpp-gateway, got %s", name)
+	}
+
+	submitted := smsc.Submitted()
+	if len(submitted) != 1 {
+		t.Fatalf("Expected 1 submit_sm, got %d", len(submitted))
+	}
+	msg := submitted[0]
+	if msg.DestAddr != "989123456789" || msg.DestAddrTON != smpp.TONInternational || msg.DestAddrNPI != smpp.NPIISDN {
+		t.Errorf("Expected international destination 989123456789, got %+v", msg)
+	}
+	if msg.SourceAddr != "ArvanSMS" || msg.SourceAddrTON != smpp.TONAlphanumeric {
+		t.Errorf("Expected alphanumeric source ArvanSMS, got %+v", msg)
+	}
+	if msg.DataCoding != smpp.DataCodingDefault || msg.ESMClass != 0 {
+		t.Errorf("Expected default coding without UDHI, got coding %d esm %d", msg.DataCoding, msg.ESMClass)
+	}
+	if string(msg.ShortMessage) != "Code: 1234" {
+		t.Errorf("Expected short message %q, got %q", "Code: 1234", msg.ShortMessage)
+	}
+}
+
+func TestSMPPProvider_SubmitMultipartUCS2(t *testing.T) {
+	smsc := newTestSMSC(t)
+	provider := newTestSMPPProvider(t, smsc, nil)
+
+	message := &sms.SMSMessage{ID: "sms-1", Receiver: "+989123456789", Content: strings.Repeat("ک", 100)}
+	if _, err := provider.SendSMS(context.Background(), message); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	submitted := smsc.Submitted()
+	if len(submitted) != 2 {
+		t.Fatalf("Expected 2 submit_sm, got %d", len(submitted))
+	}
+	encoded := message.Encode()
+	for i, msg := range submitted {
+		if msg.DataCoding != smpp.DataCodingUCS2 || msg.ESMClass != smpp.ESMClassUDHI {
+			t.Errorf("Expected UCS-2 with UDHI, got coding %d esm %d", msg.DataCoding, msg.ESMClass)
+		}
+		if !bytes.HasPrefix(msg.ShortMessage, encoded.Segments[i].UDH) {
+			t.Errorf("Expected part %d to start with UDH % X, got % X", i+1, encoded.Segments[i].UDH, msg.ShortMessage[:6])
+		}
+	}
+	if message.ProviderMessageID != "smsc-1" || !slices.Equal(message.ProviderPartIDs, []string{"smsc-1", "smsc-2"}) {
+		t.Errorf("Expected the IDs of both parts, got %q %v", message.ProviderMessageID, message.ProviderPartIDs)
+	}
+}
+
+func TestSMPPProvider_PartialMultipartSubmit(t *testing.T) {
+	smsc := newTestSMSC(t)
+	// the second part is throttled, which alone would be worth a retry
+	smsc.FailSubmitsAfter(1, smpp.StatusThrottled)
+	backup := &mockSMSProvider{providerName: "backup"}
+	recorder := &mockAttemptRecorder{}
+	provider := external.NewFailoverProvider([]external.NamedProvider{
+		{Name: "smpp-gateway", Provider: newTestSMPPProvider(t, smsc, nil)},
+		{Name: "backup", Provider: backup},
+	}, external.BreakerOptions{FailureThreshold: 2, OpenTimeout: time.Hour}, recorder, logger.NewLogger("info"))
+
+	name, err := provider.SendSMS(context.Background(), &sms.SMSMessage{ID: "sms-1", Receiver: "+989123456789", Content: strings.Repeat("ک", 100)})
+	if !errors.Is(err, sms.ErrPartiallySubmitted) || sms.IsTransient(err) {
+		t.Fatalf("Expected a permanent ErrPartiallySubmitted, got %v", err)
+	}
+	expectProviderErrorCode(t, err, sms.PartiallySubmitted)
+	if name != "smpp-gateway" {
+		t.Errorf("Expected provider smpp-gateway, got %s", name)
+	}
+	if backup.calls != 0 {
+		t.Errorf("Expected the message not to be sent again by the backup, got %d calls", backup.calls)
+	}
+	if len(smsc.Submitted()) != 1 || len(recorder.attempts) != 1 || !recorder.attempts[0].Permanent {
+		t.Errorf("Expected one permanent attempt with one part submitted, got %d parts and %+v", len(smsc.Submitted()), recorder.attempts)
+	}
+}
+
+func TestSMPPProvider_ReusesConnection(t *testing.T) {
+	smsc := newTestSMSC(t)
+	provider := newTestSMPPProvider(t, smsc, nil)
+
+	for i := 0; i < 3; i++ {
+		if _, err := provider.SendSMS(context.Background(), &sms.SMSMessage{ID: "sms-1", Receiver: "+989123456789", Content: "hi"}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if smsc.Binds() != 1 {
+		t.Errorf("Expected 1 bind, got %d", smsc.Binds())
+	}
+
+	smsc.DropConnections()
+	time.Sleep(20 * time.Millisecond)
+
+	if _, err := provider.SendSMS(context.Background(), &sms.SMSMessage{ID: "sms-2", Receiver: "+989123456789", Content: "hi"}); err != nil {
+		t.Fatalf("Expected no error after reconnect, got %v", err)
+	}
+	if smsc.Binds() != 2 {
+		t.Errorf("Expected a new bind after the connection dropped, got %d binds", smsc.Binds())
+	}
+}
+
+func TestSMPPProvider_WindowSize(t *testing.T) {
+	smsc := newTestSMSC(t)
+	smsc.SetResponseDelay(30 * time.Millisecond)
+	provider := newTestSMPPProvider(t, smsc, func(cfg *external.SMPPProviderConfig) { cfg.WindowSize = 2 })
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 6)
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := provider.SendSMS(context.Background(), &sms.SMSMessage{ID: "sms-1", Receiver: "+989123456789", Content: "hi"})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if smsc.MaxInFlight() != 2 {
+		t.Errorf("Expected at most 2 outstanding submit_sm, got %d", smsc.MaxInFlight())
+	}
+	if len(smsc.Submitted()) != 6 {
+		t.Errorf("Expected 6 submitted messages, got %d", len(smsc.Submitted()))
+	}
+}
+
+func TestSMPPProvider_EnquireLink(t *testing.T) {
+	smsc := newTestSMSC(t)
+	provider := newTestSMPPProvider(t, smsc, func(cfg *external.SMPPProviderConfig) {
+		cfg.EnquireLinkInterval = 10 * time.Millisecond
+		cfg.Timeout = 50 * time.Millisecond
+	})
+
+	if _, err := provider.SendSMS(context.Background(), &sms.SMSMessage{ID: "sms-1", Receiver: "+989123456789", Content: "hi"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if smsc.EnquireLinks() == 0 {
+		t.Fatal("Expected enquire_link keepalives")
+	}
+
+	// an unanswered enquire_link drops the bind; the next send re-binds
+	smsc.SetSilentEnquireLinks(true)
+	time.Sleep(100 * time.Millisecond)
+	smsc.SetSilentEnquireLinks(false)
+
+	if _, err := provider.SendSMS(context.Background(), &sms.SMSMessage{ID: "sms-2", Receiver: "+989123456789", Content: "hi"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if smsc.Binds() != 2 {
+		t.Errorf("Expected 2 binds, got %d", smsc.Binds())
+	}
+}
+
+func TestSMPPProvider_FailureMapping(t *testing.T) {
+	tests := []struct {
+		name   string
+		status smpp.Status
+		delay  time.Duration
+		code   string
+	}{
+		{"Invalid destination", smpp.StatusInvDstAdr, 0, sms.ProviderRejected},
+		{"Throttled", smpp.StatusThrottled, 0, sms.ProviderUnavailable},
+		{"No response", smpp.StatusOK, 200 * time.Millisecond, sms.ProviderTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			smsc := newTestSMSC(t)
+			smsc.SetSubmitStatus(tt.status)
+			smsc.SetResponseDelay(tt.delay)
+			provider := newTestSMPPProvider(t, smsc, func(cfg *external.SMPPProviderConfig) { cfg.Timeout = 50 * time.Millisecond })
+
+			_, err := provider.SendSMS(context.Background(), &sms.SMSMessage{ID: "sms-1", Receiver: "+989123456789", Content: "hi"})
+			expectProviderErrorCode(t, err, tt.code)
+		})
+	}
+}
+
+func TestSMPPProvider_BindRejected(t *testing.T) {
+	smsc := newTestSMSC(t)
+	provider := newTestSMPPProvider(t, smsc, func(cfg *external.SMPPProviderConfig) { cfg.Password = "wrong" })
+
+	_, err := provider.SendSMS(context.Background(), &sms.SMSMessage{ID: "sms-1", Receiver: "+989123456789", Content: "hi"})
+	expectProviderErrorCode(t, err, sms.ProviderUnavailable)
+	if !errors.Is(err, smpp.StatusInvPaswd) {
+		t.Errorf("Expected ESME_RINVPASWD, got %v", err)
+	}
+}
+
+func TestInstrumentedProvider_ClosesGateway(t *testing.T) {
+	smsc := newTestSMSC(t)
+	provider := external.NewInstrumentedProvider("smpp-gateway", newTestSMPPProvider(t, smsc, nil))
+	message := &sms.SMSMessage{ID: "sms-1", Receiver: "+989123456789", Content: "hi"}
+
+	if _, err := provider.SendSMS(context.Background(), message); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := provider.Close(); err != nil {
+		t.Fatalf("Expected no error on close, got %v", err)
+	}
+	// the bind was released, so the next send binds again
+	if _, err := provider.SendSMS(context.Background(), message); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if binds := smsc.Binds(); binds != 2 {
+		t.Errorf("Expected 2 binds, got %d", binds)
+	}
+
+	// gateways without a connection close as a no-op
+	if err := external.NewInstrumentedProvider("mock", newMockSMSProvider()).Close(); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
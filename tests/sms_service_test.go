@@ -2,21 +2,33 @@ package tests
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"slices"
 	"sms/internal/domain/sms"
+	"sms/internal/infra/pricing"
 	smsService "sms/internal/usecase/sms"
 	"sms/pkg/logger"
+	"sms/pkg/tracing"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
 )
 
+// mockSMSRepo hands out copies of its messages, like rows read from the
+// database, so changes only show once they are written back.
 type mockSMSRepo struct {
 	messages    map[string]*sms.SMSMessage
 	createError error
 	getError    error
 	updateError error
+	// updateErrorOn limits updateError to updates to that status.
+	updateErrorOn sms.SMSStatus
 }
 
 func newMockSMSRepo() *mockSMSRepo {
@@ -32,7 +44,7 @@ func (m *mockSMSRepo) GetByFilter(ctx context.Context, filter sms.Filter) (*sms.
 
 	if filter.ID != nil {
 		if msg, exists := m.messages[*filter.ID]; exists {
-			return msg, nil
+			return copySMS(msg), nil
 		}
 		return nil, gorm.ErrRecordNotFound
 	}
@@ -44,35 +56,302 @@ func (m *mockSMSRepo) GetByFilter(ctx context.Context, filter sms.Filter) (*sms.
 		if filter.UserID != nil && msg.UserID != *filter.UserID {
 			continue
 		}
-		return msg, nil
+		if filter.Provider != nil && msg.Provider != *filter.Provider {
+			continue
+		}
+		if filter.ProviderMessageID != nil && msg.ProviderMessageID != *filter.ProviderMessageID && !slices.Contains(msg.ProviderPartIDs, *filter.ProviderMessageID) {
+			continue
+		}
+		return copySMS(msg), nil
 	}
 
 	return nil, gorm.ErrRecordNotFound
 }
 
+func (m *mockSMSRepo) List(ctx context.Context, filter sms.ListFilter, page sms.Page) (sms.ListResult, error) {
+	if m.getError != nil {
+		return sms.ListResult{}, m.getError
+	}
+
+	var matched []*sms.SMSMessage
+	for _, msg := range m.messages {
+		switch {
+		case filter.UserID != nil && msg.UserID != *filter.UserID,
+			filter.Status != nil && msg.Status != *filter.Status,
+			filter.Receiver != nil && msg.Receiver != *filter.Receiver,
+			filter.Provider != nil && msg.Provider != *filter.Provider,
+			filter.BatchID != nil && msg.BatchID != *filter.BatchID,
+			filter.CreatedFrom != nil && msg.CreatedAt.Before(*filter.CreatedFrom),
+			filter.CreatedTo != nil && !msg.CreatedAt.Before(*filter.CreatedTo):
+			continue
+		}
+		matched = append(matched, msg)
+	}
+	// newest first, like the repository
+	after := func(a, b *sms.SMSMessage) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	}
+	sort.Slice(matched, func(i, j int) bool { return after(matched[i], matched[j]) })
+
+	result := sms.ListResult{}
+	if page.WithTotal {
+		total := int64(len(matched))
+		result.Total = &total
+	}
+	for _, msg := range matched {
+		if page.Cursor != nil && !after(&sms.SMSMessage{CreatedAt: page.Cursor.CreatedAt, ID: page.Cursor.ID}, msg) {
+			continue
+		}
+		if len(result.Messages) == page.Limit {
+			result.Next = sms.CursorAfter(result.Messages[len(result.Messages)-1])
+			break
+		}
+		result.Messages = append(result.Messages, copySMS(msg))
+	}
+	return result, nil
+}
+
 func (m *mockSMSRepo) Create(ctx context.Context, message *sms.SMSMessage) error {
 	if m.createError != nil {
 		return m.createError
 	}
-	m.messages[message.ID] = message
+	m.messages[message.ID] = copySMS(message)
+	return nil
+}
+
+func (m *mockSMSRepo) CreateInBatches(ctx context.Context, messages []*sms.SMSMessage, batchSize int) error {
+	for _, message := range messages {
+		if err := m.Create(ctx, message); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (m *mockSMSRepo) Update(ctx context.Context, ID string, message *sms.SMSMessage) error {
-	if m.updateError != nil {
+// Update applies the status guard of the repository: the stored message must
+// still have status from.
+func (m *mockSMSRepo) Update(ctx context.Context, ID string, from sms.SMSStatus, message *sms.SMSMessage) error {
+	if m.updateError != nil && (m.updateErrorOn == "" || m.updateErrorOn == message.Status) {
 		return m.updateError
 	}
-	m.messages[ID] = message
+	current, exists := m.messages[ID]
+	if !exists {
+		return gorm.ErrRecordNotFound
+	}
+	if current.Status != from {
+		return &sms.InvalidTransitionError{From: current.Status, To: message.Status}
+	}
+	m.messages[ID] = copySMS(message)
 	return nil
 }
 
+func (m *mockSMSRepo) Lock(ctx context.Context, ID string) (*sms.SMSMessage, error) {
+	if m.getError != nil {
+		return nil, m.getError
+	}
+	msg, exists := m.messages[ID]
+	if !exists {
+		return nil, sms.ErrSMSNotFound
+	}
+	return copySMS(msg), nil
+}
+
+func (m *mockSMSRepo) ClaimDue(ctx context.Context, dueBy time.Time, limit int) ([]*sms.SMSMessage, error) {
+	if m.getError != nil {
+		return nil, m.getError
+	}
+	var due []*sms.SMSMessage
+	for _, msg := range m.messages {
+		if msg.Status == sms.SMSStatusScheduled && !msg.SendAt.After(dueBy) {
+			due = append(due, copySMS(msg))
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].SendAt.Before(due[j].SendAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (m *mockSMSRepo) ClaimStuckSending(ctx context.Context, sendingSince time.Time, limit int) ([]*sms.SMSMessage, error) {
+	var stuck []*sms.SMSMessage
+	for _, msg := range m.messages {
+		if msg.Status == sms.SMSStatusSending && msg.UpdatedAt.Before(sendingSince) {
+			stuck = append(stuck, copySMS(msg))
+		}
+	}
+	sort.Slice(stuck, func(i, j int) bool { return stuck[i].UpdatedAt.Before(stuck[j].UpdatedAt) })
+	if len(stuck) > limit {
+		stuck = stuck[:limit]
+	}
+	return stuck, nil
+}
+
 func (m *mockSMSRepo) WithTx(tx *gorm.DB) sms.Repo {
 	return m
 }
 
+func copySMS(message *sms.SMSMessage) *sms.SMSMessage {
+	copied := *message
+	copied.ProviderPartIDs = slices.Clone(message.ProviderPartIDs)
+	copied.DeliveredPartIDs = slices.Clone(message.DeliveredPartIDs)
+	return &copied
+}
+
+type mockOutboxRepo struct {
+	messages []*sms.OutboxMessage
+	claimed  map[string]bool
+	addError error
+}
+
+func newMockOutboxRepo() *mockOutboxRepo {
+	return &mockOutboxRepo{}
+}
+
+func (m *mockOutboxRepo) Add(ctx context.Context, event sms.DomainEvent) error {
+	if m.addError != nil {
+		return m.addError
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	m.messages = append(m.messages, &sms.OutboxMessage{
+		ID:          fmt.Sprintf("outbox-%d", len(m.messages)+1),
+		EventType:   event.EventType(),
+		AggregateID: event.AggregateID(),
+		Payload:     payload,
+		TraceID:     logger.GetTraceID(ctx),
+		TraceParent: tracing.TraceParent(ctx),
+		Status:      sms.OutboxStatusPending,
+		CreatedAt:   time.Now(),
+	})
+	return nil
+}
+
+func (m *mockOutboxRepo) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]sms.OutboxMessage, error) {
+	if m.claimed == nil {
+		m.claimed = make(map[string]bool)
+	}
+	var result []sms.OutboxMessage
+	for _, msg := range m.messages {
+		if len(result) == limit {
+			break
+		}
+		if msg.Status == sms.OutboxStatusPending && !m.claimed[msg.ID] {
+			m.claimed[msg.ID] = true
+			result = append(result, *msg)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockOutboxRepo) find(ID string) *sms.OutboxMessage {
+	for _, msg := range m.messages {
+		if msg.ID == ID {
+			return msg
+		}
+	}
+	return nil
+}
+
+func (m *mockOutboxRepo) MarkSent(ctx context.Context, ID string) error {
+	if msg := m.find(ID); msg != nil {
+		msg.Status = sms.OutboxStatusSent
+		msg.Attempts++
+		msg.SentAt = time.Now()
+	}
+	return nil
+}
+
+func (m *mockOutboxRepo) MarkFailed(ctx context.Context, ID string, reason string) error {
+	if msg := m.find(ID); msg != nil {
+		msg.Status = sms.OutboxStatusFailed
+		msg.Attempts++
+		msg.LastError = reason
+	}
+	return nil
+}
+
+func (m *mockOutboxRepo) RecordAttempt(ctx context.Context, ID string, reason string) error {
+	if msg := m.find(ID); msg != nil {
+		msg.Attempts++
+		msg.LastError = reason
+	}
+	delete(m.claimed, ID)
+	return nil
+}
+
+func (m *mockOutboxRepo) Release(ctx context.Context, IDs []string) error {
+	for _, ID := range IDs {
+		delete(m.claimed, ID)
+	}
+	return nil
+}
+
+func (m *mockOutboxRepo) WithTx(tx *gorm.DB) sms.OutboxRepo {
+	return m
+}
+
+func (m *mockOutboxRepo) pending() int {
+	count := 0
+	for _, msg := range m.messages {
+		if msg.Status == sms.OutboxStatusPending {
+			count++
+		}
+	}
+	return count
+}
+
+type mockInboxRepo struct {
+	processed map[string]bool
+}
+
+func newMockInboxRepo() *mockInboxRepo {
+	return &mockInboxRepo{
+		processed: make(map[string]bool),
+	}
+}
+
+func (m *mockInboxRepo) MarkProcessed(ctx context.Context, transactionID, smsID string) (bool, error) {
+	key := transactionID + "/" + smsID
+	if m.processed[key] {
+		return false, nil
+	}
+	m.processed[key] = true
+	return true, nil
+}
+
+func (m *mockInboxRepo) WithTx(tx *gorm.DB) sms.InboxRepo {
+	return m
+}
+
+// fakeTransactor runs fn directly, as the mock repositories ignore the
+// transaction; it tracks whether a transaction is open.
+type fakeTransactor struct {
+	open  bool
+	calls int
+}
+
+func (f *fakeTransactor) InTx(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	f.open = true
+	f.calls++
+	defer func() { f.open = false }()
+	return fn(nil)
+}
+
 type mockEventPublisher struct {
 	publishedEvents []sms.DomainEvent
+	traceIDs        []string
+	spanContexts    []trace.SpanContext
 	publishError    error
+	// failFor fails the events of the given aggregates only
+	failFor map[string]error
+	// tx, when set, makes publishing inside one of its transactions fail
+	tx *fakeTransactor
 }
 
 func newMockEventPublisher() *mockEventPublisher {
@@ -85,13 +364,22 @@ func (m *mockEventPublisher) PublishEvent(ctx context.Context, event sms.DomainE
 	if m.publishError != nil {
 		return m.publishError
 	}
+	if m.tx != nil && m.tx.open {
+		return errors.New("published inside a transaction")
+	}
+	if err := m.failFor[event.AggregateID()]; err != nil {
+		return err
+	}
 	m.publishedEvents = append(m.publishedEvents, event)
+	m.traceIDs = append(m.traceIDs, logger.GetTraceID(ctx))
+	m.spanContexts = append(m.spanContexts, trace.SpanContextFromContext(ctx))
 	return nil
 }
 
 type mockSMSProvider struct {
 	sendError    error
 	providerName string
+	calls        int
 }
 
 func newMockSMSProvider() *mockSMSProvider {
@@ -101,18 +389,21 @@ func newMockSMSProvider() *mockSMSProvider {
 }
 
 func (m *mockSMSProvider) SendSMS(ctx context.Context, message *sms.SMSMessage) (string, error) {
+	m.calls++
 	if m.sendError != nil {
 		return m.providerName, m.sendError
 	}
+	message.ProviderMessageID = fmt.Sprintf("mock-msg-%d", m.calls)
 	return m.providerName, nil
 }
 
 func TestSMSService_CreateAndBillSMS_Success(t *testing.T) {
 	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
 	publisher := newMockEventPublisher()
 	provider := newMockSMSProvider()
 	log := logger.NewLogger("info")
-	service := smsService.NewSMSService(repo, publisher, provider, &gorm.DB{}, log)
+	service := smsService.NewSMSService(repo, outbox, newMockInboxRepo(), publisher, provider, &fakeTransactor{}, log)
 
 	message := &sms.SMSMessage{
 		ID:       "test-sms-id",
@@ -134,8 +425,22 @@ func TestSMSService_CreateAndBillSMS_Success(t *testing.T) {
 		t.Error("Expected message to be created in repository")
 	}
 
+	if len(publisher.publishedEvents) != 0 {
+		t.Errorf("Expected billing request to wait in outbox, got %d published events", len(publisher.publishedEvents))
+	}
+	if outbox.pending() != 1 {
+		t.Fatalf("Expected 1 pending outbox event, got %d", outbox.pending())
+	}
+
+	relayed, err := service.RelayOutbox(ctx, 10)
+	if err != nil {
+		t.Fatalf("Expected no relay error, got %v", err)
+	}
+	if relayed != 1 {
+		t.Errorf("Expected 1 relayed event, got %d", relayed)
+	}
 	if len(publisher.publishedEvents) != 1 {
-		t.Errorf("Expected 1 published event, got %d", len(publisher.publishedEvents))
+		t.Fatalf("Expected 1 published event, got %d", len(publisher.publishedEvents))
 	}
 
 	billingEvent, ok := publisher.publishedEvents[0].(sms.RequestSMSBilling)
@@ -153,11 +458,12 @@ func TestSMSService_CreateAndBillSMS_Success(t *testing.T) {
 
 func TestSMSService_CreateAndBillSMS_RepoError(t *testing.T) {
 	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
 	repo.createError = errors.New("database error")
 	publisher := newMockEventPublisher()
 	provider := newMockSMSProvider()
 	log := logger.NewLogger("info")
-	service := smsService.NewSMSService(repo, publisher, provider, &gorm.DB{}, log)
+	service := smsService.NewSMSService(repo, outbox, newMockInboxRepo(), publisher, provider, &fakeTransactor{}, log)
 
 	message := &sms.SMSMessage{
 		ID:       "test-sms-id",
@@ -178,15 +484,43 @@ func TestSMSService_CreateAndBillSMS_RepoError(t *testing.T) {
 	if len(publisher.publishedEvents) != 0 {
 		t.Errorf("Expected no published events, got %d", len(publisher.publishedEvents))
 	}
+	if len(outbox.messages) != 0 {
+		t.Errorf("Expected no outbox events, got %d", len(outbox.messages))
+	}
+}
+
+func TestSMSService_CreateAndBillSMS_OutboxError(t *testing.T) {
+	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
+	outbox.addError = errors.New("outbox error")
+	publisher := newMockEventPublisher()
+	provider := newMockSMSProvider()
+	log := logger.NewLogger("info")
+	service := smsService.NewSMSService(repo, outbox, newMockInboxRepo(), publisher, provider, &fakeTransactor{}, log)
+
+	message := &sms.SMSMessage{
+		ID:       "test-sms-id",
+		UserID:   "user-123",
+		Content:  "Test message",
+		Receiver: "+1234567890",
+		Status:   sms.SMSStatusPending,
+	}
+
+	err := service.CreateAndBillSMS(context.Background(), message)
+
+	if err == nil {
+		t.Error("Expected error, got nil")
+	}
 }
 
-func TestSMSService_CreateAndBillSMS_PublishError(t *testing.T) {
+func TestSMSService_RelayOutbox_PublishError(t *testing.T) {
 	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
 	publisher := newMockEventPublisher()
 	publisher.publishError = errors.New("publish error")
 	provider := newMockSMSProvider()
 	log := logger.NewLogger("info")
-	service := smsService.NewSMSService(repo, publisher, provider, &gorm.DB{}, log)
+	service := smsService.NewSMSService(repo, outbox, newMockInboxRepo(), publisher, provider, &fakeTransactor{}, log)
 
 	message := &sms.SMSMessage{
 		ID:       "test-sms-id",
@@ -200,21 +534,135 @@ func TestSMSService_CreateAndBillSMS_PublishError(t *testing.T) {
 
 	err := service.CreateAndBillSMS(ctx, message)
 
-	if err == nil {
-		t.Error("Expected error, got nil")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
 	}
 
 	if _, exists := repo.messages[message.ID]; !exists {
 		t.Error("Expected message to be created in repository")
 	}
+
+	relayed, err := service.RelayOutbox(ctx, 10)
+	if err == nil {
+		t.Error("Expected relay error, got nil")
+	}
+	if relayed != 0 {
+		t.Errorf("Expected 0 relayed events, got %d", relayed)
+	}
+	if outbox.pending() != 1 {
+		t.Errorf("Expected billing request to stay pending in outbox, got %d pending", outbox.pending())
+	}
+	if outbox.messages[0].Attempts != 1 {
+		t.Errorf("Expected 1 recorded attempt, got %d", outbox.messages[0].Attempts)
+	}
+
+	publisher.publishError = nil
+	relayed, err = service.RelayOutbox(ctx, 10)
+	if err != nil {
+		t.Fatalf("Expected no relay error, got %v", err)
+	}
+	if relayed != 1 || outbox.pending() != 0 {
+		t.Errorf("Expected billing request to be relayed on retry, relayed %d, pending %d", relayed, outbox.pending())
+	}
+}
+
+func TestSMSService_RelayOutbox_PublishesAfterClaiming(t *testing.T) {
+	outbox := newMockOutboxRepo()
+	publisher := newMockEventPublisher()
+	tx := &fakeTransactor{}
+	publisher.tx = tx
+	service := smsService.NewSMSService(newMockSMSRepo(), outbox, newMockInboxRepo(), publisher, newMockSMSProvider(), tx, logger.NewLogger("info"))
+	ctx := context.Background()
+
+	for i := range 3 {
+		if err := outbox.Add(ctx, sms.RequestSMSBilling{SMSID: fmt.Sprintf("sms-%d", i), Amount: 1}); err != nil {
+			t.Fatalf("Failed to add outbox event: %v", err)
+		}
+	}
+
+	relayed, err := service.RelayOutbox(ctx, 10)
+	if err != nil {
+		t.Fatalf("Expected the events to be published outside the claim transaction, got %v", err)
+	}
+	if relayed != 3 || tx.calls != 1 {
+		t.Errorf("Expected 3 events relayed after one claim transaction, got %d after %d", relayed, tx.calls)
+	}
+}
+
+func TestSMSService_RelayOutbox_ParksRejectedEvents(t *testing.T) {
+	outbox := newMockOutboxRepo()
+	publisher := newMockEventPublisher()
+	publisher.failFor = map[string]error{
+		"sms-0": fmt.Errorf("%w: no route", sms.ErrEventRejected),
+	}
+	service := newTestService(newMockSMSRepo(), outbox, publisher, newMockSMSProvider())
+	ctx := context.Background()
+
+	for i := range 3 {
+		if err := outbox.Add(ctx, sms.RequestSMSBilling{SMSID: fmt.Sprintf("sms-%d", i), Amount: 1}); err != nil {
+			t.Fatalf("Failed to add outbox event: %v", err)
+		}
+	}
+
+	relayed, err := service.RelayOutbox(ctx, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if relayed != 2 {
+		t.Errorf("Expected the events behind the rejected one to be relayed, got %d", relayed)
+	}
+	if status := outbox.messages[0].Status; status != sms.OutboxStatusFailed {
+		t.Errorf("Expected the rejected event to be parked as failed, got %s", status)
+	}
+	if outbox.pending() != 0 {
+		t.Errorf("Expected no pending events, got %d", outbox.pending())
+	}
+}
+
+func TestSMSService_RelayOutbox_CapsAttempts(t *testing.T) {
+	outbox := newMockOutboxRepo()
+	publisher := newMockEventPublisher()
+	publisher.failFor = map[string]error{"sms-0": errors.New("confirm timeout")}
+	service := newTestService(newMockSMSRepo(), outbox, publisher, newMockSMSProvider()).
+		WithOutboxPolicy(sms.OutboxPolicy{MaxAttempts: 3, ClaimTimeout: time.Minute})
+	ctx := context.Background()
+
+	for i := range 2 {
+		if err := outbox.Add(ctx, sms.RequestSMSBilling{SMSID: fmt.Sprintf("sms-%d", i), Amount: 1}); err != nil {
+			t.Fatalf("Failed to add outbox event: %v", err)
+		}
+	}
+
+	// the failing event holds up the one behind it until it runs out of attempts
+	for attempt := 1; attempt < 3; attempt++ {
+		relayed, err := service.RelayOutbox(ctx, 10)
+		if err == nil || relayed != 0 {
+			t.Fatalf("Attempt %d: expected the batch to stop, got %d relayed and %v", attempt, relayed, err)
+		}
+		if outbox.pending() != 2 {
+			t.Fatalf("Attempt %d: expected both events to stay pending, got %d", attempt, outbox.pending())
+		}
+	}
+
+	relayed, err := service.RelayOutbox(ctx, 10)
+	if err != nil {
+		t.Fatalf("Expected no error once the event is parked, got %v", err)
+	}
+	if relayed != 1 {
+		t.Errorf("Expected the event behind it to be relayed, got %d", relayed)
+	}
+	if msg := outbox.messages[0]; msg.Status != sms.OutboxStatusFailed || msg.Attempts != 3 {
+		t.Errorf("Expected the event parked after 3 attempts, got %s after %d", msg.Status, msg.Attempts)
+	}
 }
 
 func TestSMSService_ProcessDebitedSMS_Success(t *testing.T) {
 	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
 	publisher := newMockEventPublisher()
 	provider := newMockSMSProvider()
 	log := logger.NewLogger("info")
-	service := smsService.NewSMSService(repo, publisher, provider, &gorm.DB{}, log)
+	service := smsService.NewSMSService(repo, outbox, newMockInboxRepo(), publisher, provider, &fakeTransactor{}, log)
 
 	message := &sms.SMSMessage{
 		ID:       "test-sms-id",
@@ -242,21 +690,25 @@ func TestSMSService_ProcessDebitedSMS_Success(t *testing.T) {
 	}
 
 	updatedMessage := repo.messages[message.ID]
-	if updatedMessage.Status != sms.SMSStatusDelivered {
-		t.Errorf("Expected message status to be %s, got %s", sms.SMSStatusDelivered, updatedMessage.Status)
+	if updatedMessage.Status != sms.SMSStatusSent {
+		t.Errorf("Expected message status to be %s, got %s", sms.SMSStatusSent, updatedMessage.Status)
 	}
 	if updatedMessage.Provider != provider.providerName {
 		t.Errorf("Expected provider to be %s, got %s", provider.providerName, updatedMessage.Provider)
 	}
+	if updatedMessage.ProviderMessageID != "mock-msg-1" {
+		t.Errorf("Expected provider message ID mock-msg-1, got %s", updatedMessage.ProviderMessageID)
+	}
 }
 
 func TestSMSService_ProcessDebitedSMS_DeliveryFailure(t *testing.T) {
 	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
 	publisher := newMockEventPublisher()
 	provider := newMockSMSProvider()
 	provider.sendError = errors.New("network error")
 	log := logger.NewLogger("info")
-	service := smsService.NewSMSService(repo, publisher, provider, &gorm.DB{}, log)
+	service := smsService.NewSMSService(repo, outbox, newMockInboxRepo(), publisher, provider, &fakeTransactor{}, log)
 
 	message := &sms.SMSMessage{
 		ID:       "test-sms-id",
@@ -291,8 +743,14 @@ func TestSMSService_ProcessDebitedSMS_DeliveryFailure(t *testing.T) {
 		t.Errorf("Expected failure code to be %s, got %s", sms.MNOProviderFailed, updatedMessage.FailureCode)
 	}
 
+	if outbox.pending() != 1 {
+		t.Fatalf("Expected refund request in outbox, got %d pending", outbox.pending())
+	}
+	if _, err := service.RelayOutbox(ctx, 10); err != nil {
+		t.Fatalf("Expected no relay error, got %v", err)
+	}
 	if len(publisher.publishedEvents) != 1 {
-		t.Errorf("Expected 1 published event, got %d", len(publisher.publishedEvents))
+		t.Fatalf("Expected 1 published event, got %d", len(publisher.publishedEvents))
 	}
 
 	refundEvent, ok := publisher.publishedEvents[0].(sms.RequestBillingRefund)
@@ -306,10 +764,11 @@ func TestSMSService_ProcessDebitedSMS_DeliveryFailure(t *testing.T) {
 
 func TestSMSService_GetSMSByID_NotFound(t *testing.T) {
 	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
 	publisher := newMockEventPublisher()
 	provider := newMockSMSProvider()
 	log := logger.NewLogger("info")
-	service := smsService.NewSMSService(repo, publisher, provider, &gorm.DB{}, log)
+	service := smsService.NewSMSService(repo, outbox, newMockInboxRepo(), publisher, provider, &fakeTransactor{}, log)
 
 	nonExistentID := "non-existent-id"
 	filter := sms.Filter{ID: &nonExistentID}
@@ -324,3 +783,276 @@ func TestSMSService_GetSMSByID_NotFound(t *testing.T) {
 		t.Error("Expected no message to be returned")
 	}
 }
+
+func TestSMSService_ProcessDebitedSMS_Redelivery(t *testing.T) {
+	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
+	publisher := newMockEventPublisher()
+	provider := newMockSMSProvider()
+	log := logger.NewLogger("info")
+	service := smsService.NewSMSService(repo, outbox, newMockInboxRepo(), publisher, provider, &fakeTransactor{}, log)
+
+	repo.messages["test-sms-id"] = &sms.SMSMessage{
+		ID:       "test-sms-id",
+		UserID:   "user-123",
+		Content:  "Test message",
+		Receiver: "+1234567890",
+		Status:   sms.SMSStatusPending,
+	}
+
+	event := sms.SMSBillingCompleted{
+		UserID:        "user-123",
+		SMSID:         "test-sms-id",
+		Amount:        1,
+		TransactionID: "txn-123",
+		TimeStamp:     time.Now(),
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := service.ProcessDebitedSMS(ctx, event); err != nil {
+			t.Fatalf("Expected no error on delivery %d, got %v", i+1, err)
+		}
+	}
+
+	if provider.calls != 1 {
+		t.Errorf("Expected SMS to be dispatched once, got %d dispatches", provider.calls)
+	}
+}
+
+func TestSMSService_ProcessDebitedSMS_FinalStatus(t *testing.T) {
+	for _, status := range []sms.SMSStatus{sms.SMSStatusDelivered, sms.SMSStatusFailed} {
+		t.Run(string(status), func(t *testing.T) {
+			repo := newMockSMSRepo()
+			outbox := newMockOutboxRepo()
+			publisher := newMockEventPublisher()
+			provider := newMockSMSProvider()
+			log := logger.NewLogger("info")
+			service := smsService.NewSMSService(repo, outbox, newMockInboxRepo(), publisher, provider, &fakeTransactor{}, log)
+
+			repo.messages["test-sms-id"] = &sms.SMSMessage{
+				ID:       "test-sms-id",
+				UserID:   "user-123",
+				Content:  "Test message",
+				Receiver: "+1234567890",
+				Status:   status,
+			}
+
+			// a different transaction for the same SMS must not re-send it either
+			event := sms.SMSBillingCompleted{
+				UserID:        "user-123",
+				SMSID:         "test-sms-id",
+				Amount:        1,
+				TransactionID: "txn-other",
+				TimeStamp:     time.Now(),
+			}
+
+			if err := service.ProcessDebitedSMS(context.Background(), event); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if provider.calls != 0 {
+				t.Errorf("Expected no dispatch, got %d", provider.calls)
+			}
+			if repo.messages["test-sms-id"].Status != status {
+				t.Errorf("Expected status to stay %s, got %s", status, repo.messages["test-sms-id"].Status)
+			}
+			if len(outbox.messages) != 0 {
+				t.Errorf("Expected no refund request, got %d outbox events", len(outbox.messages))
+			}
+		})
+	}
+}
+
+// The stored row still says billing_requested while the SMS moves through
+// billed and sending in memory, so the update must be guarded on the status
+// the SMS was read with.
+func TestSMSService_ProcessDebitedSMS_UpdatesFromBillingRequested(t *testing.T) {
+	tests := []struct {
+		name      string
+		sendError error
+		expected  sms.SMSStatus
+	}{
+		{"Sent", nil, sms.SMSStatusSent},
+		{"Retry scheduled", &sms.ProviderError{Provider: "mock-provider", Code: sms.ProviderTimeout, Err: errors.New("timeout")}, sms.SMSStatusRetryScheduled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMockSMSRepo()
+			outbox := newMockOutboxRepo()
+			provider := newMockSMSProvider()
+			provider.sendError = tt.sendError
+			service := newTestService(repo, outbox, newMockEventPublisher(), provider).WithRetryPolicy(testRetryPolicy)
+			repo.messages["sms-1"] = &sms.SMSMessage{ID: "sms-1", Receiver: "+989123456789", Amount: 1, Status: sms.SMSStatusBillingRequested}
+
+			if err := service.ProcessDebitedSMS(context.Background(), sms.SMSBillingCompleted{SMSID: "sms-1", TransactionID: "txn-1"}); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if status := repo.messages["sms-1"].Status; status != tt.expected {
+				t.Errorf("Expected %s to be stored, got %s", tt.expected, status)
+			}
+			if provider.calls != 1 {
+				t.Errorf("Expected 1 provider call, got %d", provider.calls)
+			}
+		})
+	}
+}
+
+func TestSMSService_ProcessDebitedSMS_OutcomeNotRecorded(t *testing.T) {
+	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
+	provider := newMockSMSProvider()
+	service := newTestService(repo, outbox, newMockEventPublisher(), provider)
+	repo.messages["sms-1"] = &sms.SMSMessage{ID: "sms-1", Receiver: "+989123456789", Amount: 1, Status: sms.SMSStatusBillingRequested}
+	event := sms.SMSBillingCompleted{SMSID: "sms-1", TransactionID: "txn-1"}
+	ctx := context.Background()
+
+	// the provider accepts the SMS but storing sent fails
+	repo.updateError = errors.New("connection reset")
+	repo.updateErrorOn = sms.SMSStatusSent
+	if err := service.ProcessDebitedSMS(ctx, event); err == nil {
+		t.Fatal("Expected the failed update to be returned")
+	}
+	if status := repo.messages["sms-1"].Status; status != sms.SMSStatusSending {
+		t.Errorf("Expected the SMS to stay sending, got %s", status)
+	}
+
+	// the redelivered event finds the claim committed and sends nothing
+	repo.updateError = nil
+	if err := service.ProcessDebitedSMS(ctx, event); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if provider.calls != 1 {
+		t.Errorf("Expected 1 provider call, got %d", provider.calls)
+	}
+
+	// the reconciler leaves it alone until the sending timeout has passed
+	if settled, err := service.ReconcileStuckSMS(ctx, time.Hour, 10); settled != 0 || err != nil {
+		t.Fatalf("Expected nothing to settle yet, got %d %v", settled, err)
+	}
+	repo.messages["sms-1"].UpdatedAt = time.Now().Add(-2 * time.Hour)
+	if settled, err := service.ReconcileStuckSMS(ctx, time.Hour, 10); settled != 1 || err != nil {
+		t.Fatalf("Expected the stuck SMS to be settled, got %d %v", settled, err)
+	}
+
+	stored := repo.messages["sms-1"]
+	if stored.Status != sms.SMSStatusFailed || stored.FailureCode != sms.DeliveryOutcomeUnknown {
+		t.Errorf("Expected the SMS failed with %s, got %s with %q", sms.DeliveryOutcomeUnknown, stored.Status, stored.FailureCode)
+	}
+	if len(outbox.messages) != 1 || outbox.messages[0].EventType != sms.EventTypeBillingRefunded {
+		t.Fatalf("Expected a refund request in the outbox, got %d events", len(outbox.messages))
+	}
+	var refund sms.RequestBillingRefund
+	if err := json.Unmarshal(outbox.messages[0].Payload, &refund); err != nil {
+		t.Fatal(err)
+	}
+	if refund.TransactionID != "txn-1" || refund.Amount != 1 {
+		t.Errorf("Expected the debit txn-1 of 1 refunded, got %+v", refund)
+	}
+}
+
+func TestSMSService_CreateAndBillSMS_Segments(t *testing.T) {
+	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
+	publisher := newMockEventPublisher()
+	provider := newMockSMSProvider()
+	log := logger.NewLogger("info")
+	service := smsService.NewSMSService(repo, outbox, newMockInboxRepo(), publisher, provider, &fakeTransactor{}, log)
+
+	ctx := context.Background()
+	message := &sms.SMSMessage{
+		ID:       "long-sms-id",
+		UserID:   "user-123",
+		Content:  strings.Repeat("س", 100),
+		Receiver: "+989123456789",
+		Status:   sms.SMSStatusPending,
+	}
+	if err := service.CreateAndBillSMS(ctx, message); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if repo.messages[message.ID].SegmentCount != 2 {
+		t.Errorf("Expected 2 segments to be stored, got %d", repo.messages[message.ID].SegmentCount)
+	}
+
+	tooLong := &sms.SMSMessage{
+		ID:       "too-long-sms-id",
+		UserID:   "user-123",
+		Content:  strings.Repeat("س", sms.MaxSegments*67+1),
+		Receiver: "+989123456789",
+		Status:   sms.SMSStatusPending,
+	}
+	if err := service.CreateAndBillSMS(ctx, tooLong); !errors.Is(err, sms.ErrContentTooLong) {
+		t.Errorf("Expected ErrContentTooLong, got %v", err)
+	}
+	if _, exists := repo.messages[tooLong.ID]; exists {
+		t.Error("Expected too long message not to be stored")
+	}
+}
+
+func TestSMSService_CreateAndBillSMS_Pricing(t *testing.T) {
+	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
+	publisher := newMockEventPublisher()
+	provider := newMockSMSProvider()
+	provider.sendError = errors.New("network error")
+	log := logger.NewLogger("info")
+	tariffs := pricing.NewStaticTariffRepo([]sms.Tariff{{
+		Plan:  "standard",
+		Rates: []sms.TariffRate{{Prefix: "+98", PricePerSegment: 2}},
+	}}, nil, "standard")
+	service := smsService.NewSMSService(repo, outbox, newMockInboxRepo(), publisher, provider, &fakeTransactor{}, log).
+		WithTariffs(tariffs)
+
+	ctx := context.Background()
+	message := &sms.SMSMessage{
+		ID:       "priced-sms-id",
+		UserID:   "user-123",
+		Content:  strings.Repeat("a", 200),
+		Receiver: "+989123456789",
+		Status:   sms.SMSStatusPending,
+	}
+	if err := service.CreateAndBillSMS(ctx, message); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if repo.messages[message.ID].Amount != 4 {
+		t.Errorf("Expected stored amount 4, got %d", repo.messages[message.ID].Amount)
+	}
+
+	err := service.ProcessDebitedSMS(ctx, sms.SMSBillingCompleted{
+		UserID:        message.UserID,
+		SMSID:         message.ID,
+		Amount:        4,
+		TransactionID: "txn-priced",
+		TimeStamp:     time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := service.RelayOutbox(ctx, 10); err != nil {
+		t.Fatalf("Expected no relay error, got %v", err)
+	}
+	if len(publisher.publishedEvents) != 2 {
+		t.Fatalf("Expected billing and refund events, got %d", len(publisher.publishedEvents))
+	}
+	if billing := publisher.publishedEvents[0].(sms.RequestSMSBilling); billing.Amount != 4 {
+		t.Errorf("Expected billed amount 4, got %d", billing.Amount)
+	}
+	if refund := publisher.publishedEvents[1].(sms.RequestBillingRefund); refund.Amount != 4 {
+		t.Errorf("Expected refunded amount 4, got %d", refund.Amount)
+	}
+
+	unroutable := &sms.SMSMessage{
+		ID:       "unroutable-sms-id",
+		UserID:   "user-123",
+		Content:  "hello",
+		Receiver: "+447700900123",
+		Status:   sms.SMSStatusPending,
+	}
+	if err := service.CreateAndBillSMS(ctx, unroutable); !errors.Is(err, sms.ErrNoTariffRate) {
+		t.Errorf("Expected ErrNoTariffRate, got %v", err)
+	}
+}
+
+func newTestService(repo *mockSMSRepo, outbox *mockOutboxRepo, publisher *mockEventPublisher, provider sms.SMSProvider) *smsService.Service {
+	return smsService.NewSMSService(repo, outbox, newMockInboxRepo(), publisher, provider, &fakeTransactor{}, logger.NewLogger("info"))
+}
@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sms/config"
+	"sms/internal/api/handlers/messaging"
+	"sms/internal/domain/sms"
+	"sms/pkg/logger"
+	"testing"
+)
+
+func TestSMSService_OutboxKeepsTraceID(t *testing.T) {
+	outbox := newMockOutboxRepo()
+	publisher := newMockEventPublisher()
+	service := newTestService(newMockSMSRepo(), outbox, publisher, newMockSMSProvider())
+
+	requestCtx := logger.ContextWithTraceID(context.Background(), "trace-request")
+	message := &sms.SMSMessage{ID: "sms-1", UserID: "user-1", Content: "hi", Receiver: "+989123456789", Status: sms.SMSStatusPending}
+	if err := service.CreateAndBillSMS(requestCtx, message); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if outbox.messages[0].TraceID != "trace-request" {
+		t.Fatalf("Expected the outbox event to keep the request trace, got %q", outbox.messages[0].TraceID)
+	}
+
+	// the relay runs under its own trace but publishes with the request's
+	relayCtx := logger.ContextWithTraceID(context.Background(), "trace-relay")
+	if _, err := service.RelayOutbox(relayCtx, 10); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(publisher.traceIDs) != 1 || publisher.traceIDs[0] != "trace-request" {
+		t.Errorf("Expected the event to be published with trace-request, got %v", publisher.traceIDs)
+	}
+}
+
+func TestConsumerHandler_FollowUpEventsKeepTraceID(t *testing.T) {
+	repo := newMockSMSRepo()
+	outbox := newMockOutboxRepo()
+	provider := newMockSMSProvider()
+	provider.sendError = &sms.ProviderError{Provider: "mock-provider", Code: sms.ProviderRejected, Permanent: true, Err: errors.New("bad receiver")}
+	service := newTestService(repo, outbox, newMockEventPublisher(), provider)
+	handler := messaging.NewSMSConsumer(*service, logger.NewLogger("info"), nil, config.Config{})
+	repo.messages["sms-1"] = &sms.SMSMessage{ID: "sms-1", Amount: 1, Status: sms.SMSStatusBillingRequested}
+
+	ctx := logger.ContextWithTraceID(context.Background(), "trace-message")
+	if err := handler.HandleDebitedSMS(ctx, []byte(`{"sms_id":"sms-1","transaction_id":"txn-1"}`)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(outbox.messages) != 1 || outbox.messages[0].EventType != sms.EventTypeBillingRefunded {
+		t.Fatalf("Expected a refund in the outbox, got %d events", len(outbox.messages))
+	}
+	if outbox.messages[0].TraceID != "trace-message" {
+		t.Errorf("Expected the refund to continue trace-message, got %q", outbox.messages[0].TraceID)
+	}
+}
@@ -0,0 +1,183 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	handlers "sms/internal/api/handlers/http"
+	"sms/internal/domain/sms"
+	"sms/internal/infra/external"
+	"sms/internal/infra/storage"
+	"sms/pkg/tracing"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// newSpanRecorder installs a tracer provider recording spans in memory for
+// the duration of the test.
+func newSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return recorder
+}
+
+func findSpan(t *testing.T, recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			return span
+		}
+	}
+	var names []string
+	for _, span := range recorder.Ended() {
+		names = append(names, span.Name())
+	}
+	t.Fatalf("Expected span %q, got %v", name, names)
+	return nil
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, attr := range span.Attributes() {
+		if attr.Key == key {
+			return attr.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracingMiddleware_ContinuesTraceparent(t *testing.T) {
+	recorder := newSpanRecorder(t)
+	repo := newMockSMSRepo()
+	repo.messages["sms-1"] = &sms.SMSMessage{ID: "sms-1", Status: sms.SMSStatusSent}
+	service := newTestService(repo, newMockOutboxRepo(), newMockEventPublisher(), newMockSMSProvider())
+
+	app := fiber.New()
+	app.Use(tracing.Middleware())
+	app.Get("/api/v1/sms/:id", handlers.NewSMSHandler(service).GetSMSByID)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/sms/sms-1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %v %v", resp, err)
+	}
+
+	span := findSpan(t, recorder, "GET /api/v1/sms/:id")
+	if span.SpanKind() != trace.SpanKindServer {
+		t.Errorf("Expected a server span, got %v", span.SpanKind())
+	}
+	if got := span.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected the caller's trace to continue, got %s", got)
+	}
+	if got := span.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("Expected the caller's span as parent, got %s", got)
+	}
+	if got := spanAttribute(span, "http.response.status_code").AsInt64(); got != http.StatusOK {
+		t.Errorf("Expected status code 200 on the span, got %d", got)
+	}
+}
+
+func TestInstrumentedProvider_RecordsFailure(t *testing.T) {
+	recorder := newSpanRecorder(t)
+	failing := newMockSMSProvider()
+	failing.sendError = errors.New("gateway down")
+	provider := external.NewInstrumentedProvider("gateway-a", failing)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	_, err := provider.SendSMS(ctx, &sms.SMSMessage{ID: "sms-1"})
+	parent.End()
+	if err == nil {
+		t.Fatal("Expected the provider error")
+	}
+
+	span := findSpan(t, recorder, "sms.send gateway-a")
+	if span.Status().Code != codes.Error {
+		t.Errorf("Expected an error status, got %v", span.Status())
+	}
+	if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("Expected the send span to be a child of the caller's span")
+	}
+	if got := spanAttribute(span, "sms.id").AsString(); got != "sms-1" {
+		t.Errorf("Expected sms.id attribute, got %q", got)
+	}
+}
+
+func TestGormPlugin_SMSRepositorySpans(t *testing.T) {
+	recorder := newSpanRecorder(t)
+	// DryRun builds the SQL and runs the callbacks without a database
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 port=1"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 gormlogger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	repo := storage.NewSMSRepository(db)
+	if err := repo.Create(ctx, &sms.SMSMessage{ID: "sms-1", Receiver: "+989123456789", Status: sms.SMSStatusPending}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	parent.End()
+
+	span := findSpan(t, recorder, "gorm.create")
+	if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("Expected the gorm span to be a child of the caller's span")
+	}
+	if table := spanAttribute(span, "db.sql.table").AsString(); table != "sms" {
+		t.Errorf("Expected table sms, got %q", table)
+	}
+	if statement := spanAttribute(span, "db.statement").AsString(); statement == "" {
+		t.Error("Expected the SQL statement on the span")
+	}
+}
+
+func TestSMSService_RelayContinuesRequestSpan(t *testing.T) {
+	newSpanRecorder(t)
+	outbox := newMockOutboxRepo()
+	publisher := newMockEventPublisher()
+	service := newTestService(newMockSMSRepo(), outbox, publisher, newMockSMSProvider())
+
+	ctx, request := otel.Tracer("test").Start(context.Background(), "POST /api/v1/sms")
+	message := &sms.SMSMessage{ID: "sms-1", UserID: "user-1", Content: "hi", Receiver: "+989123456789", Status: sms.SMSStatusPending}
+	if err := service.CreateAndBillSMS(ctx, message); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	request.End()
+
+	if _, err := service.RelayOutbox(context.Background(), 10); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(publisher.spanContexts) != 1 {
+		t.Fatalf("Expected 1 published event, got %d", len(publisher.spanContexts))
+	}
+	if got := publisher.spanContexts[0]; got.TraceID() != request.SpanContext().TraceID() || got.SpanID() != request.SpanContext().SpanID() {
+		t.Errorf("Expected the relay to publish under the request span, got %v", got)
+	}
+}
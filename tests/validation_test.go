@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sms/internal/api/dto"
+	handlers "sms/internal/api/handlers/http"
+	"sms/internal/domain/sms"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestNormalizeReceiver(t *testing.T) {
+	tests := []struct {
+		receiver string
+		expected string
+	}{
+		{"09123456789", "+989123456789"},
+		{"9123456789", "+989123456789"},
+		{"989123456789", "+989123456789"},
+		{"00989123456789", "+989123456789"},
+		{"+989123456789", "+989123456789"},
+		{" 0912-345 6789 ", "+989123456789"},
+		{"۰۹۱۲۳۴۵۶۷۸۹", "+989123456789"},
+		{"+1 (234) 567-890", "+1234567890"},
+		{"12345", "12345"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.receiver, func(t *testing.T) {
+			if got := sms.NormalizeReceiver(tt.receiver); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func postJSON(t *testing.T, app *fiber.App, path, body string) (*http.Response, dto.ErrorResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var errResp dto.ErrorResponse
+	if resp.StatusCode >= http.StatusBadRequest {
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+			t.Fatalf("Failed to decode error response: %v", err)
+		}
+	}
+	return resp, errResp
+}
+
+func TestSMSHandler_SendSMS_Validation(t *testing.T) {
+	repo := newMockSMSRepo()
+	service := newTestService(repo, newMockOutboxRepo(), newMockEventPublisher(), newMockSMSProvider())
+	handler := handlers.NewSMSHandler(service)
+	app := fiber.New()
+	app.Post("/api/v1/sms", handler.SendSMS)
+	app.Post("/api/v1/dlr/:provider", handler.ReceiveDeliveryReceipt)
+
+	resp, errResp := postJSON(t, app, "/api/v1/sms", `{"content":"","receiver":"12345","user_id":"not-a-uuid"}`)
+	if resp.StatusCode != http.StatusUnprocessableEntity || errResp.Error != "validation_failed" {
+		t.Fatalf("Expected 422 validation_failed, got %d %+v", resp.StatusCode, errResp)
+	}
+	rules := make(map[string]string)
+	for _, field := range errResp.Fields {
+		rules[field.Field] = field.Rule
+	}
+	expected := map[string]string{"content": "required", "receiver": "e164", "user_id": "uuid"}
+	for field, rule := range expected {
+		if rules[field] != rule {
+			t.Errorf("Expected %s to fail %s, got %v", field, rule, errResp.Fields)
+		}
+	}
+	if len(repo.messages) != 0 {
+		t.Errorf("Expected nothing stored for an invalid request, got %d messages", len(repo.messages))
+	}
+
+	// local Iranian numbers are stored in E.164
+	resp, _ = postJSON(t, app, "/api/v1/sms", `{"content":"hi","receiver":"0912 345 6789","user_id":"550e8400-e29b-41d4-a716-446655440000"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201 for a local number, got %d", resp.StatusCode)
+	}
+	for _, message := range repo.messages {
+		if message.Receiver != "+989123456789" {
+			t.Errorf("Expected receiver +989123456789, got %q", message.Receiver)
+		}
+	}
+
+	resp, errResp = postJSON(t, app, "/api/v1/dlr/http-gateway", `{"status":"delivered"}`)
+	if resp.StatusCode != http.StatusUnprocessableEntity || len(errResp.Fields) != 1 || errResp.Fields[0].Field != "message_id" {
+		t.Errorf("Expected 422 for a receipt without message_id, got %d %+v", resp.StatusCode, errResp)
+	}
+}